@@ -3,25 +3,25 @@ module github.com/bryan-buckman/infovore
 go 1.22
 
 require (
+	github.com/andybalholm/cascadia v1.3.1
 	github.com/go-chi/chi/v5 v5.2.0
+	github.com/lib/pq v1.10.9
 	github.com/mmcdole/gofeed v1.3.0
+	golang.org/x/net v0.4.0
 	modernc.org/sqlite v1.34.5
 )
 
 require (
 	github.com/PuerkitoBio/goquery v1.8.0 // indirect
-	github.com/andybalholm/cascadia v1.3.1 // indirect
 	github.com/dustin/go-humanize v1.0.1 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
-	github.com/lib/pq v1.10.9 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mmcdole/goxpp v1.1.1-0.20240225020742-a0c311522b23 // indirect
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/ncruces/go-strftime v0.1.9 // indirect
 	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
-	golang.org/x/net v0.4.0 // indirect
 	golang.org/x/sys v0.22.0 // indirect
 	golang.org/x/text v0.5.0 // indirect
 	modernc.org/libc v1.55.3 // indirect
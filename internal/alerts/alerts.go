@@ -0,0 +1,276 @@
+// Package alerts watches every incoming item for keyword queries, apart
+// from the feeds a reader subscribes to. Matching items are copied into a
+// virtual "Alerts" feed and can be posted to a webhook.
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+	"github.com/bryan-buckman/infovore/internal/textutil"
+)
+
+// FeedTitle is the title of the virtual feed matching items are copied to.
+const FeedTitle = "Alerts"
+
+// Alert is a named keyword query.
+type Alert struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+	// Webhook, if set, receives each matching item as JSON.
+	Webhook string `json:"webhook,omitempty"`
+
+	query *Query
+}
+
+// Query is a parsed alert query. Terms are words or quoted phrases; an item
+// matches if it contains every term and none of the terms prefixed with
+// "-". Matching ignores case and only counts whole words, so "go" does not
+// match "good".
+type Query struct {
+	Include [][]string // each term as its words
+	Exclude [][]string
+}
+
+// ParseQuery parses an alert query such as `"Jane Doe" infovore -hiring`.
+func ParseQuery(s string) (*Query, error) {
+	q := &Query{}
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		exclude := false
+		if s[0] == '-' {
+			exclude = true
+			s = s[1:]
+		}
+		var term string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				return nil, errors.New("unterminated quote")
+			}
+			term, s = s[1:end+1], s[end+2:]
+		} else {
+			end := strings.IndexFunc(s, unicode.IsSpace)
+			if end < 0 {
+				end = len(s)
+			}
+			term, s = s[:end], s[end:]
+		}
+		words := tokenize(term)
+		if len(words) == 0 {
+			continue
+		}
+		if exclude {
+			q.Exclude = append(q.Exclude, words)
+		} else {
+			q.Include = append(q.Include, words)
+		}
+	}
+	if len(q.Include) == 0 {
+		return nil, errors.New("query has no terms to look for")
+	}
+	return q, nil
+}
+
+// tokenize splits text into lowercase words of letters and digits.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Match reports whether the words of a text satisfy the query.
+func (q *Query) Match(words []string) bool {
+	for _, term := range q.Exclude {
+		if contains(words, term) {
+			return false
+		}
+	}
+	for _, term := range q.Include {
+		if !contains(words, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// contains reports whether words holds the phrase as consecutive words.
+func contains(words, phrase []string) bool {
+	for i := 0; i+len(phrase) <= len(words); i++ {
+		found := true
+		for j, w := range phrase {
+			if words[i+j] != w {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks and normalizes a list of alerts: every alert needs a
+// unique name and a valid query, and webhooks must be http(s) URLs.
+func Validate(list []Alert) ([]Alert, error) {
+	seen := make(map[string]bool)
+	out := make([]Alert, 0, len(list))
+	for _, a := range list {
+		a.Name = strings.TrimSpace(a.Name)
+		a.Query = strings.TrimSpace(a.Query)
+		a.Webhook = strings.TrimSpace(a.Webhook)
+		if a.Name == "" {
+			return nil, errors.New("every alert needs a name")
+		}
+		if seen[strings.ToLower(a.Name)] {
+			return nil, fmt.Errorf("alert %q is listed twice", a.Name)
+		}
+		seen[strings.ToLower(a.Name)] = true
+		if _, err := ParseQuery(a.Query); err != nil {
+			return nil, fmt.Errorf("alert %q: %w", a.Name, err)
+		}
+		if a.Webhook != "" {
+			u, err := url.Parse(a.Webhook)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("alert %q: webhook must be an http or https URL", a.Name)
+			}
+		}
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+// Load returns the alerts saved in the alerts setting, leaving out any
+// whose query doesn't parse.
+func Load(ctx context.Context, db database.Store) []Alert {
+	raw, err := db.GetSetting(ctx, model.SettingAlerts)
+	if err != nil || raw == "" {
+		return nil
+	}
+	var list []Alert
+	if err := json.Unmarshal([]byte(raw), &list); err != nil {
+		return nil
+	}
+	alerts := list[:0]
+	for _, a := range list {
+		q, err := ParseQuery(a.Query)
+		if err != nil {
+			continue
+		}
+		a.query = q
+		alerts = append(alerts, a)
+	}
+	return alerts
+}
+
+// Matching returns the alerts an item matches, looking at its title,
+// author and text.
+func Matching(alerts []Alert, item model.Item) []Alert {
+	words := tokenize(item.Title + " " + item.AuthorName + " " + textutil.PlainText(item.Content))
+	var matched []Alert
+	for _, a := range alerts {
+		q := a.query
+		if q == nil {
+			var err error
+			if q, err = ParseQuery(a.Query); err != nil {
+				continue
+			}
+		}
+		if q.Match(words) {
+			matched = append(matched, a)
+		}
+	}
+	return matched
+}
+
+// Deliver copies an item that matched alerts into the Alerts feed, once
+// however many alerts it matched, and posts it to their webhooks. The copy
+// names the alerts and the feed the item came from.
+func Deliver(ctx context.Context, db database.Store, feed model.Feed, item model.Item, matched []Alert) error {
+	if len(matched) == 0 {
+		return nil
+	}
+	feedID, _, err := db.GetOrCreateFeed(ctx, nil, FeedTitle, model.AlertsURLPrefix)
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(matched))
+	for i, a := range matched {
+		names[i] = html.EscapeString(a.Name)
+	}
+	header := fmt.Sprintf("<p><em>Alert %s · from %s</em></p>\n", strings.Join(names, ", "), html.EscapeString(feed.Title))
+	_, _, err = db.AddItem(ctx, &model.Item{
+		FeedID:       feedID,
+		GUID:         model.AlertsURLPrefix + strconv.FormatInt(item.ID, 10),
+		Title:        item.Title,
+		Content:      header + item.Content,
+		Link:         item.Link,
+		AuthorName:   item.AuthorName,
+		AuthorEmail:  item.AuthorEmail,
+		PublishedAt:  item.PublishedAt,
+		FetchedAt:    item.FetchedAt,
+		WordCount:    item.WordCount,
+		ReadingTime:  item.ReadingTime,
+		Snippet:      item.Snippet,
+		CommentsURL:  item.CommentsURL,
+		CommentsFeed: item.CommentsFeed,
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, a := range matched {
+		if a.Webhook == "" {
+			continue
+		}
+		if err := notify(ctx, a, feed, item); err != nil {
+			errs = append(errs, fmt.Errorf("alert %q: %w", a.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// notify posts a matching item to an alert's webhook.
+func notify(ctx context.Context, a Alert, feed model.Feed, item model.Item) error {
+	body, _ := json.Marshal(map[string]interface{}{
+		"alert":        a.Name,
+		"query":        a.Query,
+		"feed_id":      feed.ID,
+		"feed_title":   feed.Title,
+		"item_id":      item.ID,
+		"title":        item.Title,
+		"link":         item.Link,
+		"published_at": item.PublishedAt,
+	})
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.Webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	reqid.Set(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// Package classify assigns topic labels to items.
+package classify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/llm"
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// Backend names accepted by the classifier_backend setting.
+const (
+	BackendNone     = ""
+	BackendKeywords = "keywords"
+	BackendLLM      = "llm"
+)
+
+// Classifier returns topic labels for an item's title and plain text.
+type Classifier interface {
+	Classify(ctx context.Context, title, text string) ([]string, error)
+}
+
+// Rules maps a topic label to the keywords that select it.
+type Rules map[string][]string
+
+// KeywordClassifier labels items whose title or text contains any of a
+// topic's keywords (case-insensitive).
+type KeywordClassifier struct {
+	Rules Rules
+}
+
+// Classify implements Classifier.
+func (k *KeywordClassifier) Classify(_ context.Context, title, text string) ([]string, error) {
+	haystack := strings.ToLower(title + " " + text)
+	var labels []string
+	for topic, keywords := range k.Rules {
+		for _, kw := range keywords {
+			kw = strings.ToLower(strings.TrimSpace(kw))
+			if kw != "" && strings.Contains(haystack, kw) {
+				labels = append(labels, topic)
+				break
+			}
+		}
+	}
+	sort.Strings(labels)
+	return NormalizeLabels(labels), nil
+}
+
+// LLMClassifier asks a language model to pick labels from a fixed topic list.
+type LLMClassifier struct {
+	Client *llm.Client
+	Topics []string
+}
+
+// maxClassifyChars bounds the text sent to the model for classification.
+const maxClassifyChars = 4000
+
+// Classify implements Classifier.
+func (c *LLMClassifier) Classify(ctx context.Context, title, text string) ([]string, error) {
+	if len(c.Topics) == 0 {
+		return nil, nil
+	}
+	if len(text) > maxClassifyChars {
+		text = text[:maxClassifyChars]
+	}
+	reply, err := c.Client.Complete(ctx,
+		"You label articles with topics. Choose zero or more labels from this list: "+strings.Join(c.Topics, ", ")+
+			". Reply with the chosen labels separated by commas, or the word none.",
+		fmt.Sprintf("Title: %s\n\n%s", title, text))
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := make(map[string]bool, len(c.Topics))
+	for _, t := range NormalizeLabels(c.Topics) {
+		allowed[t] = true
+	}
+	var labels []string
+	for _, l := range NormalizeLabels(strings.Split(reply, ",")) {
+		if allowed[l] {
+			labels = append(labels, l)
+		}
+	}
+	return labels, nil
+}
+
+// NormalizeLabels lowercases and trims labels, dropping empty and duplicate ones.
+func NormalizeLabels(labels []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, l := range labels {
+		l = strings.ToLower(strings.TrimSpace(l))
+		if l == "" || l == "none" || seen[l] {
+			continue
+		}
+		seen[l] = true
+		out = append(out, l)
+	}
+	return out
+}
+
+// FromSettings builds the classifier selected by the classifier_backend
+// setting. Returns nil when classification is disabled or misconfigured.
+func FromSettings(ctx context.Context, db database.Store, client *llm.Client) Classifier {
+	backend, _ := db.GetSetting(ctx, model.SettingClassifierBackend)
+	switch backend {
+	case BackendKeywords:
+		raw, _ := db.GetSetting(ctx, model.SettingClassifierRules)
+		var rules Rules
+		if err := json.Unmarshal([]byte(raw), &rules); err != nil || len(rules) == 0 {
+			return nil
+		}
+		return &KeywordClassifier{Rules: rules}
+	case BackendLLM:
+		if client == nil {
+			return nil
+		}
+		raw, _ := db.GetSetting(ctx, model.SettingClassifierTopics)
+		var topics []string
+		if err := json.Unmarshal([]byte(raw), &topics); err != nil || len(topics) == 0 {
+			return nil
+		}
+		return &LLMClassifier{Client: client, Topics: topics}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+// Package cluster lets several instances share one database: only the
+// instance holding the leader lock runs the background jobs, and cache
+// invalidations are broadcast to every instance.
+package cluster
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+)
+
+const (
+	// LeaderLock names the lock held by the web instance running the
+	// background jobs.
+	LeaderLock = "infovore-leader"
+	// FetcherLock names the lock held by the fetch-only daemon running the
+	// poller.
+	FetcherLock = "infovore-fetcher"
+	// InvalidateChannel carries cache invalidation events.
+	InvalidateChannel = "infovore_invalidate"
+	// ElectionInterval is how often instances try to take the leader lock
+	// and the leader checks that it still holds it.
+	ElectionInterval = 10 * time.Second
+)
+
+// Cache invalidation events.
+const (
+	EventSettings = "settings" // settings the fetcher caches changed
+	EventItems    = "items"    // items were added by a refresh
+	EventAll      = ""         // anything may have changed
+)
+
+// Elector runs background jobs on exactly one instance. With a store that
+// serves a single instance the jobs always run.
+type Elector struct {
+	cluster  database.Cluster // nil for single-instance stores
+	lock     string
+	leading  atomic.Bool
+	start    func()
+	stop     func()
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewElector creates an elector competing for the lock called lock that
+// calls start when this instance becomes the leader and stop when it stops
+// being the leader.
+func NewElector(db database.Store, lock string, start, stop func()) *Elector {
+	c, _ := db.(database.Cluster)
+	return &Elector{
+		cluster:  c,
+		lock:     lock,
+		start:    start,
+		stop:     stop,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins competing for leadership.
+func (e *Elector) Start() {
+	if e.cluster == nil {
+		e.leading.Store(true)
+		e.start()
+		return
+	}
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		var lock database.Lock
+		for {
+			lock = e.elect(lock)
+
+			select {
+			case <-e.stopChan:
+				if lock != nil {
+					e.leading.Store(false)
+					e.stop()
+					lock.Release()
+				}
+				return
+			case <-time.After(ElectionInterval):
+			}
+		}
+	}()
+}
+
+// elect checks the held lock, or tries to take it if lock is nil, starting
+// or stopping the jobs as leadership changes. Returns the lock now held.
+func (e *Elector) elect(lock database.Lock) database.Lock {
+	ctx, cancel := context.WithTimeout(context.Background(), ElectionInterval)
+	defer cancel()
+	if lock != nil {
+		err := lock.Check(ctx)
+		if err == nil {
+			return lock
+		}
+		log.Printf("Cluster: lost leadership: %v", err)
+		e.leading.Store(false)
+		e.stop()
+		lock.Release()
+		return nil
+	}
+
+	lock, err := e.cluster.TryLock(ctx, e.lock)
+	if err != nil {
+		log.Printf("Cluster: leader election error: %v", err)
+		return nil
+	}
+	if lock == nil {
+		return nil // another instance leads
+	}
+	log.Printf("Cluster: this instance now holds %s", e.lock)
+	e.leading.Store(true)
+	e.start()
+	return lock
+}
+
+// Leading reports whether this instance currently runs the jobs.
+func (e *Elector) Leading() bool {
+	return e.leading.Load()
+}
+
+// Stop stops the jobs if this instance leads and gives up leadership.
+func (e *Elector) Stop() {
+	if e.cluster == nil {
+		e.leading.Store(false)
+		e.stop()
+		return
+	}
+	close(e.stopChan)
+	e.wg.Wait()
+}
+
+// Invalidator broadcasts cache invalidation events to every instance. With
+// a store that serves a single instance events are handled locally.
+type Invalidator struct {
+	cluster database.Cluster // nil for single-instance stores
+	handle  func(event string)
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewInvalidator creates an invalidator that calls handle for each event
+// published by any instance.
+func NewInvalidator(db database.Store, handle func(event string)) *Invalidator {
+	c, _ := db.(database.Cluster)
+	return &Invalidator{cluster: c, handle: handle}
+}
+
+// Start begins listening for events from other instances.
+func (i *Invalidator) Start() {
+	if i.cluster == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	i.cancel = cancel
+	i.wg.Add(1)
+	go func() {
+		defer i.wg.Done()
+		if err := i.cluster.Listen(ctx, InvalidateChannel, i.handle); err != nil {
+			log.Printf("Cluster: cache invalidation disabled: %v", err)
+		}
+	}()
+}
+
+// Publish tells every instance, including this one, about event.
+func (i *Invalidator) Publish(event string) {
+	if i.cluster == nil {
+		i.handle(event)
+		return
+	}
+	if err := i.cluster.Notify(InvalidateChannel, event); err != nil {
+		log.Printf("Cluster: failed to publish %q: %v", event, err)
+		i.handle(event)
+	}
+}
+
+// Stop stops listening.
+func (i *Invalidator) Stop() {
+	if i.cancel != nil {
+		i.cancel()
+	}
+	i.wg.Wait()
+}
@@ -0,0 +1,108 @@
+// Package daemon runs the feed poller and scheduled maintenance without the
+// web UI, so fetching can run in its own process next to UI instances
+// sharing the same PostgreSQL database.
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/cluster"
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/maintenance"
+	"github.com/bryan-buckman/infovore/internal/rss"
+)
+
+// Daemon polls feeds and maintains the database. Among several daemons
+// sharing a database only one runs the jobs at a time.
+type Daemon struct {
+	db         database.Store
+	poller     *rss.Poller
+	maintain   *maintenance.Job
+	elector    *cluster.Elector
+	caches     *cluster.Invalidator
+	httpServer *http.Server
+	startedAt  time.Time
+	stopChan   chan struct{}
+}
+
+// New creates a daemon.
+func New(db database.Store) *Daemon {
+	d := &Daemon{
+		db:       db,
+		poller:   rss.NewPoller(db, rss.NewFetcher(db)),
+		maintain: maintenance.NewJob(db),
+		stopChan: make(chan struct{}),
+	}
+	d.elector = cluster.NewElector(db, cluster.FetcherLock, d.startJobs, d.stopJobs)
+	// The daemon caches nothing itself; it only tells UI instances about
+	// new items.
+	d.caches = cluster.NewInvalidator(db, func(string) {})
+	d.poller.AfterPoll = func(st rss.PollStatus) {
+		if st.NewItems > 0 {
+			d.caches.Publish(cluster.EventItems)
+		}
+	}
+	return d
+}
+
+func (d *Daemon) startJobs() {
+	d.poller.Start()
+	d.maintain.Start()
+}
+
+func (d *Daemon) stopJobs() {
+	d.poller.Stop()
+	d.maintain.Stop()
+}
+
+// Start runs the daemon, serving a status endpoint on addr unless it is
+// empty. It blocks until Stop is called.
+func (d *Daemon) Start(addr string) error {
+	d.startedAt = time.Now()
+	d.elector.Start()
+	if addr == "" {
+		log.Println("Fetch-only daemon started")
+		<-d.stopChan
+		return http.ErrServerClosed
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", d.handleStatus)
+	d.httpServer = &http.Server{Addr: addr, Handler: mux}
+	log.Printf("Fetch-only daemon started, status on %s/status", addr)
+	return d.httpServer.ListenAndServe()
+}
+
+// Stop stops the jobs and the status endpoint.
+func (d *Daemon) Stop() {
+	log.Println("Stopping poller...")
+	d.elector.Stop()
+	close(d.stopChan)
+	if d.httpServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := d.httpServer.Shutdown(ctx); err != nil {
+			log.Printf("HTTP server shutdown error: %v", err)
+		}
+	}
+	log.Println("Shutdown complete")
+}
+
+// handleStatus reports whether this daemon runs the jobs and how the last
+// poll went.
+func (d *Daemon) handleStatus(w http.ResponseWriter, r *http.Request) {
+	interval, _ := d.db.GetPollingInterval(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mode":             "fetch-only",
+		"database_type":    d.db.DatabaseType(),
+		"leader":           d.elector.Leading(),
+		"started_at":       d.startedAt,
+		"polling_interval": interval,
+		"last_poll":        d.poller.Status(),
+	})
+}
@@ -0,0 +1,2036 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// MemoryStore keeps everything in memory and loses it on exit. It serves
+// tests and the zero-setup demo mode.
+type MemoryStore struct {
+	mu       sync.Mutex
+	lastID   int64 // IDs are shared by all tables, which is harmless
+	folders  map[int64]*memFolder
+	feeds    map[int64]*memFeed
+	items    map[int64]*memItem
+	tags     map[string]int64         // tag name -> ID
+	itemTags map[int64]map[int64]bool // item ID -> tag IDs
+	archives map[int64]model.ItemArchive
+	media    map[int64]model.ItemMedia
+	links    map[int64]model.LinkCheck
+	encs     map[int64][]model.Enclosure
+	events   []model.InterestEvent // oldest first
+	fetches  []model.FetchLogEntry // oldest first
+	audit    []model.AuditEntry    // oldest first
+	jobs     map[int64]model.Job
+	settings map[string]string
+}
+
+type memFolder struct {
+	model.Folder
+	sortOrder int
+}
+
+type memFeed struct {
+	model.Feed
+	deletedAt time.Time // zero unless trashed
+	sortOrder int
+	icon      *model.FeedIcon // nil unless chosen
+	labels    []string        // sorted
+}
+
+type memItem struct {
+	model.Item
+	opened    bool
+	readAt    time.Time // zero unless read since read times were tracked
+	deletedAt time.Time // zero unless trashed
+}
+
+// markRead marks the item read at t, reporting whether it was unread.
+func (it *memItem) markRead(t time.Time) bool {
+	if it.IsRead {
+		return false
+	}
+	it.IsRead, it.readAt = true, t
+	return true
+}
+
+// Ensure MemoryStore implements Store interface.
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemory creates an empty in-memory store.
+func NewMemory() *MemoryStore {
+	return &MemoryStore{
+		folders:  make(map[int64]*memFolder),
+		feeds:    make(map[int64]*memFeed),
+		items:    make(map[int64]*memItem),
+		tags:     make(map[string]int64),
+		itemTags: make(map[int64]map[int64]bool),
+		archives: make(map[int64]model.ItemArchive),
+		media:    make(map[int64]model.ItemMedia),
+		links:    make(map[int64]model.LinkCheck),
+		encs:     make(map[int64][]model.Enclosure),
+		jobs:     make(map[int64]model.Job),
+		settings: map[string]string{model.SettingPollingInterval: "15"},
+	}
+}
+
+// sampleFeeds are subscribed to by SeedSampleFeeds, by folder.
+var sampleFeeds = []struct {
+	folder string
+	feeds  [][2]string // title, URL
+}{
+	{"Tech", [][2]string{
+		{"Hacker News", "https://news.ycombinator.com/rss"},
+		{"The Go Blog", "https://go.dev/blog/feed.atom"},
+	}},
+	{"Science", [][2]string{
+		{"NASA Breaking News", "https://www.nasa.gov/news-release/feed/"},
+	}},
+	{"", [][2]string{
+		{"xkcd", "https://xkcd.com/atom.xml"},
+	}},
+}
+
+// SeedSampleFeeds subscribes db to a few well-known feeds so a demo has
+// something to show after the first refresh.
+func SeedSampleFeeds(ctx context.Context, db Store) error {
+	for _, group := range sampleFeeds {
+		var folderID *int64
+		if group.folder != "" {
+			id, err := db.GetOrCreateFolder(ctx, group.folder, nil)
+			if err != nil {
+				return err
+			}
+			folderID = &id
+		}
+		for _, f := range group.feeds {
+			if _, _, err := db.GetOrCreateFeed(ctx, folderID, f[0], f[1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close does nothing; the data is discarded with the store.
+func (db *MemoryStore) Close() error {
+	return nil
+}
+
+// DatabaseType returns the database backend name.
+func (db *MemoryStore) DatabaseType() string {
+	return "Memory"
+}
+
+// SupportsHighConcurrency returns true; writes only take a mutex briefly.
+func (db *MemoryStore) SupportsHighConcurrency() bool {
+	return true
+}
+
+func (db *MemoryStore) nextID() int64 {
+	db.lastID++
+	return db.lastID
+}
+
+// copyID returns a copy of an optional ID so callers can't alias the store.
+func copyID(id *int64) *int64 {
+	if id == nil {
+		return nil
+	}
+	v := *id
+	return &v
+}
+
+func sameID(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// limitLen returns the number of results to keep of n under an SQL-style
+// LIMIT, where a negative limit means no limit.
+func limitLen(n, limit int) int {
+	if limit >= 0 && n > limit {
+		return limit
+	}
+	return n
+}
+
+// --- Folder Methods ---
+
+// GetFolders returns all folders in the sidebar order.
+func (db *MemoryStore) GetFolders(ctx context.Context) ([]model.Folder, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	folders := make([]*memFolder, 0, len(db.folders))
+	for _, f := range db.folders {
+		folders = append(folders, f)
+	}
+	db.sortFolders(folders)
+	var result []model.Folder
+	for _, f := range folders {
+		folder := f.Folder
+		folder.ParentID = copyID(f.ParentID)
+		result = append(result, folder)
+	}
+	return result, nil
+}
+
+// CreateFolder creates a new folder. Returns the ID.
+func (db *MemoryStore) CreateFolder(ctx context.Context, name string, parentID *int64) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if parentID != nil && db.folders[*parentID] == nil {
+		return 0, fmt.Errorf("parent folder %d does not exist", *parentID)
+	}
+	id := db.nextID()
+	db.folders[id] = &memFolder{Folder: model.Folder{ID: id, Name: name, ParentID: copyID(parentID)}}
+	return id, nil
+}
+
+// GetOrCreateFolder finds a folder by name and parent, or creates it.
+func (db *MemoryStore) GetOrCreateFolder(ctx context.Context, name string, parentID *int64) (int64, error) {
+	db.mu.Lock()
+	var found int64
+	for id, f := range db.folders {
+		if f.Name == name && sameID(f.ParentID, parentID) && (found == 0 || id < found) {
+			found = id
+		}
+	}
+	db.mu.Unlock()
+	if found != 0 {
+		return found, nil
+	}
+	return db.CreateFolder(ctx, name, parentID)
+}
+
+// GetFolderByID returns a single folder by its ID.
+func (db *MemoryStore) GetFolderByID(ctx context.Context, folderID int64) (*model.Folder, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	f, ok := db.folders[folderID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	folder := f.Folder
+	folder.ParentID = copyID(f.ParentID)
+	return &folder, nil
+}
+
+// DeleteFolder removes a folder and moves all its feeds (and their items) to
+// the trash. Feeds restored later come back unfiled.
+func (db *MemoryStore) DeleteFolder(ctx context.Context, folderID int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, f := range db.folders {
+		if f.ParentID != nil && *f.ParentID == folderID {
+			return fmt.Errorf("folder %d has subfolders", folderID)
+		}
+	}
+	now := time.Now().UTC()
+	for _, f := range db.feeds {
+		if f.FolderID == nil || *f.FolderID != folderID {
+			continue
+		}
+		if f.deletedAt.IsZero() {
+			db.trashFeed(f, now)
+		}
+		f.FolderID = nil
+	}
+	delete(db.folders, folderID)
+	return nil
+}
+
+// --- Feed Methods ---
+
+// GetFeeds returns all feeds with their item counts, optionally filtered by
+// folder.
+func (db *MemoryStore) GetFeeds(ctx context.Context, folderID *int64) ([]model.Feed, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	feeds := db.liveFeeds(func(f *memFeed) bool { return folderID == nil || sameID(f.FolderID, folderID) })
+	for i := range feeds {
+		for _, it := range db.items {
+			if it.FeedID == feeds[i].ID && it.deletedAt.IsZero() {
+				feeds[i].ItemCount++
+			}
+		}
+	}
+	return feeds, nil
+}
+
+// GetAllFeeds returns all feeds regardless of folder.
+func (db *MemoryStore) GetAllFeeds(ctx context.Context) ([]model.Feed, error) {
+	return db.GetFeeds(ctx, nil)
+}
+
+// GetFeedsByFolderID returns feeds belonging to a specific folder.
+func (db *MemoryStore) GetFeedsByFolderID(ctx context.Context, folderID int64) ([]model.Feed, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.liveFeeds(func(f *memFeed) bool { return sameID(f.FolderID, &folderID) }), nil
+}
+
+// GetUnfiledFeeds returns feeds that don't belong to any folder.
+func (db *MemoryStore) GetUnfiledFeeds(ctx context.Context) ([]model.Feed, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.liveFeeds(func(f *memFeed) bool { return f.FolderID == nil }), nil
+}
+
+// GetFoldersWithFeeds returns all folders with their feeds populated.
+func (db *MemoryStore) GetFoldersWithFeeds(ctx context.Context) ([]model.FolderWithFeeds, error) {
+	folders, err := db.GetFolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []model.FolderWithFeeds
+	for _, folder := range folders {
+		feeds, err := db.GetFeedsByFolderID(ctx, folder.ID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, model.FolderWithFeeds{
+			Folder: folder,
+			Feeds:  feeds,
+		})
+	}
+	return result, nil
+}
+
+// CreateFeed adds a new feed. Returns the ID.
+func (db *MemoryStore) CreateFeed(ctx context.Context, folderID *int64, title, url string) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.createFeed(model.Feed{FolderID: copyID(folderID), Title: title, URL: url})
+}
+
+// CreateInboxFeed creates a virtual feed that receives items pushed with token.
+func (db *MemoryStore) CreateInboxFeed(ctx context.Context, folderID *int64, title, token string) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.createFeed(model.Feed{FolderID: copyID(folderID), Title: title, URL: model.InboxURLPrefix + token, InboxToken: token})
+}
+
+func (db *MemoryStore) createFeed(f model.Feed) (int64, error) {
+	if db.feedByURL(f.URL) != nil {
+		return 0, fmt.Errorf("feed %s already exists", f.URL)
+	}
+	if f.FolderID != nil && db.folders[*f.FolderID] == nil {
+		return 0, fmt.Errorf("folder %d does not exist", *f.FolderID)
+	}
+	f.ID = db.nextID()
+	db.feeds[f.ID] = &memFeed{Feed: f}
+	return f.ID, nil
+}
+
+// GetFeedByInboxToken returns the virtual feed owning token.
+func (db *MemoryStore) GetFeedByInboxToken(ctx context.Context, token string) (*model.Feed, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, f := range db.feeds {
+		if token != "" && f.InboxToken == token && f.deletedAt.IsZero() {
+			return db.copyFeed(f), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// GetOrCreateFeed finds a feed by URL, or creates it. A trashed feed with
+// the same URL is restored into folderID and reported as new.
+func (db *MemoryStore) GetOrCreateFeed(ctx context.Context, folderID *int64, title, url string) (int64, bool, error) {
+	db.mu.Lock()
+	f := db.feedByURL(url)
+	db.mu.Unlock()
+	if f == nil {
+		id, err := db.CreateFeed(ctx, folderID, title, url)
+		return id, true, err
+	}
+	if f.deletedAt.IsZero() {
+		return f.ID, false, nil
+	}
+	if err := db.RestoreFeed(ctx, f.ID); err != nil {
+		return 0, false, err
+	}
+	return f.ID, true, db.MoveFeedToFolder(ctx, f.ID, folderID)
+}
+
+// UpdateFeedLastFetched records a successful fetch of a feed at t and
+// clears its error.
+func (db *MemoryStore) UpdateFeedLastFetched(ctx context.Context, feedID int64, t time.Time) error {
+	return db.updateFeed(feedID, func(f *memFeed) {
+		f.LastAttempt = t
+		f.LastSuccess = t
+		f.LastError = ""
+		f.LastErrorStatus = 0
+		f.LastErrorClass = ""
+		f.ErrorStreak = 0
+	})
+}
+
+// UpdateFeedNextFetch sets the earliest time a feed should be polled again.
+// A zero time clears it.
+func (db *MemoryStore) UpdateFeedNextFetch(ctx context.Context, feedID int64, t time.Time) error {
+	return db.updateFeed(feedID, func(f *memFeed) { f.NextFetch = t })
+}
+
+// UpdateFeedTitle updates the title for a feed.
+func (db *MemoryStore) UpdateFeedTitle(ctx context.Context, feedID int64, title string) error {
+	return db.updateFeed(feedID, func(f *memFeed) { f.Title = title })
+}
+
+// UpdateFeedMetadata updates the descriptive fields of a feed.
+func (db *MemoryStore) UpdateFeedMetadata(ctx context.Context, feedID int64, title, siteURL, description, iconURL string) error {
+	return db.updateFeed(feedID, func(f *memFeed) {
+		f.Title = title
+		f.SiteURL = siteURL
+		f.Description = description
+		f.IconURL = iconURL
+	})
+}
+
+// UpdateFeedOptions saves the per-feed behaviour toggles.
+func (db *MemoryStore) UpdateFeedOptions(ctx context.Context, feedID int64, opts model.FeedOptions) error {
+	return db.updateFeed(feedID, func(f *memFeed) { f.FeedOptions = opts })
+}
+
+// UpdateFeedError records a failed fetch of a feed at t and counts it
+// towards the feed's error streak.
+func (db *MemoryStore) UpdateFeedError(ctx context.Context, feedID int64, fe model.FetchError, t time.Time) error {
+	return db.updateFeed(feedID, func(f *memFeed) {
+		f.LastError = fe.Message
+		f.LastErrorStatus = fe.StatusCode
+		f.LastErrorClass = fe.Class
+		f.ErrorStreak++
+		f.LastAttempt = t
+	})
+}
+
+// SetFeedSuggestedURL records the feed URL rediscovery found for a feed, or
+// clears it if url is empty.
+func (db *MemoryStore) SetFeedSuggestedURL(ctx context.Context, feedID int64, url string) error {
+	return db.updateFeed(feedID, func(f *memFeed) { f.SuggestedURL = url })
+}
+
+// UpdateFeedURL points a feed at a new URL, clearing its suggested URL and
+// next fetch time so that the new URL is fetched on the next run.
+func (db *MemoryStore) UpdateFeedURL(ctx context.Context, feedID int64, url string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if other := db.feedByURL(url); other != nil && other.ID != feedID {
+		return fmt.Errorf("feed URL %s is already in use", url)
+	}
+	if f, ok := db.feeds[feedID]; ok {
+		f.URL = url
+		f.SuggestedURL = ""
+		f.NextFetch = time.Time{}
+	}
+	return nil
+}
+
+// SetFeedIcon replaces the icon chosen for a feed.
+func (db *MemoryStore) SetFeedIcon(ctx context.Context, icon model.FeedIcon) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	f, ok := db.feeds[icon.FeedID]
+	if !ok {
+		return fmt.Errorf("feed %d does not exist", icon.FeedID)
+	}
+	icon.Data = append([]byte(nil), icon.Data...)
+	f.icon = &icon
+	return nil
+}
+
+// GetFeedIcon returns the icon chosen for a feed, or sql.ErrNoRows if the
+// feed uses its detected icon.
+func (db *MemoryStore) GetFeedIcon(ctx context.Context, feedID int64) (*model.FeedIcon, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	f, ok := db.feeds[feedID]
+	if !ok || f.icon == nil {
+		return nil, sql.ErrNoRows
+	}
+	icon := *f.icon
+	return &icon, nil
+}
+
+// DeleteFeedIcon reverts a feed to its detected icon.
+func (db *MemoryStore) DeleteFeedIcon(ctx context.Context, feedID int64) error {
+	return db.updateFeed(feedID, func(f *memFeed) { f.icon = nil })
+}
+
+// AddFetchLog records a fetch of a feed.
+func (db *MemoryStore) AddFetchLog(ctx context.Context, e model.FetchLogEntry) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.fetches = append(db.fetches, e)
+	return nil
+}
+
+// GetFetchStats summarizes the logged fetches of every feed.
+func (db *MemoryStore) GetFetchStats(ctx context.Context) ([]model.FetchStats, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	byFeed := make(map[int64]*model.FetchStats)
+	for id, f := range db.feeds {
+		if f.deletedAt.IsZero() {
+			byFeed[id] = &model.FetchStats{FeedID: id}
+		}
+	}
+	for _, e := range db.fetches {
+		s, ok := byFeed[e.FeedID]
+		if !ok {
+			continue
+		}
+		s.Attempts++
+		if e.OK {
+			s.Successes++
+			s.AvgDuration += e.Duration // summed until divided below
+		}
+	}
+	stats := make([]model.FetchStats, 0, len(byFeed))
+	for id, s := range byFeed {
+		if s.Successes > 0 {
+			s.AvgDuration /= time.Duration(s.Successes)
+		}
+		_, s.LastPublished = db.feedStats(func(it *memItem) bool { return it.FeedID == id })
+		stats = append(stats, *s)
+	}
+	return stats, nil
+}
+
+// PruneFetchLog deletes the fetches logged before a time.
+func (db *MemoryStore) PruneFetchLog(ctx context.Context, before time.Time) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	kept := db.fetches[:0]
+	for _, e := range db.fetches {
+		if !e.FetchedAt.Before(before) {
+			kept = append(kept, e)
+		}
+	}
+	pruned := int64(len(db.fetches) - len(kept))
+	db.fetches = kept
+	return pruned, nil
+}
+
+// SetFeedHealth stores health scores by feed ID. Feeds missing from scores
+// become ungraded.
+func (db *MemoryStore) SetFeedHealth(ctx context.Context, scores map[int64]int) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for id, f := range db.feeds {
+		score, ok := scores[id]
+		f.HealthScore, f.HealthGrade = 0, ""
+		if ok {
+			f.HealthScore, f.HealthGrade = score, model.HealthGrade(score)
+		}
+	}
+	return nil
+}
+
+// GetFeedByID returns a single feed by its ID.
+func (db *MemoryStore) GetFeedByID(ctx context.Context, feedID int64) (*model.Feed, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	f, ok := db.feeds[feedID]
+	if !ok || !f.deletedAt.IsZero() {
+		return nil, sql.ErrNoRows
+	}
+	return db.copyFeed(f), nil
+}
+
+// SearchFeeds returns the feeds whose title, URL, description or notes
+// contain query, ignoring case, in sidebar order.
+func (db *MemoryStore) SearchFeeds(ctx context.Context, query string) ([]model.Feed, error) {
+	query = strings.ToLower(query)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.liveFeeds(func(f *memFeed) bool {
+		for _, s := range []string{f.Title, f.URL, f.Description, f.Notes} {
+			if strings.Contains(strings.ToLower(s), query) {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+// DeleteFeed moves a feed and all its items to the trash.
+func (db *MemoryStore) DeleteFeed(ctx context.Context, feedID int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if f, ok := db.feeds[feedID]; ok && f.deletedAt.IsZero() {
+		db.trashFeed(f, time.Now().UTC())
+	}
+	return nil
+}
+
+// MoveFeedToFolder updates a feed's folder assignment.
+func (db *MemoryStore) MoveFeedToFolder(ctx context.Context, feedID int64, folderID *int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if folderID != nil && db.folders[*folderID] == nil {
+		return fmt.Errorf("folder %d does not exist", *folderID)
+	}
+	if f, ok := db.feeds[feedID]; ok {
+		f.FolderID = copyID(folderID)
+	}
+	return nil
+}
+
+// SetSidebarOrder saves the manual sidebar order: each folder and feed gets
+// its position in the given lists.
+func (db *MemoryStore) SetSidebarOrder(ctx context.Context, folderIDs, feedIDs []int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for pos, id := range folderIDs {
+		if f, ok := db.folders[id]; ok {
+			f.sortOrder = pos
+		}
+	}
+	for pos, id := range feedIDs {
+		if f, ok := db.feeds[id]; ok {
+			f.sortOrder = pos
+		}
+	}
+	return nil
+}
+
+// ImportFeeds subscribes to feeds, creating their folders as needed. The
+// whole import happens under the lock, so other callers never see part of
+// it.
+func (db *MemoryStore) ImportFeeds(ctx context.Context, feeds []model.ImportFeed, progress func(done int)) ([]model.ImportResult, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	results := make([]model.ImportResult, len(feeds))
+	for i, f := range feeds {
+		folderID := db.importFolders(f.FolderPath)
+		res := model.ImportResult{URL: f.URL, Title: f.Title, Status: model.ImportExists}
+		switch existing := db.feedByURL(f.URL); {
+		case existing == nil:
+			res.FeedID, _ = db.createFeed(model.Feed{FolderID: folderID, Title: f.Title, URL: f.URL})
+			res.Status = model.ImportAdded
+		case !existing.deletedAt.IsZero():
+			db.restoreFeed(existing)
+			existing.FolderID = folderID
+			res.FeedID, res.Status = existing.ID, model.ImportAdded
+		default:
+			res.FeedID = existing.ID
+		}
+		results[i] = res
+		if progress != nil {
+			progress(i + 1)
+		}
+	}
+	return results, nil
+}
+
+// importFolders finds or creates the folders along path and returns the
+// innermost one, or nil for an empty path. The caller holds the lock.
+func (db *MemoryStore) importFolders(path []string) *int64 {
+	var parentID *int64
+	for _, name := range path {
+		var found int64
+		for id, f := range db.folders {
+			if f.Name == name && sameID(f.ParentID, parentID) && (found == 0 || id < found) {
+				found = id
+			}
+		}
+		if found == 0 {
+			found = db.nextID()
+			db.folders[found] = &memFolder{Folder: model.Folder{ID: found, Name: name, ParentID: copyID(parentID)}}
+		}
+		parentID = &found
+	}
+	return parentID
+}
+
+// updateFeed applies change to a feed. Missing feeds are ignored, like an
+// UPDATE matching no rows.
+func (db *MemoryStore) updateFeed(feedID int64, change func(f *memFeed)) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if f, ok := db.feeds[feedID]; ok {
+		change(f)
+	}
+	return nil
+}
+
+// trashFeed moves a feed and its items to the trash at now.
+func (db *MemoryStore) trashFeed(f *memFeed, now time.Time) {
+	for _, it := range db.items {
+		if it.FeedID == f.ID && it.deletedAt.IsZero() {
+			it.deletedAt = now
+		}
+	}
+	f.deletedAt = now
+}
+
+// feedByURL returns the feed with url, trashed or not.
+func (db *MemoryStore) feedByURL(url string) *memFeed {
+	for _, f := range db.feeds {
+		if f.URL == url {
+			return f
+		}
+	}
+	return nil
+}
+
+// liveFeeds returns copies of the feeds outside the trash accepted by keep,
+// in the sidebar order.
+func (db *MemoryStore) liveFeeds(keep func(f *memFeed) bool) []model.Feed {
+	var feeds []*memFeed
+	for _, f := range db.feeds {
+		if f.deletedAt.IsZero() && keep(f) {
+			feeds = append(feeds, f)
+		}
+	}
+	db.sortFeeds(feeds)
+	var result []model.Feed
+	for _, f := range feeds {
+		result = append(result, *db.copyFeed(f))
+	}
+	return result
+}
+
+func (f *memFeed) copy() *model.Feed {
+	feed := f.Feed
+	feed.FolderID = copyID(f.FolderID)
+	if f.icon != nil {
+		feed.IconEmoji = f.icon.Emoji
+		feed.CustomIcon = f.icon.ContentType != ""
+	}
+	return &feed
+}
+
+// copyFeed copies a feed with its unread count filled in.
+func (db *MemoryStore) copyFeed(f *memFeed) *model.Feed {
+	feed := f.copy()
+	feed.UnreadCount, _ = db.feedStats(func(it *memItem) bool { return it.FeedID == f.ID })
+	return feed
+}
+
+// feedStats returns the number of unread items and the latest publication
+// time of the items outside the trash accepted by keep.
+func (db *MemoryStore) feedStats(keep func(it *memItem) bool) (unread int, latest time.Time) {
+	for _, it := range db.items {
+		if !it.deletedAt.IsZero() || !keep(it) {
+			continue
+		}
+		if !it.IsRead {
+			unread++
+		}
+		if it.PublishedAt.After(latest) {
+			latest = it.PublishedAt
+		}
+	}
+	return unread, latest
+}
+
+// sortFeeds orders feeds like feedOrder.
+func (db *MemoryStore) sortFeeds(feeds []*memFeed) {
+	mode := db.settings[model.SettingSidebarSort]
+	unread := make(map[int64]int)
+	latest := make(map[int64]time.Time)
+	if mode == model.SidebarSortUnread || mode == model.SidebarSortUpdated {
+		for _, f := range feeds {
+			id := f.ID
+			unread[id], latest[id] = db.feedStats(func(it *memItem) bool { return it.FeedID == id })
+		}
+	}
+	sort.SliceStable(feeds, func(i, j int) bool {
+		a, b := feeds[i], feeds[j]
+		switch mode {
+		case model.SidebarSortManual:
+			if a.sortOrder != b.sortOrder {
+				return a.sortOrder < b.sortOrder
+			}
+		case model.SidebarSortUnread:
+			if unread[a.ID] != unread[b.ID] {
+				return unread[a.ID] > unread[b.ID]
+			}
+		case model.SidebarSortUpdated:
+			if !latest[a.ID].Equal(latest[b.ID]) {
+				return latest[a.ID].After(latest[b.ID])
+			}
+		}
+		if a.Title != b.Title {
+			return a.Title < b.Title
+		}
+		return a.ID < b.ID
+	})
+}
+
+// sortFolders orders folders like folderOrder.
+func (db *MemoryStore) sortFolders(folders []*memFolder) {
+	mode := db.settings[model.SettingSidebarFolderSort]
+	if mode == "" {
+		mode = db.settings[model.SettingSidebarSort]
+	}
+	unread := make(map[int64]int)
+	latest := make(map[int64]time.Time)
+	if mode == model.SidebarSortUnread || mode == model.SidebarSortUpdated {
+		for _, fo := range folders {
+			id := fo.ID
+			unread[id], latest[id] = db.feedStats(func(it *memItem) bool {
+				f := db.feeds[it.FeedID]
+				return f != nil && f.FolderID != nil && *f.FolderID == id
+			})
+		}
+	}
+	sort.SliceStable(folders, func(i, j int) bool {
+		a, b := folders[i], folders[j]
+		switch mode {
+		case model.SidebarSortManual:
+			if a.sortOrder != b.sortOrder {
+				return a.sortOrder < b.sortOrder
+			}
+		case model.SidebarSortUnread:
+			if unread[a.ID] != unread[b.ID] {
+				return unread[a.ID] > unread[b.ID]
+			}
+		case model.SidebarSortUpdated:
+			if !latest[a.ID].Equal(latest[b.ID]) {
+				return latest[a.ID].After(latest[b.ID])
+			}
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.ID < b.ID
+	})
+}
+
+// --- Item Methods ---
+
+// AddItem inserts a new item if GUID doesn't exist for that feed. Returns ID and whether it was new.
+func (db *MemoryStore) AddItem(ctx context.Context, item *model.Item) (int64, bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.feeds[item.FeedID] == nil {
+		return 0, false, fmt.Errorf("feed %d does not exist", item.FeedID)
+	}
+	for _, it := range db.items {
+		if it.FeedID == item.FeedID && it.GUID == item.GUID {
+			return 0, false, nil
+		}
+	}
+	id := db.nextID()
+	db.items[id] = &memItem{Item: model.Item{
+		ID:            id,
+		FeedID:        item.FeedID,
+		GUID:          item.GUID,
+		Title:         item.Title,
+		Content:       item.Content,
+		Link:          item.Link,
+		AuthorName:    item.AuthorName,
+		AuthorEmail:   item.AuthorEmail,
+		PublishedAt:   item.PublishedAt,
+		FetchedAt:     item.FetchedAt,
+		WordCount:     item.WordCount,
+		ReadingTime:   item.ReadingTime,
+		EnclosureURL:  item.EnclosureURL,
+		EnclosureType: item.EnclosureType,
+		CommentsURL:   item.CommentsURL,
+		CommentsFeed:  item.CommentsFeed,
+		Domain:        model.LinkDomain(item.Link),
+		Snippet:       item.Snippet,
+		RawTitle:      item.RawTitle,
+	}}
+	return id, true, nil
+}
+
+// AddItems adds items in bulk. It returns the ID of each item, 0 where its
+// feed already had its GUID.
+func (db *MemoryStore) AddItems(ctx context.Context, items []model.Item) ([]int64, error) {
+	ids := make([]int64, len(items))
+	now := time.Now().UTC()
+	for n, it := range items {
+		id, isNew, err := db.AddItem(ctx, &it)
+		if err != nil {
+			return nil, err
+		}
+		if !isNew {
+			continue
+		}
+		db.updateItem(id, func(m *memItem) {
+			if it.IsRead {
+				m.markRead(now)
+			}
+			m.Note, m.Summary, m.WaybackURL = it.Note, it.Summary, it.WaybackURL
+		})
+		ids[n] = id
+	}
+	return ids, nil
+}
+
+// GetItems returns items for a feed, ordered by published date desc.
+func (db *MemoryStore) GetItems(ctx context.Context, feedID int64, onlyUnread bool) ([]model.Item, error) {
+	return db.QueryItems(ctx, model.ItemFilter{FeedID: &feedID, OnlyUnread: onlyUnread})
+}
+
+// GetAllItems returns all items for the sidebar/home stream.
+func (db *MemoryStore) GetAllItems(ctx context.Context, onlyUnread bool) ([]model.Item, error) {
+	return db.QueryItems(ctx, model.ItemFilter{OnlyUnread: onlyUnread})
+}
+
+// GetItemsByFolderID returns all items for feeds in a specific folder.
+func (db *MemoryStore) GetItemsByFolderID(ctx context.Context, folderID int64, onlyUnread bool) ([]model.Item, error) {
+	return db.QueryItems(ctx, model.ItemFilter{FolderID: &folderID, OnlyUnread: onlyUnread})
+}
+
+// QueryItems returns items matching the filter.
+func (db *MemoryStore) QueryItems(ctx context.Context, filter model.ItemFilter) ([]model.Item, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	items := db.matchItems(filter)
+	sortItems(items, filter.Sort, filter.Seed)
+	if filter.Limit > 0 {
+		start := min(filter.Offset, len(items))
+		items = items[start:min(start+filter.Limit, len(items))]
+	}
+	return db.copyItems(items), nil
+}
+
+// matchItems returns the items outside the trash matching filter, like
+// buildItemFrom.
+func (db *MemoryStore) matchItems(f model.ItemFilter) []*memItem {
+	tagID, hasTag := db.tags[f.Tag]
+	older, newer := db.items[f.OlderThan], db.items[f.NewerThan]
+	var items []*memItem
+	for _, it := range db.items {
+		switch {
+		case !it.deletedAt.IsZero():
+		case f.OlderThan != 0 && (older == nil || !listedBefore(older, it)):
+		case f.NewerThan != 0 && (newer == nil || !listedBefore(it, newer)):
+		case f.FolderID != nil && !db.inFolder(it, *f.FolderID):
+		case f.FeedID != nil && it.FeedID != *f.FeedID:
+		case f.OnlyUnread && it.IsRead:
+		case f.OnlyRead && !it.IsRead:
+		case f.Starred && !it.Starred:
+		case f.DeadLinks && db.links[it.ID].DeadSince.IsZero():
+		case f.MinWords > 0 && it.WordCount < f.MinWords:
+		case f.MaxWords > 0 && it.WordCount > f.MaxWords:
+		case !f.Since.IsZero() && it.PublishedAt.Before(f.Since):
+		case !f.Until.IsZero() && !it.PublishedAt.Before(f.Until):
+		case !f.FetchedSince.IsZero() && it.FetchedAt.Before(f.FetchedSince):
+		case db.inAnyFolder(it, f.ExcludeFolders):
+		case f.Author != "" && strings.ToLower(it.AuthorName) != strings.ToLower(f.Author):
+		case f.Domain != "" && it.Domain != f.Domain:
+		case f.Tag != "" && (!hasTag || !db.itemTags[it.ID][tagID]):
+		case f.FeedLabel != "" && !db.feedHasLabel(it.FeedID, f.FeedLabel):
+		default:
+			items = append(items, it)
+		}
+	}
+	return items
+}
+
+func (db *MemoryStore) feedHasLabel(feedID int64, label string) bool {
+	if f := db.feeds[feedID]; f != nil {
+		for _, l := range f.labels {
+			if l == label {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (db *MemoryStore) inFolder(it *memItem, folderID int64) bool {
+	f := db.feeds[it.FeedID]
+	return f != nil && f.FolderID != nil && *f.FolderID == folderID
+}
+
+// listedBefore reports whether a comes before b in the default, newest first
+// listing.
+func listedBefore(a, b *memItem) bool {
+	if !a.PublishedAt.Equal(b.PublishedAt) {
+		return a.PublishedAt.After(b.PublishedAt)
+	}
+	return a.ID > b.ID
+}
+
+func (db *MemoryStore) inAnyFolder(it *memItem, folderIDs []int64) bool {
+	for _, id := range folderIDs {
+		if db.inFolder(it, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortItems orders items like itemOrder.
+func sortItems(items []*memItem, mode string, seed int64) {
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		switch mode {
+		case model.SortOldest:
+			return listedBefore(b, a)
+		case model.SortFetched:
+			if !a.FetchedAt.Equal(b.FetchedAt) {
+				return a.FetchedAt.After(b.FetchedAt)
+			}
+			return a.ID > b.ID
+		case model.SortRandom:
+			if ka, kb := model.ShuffleKey(a.ID, seed), model.ShuffleKey(b.ID, seed); ka != kb {
+				return ka < kb
+			}
+			return a.ID < b.ID
+		case model.SortLongest:
+			if a.WordCount != b.WordCount {
+				return a.WordCount > b.WordCount
+			}
+		case model.SortShortest:
+			if a.WordCount != b.WordCount {
+				return a.WordCount < b.WordCount
+			}
+		case model.SortInterest:
+			if a.InterestScore != b.InterestScore {
+				return a.InterestScore > b.InterestScore
+			}
+		}
+		return listedBefore(a, b)
+	})
+}
+
+// copyItems returns copies of items with the derived fields filled in.
+func (db *MemoryStore) copyItems(items []*memItem) []model.Item {
+	var result []model.Item
+	for _, it := range items {
+		result = append(result, db.copyItem(it))
+	}
+	return result
+}
+
+func (db *MemoryStore) copyItem(it *memItem) model.Item {
+	item := it.Item
+	_, item.Archived = db.archives[it.ID]
+	item.MediaStatus = db.media[it.ID].Status
+	item.LinkDead = !db.links[it.ID].DeadSince.IsZero()
+	return item
+}
+
+// GetItemByID returns a single item by its ID.
+func (db *MemoryStore) GetItemByID(ctx context.Context, itemID int64) (*model.Item, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	it, ok := db.items[itemID]
+	if !ok || !it.deletedAt.IsZero() {
+		return nil, sql.ErrNoRows
+	}
+	item := db.copyItem(it)
+	return &item, nil
+}
+
+// updateItem applies change to an item. Missing items are ignored, like an
+// UPDATE matching no rows.
+func (db *MemoryStore) updateItem(itemID int64, change func(it *memItem)) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if it, ok := db.items[itemID]; ok {
+		change(it)
+	}
+	return nil
+}
+
+// SetItemNote stores a private note on an item. An empty note removes it.
+func (db *MemoryStore) SetItemNote(ctx context.Context, itemID int64, note string) error {
+	return db.updateItem(itemID, func(it *memItem) { it.Note = note })
+}
+
+// SetItemPosition records how far an item has been read, in percent. It
+// returns sql.ErrNoRows if the item doesn't exist or is in the trash.
+func (db *MemoryStore) SetItemPosition(ctx context.Context, itemID int64, percent float64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	it, ok := db.items[itemID]
+	if !ok || !it.deletedAt.IsZero() {
+		return sql.ErrNoRows
+	}
+	it.ReadPosition = percent
+	return nil
+}
+
+// SetItemSummary stores a generated summary on an item.
+func (db *MemoryStore) SetItemSummary(ctx context.Context, itemID int64, summary string) error {
+	return db.updateItem(itemID, func(it *memItem) { it.Summary = summary })
+}
+
+// SetItemStarred stars or unstars an item. Starring records a positive
+// interest event.
+func (db *MemoryStore) SetItemStarred(ctx context.Context, itemID int64, starred bool) error {
+	return db.updateItem(itemID, func(it *memItem) {
+		if it.Starred == starred {
+			return
+		}
+		it.Starred = starred
+		if starred {
+			db.addEvent(it, true)
+		}
+	})
+}
+
+// GetItemTags returns the names of the tags on an item.
+func (db *MemoryStore) GetItemTags(ctx context.Context, itemID int64) ([]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var tags []string
+	for name, id := range db.tags {
+		if db.itemTags[itemID][id] {
+			tags = append(tags, name)
+		}
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// SetItemWaybackURL records the Wayback Machine capture of an item's link.
+func (db *MemoryStore) SetItemWaybackURL(ctx context.Context, itemID int64, waybackURL string) error {
+	return db.updateItem(itemID, func(it *memItem) { it.WaybackURL = waybackURL })
+}
+
+// SetItemMedia creates or updates the download state of an item's enclosure.
+func (db *MemoryStore) SetItemMedia(ctx context.Context, m model.ItemMedia) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.items[m.ItemID] == nil {
+		return fmt.Errorf("item %d does not exist", m.ItemID)
+	}
+	m.UpdatedAt = m.UpdatedAt.UTC()
+	db.media[m.ItemID] = m
+	return nil
+}
+
+// GetItemMedia returns the download state of an item's enclosure, or
+// sql.ErrNoRows if it was never queued.
+func (db *MemoryStore) GetItemMedia(ctx context.Context, itemID int64) (*model.ItemMedia, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	m, ok := db.media[itemID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &m, nil
+}
+
+// GetPendingMedia returns up to limit items whose enclosure is queued for
+// download, oldest first.
+func (db *MemoryStore) GetPendingMedia(ctx context.Context, limit int) ([]model.Item, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var items []*memItem
+	for id, m := range db.media {
+		if it := db.items[id]; m.Status == model.MediaPending && it != nil && it.deletedAt.IsZero() {
+			items = append(items, it)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		a, b := db.media[items[i].ID].UpdatedAt, db.media[items[j].ID].UpdatedAt
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return items[i].ID < items[j].ID
+	})
+	return db.copyItems(items[:limitLen(len(items), limit)]), nil
+}
+
+// SetLinkCheck creates or updates the latest check of an item's link.
+func (db *MemoryStore) SetLinkCheck(ctx context.Context, c model.LinkCheck) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.items[c.ItemID] == nil {
+		return fmt.Errorf("item %d does not exist", c.ItemID)
+	}
+	if !c.DeadSince.IsZero() {
+		c.DeadSince = c.DeadSince.UTC()
+	}
+	c.CheckedAt, c.NextCheckAt = c.CheckedAt.UTC(), c.NextCheckAt.UTC()
+	db.links[c.ItemID] = c
+	return nil
+}
+
+// GetLinkCheck returns the latest check of an item's link, or sql.ErrNoRows
+// if it was never checked.
+func (db *MemoryStore) GetLinkCheck(ctx context.Context, itemID int64) (*model.LinkCheck, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	c, ok := db.links[itemID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &c, nil
+}
+
+// GetLinkCheckItems returns up to limit starred or archived items whose link
+// was never checked or is due for a check at now, never checked first, then
+// longest due.
+func (db *MemoryStore) GetLinkCheckItems(ctx context.Context, now time.Time, limit int) ([]model.Item, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var items []*memItem
+	for _, it := range db.items {
+		_, archived := db.archives[it.ID]
+		c, checked := db.links[it.ID]
+		if it.deletedAt.IsZero() && it.Link != "" && (it.Starred || archived) && (!checked || !c.NextCheckAt.After(now)) {
+			items = append(items, it)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		a, aChecked := db.links[items[i].ID]
+		b, bChecked := db.links[items[j].ID]
+		switch {
+		case aChecked != bChecked:
+			return !aChecked
+		case !a.NextCheckAt.Equal(b.NextCheckAt):
+			return a.NextCheckAt.Before(b.NextCheckAt)
+		}
+		return items[i].ID < items[j].ID
+	})
+	return db.copyItems(items[:limitLen(len(items), limit)]), nil
+}
+
+// SetItemEnclosures replaces the enclosures of an item.
+func (db *MemoryStore) SetItemEnclosures(ctx context.Context, itemID int64, encs []model.Enclosure) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.items[itemID] == nil {
+		return fmt.Errorf("item %d does not exist", itemID)
+	}
+	if len(encs) == 0 {
+		delete(db.encs, itemID)
+		return nil
+	}
+	db.encs[itemID] = append([]model.Enclosure(nil), encs...)
+	return nil
+}
+
+// GetItemEnclosures returns the enclosures of the items, by item ID.
+func (db *MemoryStore) GetItemEnclosures(ctx context.Context, itemIDs []int64) (map[int64][]model.Enclosure, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	encs := make(map[int64][]model.Enclosure)
+	for _, id := range itemIDs {
+		if e, ok := db.encs[id]; ok {
+			encs[id] = append([]model.Enclosure(nil), e...)
+		}
+	}
+	return encs, nil
+}
+
+// SaveItemArchive stores or replaces the page snapshot of an item.
+func (db *MemoryStore) SaveItemArchive(ctx context.Context, a model.ItemArchive) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.items[a.ItemID] == nil {
+		return fmt.Errorf("item %d does not exist", a.ItemID)
+	}
+	a.FetchedAt = a.FetchedAt.UTC()
+	db.archives[a.ItemID] = a
+	return nil
+}
+
+// GetItemArchive returns the page snapshot of an item, or sql.ErrNoRows if
+// none is stored.
+func (db *MemoryStore) GetItemArchive(ctx context.Context, itemID int64) (*model.ItemArchive, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	a, ok := db.archives[itemID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &a, nil
+}
+
+// SearchItemNotes returns annotated items whose note or title contains query.
+// An empty query returns every annotated item.
+func (db *MemoryStore) SearchItemNotes(ctx context.Context, query string) ([]model.Item, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	query = strings.ToLower(query)
+	var items []*memItem
+	for _, it := range db.items {
+		if it.Note == "" || !it.deletedAt.IsZero() {
+			continue
+		}
+		if strings.Contains(strings.ToLower(it.Note), query) || strings.Contains(strings.ToLower(it.Title), query) {
+			items = append(items, it)
+		}
+	}
+	sortItems(items, model.SortNewest, 0)
+	return db.copyItems(items), nil
+}
+
+// GetAuthors returns up to limit authors whose name contains query, with
+// the most prolific first. An empty query matches every author.
+func (db *MemoryStore) GetAuthors(ctx context.Context, query string, limit int) ([]model.Author, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	query = strings.ToLower(query)
+	byKey := make(map[string]*model.Author)
+	for _, it := range db.items {
+		key := strings.ToLower(it.AuthorName)
+		if it.AuthorName == "" || !it.deletedAt.IsZero() || !strings.Contains(key, query) {
+			continue
+		}
+		a, ok := byKey[key]
+		if !ok {
+			a = &model.Author{Name: it.AuthorName}
+			byKey[key] = a
+		}
+		a.ItemCount++
+		a.Name = min(a.Name, it.AuthorName)
+	}
+	var authors []model.Author
+	for _, a := range byKey {
+		authors = append(authors, *a)
+	}
+	sort.Slice(authors, func(i, j int) bool {
+		if authors[i].ItemCount != authors[j].ItemCount {
+			return authors[i].ItemCount > authors[j].ItemCount
+		}
+		return authors[i].Name < authors[j].Name
+	})
+	return authors[:limitLen(len(authors), limit)], nil
+}
+
+// GetDomains returns up to limit domains containing query, with the number
+// of items and feeds linking to each, the most linked to first.
+func (db *MemoryStore) GetDomains(ctx context.Context, query string, limit int) ([]model.Domain, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	query = strings.ToLower(query)
+	byName := make(map[string]*model.Domain)
+	feeds := make(map[string]map[int64]bool)
+	for _, it := range db.items {
+		if it.Domain == "" || !it.deletedAt.IsZero() || !strings.Contains(it.Domain, query) {
+			continue
+		}
+		d, ok := byName[it.Domain]
+		if !ok {
+			d = &model.Domain{Name: it.Domain}
+			byName[it.Domain] = d
+			feeds[it.Domain] = make(map[int64]bool)
+		}
+		d.ItemCount++
+		feeds[it.Domain][it.FeedID] = true
+	}
+	var domains []model.Domain
+	for name, d := range byName {
+		d.FeedCount = len(feeds[name])
+		domains = append(domains, *d)
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		if domains[i].ItemCount != domains[j].ItemCount {
+			return domains[i].ItemCount > domains[j].ItemCount
+		}
+		return domains[i].Name < domains[j].Name
+	})
+	return domains[:limitLen(len(domains), limit)], nil
+}
+
+// MarkItemRead marks an item as read.
+func (db *MemoryStore) MarkItemRead(ctx context.Context, itemID int64) error {
+	return db.updateItem(itemID, func(it *memItem) { it.markRead(time.Now().UTC()) })
+}
+
+// MarkItemsRead marks multiple items as read.
+func (db *MemoryStore) MarkItemsRead(ctx context.Context, itemIDs []int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	now := time.Now().UTC()
+	for _, id := range itemIDs {
+		if it, ok := db.items[id]; ok {
+			it.markRead(now)
+		}
+	}
+	return nil
+}
+
+// MarkReadByFilter marks every item matching filter as read. Returns the
+// number of items changed.
+func (db *MemoryStore) MarkReadByFilter(ctx context.Context, filter model.ItemFilter) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var n int64
+	now := time.Now().UTC()
+	for _, it := range db.matchItems(filter) {
+		if it.markRead(now) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// GetReadActivity returns the items read since a time and the unread items.
+func (db *MemoryStore) GetReadActivity(ctx context.Context, since time.Time) ([]model.ItemActivity, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var acts []model.ItemActivity
+	for _, it := range db.items {
+		a := model.ItemActivity{FeedID: it.FeedID, FetchedAt: it.FetchedAt}
+		switch {
+		case !it.readAt.IsZero() && !it.readAt.Before(since):
+			readAt := it.readAt
+			a.ReadAt = &readAt
+		case it.IsRead || !it.deletedAt.IsZero():
+			continue
+		}
+		acts = append(acts, a)
+	}
+	return acts, nil
+}
+
+// deletable reports whether a read item may be moved to the trash.
+// Annotated and starred items are kept.
+func (it *memItem) deletable() bool {
+	return it.IsRead && !it.Starred && it.Note == "" && it.deletedAt.IsZero()
+}
+
+// MergeItems folds duplicates into keep and moves them to the trash.
+func (db *MemoryStore) MergeItems(ctx context.Context, keep model.Item, duplicateIDs []int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	it, ok := db.items[keep.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	now := time.Now().UTC()
+	if keep.IsRead {
+		it.markRead(now)
+	} else {
+		it.IsRead, it.readAt = false, time.Time{}
+	}
+	it.Starred, it.Note = keep.Starred, keep.Note
+	for _, id := range duplicateIDs {
+		dup, ok := db.items[id]
+		if !ok {
+			continue
+		}
+		for tagID := range db.itemTags[id] {
+			if db.itemTags[keep.ID] == nil {
+				db.itemTags[keep.ID] = make(map[int64]bool)
+			}
+			db.itemTags[keep.ID][tagID] = true
+		}
+		if dup.deletedAt.IsZero() {
+			dup.deletedAt = now
+		}
+	}
+	return nil
+}
+
+// DeleteReadItems moves specific read items to the trash. Annotated and starred items are kept.
+func (db *MemoryStore) DeleteReadItems(ctx context.Context, itemIDs []int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	now := time.Now().UTC()
+	for _, id := range itemIDs {
+		if it, ok := db.items[id]; ok && it.deletable() {
+			it.deletedAt = now
+		}
+	}
+	return nil
+}
+
+// CleanupReadItems moves all items marked as read to the trash. Annotated and starred items are kept.
+func (db *MemoryStore) CleanupReadItems(ctx context.Context) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	now := time.Now().UTC()
+	var n int64
+	for _, it := range db.items {
+		if it.deletable() {
+			it.deletedAt = now
+			n++
+		}
+	}
+	return n, nil
+}
+
+// --- Trash Methods ---
+
+// GetTrashedFeeds returns feeds in the trash, most recently deleted first.
+func (db *MemoryStore) GetTrashedFeeds(ctx context.Context) ([]model.TrashedFeed, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var feeds []model.TrashedFeed
+	for _, f := range db.feeds {
+		if f.deletedAt.IsZero() {
+			continue
+		}
+		tf := model.TrashedFeed{Feed: *db.copyFeed(f), DeletedAt: f.deletedAt}
+		for _, it := range db.items {
+			if it.FeedID == f.ID && !it.deletedAt.IsZero() && !it.deletedAt.Before(f.deletedAt) {
+				tf.ItemCount++
+			}
+		}
+		feeds = append(feeds, tf)
+	}
+	sort.Slice(feeds, func(i, j int) bool {
+		if !feeds[i].DeletedAt.Equal(feeds[j].DeletedAt) {
+			return feeds[i].DeletedAt.After(feeds[j].DeletedAt)
+		}
+		return feeds[i].ID > feeds[j].ID
+	})
+	return feeds, nil
+}
+
+// GetTrashedItems returns up to limit trashed items of feeds that are not
+// themselves in the trash, most recently deleted first.
+func (db *MemoryStore) GetTrashedItems(ctx context.Context, limit int) ([]model.TrashedItem, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var items []model.TrashedItem
+	for _, it := range db.items {
+		if f := db.feeds[it.FeedID]; !it.deletedAt.IsZero() && f != nil && f.deletedAt.IsZero() {
+			items = append(items, model.TrashedItem{Item: db.copyItem(it), DeletedAt: it.deletedAt})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].DeletedAt.Equal(items[j].DeletedAt) {
+			return items[i].DeletedAt.After(items[j].DeletedAt)
+		}
+		return items[i].ID > items[j].ID
+	})
+	return items[:limitLen(len(items), limit)], nil
+}
+
+// RestoreFeed takes a feed out of the trash along with the items deleted
+// with it. Returns sql.ErrNoRows if the feed is not in the trash.
+func (db *MemoryStore) RestoreFeed(ctx context.Context, feedID int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	f, ok := db.feeds[feedID]
+	if !ok || f.deletedAt.IsZero() {
+		return sql.ErrNoRows
+	}
+	db.restoreFeed(f)
+	return nil
+}
+
+// restoreFeed takes a trashed feed and the items deleted with it out of the
+// trash.
+func (db *MemoryStore) restoreFeed(f *memFeed) {
+	for _, it := range db.items {
+		if it.FeedID == f.ID && !it.deletedAt.IsZero() && !it.deletedAt.Before(f.deletedAt) {
+			it.deletedAt = time.Time{}
+		}
+	}
+	f.deletedAt = time.Time{}
+}
+
+// RestoreItems takes items out of the trash. Returns the number restored.
+func (db *MemoryStore) RestoreItems(ctx context.Context, itemIDs []int64) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var restored int64
+	for _, id := range itemIDs {
+		if it, ok := db.items[id]; ok && !it.deletedAt.IsZero() {
+			it.deletedAt = time.Time{}
+			restored++
+		}
+	}
+	return restored, nil
+}
+
+// PurgeTrash permanently deletes feeds and items trashed before the given time.
+// Returns the number of feeds and items removed.
+func (db *MemoryStore) PurgeTrash(ctx context.Context, before time.Time) (feeds, items int64, err error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for id, it := range db.items {
+		if !it.deletedAt.IsZero() && it.deletedAt.Before(before) {
+			db.deleteItem(id)
+			items++
+		}
+	}
+	for id, f := range db.feeds {
+		if f.deletedAt.IsZero() || !f.deletedAt.Before(before) {
+			continue
+		}
+		// Like the cascade, remove any items left on the feed uncounted.
+		for itemID, it := range db.items {
+			if it.FeedID == id {
+				db.deleteItem(itemID)
+			}
+		}
+		delete(db.feeds, id)
+		feeds++
+	}
+	return feeds, items, nil
+}
+
+// deleteItem removes an item with everything attached to it.
+func (db *MemoryStore) deleteItem(itemID int64) {
+	delete(db.items, itemID)
+	delete(db.itemTags, itemID)
+	delete(db.archives, itemID)
+	delete(db.media, itemID)
+	delete(db.links, itemID)
+	delete(db.encs, itemID)
+}
+
+// --- Tag Methods ---
+
+// AddItemTags attaches tags to an item, creating missing tags.
+func (db *MemoryStore) AddItemTags(ctx context.Context, itemID int64, tags []string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if len(tags) > 0 && db.items[itemID] == nil {
+		return fmt.Errorf("item %d does not exist", itemID)
+	}
+	for _, name := range tags {
+		id, ok := db.tags[name]
+		if !ok {
+			id = db.nextID()
+			db.tags[name] = id
+		}
+		if db.itemTags[itemID] == nil {
+			db.itemTags[itemID] = make(map[int64]bool)
+		}
+		db.itemTags[itemID][id] = true
+	}
+	return nil
+}
+
+// GetTags returns all tags in use with the number of items carrying each.
+func (db *MemoryStore) GetTags(ctx context.Context) ([]model.Tag, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var tags []model.Tag
+	for name, id := range db.tags {
+		t := model.Tag{ID: id, Name: name}
+		for itemID, tagIDs := range db.itemTags {
+			if it := db.items[itemID]; tagIDs[id] && it != nil && it.deletedAt.IsZero() {
+				t.ItemCount++
+			}
+		}
+		if t.ItemCount > 0 {
+			tags = append(tags, t)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+// GetFeedTags returns up to perFeed tags of each feed's items by feed ID,
+// the tags carried by most items first.
+func (db *MemoryStore) GetFeedTags(ctx context.Context, perFeed int) (map[int64][]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	names := make(map[int64]string, len(db.tags))
+	for name, id := range db.tags {
+		names[id] = name
+	}
+	counts := make(map[int64]map[string]int)
+	for itemID, tagIDs := range db.itemTags {
+		it := db.items[itemID]
+		if it == nil || !it.deletedAt.IsZero() {
+			continue
+		}
+		if counts[it.FeedID] == nil {
+			counts[it.FeedID] = make(map[string]int)
+		}
+		for id, ok := range tagIDs {
+			if ok {
+				counts[it.FeedID][names[id]]++
+			}
+		}
+	}
+	tags := make(map[int64][]string, len(counts))
+	for feedID, c := range counts {
+		list := make([]string, 0, len(c))
+		for name := range c {
+			list = append(list, name)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if c[list[i]] != c[list[j]] {
+				return c[list[i]] > c[list[j]]
+			}
+			return list[i] < list[j]
+		})
+		tags[feedID] = list[:min(len(list), perFeed)]
+	}
+	return tags, nil
+}
+
+// SetFeedLabels replaces the labels a reader put on a feed.
+func (db *MemoryStore) SetFeedLabels(ctx context.Context, feedID int64, labels []string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	f := db.feeds[feedID]
+	if f == nil {
+		return sql.ErrNoRows
+	}
+	seen := make(map[string]bool, len(labels))
+	f.labels = nil
+	for _, label := range labels {
+		if !seen[label] {
+			seen[label] = true
+			f.labels = append(f.labels, label)
+		}
+	}
+	sort.Strings(f.labels)
+	return nil
+}
+
+// GetFeedLabels returns the labels of each feed outside the trash by feed
+// ID, sorted by name.
+func (db *MemoryStore) GetFeedLabels(ctx context.Context) (map[int64][]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	labels := make(map[int64][]string)
+	for id, f := range db.feeds {
+		if f.deletedAt.IsZero() && len(f.labels) > 0 {
+			labels[id] = append([]string(nil), f.labels...)
+		}
+	}
+	return labels, nil
+}
+
+// --- Interest Methods ---
+
+// addEvent records an interest event for it.
+func (db *MemoryStore) addEvent(it *memItem, positive bool) {
+	db.events = append(db.events, model.InterestEvent{
+		FeedID:    it.FeedID,
+		Title:     it.Title,
+		Positive:  positive,
+		CreatedAt: time.Now(),
+	})
+}
+
+// MarkItemOpened flags an item as opened and records a positive interest
+// event the first time it is opened.
+func (db *MemoryStore) MarkItemOpened(ctx context.Context, itemID int64) error {
+	return db.updateItem(itemID, func(it *memItem) {
+		if !it.opened {
+			it.opened = true
+			db.addEvent(it, true)
+		}
+	})
+}
+
+// RecordSkippedItems records a negative interest event for each read item
+// that was neither opened nor annotated.
+func (db *MemoryStore) RecordSkippedItems(ctx context.Context, itemIDs []int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, id := range itemIDs {
+		if it, ok := db.items[id]; ok && it.IsRead && !it.opened && !it.Starred && it.Note == "" {
+			db.addEvent(it, false)
+		}
+	}
+	return nil
+}
+
+// GetInterestEvents returns the most recent interest events, newest first.
+func (db *MemoryStore) GetInterestEvents(ctx context.Context, limit int) ([]model.InterestEvent, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var events []model.InterestEvent
+	for i := len(db.events) - 1; i >= 0 && len(events) < limitLen(len(db.events), limit); i-- {
+		events = append(events, db.events[i])
+	}
+	return events, nil
+}
+
+// SetInterestScores stores interest scores keyed by item ID.
+func (db *MemoryStore) SetInterestScores(ctx context.Context, scores map[int64]float64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for id, score := range scores {
+		if it, ok := db.items[id]; ok {
+			it.InterestScore = score
+		}
+	}
+	return nil
+}
+
+// --- Audit Methods ---
+
+// AddAuditEntry appends an entry to the audit log.
+func (db *MemoryStore) AddAuditEntry(ctx context.Context, e model.AuditEntry) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	e.ID = db.nextID()
+	db.audit = append(db.audit, e)
+	return nil
+}
+
+// GetAuditLog returns a page of audit entries, newest first.
+func (db *MemoryStore) GetAuditLog(ctx context.Context, limit, offset int) ([]model.AuditEntry, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var entries []model.AuditEntry
+	for i := len(db.audit) - 1 - offset; i >= 0 && len(entries) < limitLen(len(db.audit), limit); i-- {
+		entries = append(entries, db.audit[i])
+	}
+	return entries, nil
+}
+
+// --- Job Methods ---
+
+// AddJob records a new job and returns its ID.
+func (db *MemoryStore) AddJob(ctx context.Context, j *model.Job) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	job := *j
+	job.ID = db.nextID()
+	db.jobs[job.ID] = job
+	return job.ID, nil
+}
+
+// GetJob returns a job, or sql.ErrNoRows if there is none with that ID.
+func (db *MemoryStore) GetJob(ctx context.Context, jobID int64) (*model.Job, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	j, ok := db.jobs[jobID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &j, nil
+}
+
+// GetJobs returns the newest jobs.
+func (db *MemoryStore) GetJobs(ctx context.Context, limit int) ([]model.Job, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	jobs := make([]model.Job, 0, len(db.jobs))
+	for _, j := range db.jobs {
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].ID > jobs[b].ID })
+	return jobs[:limitLen(len(jobs), limit)], nil
+}
+
+// UpdateJob saves the state, progress and outcome of a job.
+func (db *MemoryStore) UpdateJob(ctx context.Context, j *model.Job) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	old, ok := db.jobs[j.ID]
+	if !ok {
+		return nil
+	}
+	job := *j
+	job.Kind, job.Payload, job.CreatedAt = old.Kind, old.Payload, old.CreatedAt
+	db.jobs[j.ID] = job
+	return nil
+}
+
+// GetStaleJobs returns the running jobs not updated since a time.
+func (db *MemoryStore) GetStaleJobs(ctx context.Context, since time.Time) ([]model.Job, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var jobs []model.Job
+	for _, j := range db.jobs {
+		if j.State == model.JobRunning && j.UpdatedAt.Before(since) {
+			jobs = append(jobs, j)
+		}
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].ID < jobs[b].ID })
+	return jobs, nil
+}
+
+// ClaimJob restarts a job that is still stale, counting the attempt.
+func (db *MemoryStore) ClaimJob(ctx context.Context, jobID int64, stale, now time.Time) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	j, ok := db.jobs[jobID]
+	if !ok || j.State != model.JobRunning || !j.UpdatedAt.Before(stale) {
+		return false, nil
+	}
+	j.Attempts++
+	j.StartedAt, j.UpdatedAt = now, now
+	db.jobs[jobID] = j
+	return true, nil
+}
+
+// PruneJobs deletes the jobs finished before a time.
+func (db *MemoryStore) PruneJobs(ctx context.Context, before time.Time) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var n int64
+	for id, j := range db.jobs {
+		if !j.FinishedAt.IsZero() && j.FinishedAt.Before(before) {
+			delete(db.jobs, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// --- Maintenance Methods ---
+
+// Maintain has nothing to check or compact; it reports an empty run.
+func (db *MemoryStore) Maintain(ctx context.Context) (*model.MaintenanceReport, error) {
+	return &model.MaintenanceReport{}, nil
+}
+
+// GetStorageReport counts the items, by feed, and the bytes of text they
+// store. Nothing is on disk, so there are no sizes to measure.
+func (db *MemoryStore) GetStorageReport(ctx context.Context) (*model.StorageReport, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	report := &model.StorageReport{Tables: []model.TableSize{}, Feeds: []model.FeedStorage{}}
+	byFeed := make(map[int64]*model.FeedStorage, len(db.feeds))
+	for id, f := range db.feeds {
+		byFeed[id] = &model.FeedStorage{FeedID: id, Title: f.Title}
+	}
+	for id, it := range db.items {
+		report.Items++
+		trashed := !it.deletedAt.IsZero()
+		if trashed {
+			report.TrashedItems++
+		}
+		fs, ok := byFeed[it.FeedID]
+		if !ok {
+			continue
+		}
+		fs.Items++
+		if trashed {
+			fs.TrashedItems++
+		}
+		fs.Bytes += int64(len(it.Title) + len(it.Content) + len(it.Summary) + len(it.Snippet) + len(it.Note) + len(db.archives[id].HTML))
+	}
+	for _, fs := range byFeed {
+		report.Feeds = append(report.Feeds, *fs)
+	}
+	sort.Slice(report.Feeds, func(i, j int) bool {
+		a, b := report.Feeds[i], report.Feeds[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.FeedID < b.FeedID
+	})
+	return report, nil
+}
+
+// FindOrphans reports rows left behind by deleted ones.
+func (db *MemoryStore) FindOrphans(ctx context.Context) (*model.OrphanReport, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.orphans(false), nil
+}
+
+// FixOrphans removes rows left behind by deleted ones, moving orphaned
+// folders to the top level.
+func (db *MemoryStore) FixOrphans(ctx context.Context) (*model.OrphanReport, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.orphans(true), nil
+}
+
+// orphans finds, and with fix removes, the orphans. The caller holds the
+// lock.
+func (db *MemoryStore) orphans(fix bool) *model.OrphanReport {
+	report := &model.OrphanReport{Folders: []int64{}, Settings: []string{}}
+	for id, f := range db.folders {
+		if f.ParentID != nil && db.folders[*f.ParentID] == nil {
+			report.Folders = append(report.Folders, id)
+			if fix {
+				f.ParentID = nil
+			}
+		}
+	}
+	sort.Slice(report.Folders, func(i, j int) bool { return report.Folders[i] < report.Folders[j] })
+
+	for id, it := range db.items {
+		if db.feeds[it.FeedID] == nil {
+			report.Items++
+			report.TagLinks += int64(len(db.itemTags[id]))
+			if fix {
+				db.deleteItem(id)
+			}
+		}
+	}
+	tagIDs := make(map[int64]bool, len(db.tags))
+	for _, id := range db.tags {
+		tagIDs[id] = true
+	}
+	for itemID, links := range db.itemTags {
+		for tagID := range links {
+			if db.items[itemID] == nil || !tagIDs[tagID] {
+				report.TagLinks++
+				if fix {
+					delete(links, tagID)
+				}
+			}
+		}
+		if fix && len(links) == 0 {
+			delete(db.itemTags, itemID)
+		}
+	}
+
+	known := make(map[string]bool, len(model.KnownSettings))
+	for _, key := range model.KnownSettings {
+		known[key] = true
+	}
+	for key := range db.settings {
+		if !known[key] {
+			report.Settings = append(report.Settings, key)
+			if fix {
+				delete(db.settings, key)
+			}
+		}
+	}
+	sort.Strings(report.Settings)
+	return report
+}
+
+// --- Settings Methods ---
+
+// GetSetting retrieves a setting value, or sql.ErrNoRows if it is not set.
+func (db *MemoryStore) GetSetting(ctx context.Context, key string) (string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	val, ok := db.settings[key]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return val, nil
+}
+
+// SetSetting saves a setting.
+func (db *MemoryStore) SetSetting(ctx context.Context, key, value string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.settings[key] = value
+	return nil
+}
+
+// SetSettings saves several settings at once.
+func (db *MemoryStore) SetSettings(ctx context.Context, values map[string]string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for key, value := range values {
+		db.settings[key] = value
+	}
+	return nil
+}
+
+// GetPollingInterval returns the polling interval in minutes, with a minimum of 15.
+func (db *MemoryStore) GetPollingInterval(ctx context.Context) (int, error) {
+	val, err := db.GetSetting(ctx, model.SettingPollingInterval)
+	if err != nil {
+		return 15, nil // default
+	}
+	var mins int
+	fmt.Sscanf(val, "%d", &mins)
+	if mins < 15 {
+		mins = 15
+	}
+	return mins, nil
+}
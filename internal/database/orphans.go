@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// Orphan queries shared by the SQL backends. Orphans can only exist where
+// foreign keys were not enforced when their parents were deleted.
+const (
+	orphanFolderWhere = "parent_id IS NOT NULL AND parent_id NOT IN (SELECT id FROM folders)"
+	orphanItemWhere   = "feed_id NOT IN (SELECT id FROM feeds)"
+	orphanTagWhere    = "item_id NOT IN (SELECT id FROM items) OR tag_id NOT IN (SELECT id FROM tags)"
+)
+
+// sqlQueryer is satisfied by both *sql.DB and *sql.Tx.
+type sqlQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// findOrphans reports the orphans visible to q.
+func findOrphans(ctx context.Context, q sqlQueryer) (*model.OrphanReport, error) {
+	report := &model.OrphanReport{Folders: []int64{}, Settings: []string{}}
+	rows, err := q.QueryContext(ctx, "SELECT id FROM folders WHERE "+orphanFolderWhere+" ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		report.Folders = append(report.Folders, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM items WHERE "+orphanItemWhere).Scan(&report.Items); err != nil {
+		return nil, err
+	}
+	// Links of orphaned items are counted too, since removing the items
+	// removes them.
+	if err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM item_tags WHERE "+orphanTagWhere+
+		" OR item_id IN (SELECT id FROM items WHERE "+orphanItemWhere+")").Scan(&report.TagLinks); err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(model.KnownSettings))
+	for _, key := range model.KnownSettings {
+		known[key] = true
+	}
+	rows, err = q.QueryContext(ctx, "SELECT key FROM settings ORDER BY key")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		if !known[key] {
+			report.Settings = append(report.Settings, key)
+		}
+	}
+	return report, rows.Err()
+}
+
+// fixOrphans removes the orphans in one transaction.
+func fixOrphans(ctx context.Context, conn *sql.DB, ph placeholderFunc) (*model.OrphanReport, error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	report, err := findOrphans(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	for _, query := range []string{
+		"UPDATE folders SET parent_id = NULL WHERE " + orphanFolderWhere,
+		"DELETE FROM item_tags WHERE item_id IN (SELECT id FROM items WHERE " + orphanItemWhere + ")",
+		"DELETE FROM items WHERE " + orphanItemWhere,
+		"DELETE FROM item_tags WHERE " + orphanTagWhere,
+	} {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	for _, key := range report.Settings {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM settings WHERE key = "+ph(1), key); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	return report, tx.Commit()
+}
@@ -0,0 +1,177 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// placeholderFunc renders the bind parameter for the n-th (1-based) argument.
+type placeholderFunc func(n int) string
+
+func sqlitePlaceholder(int) string { return "?" }
+
+func postgresPlaceholder(n int) string { return "$" + strconv.Itoa(n) }
+
+// octetsFunc returns the SQL expression for the size in bytes of a text
+// column, which differs between backends.
+type octetsFunc func(col string) string
+
+func sqliteOctets(col string) string   { return "LENGTH(CAST(" + col + " AS BLOB))" }
+func postgresOctets(col string) string { return "OCTET_LENGTH(" + col + ")" }
+
+// buildItemQuery renders the SQL and arguments for an item listing.
+func buildItemQuery(f model.ItemFilter, ph placeholderFunc) (string, []interface{}) {
+	from, args := buildItemFrom(f, ph)
+	query := "SELECT " + itemColumns + " " + from + " ORDER BY " + itemOrder(f.Sort, f.Seed)
+	if f.Limit > 0 {
+		query += " LIMIT " + strconv.Itoa(f.Limit) + " OFFSET " + strconv.Itoa(f.Offset)
+	}
+	return query, args
+}
+
+// buildMarkReadQuery renders an UPDATE marking every item matching the
+// filter as read at readAt.
+func buildMarkReadQuery(f model.ItemFilter, readAt time.Time, ph placeholderFunc) (string, []interface{}) {
+	// readAt is the first argument, so the filter's are numbered after it.
+	from, args := buildItemFrom(f, func(n int) string { return ph(n + 1) })
+	return "UPDATE items SET is_read = TRUE, read_at = " + ph(1) + " WHERE is_read = FALSE AND id IN (SELECT i.id " + from + ")",
+		append([]interface{}{readAt}, args...)
+}
+
+// buildItemFrom renders the FROM and WHERE clauses selecting the items that
+// match a filter, with the items table aliased as "i".
+func buildItemFrom(f model.ItemFilter, ph placeholderFunc) (string, []interface{}) {
+	where := []string{"i.deleted_at IS NULL"} // trashed items are never listed
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return ph(len(args))
+	}
+
+	from := "FROM items i"
+	if f.FolderID != nil {
+		from += " JOIN feeds f ON i.feed_id = f.id"
+		where = append(where, "f.folder_id = "+arg(*f.FolderID))
+	}
+	if f.FeedID != nil {
+		where = append(where, "i.feed_id = "+arg(*f.FeedID))
+	}
+	if f.OnlyUnread {
+		where = append(where, "i.is_read = FALSE")
+	}
+	if f.OnlyRead {
+		where = append(where, "i.is_read = TRUE")
+	}
+	if f.Starred {
+		where = append(where, "i.starred = TRUE")
+	}
+	if f.DeadLinks {
+		where = append(where, "EXISTS (SELECT 1 FROM item_links il WHERE il.item_id = i.id AND il.dead_since IS NOT NULL)")
+	}
+	if f.MinWords > 0 {
+		where = append(where, "i.word_count >= "+arg(f.MinWords))
+	}
+	if f.MaxWords > 0 {
+		where = append(where, "i.word_count <= "+arg(f.MaxWords))
+	}
+	if !f.Since.IsZero() {
+		where = append(where, "i.published_at >= "+arg(f.Since.UTC()))
+	}
+	if !f.Until.IsZero() {
+		where = append(where, "i.published_at < "+arg(f.Until.UTC()))
+	}
+	if !f.FetchedSince.IsZero() {
+		where = append(where, "i.fetched_at >= "+arg(f.FetchedSince.UTC()))
+	}
+	if len(f.ExcludeFolders) > 0 {
+		ids := make([]string, len(f.ExcludeFolders))
+		for n, id := range f.ExcludeFolders {
+			ids[n] = arg(id)
+		}
+		where = append(where, "i.feed_id NOT IN (SELECT id FROM feeds WHERE folder_id IN ("+strings.Join(ids, ", ")+"))")
+	}
+	// Order by (published_at, id) like the default listing, so items
+	// published at the same time as the anchor fall on the right side of it.
+	if f.OlderThan != 0 {
+		where = append(where, "(i.published_at, i.id) < (SELECT published_at, id FROM items WHERE id = "+arg(f.OlderThan)+")")
+	}
+	if f.NewerThan != 0 {
+		where = append(where, "(i.published_at, i.id) > (SELECT published_at, id FROM items WHERE id = "+arg(f.NewerThan)+")")
+	}
+	if f.Author != "" {
+		where = append(where, "LOWER(i.author_name) = LOWER("+arg(f.Author)+")")
+	}
+	if f.Domain != "" {
+		where = append(where, "i.domain = "+arg(f.Domain))
+	}
+	if f.Tag != "" {
+		where = append(where, `EXISTS (SELECT 1 FROM item_tags it JOIN tags t ON it.tag_id = t.id
+			WHERE it.item_id = i.id AND t.name = `+arg(f.Tag)+`)`)
+	}
+	if f.FeedLabel != "" {
+		where = append(where, "i.feed_id IN (SELECT feed_id FROM feed_labels WHERE label = "+arg(f.FeedLabel)+")")
+	}
+
+	from += " WHERE " + strings.Join(where, " AND ")
+	return from, args
+}
+
+// feedOrder maps a sidebar sort mode to an ORDER BY clause for feeds aliased
+// as "f", defaulting to alphabetical.
+func feedOrder(mode string) string {
+	switch mode {
+	case model.SidebarSortManual:
+		return "f.sort_order, f.title"
+	case model.SidebarSortUnread:
+		return `(SELECT COUNT(*) FROM items WHERE feed_id = f.id AND is_read = FALSE AND deleted_at IS NULL) DESC, f.title`
+	case model.SidebarSortUpdated:
+		return `(SELECT MAX(published_at) FROM items WHERE feed_id = f.id AND deleted_at IS NULL) DESC NULLS LAST, f.title`
+	default:
+		return "f.title"
+	}
+}
+
+// folderOrder maps a sidebar sort mode to an ORDER BY clause for folders
+// aliased as "fo", defaulting to alphabetical.
+func folderOrder(mode string) string {
+	switch mode {
+	case model.SidebarSortManual:
+		return "fo.sort_order, fo.name"
+	case model.SidebarSortUnread:
+		return `(SELECT COUNT(*) FROM items i JOIN feeds f ON i.feed_id = f.id
+			WHERE f.folder_id = fo.id AND i.is_read = FALSE AND i.deleted_at IS NULL) DESC, fo.name`
+	case model.SidebarSortUpdated:
+		return `(SELECT MAX(i.published_at) FROM items i JOIN feeds f ON i.feed_id = f.id
+			WHERE f.folder_id = fo.id AND i.deleted_at IS NULL) DESC NULLS LAST, fo.name`
+	default:
+		return "fo.name"
+	}
+}
+
+// itemOrder maps a sort mode to an ORDER BY clause, defaulting to newest
+// first. Ties are broken by ID, so pages of a listing don't overlap. seed
+// picks the shuffle of SortRandom, see model.ShuffleKey.
+func itemOrder(sort string, seed int64) string {
+	switch sort {
+	case model.SortOldest:
+		return "i.published_at ASC, i.id ASC"
+	case model.SortFetched:
+		return "i.fetched_at DESC, i.id DESC"
+	case model.SortRandom:
+		// XOR spelled with the AND and OR both databases have.
+		h := "(i.id % 2147483647 * 1103515245 % 2147483647)"
+		s := strconv.FormatInt(seed, 10)
+		return "((" + h + " | " + s + ") - (" + h + " & " + s + ")) % 2147483647 * 48271 % 2147483647, i.id"
+	case model.SortLongest:
+		return "i.word_count DESC, i.published_at DESC, i.id DESC"
+	case model.SortShortest:
+		return "i.word_count ASC, i.published_at DESC, i.id DESC"
+	case model.SortInterest:
+		return "i.interest_score DESC, i.published_at DESC, i.id DESC"
+	default:
+		return "i.published_at DESC, i.id DESC"
+	}
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// TestShuffleOrderMatches checks that SQLite lists items in the SortRandom
+// order of the memory store, which uses model.ShuffleKey, for IDs and seeds
+// large enough to overflow a careless key.
+func TestShuffleOrderMatches(t *testing.T) {
+	ctx := context.Background()
+	lite, err := NewSQLite(filepath.Join(t.TempDir(), "shuffle.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lite.Close()
+	mem := NewMemory()
+
+	const items = 40
+	for _, firstID := range []int64{1, 1<<31 - items/2, 1<<32 - items/2, 1 << 40} {
+		t.Run(fmt.Sprint(firstID), func(t *testing.T) {
+			for _, db := range []Store{lite, mem} {
+				feedID, err := db.CreateFeed(ctx, nil, "Feed", fmt.Sprintf("http://example.com/%d.xml", firstID))
+				if err != nil {
+					t.Fatal(err)
+				}
+				// Make both stores hand out the item IDs from firstID on.
+				if db == lite {
+					if _, err := lite.conn.Exec("DELETE FROM sqlite_sequence WHERE name = 'items'"); err != nil {
+						t.Fatal(err)
+					}
+					if _, err := lite.conn.Exec("INSERT INTO sqlite_sequence (name, seq) VALUES ('items', ?)", firstID-1); err != nil {
+						t.Fatal(err)
+					}
+				} else {
+					mem.lastID = firstID - 1
+				}
+				for i := 0; i < items; i++ {
+					id, _, err := db.AddItem(ctx, &model.Item{
+						FeedID:      feedID,
+						GUID:        fmt.Sprint(i),
+						Title:       fmt.Sprint(i),
+						PublishedAt: time.Unix(int64(i), 0),
+						FetchedAt:   time.Unix(int64(i), 0),
+					})
+					if err != nil {
+						t.Fatal(err)
+					}
+					if id != firstID+int64(i) {
+						t.Fatalf("item %d got ID %d, want %d", i, id, firstID+int64(i))
+					}
+				}
+			}
+
+			for _, seed := range []int64{0, 1, 12345, 1<<31 - 1, 1 << 31, 1<<32 - 2, model.MaxSortSeed} {
+				filter := model.ItemFilter{Sort: model.SortRandom, Seed: seed}
+				want, err := mem.QueryItems(ctx, filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := lite.QueryItems(ctx, filter)
+				if err != nil {
+					t.Fatalf("seed %d: %v", seed, err)
+				}
+				if len(got) != len(want) {
+					t.Fatalf("seed %d: SQLite listed %d items, memory %d", seed, len(got), len(want))
+				}
+				for i := range want {
+					if got[i].ID != want[i].ID {
+						t.Fatalf("seed %d: item %d is %d in SQLite, %d in memory", seed, i, got[i].ID, want[i].ID)
+					}
+				}
+			}
+		})
+	}
+}
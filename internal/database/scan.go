@@ -0,0 +1,622 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// feedColumns is the column list shared by every feed query. Queries must
+// alias the feeds table as "f".
+const feedColumns = `f.id, f.folder_id, f.title, f.url, f.icon_url, f.last_fetched, f.last_error,
+	f.site_url, f.description, f.backfill_archives, f.auto_summarize, f.inbox_token,
+	f.archive_pages, f.download_enclosures, f.ingest_categories, f.next_fetch_at,
+	f.fetch_strategy, f.last_attempted_at, f.health_score, f.embed_videos, f.notify,
+	f.last_error_status, f.last_error_class, f.error_streak, f.suggested_url, f.notes, f.transforms,
+	COALESCE((SELECT fi.emoji FROM feed_icons fi WHERE fi.feed_id = f.id), ''),
+	EXISTS (SELECT 1 FROM feed_icons fi WHERE fi.feed_id = f.id AND fi.content_type <> ''),
+	(SELECT COUNT(*) FROM items ui WHERE ui.feed_id = f.id AND ui.is_read = FALSE AND ui.deleted_at IS NULL)`
+
+// itemColumns is the column list shared by every item query. Queries must
+// alias the items table as "i".
+const itemColumns = `i.id, i.feed_id, i.guid, i.title, i.content, i.link, i.author_name, i.author_email,
+	i.published_at, i.fetched_at, i.is_read,
+	i.note, i.word_count, i.reading_time, i.summary, i.interest_score, i.starred,
+	EXISTS (SELECT 1 FROM item_archives ia WHERE ia.item_id = i.id), i.wayback_url, i.enclosure_url, i.enclosure_type,
+	COALESCE((SELECT im.status FROM item_media im WHERE im.item_id = i.id), ''), i.comments_url, i.comments_feed, i.domain,
+	i.snippet, COALESCE(i.read_position, 0), COALESCE(i.raw_title, ''),
+	EXISTS (SELECT 1 FROM item_links il WHERE il.item_id = i.id AND il.dead_since IS NOT NULL)`
+
+// bulkItemColumns are the item columns AddItems stores, in the order of
+// bulkItemValues.
+var bulkItemColumns = []string{"feed_id", "guid", "title", "content", "link", "published_at", "fetched_at",
+	"is_read", "read_at", "word_count", "reading_time", "enclosure_url", "enclosure_type", "author_name",
+	"author_email", "comments_url", "comments_feed", "domain", "snippet", "raw_title", "note", "summary",
+	"wayback_url"}
+
+// bulkItemValues returns the values of bulkItemColumns for an item added at
+// now. Read items count as read at now.
+func bulkItemValues(it model.Item, now time.Time) []interface{} {
+	var readAt interface{}
+	if it.IsRead {
+		readAt = now
+	}
+	return []interface{}{it.FeedID, it.GUID, it.Title, it.Content, it.Link, it.PublishedAt, it.FetchedAt,
+		it.IsRead, readAt, it.WordCount, it.ReadingTime, it.EnclosureURL, it.EnclosureType, it.AuthorName,
+		it.AuthorEmail, it.CommentsURL, it.CommentsFeed, model.LinkDomain(it.Link), it.Snippet, it.RawTitle, it.Note, it.Summary,
+		it.WaybackURL}
+}
+
+// itemKey identifies an item by its feed and GUID, which are unique together.
+type itemKey struct {
+	feedID int64
+	guid   string
+}
+
+// scanAddedItems reads the id, feed_id and guid rows returned by a bulk
+// insert into ids, at the index at records for each item.
+func scanAddedItems(rows *sql.Rows, at map[itemKey]int, ids []int64) error {
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var k itemKey
+		if err := rows.Scan(&id, &k.feedID, &k.guid); err != nil {
+			return err
+		}
+		if n, ok := at[k]; ok {
+			ids[n] = id
+		}
+	}
+	return rows.Err()
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanFeed scans a single feed selected with feedColumns. Any extra
+// destinations are scanned after the feed columns.
+func scanFeed(rs rowScanner, extra ...interface{}) (model.Feed, error) {
+	var f model.Feed
+	var lastFetched, lastAttempted, nextFetch sql.NullTime
+	var healthScore, lastErrorStatus, errorStreak sql.NullInt64
+	var lastError, lastErrorClass, suggestedURL, notes, transforms, siteURL, description, inboxToken, fetchStrategy sql.NullString
+	dest := []interface{}{&f.ID, &f.FolderID, &f.Title, &f.URL, &f.IconURL, &lastFetched, &lastError,
+		&siteURL, &description, &f.BackfillArchives, &f.AutoSummarize, &inboxToken,
+		&f.ArchivePages, &f.DownloadEnclosures, &f.IngestCategories, &nextFetch,
+		&fetchStrategy, &lastAttempted, &healthScore, &f.EmbedVideos, &f.Notify, &lastErrorStatus, &lastErrorClass,
+		&errorStreak, &suggestedURL, &notes, &transforms, &f.IconEmoji, &f.CustomIcon, &f.UnreadCount}
+	if err := rs.Scan(append(dest, extra...)...); err != nil {
+		return f, err
+	}
+	if lastFetched.Valid {
+		f.LastSuccess = lastFetched.Time
+	}
+	if lastAttempted.Valid {
+		f.LastAttempt = lastAttempted.Time
+	}
+	if nextFetch.Valid {
+		f.NextFetch = nextFetch.Time
+	}
+	if healthScore.Valid {
+		f.HealthScore = int(healthScore.Int64)
+		f.HealthGrade = model.HealthGrade(f.HealthScore)
+	}
+	f.LastError = lastError.String
+	f.LastErrorStatus = int(lastErrorStatus.Int64)
+	f.LastErrorClass = lastErrorClass.String
+	f.ErrorStreak = int(errorStreak.Int64)
+	f.SuggestedURL = suggestedURL.String
+	f.Notes = notes.String
+	if transforms.String != "" {
+		// Stored transforms were validated; a malformed list applies none.
+		_ = json.Unmarshal([]byte(transforms.String), &f.Transforms)
+	}
+	f.SiteURL = siteURL.String
+	f.Description = description.String
+	f.InboxToken = inboxToken.String
+	f.FetchStrategy = fetchStrategy.String
+	return f, nil
+}
+
+// encodeTransforms returns the stored form of a feed's content transforms,
+// empty if it has none.
+func encodeTransforms(ts []model.ContentTransform) string {
+	if len(ts) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(ts)
+	return string(data)
+}
+
+// scanFeeds scans all rows selected with feedColumns. When withCount is set,
+// each row is expected to carry a trailing item count column.
+func scanFeeds(rows *sql.Rows, withCount bool) ([]model.Feed, error) {
+	var feeds []model.Feed
+	for rows.Next() {
+		var count int
+		var extra []interface{}
+		if withCount {
+			extra = append(extra, &count)
+		}
+		f, err := scanFeed(rows, extra...)
+		if err != nil {
+			return nil, err
+		}
+		f.ItemCount = count
+		feeds = append(feeds, f)
+	}
+	return feeds, rows.Err()
+}
+
+// scanLinkCheck scans a row of item_links.
+func scanLinkCheck(row rowScanner) (*model.LinkCheck, error) {
+	var c model.LinkCheck
+	var deadSince sql.NullTime
+	if err := row.Scan(&c.ItemID, &c.Status, &c.Error, &c.Failures, &deadSince, &c.CheckedAt, &c.NextCheckAt); err != nil {
+		return nil, err
+	}
+	if deadSince.Valid {
+		c.DeadSince = deadSince.Time
+	}
+	return &c, nil
+}
+
+// scanItems scans all rows selected with itemColumns.
+func scanItems(rows *sql.Rows) ([]model.Item, error) {
+	var items []model.Item
+	for rows.Next() {
+		it, err := scanItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+// scanItem scans a single item selected with itemColumns. Any extra
+// destinations are scanned after the item columns.
+func scanItem(rs rowScanner, extra ...interface{}) (model.Item, error) {
+	var it model.Item
+	var publishedAt, fetchedAt sql.NullTime
+	var content, link, authorName, authorEmail, note, summary, waybackURL, enclosureURL, enclosureType sql.NullString
+	var commentsURL, commentsFeed, domain, snippet sql.NullString
+	dest := []interface{}{&it.ID, &it.FeedID, &it.GUID, &it.Title, &content, &link, &authorName, &authorEmail,
+		&publishedAt, &fetchedAt, &it.IsRead,
+		&note, &it.WordCount, &it.ReadingTime, &summary, &it.InterestScore, &it.Starred,
+		&it.Archived, &waybackURL, &enclosureURL, &enclosureType, &it.MediaStatus, &commentsURL, &commentsFeed, &domain,
+		&snippet, &it.ReadPosition, &it.RawTitle, &it.LinkDead}
+	if err := rs.Scan(append(dest, extra...)...); err != nil {
+		return it, err
+	}
+	it.Content = content.String
+	it.Link = link.String
+	it.AuthorName = authorName.String
+	it.AuthorEmail = authorEmail.String
+	it.Note = note.String
+	it.Summary = summary.String
+	it.WaybackURL = waybackURL.String
+	it.EnclosureURL = enclosureURL.String
+	it.EnclosureType = enclosureType.String
+	it.CommentsURL = commentsURL.String
+	it.CommentsFeed = commentsFeed.String
+	it.Domain = domain.String
+	it.Snippet = snippet.String
+	if publishedAt.Valid {
+		it.PublishedAt = publishedAt.Time
+	}
+	if fetchedAt.Valid {
+		it.FetchedAt = fetchedAt.Time
+	}
+	return it, nil
+}
+
+// scanTrashedFeeds scans rows selected with feedColumns followed by the
+// deletion time and an item count.
+func scanTrashedFeeds(rows *sql.Rows) ([]model.TrashedFeed, error) {
+	var feeds []model.TrashedFeed
+	for rows.Next() {
+		var deletedAt time.Time
+		var count int
+		f, err := scanFeed(rows, &deletedAt, &count)
+		if err != nil {
+			return nil, err
+		}
+		f.ItemCount = count
+		feeds = append(feeds, model.TrashedFeed{Feed: f, DeletedAt: deletedAt})
+	}
+	return feeds, rows.Err()
+}
+
+// scanTrashedItems scans rows selected with itemColumns followed by the
+// deletion time.
+func scanTrashedItems(rows *sql.Rows) ([]model.TrashedItem, error) {
+	var items []model.TrashedItem
+	for rows.Next() {
+		var deletedAt time.Time
+		it, err := scanItem(rows, &deletedAt)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, model.TrashedItem{Item: it, DeletedAt: deletedAt})
+	}
+	return items, rows.Err()
+}
+
+// queryFetchStats summarizes the fetch log by feed, for either backend.
+func queryFetchStats(ctx context.Context, conn *sql.DB) ([]model.FetchStats, error) {
+	// The newest item is joined rather than selected with MAX so that its
+	// time scans as a column of the items table.
+	rows, err := conn.QueryContext(ctx, `SELECT f.id,
+		(SELECT COUNT(*) FROM fetch_log fl WHERE fl.feed_id = f.id),
+		(SELECT COUNT(*) FROM fetch_log fl WHERE fl.feed_id = f.id AND fl.ok = TRUE),
+		COALESCE((SELECT AVG(fl.duration_ms) FROM fetch_log fl WHERE fl.feed_id = f.id AND fl.ok = TRUE), 0),
+		i.published_at
+		FROM feeds f
+		LEFT JOIN items i ON i.id = (SELECT i2.id FROM items i2 WHERE i2.feed_id = f.id AND i2.deleted_at IS NULL ORDER BY i2.published_at DESC, i2.id DESC LIMIT 1)
+		WHERE f.deleted_at IS NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var stats []model.FetchStats
+	for rows.Next() {
+		var s model.FetchStats
+		var avgMillis float64
+		var published sql.NullTime
+		if err := rows.Scan(&s.FeedID, &s.Attempts, &s.Successes, &avgMillis, &published); err != nil {
+			return nil, err
+		}
+		s.AvgDuration = time.Duration(avgMillis * float64(time.Millisecond))
+		if published.Valid {
+			s.LastPublished = published.Time
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// queryFeedTags implements GetFeedTags for the SQL stores.
+func queryFeedTags(ctx context.Context, conn *sql.DB, perFeed int) (map[int64][]string, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT i.feed_id, t.name FROM item_tags it
+		JOIN items i ON i.id = it.item_id AND i.deleted_at IS NULL
+		JOIN tags t ON t.id = it.tag_id
+		GROUP BY i.feed_id, t.name
+		ORDER BY i.feed_id, COUNT(*) DESC, t.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := make(map[int64][]string)
+	for rows.Next() {
+		var feedID int64
+		var name string
+		if err := rows.Scan(&feedID, &name); err != nil {
+			return nil, err
+		}
+		if len(tags[feedID]) < perFeed {
+			tags[feedID] = append(tags[feedID], name)
+		}
+	}
+	return tags, rows.Err()
+}
+
+// setFeedLabels implements SetFeedLabels for the SQL stores.
+func setFeedLabels(ctx context.Context, conn *sql.DB, feedID int64, labels []string, ph placeholderFunc) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM feed_labels WHERE feed_id = "+ph(1), feedID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, label := range labels {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO feed_labels (feed_id, label) VALUES ("+ph(1)+", "+ph(2)+
+			") ON CONFLICT DO NOTHING", feedID, label); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// queryFeedLabels implements GetFeedLabels for the SQL stores.
+func queryFeedLabels(ctx context.Context, conn *sql.DB) (map[int64][]string, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT fl.feed_id, fl.label FROM feed_labels fl
+		JOIN feeds f ON f.id = fl.feed_id AND f.deleted_at IS NULL
+		ORDER BY fl.feed_id, fl.label`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	labels := make(map[int64][]string)
+	for rows.Next() {
+		var feedID int64
+		var label string
+		if err := rows.Scan(&feedID, &label); err != nil {
+			return nil, err
+		}
+		labels[feedID] = append(labels[feedID], label)
+	}
+	return labels, rows.Err()
+}
+
+// queryReadActivity implements GetReadActivity for the SQL stores.
+func queryReadActivity(ctx context.Context, conn *sql.DB, since time.Time, ph placeholderFunc) ([]model.ItemActivity, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT feed_id, fetched_at, read_at FROM items
+		WHERE read_at >= `+ph(1)+` OR (is_read = FALSE AND deleted_at IS NULL)`, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var acts []model.ItemActivity
+	for rows.Next() {
+		var a model.ItemActivity
+		var readAt sql.NullTime
+		if err := rows.Scan(&a.FeedID, &a.FetchedAt, &readAt); err != nil {
+			return nil, err
+		}
+		if readAt.Valid {
+			a.ReadAt = &readAt.Time
+		}
+		acts = append(acts, a)
+	}
+	return acts, rows.Err()
+}
+
+// saveItemEnclosures implements SetItemEnclosures for the SQL stores.
+func saveItemEnclosures(ctx context.Context, conn *sql.DB, itemID int64, encs []model.Enclosure, ph placeholderFunc) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM item_enclosures WHERE item_id = "+ph(1), itemID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for n, e := range encs {
+		_, err := tx.ExecContext(ctx, `INSERT INTO item_enclosures (item_id, position, url, type, medium, size, duration, thumbnail)
+			VALUES (`+ph(1)+`, `+ph(2)+`, `+ph(3)+`, `+ph(4)+`, `+ph(5)+`, `+ph(6)+`, `+ph(7)+`, `+ph(8)+`)`,
+			itemID, n, e.URL, e.Type, e.Medium, e.Size, e.Duration, e.Thumbnail)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// queryItemEnclosures implements GetItemEnclosures for the SQL stores.
+func queryItemEnclosures(ctx context.Context, conn *sql.DB, itemIDs []int64, ph placeholderFunc) (map[int64][]model.Enclosure, error) {
+	encs := make(map[int64][]model.Enclosure)
+	if len(itemIDs) == 0 {
+		return encs, nil
+	}
+	ids := make([]string, len(itemIDs))
+	args := make([]interface{}, len(itemIDs))
+	for n, id := range itemIDs {
+		ids[n] = ph(n + 1)
+		args[n] = id
+	}
+	rows, err := conn.QueryContext(ctx, `SELECT item_id, url, type, medium, size, duration, thumbnail FROM item_enclosures
+		WHERE item_id IN (`+strings.Join(ids, ", ")+`) ORDER BY item_id, position`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var itemID int64
+		var e model.Enclosure
+		if err := rows.Scan(&itemID, &e.URL, &e.Type, &e.Medium, &e.Size, &e.Duration, &e.Thumbnail); err != nil {
+			return nil, err
+		}
+		encs[itemID] = append(encs[itemID], e)
+	}
+	return encs, rows.Err()
+}
+
+// backfillItemDomains derives the domain of the items stored before
+// domains were recorded, whose domain is NULL.
+func backfillItemDomains(conn *sql.DB, ph placeholderFunc) error {
+	rows, err := conn.Query("SELECT id, COALESCE(link, '') FROM items WHERE domain IS NULL")
+	if err != nil {
+		return err
+	}
+	links := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var link string
+		if err := rows.Scan(&id, &link); err != nil {
+			rows.Close()
+			return err
+		}
+		links[id] = link
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(links) == 0 {
+		return err
+	}
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare("UPDATE items SET domain = " + ph(1) + " WHERE id = " + ph(2))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for id, link := range links {
+		if _, err := stmt.Exec(model.LinkDomain(link), id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// queryDomains implements GetDomains for the SQL stores.
+func queryDomains(ctx context.Context, conn *sql.DB, query string, limit int, ph placeholderFunc) ([]model.Domain, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT domain, COUNT(*), COUNT(DISTINCT feed_id) FROM items
+		WHERE domain != '' AND deleted_at IS NULL AND domain LIKE `+ph(1)+`
+		GROUP BY domain ORDER BY COUNT(*) DESC, domain LIMIT `+ph(2),
+		"%"+strings.ToLower(query)+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var domains []model.Domain
+	for rows.Next() {
+		var d model.Domain
+		if err := rows.Scan(&d.Name, &d.ItemCount, &d.FeedCount); err != nil {
+			return nil, err
+		}
+		domains = append(domains, d)
+	}
+	return domains, rows.Err()
+}
+
+const jobColumns = `id, kind, state, payload, result, error, done, total, attempts,
+	created_at, started_at, updated_at, finished_at`
+
+// scanJob scans a single job selected with jobColumns.
+func scanJob(rs rowScanner) (model.Job, error) {
+	var j model.Job
+	var startedAt, finishedAt sql.NullTime
+	err := rs.Scan(&j.ID, &j.Kind, &j.State, &j.Payload, &j.Result, &j.Error, &j.Done, &j.Total, &j.Attempts,
+		&j.CreatedAt, &startedAt, &j.UpdatedAt, &finishedAt)
+	if err != nil {
+		return j, err
+	}
+	if startedAt.Valid {
+		j.StartedAt = startedAt.Time
+	}
+	if finishedAt.Valid {
+		j.FinishedAt = finishedAt.Time
+	}
+	return j, nil
+}
+
+// queryJobs runs a query selecting jobColumns and scans the jobs.
+func queryJobs(ctx context.Context, conn *sql.DB, query string, args ...interface{}) ([]model.Job, error) {
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var jobs []model.Job
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// getJob implements GetJob for the SQL stores.
+func getJob(ctx context.Context, conn *sql.DB, jobID int64, ph placeholderFunc) (*model.Job, error) {
+	j, err := scanJob(conn.QueryRowContext(ctx, "SELECT "+jobColumns+" FROM jobs WHERE id = "+ph(1), jobID))
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// updateJob implements UpdateJob for the SQL stores.
+func updateJob(ctx context.Context, conn *sql.DB, j *model.Job, ph placeholderFunc) error {
+	_, err := conn.ExecContext(ctx, `UPDATE jobs SET state = `+ph(1)+`, result = `+ph(2)+`, error = `+ph(3)+`,
+		done = `+ph(4)+`, total = `+ph(5)+`, attempts = `+ph(6)+`, started_at = `+ph(7)+`,
+		updated_at = `+ph(8)+`, finished_at = `+ph(9)+` WHERE id = `+ph(10),
+		j.State, j.Result, j.Error, j.Done, j.Total, j.Attempts,
+		sql.NullTime{Time: j.StartedAt.UTC(), Valid: !j.StartedAt.IsZero()}, j.UpdatedAt.UTC(),
+		sql.NullTime{Time: j.FinishedAt.UTC(), Valid: !j.FinishedAt.IsZero()}, j.ID)
+	return err
+}
+
+// claimJob implements ClaimJob for the SQL stores.
+func claimJob(ctx context.Context, conn *sql.DB, jobID int64, stale, now time.Time, ph placeholderFunc) (bool, error) {
+	res, err := conn.ExecContext(ctx, `UPDATE jobs SET attempts = attempts + 1, started_at = `+ph(1)+`, updated_at = `+ph(2)+`
+		WHERE id = `+ph(3)+` AND state = `+ph(4)+` AND updated_at < `+ph(5),
+		now.UTC(), now.UTC(), jobID, model.JobRunning, stale.UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// setItemPosition implements SetItemPosition for the SQL stores.
+func setItemPosition(ctx context.Context, conn *sql.DB, itemID int64, percent float64, ph placeholderFunc) error {
+	res, err := conn.ExecContext(ctx, "UPDATE items SET read_position = "+ph(1)+" WHERE id = "+ph(2)+" AND deleted_at IS NULL", percent, itemID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// queryStorage counts the items of the SQL stores, overall and by feed, and
+// sums the bytes of text each feed's items store. The caller fills in the
+// database and table sizes.
+func queryStorage(ctx context.Context, conn *sql.DB, octets octetsFunc) (*model.StorageReport, error) {
+	report := &model.StorageReport{Tables: []model.TableSize{}, Feeds: []model.FeedStorage{}}
+	err := conn.QueryRowContext(ctx, `SELECT COUNT(*), COUNT(deleted_at) FROM items`).
+		Scan(&report.Items, &report.TrashedItems)
+	if err != nil {
+		return nil, err
+	}
+
+	var size []string
+	for _, col := range []string{"i.title", "i.content", "i.summary", "i.snippet", "i.note", "a.html"} {
+		size = append(size, "COALESCE("+octets(col)+", 0)")
+	}
+	rows, err := conn.QueryContext(ctx, `SELECT f.id, f.title, COUNT(i.id), COUNT(i.deleted_at),
+		CAST(COALESCE(SUM(`+strings.Join(size, " + ")+`), 0) AS BIGINT) AS bytes
+		FROM feeds f
+		LEFT JOIN items i ON i.feed_id = f.id
+		LEFT JOIN item_archives a ON a.item_id = i.id
+		GROUP BY f.id, f.title
+		ORDER BY bytes DESC, f.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var fs model.FeedStorage
+		if err := rows.Scan(&fs.FeedID, &fs.Title, &fs.Items, &fs.TrashedItems, &fs.Bytes); err != nil {
+			return nil, err
+		}
+		report.Feeds = append(report.Feeds, fs)
+	}
+	return report, rows.Err()
+}
+
+// queryTableSizes scans the rows of a query listing table names and sizes.
+func queryTableSizes(ctx context.Context, q sqlQueryer, query string) ([]model.TableSize, error) {
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tables := []model.TableSize{}
+	for rows.Next() {
+		var t model.TableSize
+		if err := rows.Scan(&t.Name, &t.Bytes); err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
@@ -2,8 +2,11 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/bryan-buckman/infovore/internal/model"
@@ -20,7 +23,13 @@ var _ Store = (*SQLiteStore)(nil)
 
 // NewSQLite opens or creates an SQLite database at the given path.
 func NewSQLite(path string) (*SQLiteStore, error) {
-	conn, err := sql.Open("sqlite", path)
+	// Wait up to 5 seconds when the database is locked. The timeout goes in
+	// the DSN so that every pooled connection gets it, not just the first.
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	conn, err := sql.Open("sqlite", path+sep+"_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, fmt.Errorf("open db: %w", err)
 	}
@@ -34,11 +43,6 @@ func NewSQLite(path string) (*SQLiteStore, error) {
 		conn.Close()
 		return nil, fmt.Errorf("set wal mode: %w", err)
 	}
-	// Set busy timeout to wait up to 5 seconds when database is locked.
-	if _, err := conn.Exec("PRAGMA busy_timeout=5000;"); err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("set busy timeout: %w", err)
-	}
 	db := &SQLiteStore{conn: conn}
 	if err := db.migrate(); err != nil {
 		conn.Close()
@@ -67,7 +71,8 @@ func (db *SQLiteStore) migrate() error {
 	CREATE TABLE IF NOT EXISTS folders (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		name TEXT NOT NULL,
-		parent_id INTEGER REFERENCES folders(id)
+		parent_id INTEGER REFERENCES folders(id),
+		sort_order INTEGER DEFAULT 0
 	);
 	CREATE TABLE IF NOT EXISTS feeds (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -76,7 +81,29 @@ func (db *SQLiteStore) migrate() error {
 		url TEXT NOT NULL UNIQUE,
 		icon_url TEXT DEFAULT '',
 		last_fetched DATETIME,
-		last_error TEXT DEFAULT ''
+		last_error TEXT DEFAULT '',
+		last_error_status INTEGER DEFAULT 0,
+		last_error_class TEXT DEFAULT '',
+		error_streak INTEGER DEFAULT 0,
+		suggested_url TEXT DEFAULT '',
+		notes TEXT DEFAULT '',
+		transforms TEXT DEFAULT '',
+		site_url TEXT DEFAULT '',
+		description TEXT DEFAULT '',
+		backfill_archives INTEGER DEFAULT 0,
+		auto_summarize INTEGER DEFAULT 0,
+		inbox_token TEXT DEFAULT '',
+		deleted_at DATETIME,
+		sort_order INTEGER DEFAULT 0,
+		archive_pages INTEGER DEFAULT 0,
+		download_enclosures INTEGER DEFAULT 0,
+		ingest_categories INTEGER DEFAULT 0,
+		embed_videos INTEGER DEFAULT 0,
+		notify INTEGER DEFAULT 0,
+		next_fetch_at DATETIME,
+		fetch_strategy TEXT DEFAULT '',
+		last_attempted_at DATETIME,
+		health_score INTEGER
 	);
 	CREATE TABLE IF NOT EXISTS items (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -88,8 +115,124 @@ func (db *SQLiteStore) migrate() error {
 		published_at DATETIME,
 		fetched_at DATETIME NOT NULL,
 		is_read INTEGER DEFAULT 0,
+		note TEXT DEFAULT '',
+		word_count INTEGER DEFAULT 0,
+		reading_time INTEGER DEFAULT 0,
+		summary TEXT DEFAULT '',
+		opened INTEGER DEFAULT 0,
+		interest_score REAL DEFAULT 0,
+		deleted_at DATETIME,
+		starred INTEGER DEFAULT 0,
+		wayback_url TEXT DEFAULT '',
+		enclosure_url TEXT DEFAULT '',
+		enclosure_type TEXT DEFAULT '',
+		comments_url TEXT DEFAULT '',
+		comments_feed TEXT DEFAULT '',
+		author_name TEXT DEFAULT '',
+		author_email TEXT DEFAULT '',
+		read_at DATETIME,
+		domain TEXT,
+		snippet TEXT DEFAULT '',
+		read_position REAL DEFAULT 0,
+		raw_title TEXT DEFAULT '',
 		UNIQUE(feed_id, guid)
 	);
+	CREATE TABLE IF NOT EXISTS tags (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE
+	);
+	CREATE TABLE IF NOT EXISTS item_tags (
+		item_id INTEGER NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+		tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+		PRIMARY KEY (item_id, tag_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_item_tags_tag_id ON item_tags(tag_id);
+	CREATE TABLE IF NOT EXISTS feed_labels (
+		feed_id INTEGER NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+		label TEXT NOT NULL,
+		PRIMARY KEY (feed_id, label)
+	);
+	CREATE INDEX IF NOT EXISTS idx_feed_labels_label ON feed_labels(label);
+	CREATE TABLE IF NOT EXISTS item_archives (
+		item_id INTEGER PRIMARY KEY REFERENCES items(id) ON DELETE CASCADE,
+		url TEXT NOT NULL,
+		title TEXT DEFAULT '',
+		html TEXT NOT NULL,
+		fetched_at DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS item_media (
+		item_id INTEGER PRIMARY KEY REFERENCES items(id) ON DELETE CASCADE,
+		status TEXT NOT NULL,
+		file TEXT DEFAULT '',
+		size BIGINT DEFAULT 0,
+		error TEXT DEFAULT '',
+		updated_at DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS item_links (
+		item_id INTEGER PRIMARY KEY REFERENCES items(id) ON DELETE CASCADE,
+		status INTEGER DEFAULT 0,
+		error TEXT DEFAULT '',
+		failures INTEGER DEFAULT 0,
+		dead_since DATETIME,
+		checked_at DATETIME NOT NULL,
+		next_check_at DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS item_enclosures (
+		item_id INTEGER NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		url TEXT NOT NULL,
+		type TEXT DEFAULT '',
+		medium TEXT DEFAULT '',
+		size BIGINT DEFAULT 0,
+		duration INTEGER DEFAULT 0,
+		thumbnail TEXT DEFAULT '',
+		PRIMARY KEY (item_id, position)
+	);
+	CREATE TABLE IF NOT EXISTS feed_icons (
+		feed_id INTEGER PRIMARY KEY REFERENCES feeds(id) ON DELETE CASCADE,
+		emoji TEXT DEFAULT '',
+		content_type TEXT DEFAULT '',
+		data BLOB,
+		updated_at DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS fetch_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		feed_id INTEGER NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+		fetched_at DATETIME NOT NULL,
+		ok INTEGER NOT NULL,
+		duration_ms INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_fetch_log_feed_id ON fetch_log(feed_id);
+	CREATE TABLE IF NOT EXISTS interest_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		feed_id INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		positive INTEGER NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		actor TEXT NOT NULL,
+		action TEXT NOT NULL,
+		target TEXT NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		state TEXT NOT NULL,
+		payload TEXT NOT NULL DEFAULT '',
+		result TEXT NOT NULL DEFAULT '',
+		error TEXT NOT NULL DEFAULT '',
+		done INTEGER NOT NULL DEFAULT 0,
+		total INTEGER NOT NULL DEFAULT 0,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL,
+		started_at DATETIME,
+		updated_at DATETIME NOT NULL,
+		finished_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_jobs_state ON jobs(state);
 	CREATE TABLE IF NOT EXISTS settings (
 		key TEXT PRIMARY KEY,
 		value TEXT NOT NULL
@@ -102,14 +245,93 @@ func (db *SQLiteStore) migrate() error {
 	}
 	// Migration: add last_error column if it doesn't exist.
 	_, _ = db.conn.Exec("ALTER TABLE feeds ADD COLUMN last_error TEXT DEFAULT ''")
-	return nil
+	// Migration: add feed metadata columns.
+	_, _ = db.conn.Exec("ALTER TABLE feeds ADD COLUMN site_url TEXT DEFAULT ''")
+	_, _ = db.conn.Exec("ALTER TABLE feeds ADD COLUMN description TEXT DEFAULT ''")
+	_, _ = db.conn.Exec("ALTER TABLE feeds ADD COLUMN backfill_archives INTEGER DEFAULT 0")
+	// Migration: add item notes.
+	_, _ = db.conn.Exec("ALTER TABLE items ADD COLUMN note TEXT DEFAULT ''")
+	// Migration: add length statistics.
+	_, _ = db.conn.Exec("ALTER TABLE items ADD COLUMN word_count INTEGER DEFAULT 0")
+	_, _ = db.conn.Exec("ALTER TABLE items ADD COLUMN reading_time INTEGER DEFAULT 0")
+	// Migration: add LLM summaries.
+	_, _ = db.conn.Exec("ALTER TABLE feeds ADD COLUMN auto_summarize INTEGER DEFAULT 0")
+	_, _ = db.conn.Exec("ALTER TABLE items ADD COLUMN summary TEXT DEFAULT ''")
+	// Migration: add interest ranking.
+	_, _ = db.conn.Exec("ALTER TABLE items ADD COLUMN opened INTEGER DEFAULT 0")
+	_, _ = db.conn.Exec("ALTER TABLE items ADD COLUMN interest_score REAL DEFAULT 0")
+	// Migration: add virtual inbox feeds.
+	_, _ = db.conn.Exec("ALTER TABLE feeds ADD COLUMN inbox_token TEXT DEFAULT ''")
+	// Migration: add the trash.
+	_, _ = db.conn.Exec("ALTER TABLE feeds ADD COLUMN deleted_at DATETIME")
+	_, _ = db.conn.Exec("ALTER TABLE items ADD COLUMN deleted_at DATETIME")
+	// Migration: add manual sidebar ordering.
+	_, _ = db.conn.Exec("ALTER TABLE folders ADD COLUMN sort_order INTEGER DEFAULT 0")
+	_, _ = db.conn.Exec("ALTER TABLE feeds ADD COLUMN sort_order INTEGER DEFAULT 0")
+	// Migration: add starred items.
+	_, _ = db.conn.Exec("ALTER TABLE items ADD COLUMN starred INTEGER DEFAULT 0")
+	// Migration: add page archiving.
+	_, _ = db.conn.Exec("ALTER TABLE feeds ADD COLUMN archive_pages INTEGER DEFAULT 0")
+	// Migration: add Wayback Machine captures.
+	_, _ = db.conn.Exec("ALTER TABLE items ADD COLUMN wayback_url TEXT DEFAULT ''")
+	// Migration: add enclosure downloads.
+	_, _ = db.conn.Exec("ALTER TABLE items ADD COLUMN enclosure_url TEXT DEFAULT ''")
+	_, _ = db.conn.Exec("ALTER TABLE items ADD COLUMN enclosure_type TEXT DEFAULT ''")
+	_, _ = db.conn.Exec("ALTER TABLE items ADD COLUMN comments_url TEXT DEFAULT ''")
+	_, _ = db.conn.Exec("ALTER TABLE items ADD COLUMN comments_feed TEXT DEFAULT ''")
+	_, _ = db.conn.Exec("ALTER TABLE feeds ADD COLUMN download_enclosures INTEGER DEFAULT 0")
+
+	// Migration: Add ingest_categories column if it doesn't exist
+	_, _ = db.conn.Exec("ALTER TABLE feeds ADD COLUMN ingest_categories INTEGER DEFAULT 0")
+	_, _ = db.conn.Exec("ALTER TABLE feeds ADD COLUMN embed_videos INTEGER DEFAULT 0")
+	// Migration: flag feeds that send push notifications.
+	_, _ = db.conn.Exec("ALTER TABLE feeds ADD COLUMN notify INTEGER DEFAULT 0")
+
+	// Migration: Add next_fetch_at column if it doesn't exist
+	_, _ = db.conn.Exec("ALTER TABLE feeds ADD COLUMN next_fetch_at DATETIME")
+
+	// Migration: Add fetch_strategy column if it doesn't exist
+	_, _ = db.conn.Exec("ALTER TABLE feeds ADD COLUMN fetch_strategy TEXT DEFAULT ''")
+	// Migration: add item authors.
+	_, _ = db.conn.Exec("ALTER TABLE items ADD COLUMN author_name TEXT DEFAULT ''")
+	_, _ = db.conn.Exec("ALTER TABLE items ADD COLUMN author_email TEXT DEFAULT ''")
+	_, _ = db.conn.Exec("CREATE INDEX IF NOT EXISTS idx_items_author_name ON items(LOWER(author_name))")
+	// Migration: track fetch attempts apart from successes (last_fetched).
+	if _, err := db.conn.Exec("ALTER TABLE feeds ADD COLUMN last_attempted_at DATETIME"); err == nil {
+		_, _ = db.conn.Exec("UPDATE feeds SET last_attempted_at = last_fetched")
+	}
+	// Migration: add feed health grades.
+	_, _ = db.conn.Exec("ALTER TABLE feeds ADD COLUMN health_score INTEGER")
+	// Migration: record when items are read, for reading statistics.
+	_, _ = db.conn.Exec("ALTER TABLE items ADD COLUMN read_at DATETIME")
+	_, _ = db.conn.Exec("CREATE INDEX IF NOT EXISTS idx_items_read_at ON items(read_at)")
+	// Migration: record the site each item links to.
+	_, _ = db.conn.Exec("ALTER TABLE items ADD COLUMN domain TEXT")
+	_, _ = db.conn.Exec("CREATE INDEX IF NOT EXISTS idx_items_domain ON items(domain)")
+	// Migration: store item snippets for lists.
+	_, _ = db.conn.Exec("ALTER TABLE items ADD COLUMN snippet TEXT DEFAULT ''")
+	// Migration: record the HTTP status and kind of fetch errors.
+	_, _ = db.conn.Exec("ALTER TABLE feeds ADD COLUMN last_error_status INTEGER DEFAULT 0")
+	_, _ = db.conn.Exec("ALTER TABLE feeds ADD COLUMN last_error_class TEXT DEFAULT ''")
+	// Migration: count failed fetches in a row and keep rediscovered feed URLs.
+	_, _ = db.conn.Exec("ALTER TABLE feeds ADD COLUMN error_streak INTEGER DEFAULT 0")
+	_, _ = db.conn.Exec("ALTER TABLE feeds ADD COLUMN suggested_url TEXT DEFAULT ''")
+	// Migration: remember how far long items have been read.
+	_, _ = db.conn.Exec("ALTER TABLE items ADD COLUMN read_position REAL DEFAULT 0")
+	// Migration: add feed notes.
+	_, _ = db.conn.Exec("ALTER TABLE feeds ADD COLUMN notes TEXT DEFAULT ''")
+	// Migration: keep feed titles that were normalized at ingest.
+	_, _ = db.conn.Exec("ALTER TABLE items ADD COLUMN raw_title TEXT DEFAULT ''")
+	// Migration: add per-feed content transforms.
+	_, _ = db.conn.Exec("ALTER TABLE feeds ADD COLUMN transforms TEXT DEFAULT ''")
+	return backfillItemDomains(db.conn, sqlitePlaceholder)
 }
 
 // --- Folder Methods ---
 
 // GetFolders returns all folders ordered by name.
-func (db *SQLiteStore) GetFolders() ([]model.Folder, error) {
-	rows, err := db.conn.Query("SELECT id, name, parent_id FROM folders ORDER BY name")
+func (db *SQLiteStore) GetFolders(ctx context.Context) ([]model.Folder, error) {
+	rows, err := db.conn.QueryContext(ctx, "SELECT fo.id, fo.name, fo.parent_id FROM folders fo ORDER BY "+folderOrder(folderSort(ctx, db)))
 	if err != nil {
 		return nil, err
 	}
@@ -126,8 +348,8 @@ func (db *SQLiteStore) GetFolders() ([]model.Folder, error) {
 }
 
 // CreateFolder creates a new folder. Returns the ID.
-func (db *SQLiteStore) CreateFolder(name string, parentID *int64) (int64, error) {
-	res, err := db.conn.Exec("INSERT INTO folders (name, parent_id) VALUES (?, ?)", name, parentID)
+func (db *SQLiteStore) CreateFolder(ctx context.Context, name string, parentID *int64) (int64, error) {
+	res, err := db.conn.ExecContext(ctx, "INSERT INTO folders (name, parent_id) VALUES (?, ?)", name, parentID)
 	if err != nil {
 		return 0, err
 	}
@@ -135,17 +357,17 @@ func (db *SQLiteStore) CreateFolder(name string, parentID *int64) (int64, error)
 }
 
 // GetOrCreateFolder finds a folder by name and parent, or creates it.
-func (db *SQLiteStore) GetOrCreateFolder(name string, parentID *int64) (int64, error) {
+func (db *SQLiteStore) GetOrCreateFolder(ctx context.Context, name string, parentID *int64) (int64, error) {
 	var id int64
 	var row *sql.Row
 	if parentID == nil {
-		row = db.conn.QueryRow("SELECT id FROM folders WHERE name = ? AND parent_id IS NULL", name)
+		row = db.conn.QueryRowContext(ctx, "SELECT id FROM folders WHERE name = ? AND parent_id IS NULL", name)
 	} else {
-		row = db.conn.QueryRow("SELECT id FROM folders WHERE name = ? AND parent_id = ?", name, *parentID)
+		row = db.conn.QueryRowContext(ctx, "SELECT id FROM folders WHERE name = ? AND parent_id = ?", name, *parentID)
 	}
 	err := row.Scan(&id)
 	if err == sql.ErrNoRows {
-		return db.CreateFolder(name, parentID)
+		return db.CreateFolder(ctx, name, parentID)
 	}
 	return id, err
 }
@@ -153,107 +375,60 @@ func (db *SQLiteStore) GetOrCreateFolder(name string, parentID *int64) (int64, e
 // --- Feed Methods ---
 
 // GetFeeds returns all feeds, optionally filtered by folder.
-func (db *SQLiteStore) GetFeeds(folderID *int64) ([]model.Feed, error) {
+func (db *SQLiteStore) GetFeeds(ctx context.Context, folderID *int64) ([]model.Feed, error) {
 	var rows *sql.Rows
 	var err error
-	query := `SELECT f.id, f.folder_id, f.title, f.url, f.icon_url, f.last_fetched, f.last_error,
-		(SELECT COUNT(*) FROM items WHERE feed_id = f.id) as item_count
-		FROM feeds f`
+	query := `SELECT ` + feedColumns + `,
+		(SELECT COUNT(*) FROM items WHERE feed_id = f.id AND deleted_at IS NULL) as item_count
+		FROM feeds f WHERE f.deleted_at IS NULL`
+	order := " ORDER BY " + feedOrder(sidebarSort(ctx, db))
 	if folderID == nil {
-		rows, err = db.conn.Query(query + " ORDER BY f.title")
+		rows, err = db.conn.QueryContext(ctx, query+order)
 	} else {
-		rows, err = db.conn.Query(query+" WHERE f.folder_id = ? ORDER BY f.title", *folderID)
+		rows, err = db.conn.QueryContext(ctx, query+" AND f.folder_id = ?"+order, *folderID)
 	}
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var feeds []model.Feed
-	for rows.Next() {
-		var f model.Feed
-		var lastFetched sql.NullTime
-		var lastError sql.NullString
-		if err := rows.Scan(&f.ID, &f.FolderID, &f.Title, &f.URL, &f.IconURL, &lastFetched, &lastError, &f.ItemCount); err != nil {
-			return nil, err
-		}
-		if lastFetched.Valid {
-			f.LastFetched = lastFetched.Time
-		}
-		if lastError.Valid {
-			f.LastError = lastError.String
-		}
-		feeds = append(feeds, f)
-	}
-	return feeds, rows.Err()
+	return scanFeeds(rows, true)
 }
 
 // GetAllFeeds returns all feeds regardless of folder.
-func (db *SQLiteStore) GetAllFeeds() ([]model.Feed, error) {
-	return db.GetFeeds(nil)
+func (db *SQLiteStore) GetAllFeeds(ctx context.Context) ([]model.Feed, error) {
+	return db.GetFeeds(ctx, nil)
 }
 
 // GetFeedsByFolderID returns feeds belonging to a specific folder.
-func (db *SQLiteStore) GetFeedsByFolderID(folderID int64) ([]model.Feed, error) {
-	rows, err := db.conn.Query("SELECT id, folder_id, title, url, icon_url, last_fetched, last_error FROM feeds WHERE folder_id = ? ORDER BY title", folderID)
+func (db *SQLiteStore) GetFeedsByFolderID(ctx context.Context, folderID int64) ([]model.Feed, error) {
+	rows, err := db.conn.QueryContext(ctx, "SELECT "+feedColumns+" FROM feeds f WHERE f.folder_id = ? AND f.deleted_at IS NULL ORDER BY "+feedOrder(sidebarSort(ctx, db)), folderID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var feeds []model.Feed
-	for rows.Next() {
-		var f model.Feed
-		var lastFetched sql.NullTime
-		var lastError sql.NullString
-		if err := rows.Scan(&f.ID, &f.FolderID, &f.Title, &f.URL, &f.IconURL, &lastFetched, &lastError); err != nil {
-			return nil, err
-		}
-		if lastFetched.Valid {
-			f.LastFetched = lastFetched.Time
-		}
-		if lastError.Valid {
-			f.LastError = lastError.String
-		}
-		feeds = append(feeds, f)
-	}
-	return feeds, rows.Err()
+	return scanFeeds(rows, false)
 }
 
 // GetUnfiledFeeds returns feeds that don't belong to any folder.
-func (db *SQLiteStore) GetUnfiledFeeds() ([]model.Feed, error) {
-	rows, err := db.conn.Query("SELECT id, folder_id, title, url, icon_url, last_fetched, last_error FROM feeds WHERE folder_id IS NULL ORDER BY title")
+func (db *SQLiteStore) GetUnfiledFeeds(ctx context.Context) ([]model.Feed, error) {
+	rows, err := db.conn.QueryContext(ctx, "SELECT "+feedColumns+" FROM feeds f WHERE f.folder_id IS NULL AND f.deleted_at IS NULL ORDER BY "+feedOrder(sidebarSort(ctx, db)))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var feeds []model.Feed
-	for rows.Next() {
-		var f model.Feed
-		var lastFetched sql.NullTime
-		var lastError sql.NullString
-		if err := rows.Scan(&f.ID, &f.FolderID, &f.Title, &f.URL, &f.IconURL, &lastFetched, &lastError); err != nil {
-			return nil, err
-		}
-		if lastFetched.Valid {
-			f.LastFetched = lastFetched.Time
-		}
-		if lastError.Valid {
-			f.LastError = lastError.String
-		}
-		feeds = append(feeds, f)
-	}
-	return feeds, rows.Err()
+	return scanFeeds(rows, false)
 }
 
 // GetFoldersWithFeeds returns all folders with their feeds populated.
-func (db *SQLiteStore) GetFoldersWithFeeds() ([]model.FolderWithFeeds, error) {
-	folders, err := db.GetFolders()
+func (db *SQLiteStore) GetFoldersWithFeeds(ctx context.Context) ([]model.FolderWithFeeds, error) {
+	folders, err := db.GetFolders(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	var result []model.FolderWithFeeds
 	for _, folder := range folders {
-		feeds, err := db.GetFeedsByFolderID(folder.ID)
+		feeds, err := db.GetFeedsByFolderID(ctx, folder.ID)
 		if err != nil {
 			return nil, err
 		}
@@ -266,66 +441,215 @@ func (db *SQLiteStore) GetFoldersWithFeeds() ([]model.FolderWithFeeds, error) {
 }
 
 // CreateFeed adds a new feed. Returns the ID.
-func (db *SQLiteStore) CreateFeed(folderID *int64, title, url string) (int64, error) {
-	res, err := db.conn.Exec("INSERT INTO feeds (folder_id, title, url) VALUES (?, ?, ?)", folderID, title, url)
+func (db *SQLiteStore) CreateFeed(ctx context.Context, folderID *int64, title, url string) (int64, error) {
+	res, err := db.conn.ExecContext(ctx, "INSERT INTO feeds (folder_id, title, url) VALUES (?, ?, ?)", folderID, title, url)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// CreateInboxFeed creates a virtual feed that receives items pushed with token.
+func (db *SQLiteStore) CreateInboxFeed(ctx context.Context, folderID *int64, title, token string) (int64, error) {
+	res, err := db.conn.ExecContext(ctx, "INSERT INTO feeds (folder_id, title, url, inbox_token) VALUES (?, ?, ?, ?)",
+		folderID, title, model.InboxURLPrefix+token, token)
 	if err != nil {
 		return 0, err
 	}
 	return res.LastInsertId()
 }
 
-// GetOrCreateFeed finds a feed by URL, or creates it.
-func (db *SQLiteStore) GetOrCreateFeed(folderID *int64, title, url string) (int64, bool, error) {
+// GetFeedByInboxToken returns the virtual feed owning token.
+func (db *SQLiteStore) GetFeedByInboxToken(ctx context.Context, token string) (*model.Feed, error) {
+	f, err := scanFeed(db.conn.QueryRowContext(ctx, "SELECT "+feedColumns+" FROM feeds f WHERE f.inbox_token = ? AND f.inbox_token <> '' AND f.deleted_at IS NULL", token))
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// GetOrCreateFeed finds a feed by URL, or creates it. A trashed feed with
+// the same URL is restored into folderID and reported as new.
+func (db *SQLiteStore) GetOrCreateFeed(ctx context.Context, folderID *int64, title, url string) (int64, bool, error) {
 	var id int64
-	err := db.conn.QueryRow("SELECT id FROM feeds WHERE url = ?", url).Scan(&id)
+	var trashed bool
+	err := db.conn.QueryRowContext(ctx, "SELECT id, deleted_at IS NOT NULL FROM feeds WHERE url = ?", url).Scan(&id, &trashed)
 	if err == sql.ErrNoRows {
-		id, err := db.CreateFeed(folderID, title, url)
+		id, err := db.CreateFeed(ctx, folderID, title, url)
 		return id, true, err
 	}
-	return id, false, err
+	if err != nil || !trashed {
+		return id, false, err
+	}
+	if err := db.RestoreFeed(ctx, id); err != nil {
+		return 0, false, err
+	}
+	return id, true, db.MoveFeedToFolder(ctx, id, folderID)
+}
+
+// UpdateFeedLastFetched records a successful fetch of a feed at t and
+// clears its error.
+func (db *SQLiteStore) UpdateFeedLastFetched(ctx context.Context, feedID int64, t time.Time) error {
+	_, err := db.conn.ExecContext(ctx, `UPDATE feeds SET last_fetched = ?, last_attempted_at = ?, last_error = '', last_error_status = 0,
+		last_error_class = '', error_streak = 0 WHERE id = ?`, t, t, feedID)
+	return err
 }
 
-// UpdateFeedLastFetched updates the last_fetched timestamp for a feed.
-func (db *SQLiteStore) UpdateFeedLastFetched(feedID int64, t time.Time) error {
-	_, err := db.conn.Exec("UPDATE feeds SET last_fetched = ?, last_error = '' WHERE id = ?", t, feedID)
+// UpdateFeedNextFetch sets the earliest time a feed should be polled again.
+// A zero time clears it.
+func (db *SQLiteStore) UpdateFeedNextFetch(ctx context.Context, feedID int64, t time.Time) error {
+	_, err := db.conn.ExecContext(ctx, "UPDATE feeds SET next_fetch_at = ? WHERE id = ?", sql.NullTime{Time: t, Valid: !t.IsZero()}, feedID)
 	return err
 }
 
 // UpdateFeedTitle updates the title for a feed.
-func (db *SQLiteStore) UpdateFeedTitle(feedID int64, title string) error {
-	_, err := db.conn.Exec("UPDATE feeds SET title = ? WHERE id = ?", title, feedID)
+func (db *SQLiteStore) UpdateFeedTitle(ctx context.Context, feedID int64, title string) error {
+	_, err := db.conn.ExecContext(ctx, "UPDATE feeds SET title = ? WHERE id = ?", title, feedID)
 	return err
 }
 
-// UpdateFeedError sets the last error message for a feed.
-func (db *SQLiteStore) UpdateFeedError(feedID int64, errMsg string) error {
-	_, err := db.conn.Exec("UPDATE feeds SET last_error = ? WHERE id = ?", errMsg, feedID)
+// UpdateFeedMetadata updates the descriptive fields of a feed.
+func (db *SQLiteStore) UpdateFeedMetadata(ctx context.Context, feedID int64, title, siteURL, description, iconURL string) error {
+	_, err := db.conn.ExecContext(ctx, "UPDATE feeds SET title = ?, site_url = ?, description = ?, icon_url = ? WHERE id = ?",
+		title, siteURL, description, iconURL, feedID)
 	return err
 }
 
-// GetFeedByID returns a single feed by its ID.
-func (db *SQLiteStore) GetFeedByID(feedID int64) (*model.Feed, error) {
-	var f model.Feed
-	var lastFetched sql.NullTime
-	var lastError sql.NullString
-	err := db.conn.QueryRow("SELECT id, folder_id, title, url, icon_url, last_fetched, last_error FROM feeds WHERE id = ?", feedID).
-		Scan(&f.ID, &f.FolderID, &f.Title, &f.URL, &f.IconURL, &lastFetched, &lastError)
+// UpdateFeedOptions saves the per-feed behaviour toggles.
+func (db *SQLiteStore) UpdateFeedOptions(ctx context.Context, feedID int64, opts model.FeedOptions) error {
+	_, err := db.conn.ExecContext(ctx, `UPDATE feeds SET backfill_archives = ?, auto_summarize = ?, archive_pages = ?,
+		download_enclosures = ?, ingest_categories = ?, fetch_strategy = ?, embed_videos = ?, notify = ?, notes = ?,
+		transforms = ? WHERE id = ?`,
+		opts.BackfillArchives, opts.AutoSummarize, opts.ArchivePages, opts.DownloadEnclosures, opts.IngestCategories,
+		opts.FetchStrategy, opts.EmbedVideos, opts.Notify, opts.Notes, encodeTransforms(opts.Transforms), feedID)
+	return err
+}
+
+// UpdateFeedError records a failed fetch of a feed at t and counts it
+// towards the feed's error streak.
+func (db *SQLiteStore) UpdateFeedError(ctx context.Context, feedID int64, fe model.FetchError, t time.Time) error {
+	_, err := db.conn.ExecContext(ctx, `UPDATE feeds SET last_error = ?, last_error_status = ?, last_error_class = ?,
+		error_streak = COALESCE(error_streak, 0) + 1, last_attempted_at = ? WHERE id = ?`,
+		fe.Message, fe.StatusCode, fe.Class, t, feedID)
+	return err
+}
+
+// SetFeedSuggestedURL records the feed URL rediscovery found for a feed, or
+// clears it if url is empty.
+func (db *SQLiteStore) SetFeedSuggestedURL(ctx context.Context, feedID int64, url string) error {
+	_, err := db.conn.ExecContext(ctx, "UPDATE feeds SET suggested_url = ? WHERE id = ?", url, feedID)
+	return err
+}
+
+// UpdateFeedURL points a feed at a new URL, clearing its suggested URL and
+// next fetch time so that the new URL is fetched on the next run.
+func (db *SQLiteStore) UpdateFeedURL(ctx context.Context, feedID int64, url string) error {
+	_, err := db.conn.ExecContext(ctx, "UPDATE feeds SET url = ?, suggested_url = '', next_fetch_at = NULL WHERE id = ?", url, feedID)
+	return err
+}
+
+// SetFeedIcon replaces the icon chosen for a feed.
+func (db *SQLiteStore) SetFeedIcon(ctx context.Context, icon model.FeedIcon) error {
+	_, err := db.conn.ExecContext(ctx, `INSERT INTO feed_icons (feed_id, emoji, content_type, data, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(feed_id) DO UPDATE SET emoji = excluded.emoji, content_type = excluded.content_type,
+			data = excluded.data, updated_at = excluded.updated_at`,
+		icon.FeedID, icon.Emoji, icon.ContentType, icon.Data, icon.UpdatedAt.UTC())
+	return err
+}
+
+// GetFeedIcon returns the icon chosen for a feed, or sql.ErrNoRows if the
+// feed uses its detected icon.
+func (db *SQLiteStore) GetFeedIcon(ctx context.Context, feedID int64) (*model.FeedIcon, error) {
+	icon := model.FeedIcon{FeedID: feedID}
+	err := db.conn.QueryRowContext(ctx, "SELECT emoji, content_type, data, updated_at FROM feed_icons WHERE feed_id = ?", feedID).
+		Scan(&icon.Emoji, &icon.ContentType, &icon.Data, &icon.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
-	if lastFetched.Valid {
-		f.LastFetched = lastFetched.Time
+	return &icon, nil
+}
+
+// DeleteFeedIcon reverts a feed to its detected icon.
+func (db *SQLiteStore) DeleteFeedIcon(ctx context.Context, feedID int64) error {
+	_, err := db.conn.ExecContext(ctx, "DELETE FROM feed_icons WHERE feed_id = ?", feedID)
+	return err
+}
+
+// AddFetchLog records a fetch of a feed.
+func (db *SQLiteStore) AddFetchLog(ctx context.Context, e model.FetchLogEntry) error {
+	_, err := db.conn.ExecContext(ctx, "INSERT INTO fetch_log (feed_id, fetched_at, ok, duration_ms) VALUES (?, ?, ?, ?)",
+		e.FeedID, e.FetchedAt.UTC(), e.OK, e.Duration.Milliseconds())
+	return err
+}
+
+// GetFetchStats summarizes the logged fetches of every feed.
+func (db *SQLiteStore) GetFetchStats(ctx context.Context) ([]model.FetchStats, error) {
+	return queryFetchStats(ctx, db.conn)
+}
+
+// PruneFetchLog deletes the fetches logged before a time.
+func (db *SQLiteStore) PruneFetchLog(ctx context.Context, before time.Time) (int64, error) {
+	res, err := db.conn.ExecContext(ctx, "DELETE FROM fetch_log WHERE fetched_at < ?", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// SetFeedHealth stores health scores by feed ID. Feeds missing from scores
+// become ungraded.
+func (db *SQLiteStore) SetFeedHealth(ctx context.Context, scores map[int64]int) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE feeds SET health_score = NULL"); err != nil {
+		tx.Rollback()
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, "UPDATE feeds SET health_score = ? WHERE id = ?")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for id, score := range scores {
+		if _, err := stmt.ExecContext(ctx, score, id); err != nil {
+			tx.Rollback()
+			return err
+		}
 	}
-	if lastError.Valid {
-		f.LastError = lastError.String
+	return tx.Commit()
+}
+
+// GetFeedByID returns a single feed by its ID.
+func (db *SQLiteStore) GetFeedByID(ctx context.Context, feedID int64) (*model.Feed, error) {
+	f, err := scanFeed(db.conn.QueryRowContext(ctx, "SELECT "+feedColumns+" FROM feeds f WHERE f.id = ? AND f.deleted_at IS NULL", feedID))
+	if err != nil {
+		return nil, err
 	}
 	return &f, nil
 }
 
+// SearchFeeds returns the feeds whose title, URL, description or notes
+// contain query, ignoring case, in sidebar order.
+func (db *SQLiteStore) SearchFeeds(ctx context.Context, query string) ([]model.Feed, error) {
+	pattern := "%" + strings.ToLower(query) + "%"
+	rows, err := db.conn.QueryContext(ctx, `SELECT `+feedColumns+` FROM feeds f WHERE f.deleted_at IS NULL
+		AND (LOWER(f.title) LIKE ? OR LOWER(f.url) LIKE ? OR LOWER(COALESCE(f.description, '')) LIKE ?
+			OR LOWER(COALESCE(f.notes, '')) LIKE ?)
+		ORDER BY `+feedOrder(sidebarSort(ctx, db)), pattern, pattern, pattern, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanFeeds(rows, false)
+}
+
 // GetFolderByID returns a single folder by its ID.
-func (db *SQLiteStore) GetFolderByID(folderID int64) (*model.Folder, error) {
+func (db *SQLiteStore) GetFolderByID(ctx context.Context, folderID int64) (*model.Folder, error) {
 	var f model.Folder
-	err := db.conn.QueryRow("SELECT id, name, parent_id FROM folders WHERE id = ?", folderID).
+	err := db.conn.QueryRowContext(ctx, "SELECT id, name, parent_id FROM folders WHERE id = ?", folderID).
 		Scan(&f.ID, &f.Name, &f.ParentID)
 	if err != nil {
 		return nil, err
@@ -333,46 +657,179 @@ func (db *SQLiteStore) GetFolderByID(folderID int64) (*model.Folder, error) {
 	return &f, nil
 }
 
-// DeleteFeed removes a feed and all its items (cascading).
-func (db *SQLiteStore) DeleteFeed(feedID int64) error {
-	_, err := db.conn.Exec("DELETE FROM feeds WHERE id = ?", feedID)
-	return err
+// DeleteFeed moves a feed and all its items to the trash.
+func (db *SQLiteStore) DeleteFeed(ctx context.Context, feedID int64) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	if _, err := tx.ExecContext(ctx, "UPDATE items SET deleted_at = ? WHERE feed_id = ? AND deleted_at IS NULL", now, feedID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE feeds SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL", now, feedID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
 }
 
-// DeleteFolder removes a folder and all its feeds (and their items).
-func (db *SQLiteStore) DeleteFolder(folderID int64) error {
-	// First delete all feeds in the folder (items cascade via FK).
-	if _, err := db.conn.Exec("DELETE FROM feeds WHERE folder_id = ?", folderID); err != nil {
+// DeleteFolder removes a folder and moves all its feeds (and their items) to
+// the trash. Feeds restored later come back unfiled.
+func (db *SQLiteStore) DeleteFolder(ctx context.Context, folderID int64) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
 		return err
 	}
-	// Then delete the folder itself.
-	_, err := db.conn.Exec("DELETE FROM folders WHERE id = ?", folderID)
-	return err
+	now := time.Now().UTC()
+	if _, err := tx.ExecContext(ctx, `UPDATE items SET deleted_at = ? WHERE deleted_at IS NULL
+		AND feed_id IN (SELECT id FROM feeds WHERE folder_id = ? AND deleted_at IS NULL)`, now, folderID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	// Trashed feeds keep no folder so the folder itself can be removed.
+	if _, err := tx.ExecContext(ctx, "UPDATE feeds SET deleted_at = COALESCE(deleted_at, ?), folder_id = NULL WHERE folder_id = ?",
+		now, folderID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM folders WHERE id = ?", folderID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
 }
 
 // MoveFeedToFolder updates a feed's folder assignment.
-func (db *SQLiteStore) MoveFeedToFolder(feedID int64, folderID *int64) error {
-	_, err := db.conn.Exec("UPDATE feeds SET folder_id = ? WHERE id = ?", folderID, feedID)
+func (db *SQLiteStore) MoveFeedToFolder(ctx context.Context, feedID int64, folderID *int64) error {
+	_, err := db.conn.ExecContext(ctx, "UPDATE feeds SET folder_id = ? WHERE id = ?", folderID, feedID)
 	return err
 }
 
-// DeleteReadItems deletes specific read items by their IDs.
-func (db *SQLiteStore) DeleteReadItems(itemIDs []int64) error {
-	if len(itemIDs) == 0 {
-		return nil
-	}
-	tx, err := db.conn.Begin()
+// SetSidebarOrder saves the manual sidebar order: each folder and feed gets
+// its position in the given lists.
+func (db *SQLiteStore) SetSidebarOrder(ctx context.Context, folderIDs, feedIDs []int64) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	stmt, err := tx.Prepare("DELETE FROM items WHERE id = ? AND is_read = 1")
+	for _, u := range []struct {
+		query string
+		ids   []int64
+	}{
+		{"UPDATE folders SET sort_order = ? WHERE id = ?", folderIDs},
+		{"UPDATE feeds SET sort_order = ? WHERE id = ?", feedIDs},
+	} {
+		for pos, id := range u.ids {
+			if _, err := tx.ExecContext(ctx, u.query, pos, id); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// ImportFeeds subscribes to feeds in a single transaction, creating their
+// folders as needed. A trashed feed is restored into its new folder, as in
+// GetOrCreateFeed.
+func (db *SQLiteStore) ImportFeeds(ctx context.Context, feeds []model.ImportFeed, progress func(done int)) ([]model.ImportResult, error) {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	folders := make(map[string]*int64) // by path, joined with NULs
+	results := make([]model.ImportResult, len(feeds))
+	for i, f := range feeds {
+		folderID, err := db.importFolders(ctx, tx, folders, f.FolderPath)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		res := model.ImportResult{URL: f.URL, Title: f.Title, Status: model.ImportExists}
+		var trashed bool
+		err = tx.QueryRowContext(ctx, "SELECT id, deleted_at IS NOT NULL FROM feeds WHERE url = ?", f.URL).Scan(&res.FeedID, &trashed)
+		switch {
+		case err == sql.ErrNoRows:
+			var r sql.Result
+			r, err = tx.ExecContext(ctx, "INSERT INTO feeds (folder_id, title, url) VALUES (?, ?, ?)", folderID, f.Title, f.URL)
+			if err == nil {
+				res.FeedID, err = r.LastInsertId()
+			}
+			res.Status = model.ImportAdded
+		case err == nil && trashed:
+			if _, err = tx.ExecContext(ctx, `UPDATE items SET deleted_at = NULL
+				WHERE feed_id = ? AND deleted_at >= (SELECT deleted_at FROM feeds WHERE id = ?)`, res.FeedID, res.FeedID); err == nil {
+				_, err = tx.ExecContext(ctx, "UPDATE feeds SET deleted_at = NULL, folder_id = ? WHERE id = ?", folderID, res.FeedID)
+			}
+			res.Status = model.ImportAdded
+		}
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		results[i] = res
+		if progress != nil {
+			progress(i + 1)
+		}
+	}
+	return results, tx.Commit()
+}
+
+// importFolders finds or creates the folders along path within tx and
+// returns the innermost one, or nil for an empty path. Folders already seen
+// by this import are cached in known.
+func (db *SQLiteStore) importFolders(ctx context.Context, tx *sql.Tx, known map[string]*int64, path []string) (*int64, error) {
+	var parentID *int64
+	for i, name := range path {
+		key := strings.Join(path[:i+1], "\x00")
+		if id, ok := known[key]; ok {
+			parentID = id
+			continue
+		}
+		var id int64
+		var err error
+		if parentID == nil {
+			err = tx.QueryRowContext(ctx, "SELECT id FROM folders WHERE name = ? AND parent_id IS NULL", name).Scan(&id)
+		} else {
+			err = tx.QueryRowContext(ctx, "SELECT id FROM folders WHERE name = ? AND parent_id = ?", name, *parentID).Scan(&id)
+		}
+		if err == sql.ErrNoRows {
+			var r sql.Result
+			if r, err = tx.ExecContext(ctx, "INSERT INTO folders (name, parent_id) VALUES (?, ?)", name, parentID); err == nil {
+				id, err = r.LastInsertId()
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		known[key] = &id
+		parentID = &id
+	}
+	return parentID, nil
+}
+
+// MergeItems folds duplicates into keep and moves them to the trash.
+func (db *SQLiteStore) MergeItems(ctx context.Context, keep model.Item, duplicateIDs []int64) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
 	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	if _, err := tx.ExecContext(ctx, `UPDATE items SET read_at = CASE WHEN ? = FALSE THEN NULL WHEN is_read = FALSE THEN ? ELSE read_at END,
+		is_read = ?, starred = ?, note = ? WHERE id = ?`,
+		keep.IsRead, now, keep.IsRead, keep.Starred, keep.Note, keep.ID); err != nil {
 		tx.Rollback()
 		return err
 	}
-	defer stmt.Close()
-	for _, id := range itemIDs {
-		if _, err := stmt.Exec(id); err != nil {
+	for _, id := range duplicateIDs {
+		if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO item_tags (item_id, tag_id)
+			SELECT ?, tag_id FROM item_tags WHERE item_id = ?`, keep.ID, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE items SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL", now, id); err != nil {
 			tx.Rollback()
 			return err
 		}
@@ -380,33 +837,76 @@ func (db *SQLiteStore) DeleteReadItems(itemIDs []int64) error {
 	return tx.Commit()
 }
 
-// GetItemsByFolderID returns all items for feeds in a specific folder.
-func (db *SQLiteStore) GetItemsByFolderID(folderID int64, onlyUnread bool) ([]model.Item, error) {
-	query := `SELECT i.id, i.feed_id, i.guid, i.title, i.content, i.link, i.published_at, i.fetched_at, i.is_read
-		FROM items i
-		JOIN feeds f ON i.feed_id = f.id
-		WHERE f.folder_id = ?`
-	if onlyUnread {
-		query += " AND i.is_read = 0"
+// DeleteReadItems moves specific read items to the trash. Annotated and starred items are kept.
+func (db *SQLiteStore) DeleteReadItems(ctx context.Context, itemIDs []int64) error {
+	return db.execForIDs(ctx, `UPDATE items SET deleted_at = ?
+		WHERE is_read = 1 AND starred = 0 AND COALESCE(note, '') = '' AND deleted_at IS NULL AND id IN (%s)`,
+		itemIDs, time.Now().UTC())
+}
+
+// sqliteMaxIDs is how many IDs execForIDs binds per statement, well under
+// SQLite's limit on parameters.
+const sqliteMaxIDs = 1000
+
+// execForIDs runs query, whose "%s" is filled with an IN list, for ids in
+// one transaction, binding args before each batch of IDs.
+func (db *SQLiteStore) execForIDs(ctx context.Context, query string, ids []int64, args ...interface{}) error {
+	if len(ids) == 0 {
+		return nil
 	}
-	query += " ORDER BY i.published_at DESC"
-	rows, err := db.conn.Query(query, folderID)
+	tx, err := db.conn.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
-	return scanItems(rows)
+	for len(ids) > 0 {
+		batch := ids[:min(len(ids), sqliteMaxIDs)]
+		ids = ids[len(batch):]
+		params := append([]interface{}{}, args...)
+		for _, id := range batch {
+			params = append(params, id)
+		}
+		list := strings.TrimSuffix(strings.Repeat("?, ", len(batch)), ", ")
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(query, list), params...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// MarkReadByFilter marks every item matching filter as read. Returns the
+// number of items changed.
+func (db *SQLiteStore) MarkReadByFilter(ctx context.Context, filter model.ItemFilter) (int64, error) {
+	query, args := buildMarkReadQuery(filter, time.Now().UTC(), sqlitePlaceholder)
+	res, err := db.conn.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetReadActivity returns the items read since a time and the unread items.
+func (db *SQLiteStore) GetReadActivity(ctx context.Context, since time.Time) ([]model.ItemActivity, error) {
+	return queryReadActivity(ctx, db.conn, since, sqlitePlaceholder)
+}
+
+// GetItemsByFolderID returns all items for feeds in a specific folder.
+func (db *SQLiteStore) GetItemsByFolderID(ctx context.Context, folderID int64, onlyUnread bool) ([]model.Item, error) {
+	return db.QueryItems(ctx, model.ItemFilter{FolderID: &folderID, OnlyUnread: onlyUnread})
 }
 
 // --- Item Methods ---
 
 // AddItem inserts a new item if GUID doesn't exist for that feed. Returns ID and whether it was new.
-func (db *SQLiteStore) AddItem(item *model.Item) (int64, bool, error) {
-	res, err := db.conn.Exec(`
-		INSERT INTO items (feed_id, guid, title, content, link, published_at, fetched_at, is_read)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+func (db *SQLiteStore) AddItem(ctx context.Context, item *model.Item) (int64, bool, error) {
+	res, err := db.conn.ExecContext(ctx, `
+		INSERT INTO items (feed_id, guid, title, content, link, published_at, fetched_at, is_read, word_count, reading_time,
+			enclosure_url, enclosure_type, author_name, author_email, comments_url, comments_feed, domain, snippet, raw_title)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(feed_id, guid) DO NOTHING`,
-		item.FeedID, item.GUID, item.Title, item.Content, item.Link, item.PublishedAt, item.FetchedAt, 0)
+		item.FeedID, item.GUID, item.Title, item.Content, item.Link, item.PublishedAt, item.FetchedAt, 0,
+		item.WordCount, item.ReadingTime, item.EnclosureURL, item.EnclosureType, item.AuthorName, item.AuthorEmail,
+		item.CommentsURL, item.CommentsFeed, model.LinkDomain(item.Link), item.Snippet, item.RawTitle)
 	if err != nil {
 		return 0, false, err
 	}
@@ -415,29 +915,63 @@ func (db *SQLiteStore) AddItem(item *model.Item) (int64, bool, error) {
 	return id, affected > 0, nil
 }
 
-// GetItems returns items for a feed, ordered by published date desc.
-func (db *SQLiteStore) GetItems(feedID int64, onlyUnread bool) ([]model.Item, error) {
-	query := "SELECT id, feed_id, guid, title, content, link, published_at, fetched_at, is_read FROM items WHERE feed_id = ?"
-	if onlyUnread {
-		query += " AND is_read = 0"
+// sqliteInsertRows is how many items AddItems inserts per statement.
+const sqliteInsertRows = 200
+
+// AddItems inserts items in bulk, sqliteInsertRows to a statement, in one
+// transaction. It returns the ID of each item, 0 where its feed already had
+// its GUID.
+func (db *SQLiteStore) AddItems(ctx context.Context, items []model.Item) ([]int64, error) {
+	ids := make([]int64, len(items))
+	if len(items) == 0 {
+		return ids, nil
 	}
-	query += " ORDER BY published_at DESC"
-	rows, err := db.conn.Query(query, feedID)
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(bulkItemColumns)), ", ") + ")"
+	now := time.Now().UTC()
+	tx, err := db.conn.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	return scanItems(rows)
+	for start := 0; start < len(items); start += sqliteInsertRows {
+		batch := items[start:min(start+sqliteInsertRows, len(items))]
+		rows := make([]string, len(batch))
+		var args []interface{}
+		at := make(map[itemKey]int, len(batch))
+		for n, it := range batch {
+			rows[n] = row
+			args = append(args, bulkItemValues(it, now)...)
+			k := itemKey{it.FeedID, it.GUID}
+			if _, ok := at[k]; !ok {
+				at[k] = start + n
+			}
+		}
+		added, err := tx.QueryContext(ctx, "INSERT INTO items ("+strings.Join(bulkItemColumns, ", ")+") VALUES "+
+			strings.Join(rows, ", ")+" ON CONFLICT(feed_id, guid) DO NOTHING RETURNING id, feed_id, guid", args...)
+		if err == nil {
+			err = scanAddedItems(added, at, ids)
+		}
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	return ids, tx.Commit()
+}
+
+// GetItems returns items for a feed, ordered by published date desc.
+func (db *SQLiteStore) GetItems(ctx context.Context, feedID int64, onlyUnread bool) ([]model.Item, error) {
+	return db.QueryItems(ctx, model.ItemFilter{FeedID: &feedID, OnlyUnread: onlyUnread})
 }
 
 // GetAllItems returns all items for the sidebar/home stream.
-func (db *SQLiteStore) GetAllItems(onlyUnread bool) ([]model.Item, error) {
-	query := "SELECT id, feed_id, guid, title, content, link, published_at, fetched_at, is_read FROM items"
-	if onlyUnread {
-		query += " WHERE is_read = 0"
-	}
-	query += " ORDER BY published_at DESC"
-	rows, err := db.conn.Query(query)
+func (db *SQLiteStore) GetAllItems(ctx context.Context, onlyUnread bool) ([]model.Item, error) {
+	return db.QueryItems(ctx, model.ItemFilter{OnlyUnread: onlyUnread})
+}
+
+// QueryItems returns items matching the filter.
+func (db *SQLiteStore) QueryItems(ctx context.Context, filter model.ItemFilter) ([]model.Item, error) {
+	query, args := buildItemQuery(filter, sqlitePlaceholder)
+	rows, err := db.conn.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -445,48 +979,48 @@ func (db *SQLiteStore) GetAllItems(onlyUnread bool) ([]model.Item, error) {
 	return scanItems(rows)
 }
 
-func scanItems(rows *sql.Rows) ([]model.Item, error) {
-	var items []model.Item
-	for rows.Next() {
-		var it model.Item
-		var publishedAt, fetchedAt sql.NullTime
-		if err := rows.Scan(&it.ID, &it.FeedID, &it.GUID, &it.Title, &it.Content, &it.Link, &publishedAt, &fetchedAt, &it.IsRead); err != nil {
-			return nil, err
-		}
-		if publishedAt.Valid {
-			it.PublishedAt = publishedAt.Time
-		}
-		if fetchedAt.Valid {
-			it.FetchedAt = fetchedAt.Time
-		}
-		items = append(items, it)
+// GetItemByID returns a single item by its ID.
+func (db *SQLiteStore) GetItemByID(ctx context.Context, itemID int64) (*model.Item, error) {
+	it, err := scanItem(db.conn.QueryRowContext(ctx, "SELECT "+itemColumns+" FROM items i WHERE i.id = ? AND i.deleted_at IS NULL", itemID))
+	if err != nil {
+		return nil, err
 	}
-	return items, rows.Err()
+	return &it, nil
 }
 
-// MarkItemRead marks an item as read.
-func (db *SQLiteStore) MarkItemRead(itemID int64) error {
-	_, err := db.conn.Exec("UPDATE items SET is_read = 1 WHERE id = ?", itemID)
+// SetItemNote stores a private note on an item. An empty note removes it.
+func (db *SQLiteStore) SetItemNote(ctx context.Context, itemID int64, note string) error {
+	_, err := db.conn.ExecContext(ctx, "UPDATE items SET note = ? WHERE id = ?", note, itemID)
 	return err
 }
 
-// MarkItemsRead marks multiple items as read.
-func (db *SQLiteStore) MarkItemsRead(itemIDs []int64) error {
-	if len(itemIDs) == 0 {
-		return nil
-	}
-	tx, err := db.conn.Begin()
+// SetItemPosition records how far an item has been read, in percent. It
+// returns sql.ErrNoRows if the item doesn't exist or is in the trash.
+func (db *SQLiteStore) SetItemPosition(ctx context.Context, itemID int64, percent float64) error {
+	return setItemPosition(ctx, db.conn, itemID, percent, sqlitePlaceholder)
+}
+
+// SetItemSummary stores a generated summary on an item.
+func (db *SQLiteStore) SetItemSummary(ctx context.Context, itemID int64, summary string) error {
+	_, err := db.conn.ExecContext(ctx, "UPDATE items SET summary = ? WHERE id = ?", summary, itemID)
+	return err
+}
+
+// SetItemStarred stars or unstars an item. Starring records a positive
+// interest event.
+func (db *SQLiteStore) SetItemStarred(ctx context.Context, itemID int64, starred bool) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	stmt, err := tx.Prepare("UPDATE items SET is_read = 1 WHERE id = ?")
+	res, err := tx.ExecContext(ctx, "UPDATE items SET starred = ? WHERE id = ? AND starred <> ?", starred, itemID, starred)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
-	defer stmt.Close()
-	for _, id := range itemIDs {
-		if _, err := stmt.Exec(id); err != nil {
+	if n, _ := res.RowsAffected(); n > 0 && starred {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO interest_events (feed_id, title, positive, created_at)
+			SELECT feed_id, title, 1, ? FROM items WHERE id = ?`, time.Now(), itemID); err != nil {
 			tx.Rollback()
 			return err
 		}
@@ -494,33 +1028,710 @@ func (db *SQLiteStore) MarkItemsRead(itemIDs []int64) error {
 	return tx.Commit()
 }
 
-// CleanupReadItems deletes all items marked as read.
-func (db *SQLiteStore) CleanupReadItems() (int64, error) {
-	res, err := db.conn.Exec("DELETE FROM items WHERE is_read = 1")
+// GetItemTags returns the names of the tags on an item.
+func (db *SQLiteStore) GetItemTags(ctx context.Context, itemID int64) ([]string, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT t.name FROM tags t JOIN item_tags it ON it.tag_id = t.id
+		WHERE it.item_id = ? ORDER BY t.name`, itemID)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return res.RowsAffected()
+	defer rows.Close()
+	var tags []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, name)
+	}
+	return tags, rows.Err()
+}
+
+// SetItemWaybackURL records the Wayback Machine capture of an item's link.
+func (db *SQLiteStore) SetItemWaybackURL(ctx context.Context, itemID int64, waybackURL string) error {
+	_, err := db.conn.ExecContext(ctx, "UPDATE items SET wayback_url = ? WHERE id = ?", waybackURL, itemID)
+	return err
+}
+
+// SetItemMedia creates or updates the download state of an item's enclosure.
+func (db *SQLiteStore) SetItemMedia(ctx context.Context, m model.ItemMedia) error {
+	_, err := db.conn.ExecContext(ctx, `INSERT INTO item_media (item_id, status, file, size, error, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(item_id) DO UPDATE SET status = excluded.status, file = excluded.file, size = excluded.size,
+			error = excluded.error, updated_at = excluded.updated_at`,
+		m.ItemID, m.Status, m.File, m.Size, m.Error, m.UpdatedAt.UTC())
+	return err
+}
+
+// GetItemMedia returns the download state of an item's enclosure, or
+// sql.ErrNoRows if it was never queued.
+func (db *SQLiteStore) GetItemMedia(ctx context.Context, itemID int64) (*model.ItemMedia, error) {
+	m := model.ItemMedia{ItemID: itemID}
+	err := db.conn.QueryRowContext(ctx, "SELECT status, file, size, error, updated_at FROM item_media WHERE item_id = ?", itemID).
+		Scan(&m.Status, &m.File, &m.Size, &m.Error, &m.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// GetPendingMedia returns up to limit items whose enclosure is queued for
+// download, oldest first.
+func (db *SQLiteStore) GetPendingMedia(ctx context.Context, limit int) ([]model.Item, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT `+itemColumns+` FROM items i
+		JOIN item_media m ON m.item_id = i.id
+		WHERE m.status = ? AND i.deleted_at IS NULL
+		ORDER BY m.updated_at LIMIT ?`, model.MediaPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanItems(rows)
+}
+
+// SetLinkCheck creates or updates the latest check of an item's link.
+func (db *SQLiteStore) SetLinkCheck(ctx context.Context, c model.LinkCheck) error {
+	_, err := db.conn.ExecContext(ctx, `INSERT INTO item_links (item_id, status, error, failures, dead_since, checked_at, next_check_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(item_id) DO UPDATE SET status = excluded.status, error = excluded.error, failures = excluded.failures,
+			dead_since = excluded.dead_since, checked_at = excluded.checked_at, next_check_at = excluded.next_check_at`,
+		c.ItemID, c.Status, c.Error, c.Failures, sql.NullTime{Time: c.DeadSince.UTC(), Valid: !c.DeadSince.IsZero()},
+		c.CheckedAt.UTC(), c.NextCheckAt.UTC())
+	return err
+}
+
+// GetLinkCheck returns the latest check of an item's link, or sql.ErrNoRows
+// if it was never checked.
+func (db *SQLiteStore) GetLinkCheck(ctx context.Context, itemID int64) (*model.LinkCheck, error) {
+	return scanLinkCheck(db.conn.QueryRowContext(ctx, `SELECT item_id, status, error, failures, dead_since, checked_at, next_check_at
+		FROM item_links WHERE item_id = ?`, itemID))
+}
+
+// GetLinkCheckItems returns up to limit starred or archived items whose link
+// was never checked or is due for a check at now, never checked first, then
+// longest due.
+func (db *SQLiteStore) GetLinkCheckItems(ctx context.Context, now time.Time, limit int) ([]model.Item, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT `+itemColumns+` FROM items i
+		LEFT JOIN item_links lc ON lc.item_id = i.id
+		WHERE i.deleted_at IS NULL AND i.link <> ''
+			AND (i.starred = TRUE OR EXISTS (SELECT 1 FROM item_archives ia WHERE ia.item_id = i.id))
+			AND (lc.item_id IS NULL OR lc.next_check_at <= ?)
+		ORDER BY lc.next_check_at IS NOT NULL, lc.next_check_at, i.id LIMIT ?`, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanItems(rows)
+}
+
+// SetItemEnclosures replaces the enclosures of an item.
+func (db *SQLiteStore) SetItemEnclosures(ctx context.Context, itemID int64, encs []model.Enclosure) error {
+	return saveItemEnclosures(ctx, db.conn, itemID, encs, sqlitePlaceholder)
+}
+
+// GetItemEnclosures returns the enclosures of the items, by item ID.
+func (db *SQLiteStore) GetItemEnclosures(ctx context.Context, itemIDs []int64) (map[int64][]model.Enclosure, error) {
+	return queryItemEnclosures(ctx, db.conn, itemIDs, sqlitePlaceholder)
+}
+
+// SaveItemArchive stores or replaces the page snapshot of an item.
+func (db *SQLiteStore) SaveItemArchive(ctx context.Context, a model.ItemArchive) error {
+	_, err := db.conn.ExecContext(ctx, `INSERT INTO item_archives (item_id, url, title, html, fetched_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(item_id) DO UPDATE SET url = excluded.url, title = excluded.title, html = excluded.html, fetched_at = excluded.fetched_at`,
+		a.ItemID, a.URL, a.Title, a.HTML, a.FetchedAt.UTC())
+	return err
+}
+
+// GetItemArchive returns the page snapshot of an item, or sql.ErrNoRows if
+// none is stored.
+func (db *SQLiteStore) GetItemArchive(ctx context.Context, itemID int64) (*model.ItemArchive, error) {
+	a := model.ItemArchive{ItemID: itemID}
+	err := db.conn.QueryRowContext(ctx, "SELECT url, title, html, fetched_at FROM item_archives WHERE item_id = ?", itemID).
+		Scan(&a.URL, &a.Title, &a.HTML, &a.FetchedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// SearchItemNotes returns annotated items whose note or title contains query.
+// An empty query returns every annotated item.
+func (db *SQLiteStore) SearchItemNotes(ctx context.Context, query string) ([]model.Item, error) {
+	pattern := "%" + strings.ToLower(query) + "%"
+	rows, err := db.conn.QueryContext(ctx, `SELECT `+itemColumns+` FROM items i
+		WHERE COALESCE(i.note, '') != '' AND i.deleted_at IS NULL AND (LOWER(i.note) LIKE ? OR LOWER(i.title) LIKE ?)
+		ORDER BY i.published_at DESC`, pattern, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanItems(rows)
+}
+
+// MarkItemRead marks an item as read.
+func (db *SQLiteStore) MarkItemRead(ctx context.Context, itemID int64) error {
+	_, err := db.conn.ExecContext(ctx, "UPDATE items SET is_read = 1, read_at = ? WHERE id = ? AND is_read = 0", time.Now().UTC(), itemID)
+	return err
+}
+
+// MarkItemsRead marks multiple items as read.
+func (db *SQLiteStore) MarkItemsRead(ctx context.Context, itemIDs []int64) error {
+	return db.execForIDs(ctx, "UPDATE items SET is_read = 1, read_at = ? WHERE is_read = 0 AND id IN (%s)", itemIDs, time.Now().UTC())
+}
+
+// CleanupReadItems moves all items marked as read to the trash. Annotated and starred items are kept.
+func (db *SQLiteStore) CleanupReadItems(ctx context.Context) (int64, error) {
+	res, err := db.conn.ExecContext(ctx, "UPDATE items SET deleted_at = ? WHERE is_read = 1 AND starred = 0 AND COALESCE(note, '') = '' AND deleted_at IS NULL",
+		time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// --- Trash Methods ---
+
+// GetTrashedFeeds returns feeds in the trash, most recently deleted first.
+func (db *SQLiteStore) GetTrashedFeeds(ctx context.Context) ([]model.TrashedFeed, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT `+feedColumns+`, f.deleted_at,
+		(SELECT COUNT(*) FROM items WHERE feed_id = f.id AND deleted_at >= f.deleted_at) as item_count
+		FROM feeds f WHERE f.deleted_at IS NOT NULL ORDER BY f.deleted_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanTrashedFeeds(rows)
+}
+
+// GetTrashedItems returns up to limit trashed items of feeds that are not
+// themselves in the trash, most recently deleted first.
+func (db *SQLiteStore) GetTrashedItems(ctx context.Context, limit int) ([]model.TrashedItem, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT `+itemColumns+`, i.deleted_at FROM items i
+		JOIN feeds f ON i.feed_id = f.id
+		WHERE i.deleted_at IS NOT NULL AND f.deleted_at IS NULL
+		ORDER BY i.deleted_at DESC, i.id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanTrashedItems(rows)
+}
+
+// RestoreFeed takes a feed out of the trash along with the items deleted
+// with it. Returns sql.ErrNoRows if the feed is not in the trash.
+func (db *SQLiteStore) RestoreFeed(ctx context.Context, feedID int64) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE items SET deleted_at = NULL
+		WHERE feed_id = ? AND deleted_at >= (SELECT deleted_at FROM feeds WHERE id = ?)`, feedID, feedID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	res, err := tx.ExecContext(ctx, "UPDATE feeds SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL", feedID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// RestoreItems takes items out of the trash. Returns the number restored.
+func (db *SQLiteStore) RestoreItems(ctx context.Context, itemIDs []int64) (int64, error) {
+	if len(itemIDs) == 0 {
+		return 0, nil
+	}
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	stmt, err := tx.PrepareContext(ctx, "UPDATE items SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL")
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	defer stmt.Close()
+	var restored int64
+	for _, id := range itemIDs {
+		res, err := stmt.ExecContext(ctx, id)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		n, _ := res.RowsAffected()
+		restored += n
+	}
+	return restored, tx.Commit()
+}
+
+// PurgeTrash permanently deletes feeds and items trashed before the given time.
+// Returns the number of feeds and items removed.
+func (db *SQLiteStore) PurgeTrash(ctx context.Context, before time.Time) (feeds, items int64, err error) {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM items WHERE deleted_at < ?", before.UTC())
+	if err != nil {
+		tx.Rollback()
+		return 0, 0, err
+	}
+	items, _ = res.RowsAffected()
+	// Any items left on a purged feed are removed by the cascade.
+	res, err = tx.ExecContext(ctx, "DELETE FROM feeds WHERE deleted_at < ?", before.UTC())
+	if err != nil {
+		tx.Rollback()
+		return 0, 0, err
+	}
+	feeds, _ = res.RowsAffected()
+	return feeds, items, tx.Commit()
+}
+
+// GetAuthors returns up to limit authors whose name contains query, with
+// the most prolific first. An empty query matches every author.
+func (db *SQLiteStore) GetAuthors(ctx context.Context, query string, limit int) ([]model.Author, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT MIN(author_name), COUNT(*) FROM items
+		WHERE author_name != '' AND deleted_at IS NULL AND LOWER(author_name) LIKE ?
+		GROUP BY LOWER(author_name) ORDER BY COUNT(*) DESC, MIN(author_name) LIMIT ?`,
+		"%"+strings.ToLower(query)+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var authors []model.Author
+	for rows.Next() {
+		var a model.Author
+		if err := rows.Scan(&a.Name, &a.ItemCount); err != nil {
+			return nil, err
+		}
+		authors = append(authors, a)
+	}
+	return authors, rows.Err()
+}
+
+// GetDomains returns up to limit domains containing query, with the number
+// of items and feeds linking to each, the most linked to first.
+func (db *SQLiteStore) GetDomains(ctx context.Context, query string, limit int) ([]model.Domain, error) {
+	return queryDomains(ctx, db.conn, query, limit, sqlitePlaceholder)
+}
+
+// --- Tag Methods ---
+
+// AddItemTags attaches tags to an item, creating missing tags.
+func (db *SQLiteStore) AddItemTags(ctx context.Context, itemID int64, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, name := range tags {
+		if _, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO tags (name) VALUES (?)", name); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO item_tags (item_id, tag_id)
+			SELECT ?, id FROM tags WHERE name = ?`, itemID, name); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetTags returns all tags in use with the number of items carrying each.
+func (db *SQLiteStore) GetTags(ctx context.Context) ([]model.Tag, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT t.id, t.name, COUNT(i.id) FROM tags t
+		LEFT JOIN item_tags it ON it.tag_id = t.id
+		LEFT JOIN items i ON i.id = it.item_id AND i.deleted_at IS NULL
+		GROUP BY t.id, t.name HAVING COUNT(i.id) > 0 ORDER BY t.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tags []model.Tag
+	for rows.Next() {
+		var t model.Tag
+		if err := rows.Scan(&t.ID, &t.Name, &t.ItemCount); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// GetFeedTags returns up to perFeed tags of each feed's items by feed ID,
+// the tags carried by most items first.
+func (db *SQLiteStore) GetFeedTags(ctx context.Context, perFeed int) (map[int64][]string, error) {
+	return queryFeedTags(ctx, db.conn, perFeed)
+}
+
+// SetFeedLabels replaces the labels a reader put on a feed.
+func (db *SQLiteStore) SetFeedLabels(ctx context.Context, feedID int64, labels []string) error {
+	return setFeedLabels(ctx, db.conn, feedID, labels, sqlitePlaceholder)
+}
+
+// GetFeedLabels returns the labels of each feed outside the trash by feed
+// ID, sorted by name.
+func (db *SQLiteStore) GetFeedLabels(ctx context.Context) (map[int64][]string, error) {
+	return queryFeedLabels(ctx, db.conn)
+}
+
+// --- Interest Methods ---
+
+// MarkItemOpened flags an item as opened and records a positive interest
+// event the first time it is opened.
+func (db *SQLiteStore) MarkItemOpened(ctx context.Context, itemID int64) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, "UPDATE items SET opened = 1 WHERE id = ? AND opened = 0", itemID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO interest_events (feed_id, title, positive, created_at)
+			SELECT feed_id, title, 1, ? FROM items WHERE id = ?`, time.Now(), itemID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// RecordSkippedItems records a negative interest event for each read item
+// that was neither opened nor annotated.
+func (db *SQLiteStore) RecordSkippedItems(ctx context.Context, itemIDs []int64) error {
+	if len(itemIDs) == 0 {
+		return nil
+	}
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO interest_events (feed_id, title, positive, created_at)
+		SELECT feed_id, title, 0, ? FROM items
+		WHERE id = ? AND is_read = 1 AND opened = 0 AND starred = 0 AND COALESCE(note, '') = ''`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	now := time.Now()
+	for _, id := range itemIDs {
+		if _, err := stmt.ExecContext(ctx, now, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetInterestEvents returns the most recent interest events, newest first.
+func (db *SQLiteStore) GetInterestEvents(ctx context.Context, limit int) ([]model.InterestEvent, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT feed_id, title, positive, created_at FROM interest_events
+		ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []model.InterestEvent
+	for rows.Next() {
+		var e model.InterestEvent
+		if err := rows.Scan(&e.FeedID, &e.Title, &e.Positive, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// SetInterestScores stores interest scores keyed by item ID.
+func (db *SQLiteStore) SetInterestScores(ctx context.Context, scores map[int64]float64) error {
+	if len(scores) == 0 {
+		return nil
+	}
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, "UPDATE items SET interest_score = ? WHERE id = ?")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for id, score := range scores {
+		if _, err := stmt.ExecContext(ctx, score, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// --- Audit Methods ---
+
+// AddAuditEntry appends an entry to the audit log.
+func (db *SQLiteStore) AddAuditEntry(ctx context.Context, e model.AuditEntry) error {
+	_, err := db.conn.ExecContext(ctx, "INSERT INTO audit_log (actor, action, target, created_at) VALUES (?, ?, ?, ?)",
+		e.Actor, e.Action, e.Target, e.CreatedAt)
+	return err
+}
+
+// GetAuditLog returns a page of audit entries, newest first.
+func (db *SQLiteStore) GetAuditLog(ctx context.Context, limit, offset int) ([]model.AuditEntry, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT id, actor, action, target, created_at FROM audit_log
+		ORDER BY id DESC LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []model.AuditEntry
+	for rows.Next() {
+		var e model.AuditEntry
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.Target, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// --- Job Methods ---
+
+// AddJob records a new job and returns its ID.
+func (db *SQLiteStore) AddJob(ctx context.Context, j *model.Job) (int64, error) {
+	res, err := db.conn.ExecContext(ctx, `INSERT INTO jobs (kind, state, payload, result, error, done, total, attempts,
+		created_at, started_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		j.Kind, j.State, j.Payload, j.Result, j.Error, j.Done, j.Total, j.Attempts,
+		j.CreatedAt.UTC(), sql.NullTime{Time: j.StartedAt.UTC(), Valid: !j.StartedAt.IsZero()}, j.UpdatedAt.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// GetJob returns a job, or sql.ErrNoRows if there is none with that ID.
+func (db *SQLiteStore) GetJob(ctx context.Context, jobID int64) (*model.Job, error) {
+	return getJob(ctx, db.conn, jobID, sqlitePlaceholder)
+}
+
+// GetJobs returns the newest jobs.
+func (db *SQLiteStore) GetJobs(ctx context.Context, limit int) ([]model.Job, error) {
+	return queryJobs(ctx, db.conn, "SELECT "+jobColumns+" FROM jobs ORDER BY id DESC LIMIT ?", limit)
+}
+
+// UpdateJob saves the state, progress and outcome of a job.
+func (db *SQLiteStore) UpdateJob(ctx context.Context, j *model.Job) error {
+	return updateJob(ctx, db.conn, j, sqlitePlaceholder)
+}
+
+// GetStaleJobs returns the running jobs not updated since a time.
+func (db *SQLiteStore) GetStaleJobs(ctx context.Context, since time.Time) ([]model.Job, error) {
+	return queryJobs(ctx, db.conn, "SELECT "+jobColumns+" FROM jobs WHERE state = ? AND updated_at < ? ORDER BY id",
+		model.JobRunning, since.UTC())
+}
+
+// ClaimJob restarts a job that is still stale, counting the attempt.
+func (db *SQLiteStore) ClaimJob(ctx context.Context, jobID int64, stale, now time.Time) (bool, error) {
+	return claimJob(ctx, db.conn, jobID, stale, now, sqlitePlaceholder)
+}
+
+// PruneJobs deletes the jobs finished before a time.
+func (db *SQLiteStore) PruneJobs(ctx context.Context, before time.Time) (int64, error) {
+	res, err := db.conn.ExecContext(ctx, "DELETE FROM jobs WHERE finished_at < ?", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// --- Maintenance Methods ---
+
+// Maintain runs an integrity check, returns free pages to the file system
+// with an incremental vacuum and truncates the WAL. The first run switches
+// the database to incremental auto-vacuum, which takes one full VACUUM.
+// A database failing the integrity check is left untouched.
+func (db *SQLiteStore) Maintain(ctx context.Context) (*model.MaintenanceReport, error) {
+	start := time.Now()
+	// The pragmas below must all run on the same connection.
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	path, err := sqliteFile(ctx, conn)
+	if err != nil {
+		return nil, fmt.Errorf("locate database file: %w", err)
+	}
+	report := &model.MaintenanceReport{SizeBefore: sqliteSize(path)}
+
+	problems, err := pragmaStrings(ctx, conn, "PRAGMA integrity_check")
+	if err != nil {
+		return nil, fmt.Errorf("integrity check: %w", err)
+	}
+	report.Integrity = strings.Join(problems, "; ")
+
+	if report.Integrity == "ok" {
+		var mode int
+		if err := conn.QueryRowContext(ctx, "PRAGMA auto_vacuum").Scan(&mode); err != nil {
+			return nil, err
+		}
+		if mode != 2 { // not yet INCREMENTAL
+			if _, err := conn.ExecContext(ctx, "PRAGMA auto_vacuum = INCREMENTAL"); err != nil {
+				return nil, err
+			}
+			if _, err := conn.ExecContext(ctx, "VACUUM"); err != nil {
+				return nil, fmt.Errorf("vacuum: %w", err)
+			}
+		} else if _, err := pragmaStrings(ctx, conn, "PRAGMA incremental_vacuum"); err != nil {
+			return nil, fmt.Errorf("incremental vacuum: %w", err)
+		}
+		var busy, logFrames, checkpointed int
+		if err := conn.QueryRowContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logFrames, &checkpointed); err != nil {
+			return nil, fmt.Errorf("checkpoint: %w", err)
+		}
+	}
+
+	report.SizeAfter = sqliteSize(path)
+	report.Reclaimed = max(report.SizeBefore-report.SizeAfter, 0)
+	report.DurationMs = time.Since(start).Milliseconds()
+	return report, nil
+}
+
+// GetStorageReport counts the items, by feed, and measures the database
+// file and its tables.
+func (db *SQLiteStore) GetStorageReport(ctx context.Context) (*model.StorageReport, error) {
+	report, err := queryStorage(ctx, db.conn, sqliteOctets)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	path, err := sqliteFile(ctx, conn)
+	if err != nil {
+		return nil, fmt.Errorf("locate database file: %w", err)
+	}
+	report.Size = sqliteSize(path)
+	// dbstat measures each b-tree; indexes count towards their table.
+	report.Tables, err = queryTableSizes(ctx, conn, `SELECT COALESCE(m.tbl_name, d.name) AS tbl, SUM(d.pgsize) AS bytes
+		FROM dbstat d LEFT JOIN sqlite_schema m ON m.name = d.name
+		GROUP BY tbl ORDER BY bytes DESC, tbl`)
+	if err != nil {
+		return nil, fmt.Errorf("table sizes: %w", err)
+	}
+	return report, nil
+}
+
+// FindOrphans reports rows left behind by deleted ones.
+func (db *SQLiteStore) FindOrphans(ctx context.Context) (*model.OrphanReport, error) {
+	return findOrphans(ctx, db.conn)
+}
+
+// FixOrphans removes rows left behind by deleted ones, moving orphaned
+// folders to the top level.
+func (db *SQLiteStore) FixOrphans(ctx context.Context) (*model.OrphanReport, error) {
+	return fixOrphans(ctx, db.conn, sqlitePlaceholder)
+}
+
+// sqliteFile returns the path of the main database file, empty if in memory.
+func sqliteFile(ctx context.Context, conn *sql.Conn) (string, error) {
+	rows, err := conn.QueryContext(ctx, "PRAGMA database_list")
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var seq int
+		var name, file string
+		if err := rows.Scan(&seq, &name, &file); err != nil {
+			return "", err
+		}
+		if name == "main" {
+			return file, nil
+		}
+	}
+	return "", rows.Err()
+}
+
+// sqliteSize returns the combined size of a database file and its WAL.
+func sqliteSize(path string) int64 {
+	if path == "" {
+		return 0
+	}
+	var total int64
+	for _, p := range []string{path, path + "-wal"} {
+		if fi, err := os.Stat(p); err == nil {
+			total += fi.Size()
+		}
+	}
+	return total
+}
+
+// pragmaStrings runs a pragma to completion and returns the rows it
+// produced as strings.
+func pragmaStrings(ctx context.Context, conn *sql.Conn, pragma string) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, pragma)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
 }
 
 // --- Settings Methods ---
 
 // GetSetting retrieves a setting value.
-func (db *SQLiteStore) GetSetting(key string) (string, error) {
+func (db *SQLiteStore) GetSetting(ctx context.Context, key string) (string, error) {
 	var val string
-	err := db.conn.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&val)
+	err := db.conn.QueryRowContext(ctx, "SELECT value FROM settings WHERE key = ?", key).Scan(&val)
 	return val, err
 }
 
 // SetSetting saves a setting.
-func (db *SQLiteStore) SetSetting(key, value string) error {
-	_, err := db.conn.Exec("INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = ?", key, value, value)
+func (db *SQLiteStore) SetSetting(ctx context.Context, key, value string) error {
+	_, err := db.conn.ExecContext(ctx, "INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = ?", key, value, value)
 	return err
 }
 
+// SetSettings saves several settings in one transaction.
+func (db *SQLiteStore) SetSettings(ctx context.Context, values map[string]string) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for key, value := range values {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = ?", key, value, value); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
 // GetPollingInterval returns the polling interval in minutes, with a minimum of 15.
-func (db *SQLiteStore) GetPollingInterval() (int, error) {
-	val, err := db.GetSetting(model.SettingPollingInterval)
+func (db *SQLiteStore) GetPollingInterval(ctx context.Context) (int, error) {
+	val, err := db.GetSetting(ctx, model.SettingPollingInterval)
 	if err != nil {
 		return 15, nil // default
 	}
@@ -2,6 +2,8 @@
 package database
 
 import (
+	"context"
+	"strconv"
 	"time"
 
 	"github.com/bryan-buckman/infovore/internal/model"
@@ -9,6 +11,8 @@ import (
 
 // Store defines the interface for database operations.
 // Both SQLite and PostgreSQL implementations satisfy this interface.
+// Methods take the context of the request or job they serve, so that their
+// queries are abandoned when it is cancelled, e.g. by a client going away.
 type Store interface {
 	Close() error
 
@@ -21,39 +25,211 @@ type Store interface {
 	SupportsHighConcurrency() bool
 
 	// Folder operations
-	GetFolders() ([]model.Folder, error)
-	CreateFolder(name string, parentID *int64) (int64, error)
-	GetOrCreateFolder(name string, parentID *int64) (int64, error)
-	GetFolderByID(folderID int64) (*model.Folder, error)
-	DeleteFolder(folderID int64) error
+	GetFolders(ctx context.Context) ([]model.Folder, error)
+	CreateFolder(ctx context.Context, name string, parentID *int64) (int64, error)
+	GetOrCreateFolder(ctx context.Context, name string, parentID *int64) (int64, error)
+	GetFolderByID(ctx context.Context, folderID int64) (*model.Folder, error)
+	DeleteFolder(ctx context.Context, folderID int64) error
 
 	// Feed operations
-	GetFeeds(folderID *int64) ([]model.Feed, error)
-	GetAllFeeds() ([]model.Feed, error)
-	GetFeedsByFolderID(folderID int64) ([]model.Feed, error)
-	GetUnfiledFeeds() ([]model.Feed, error)
-	GetFoldersWithFeeds() ([]model.FolderWithFeeds, error)
-	CreateFeed(folderID *int64, title, url string) (int64, error)
-	GetOrCreateFeed(folderID *int64, title, url string) (int64, bool, error)
-	UpdateFeedLastFetched(feedID int64, t time.Time) error
-	UpdateFeedTitle(feedID int64, title string) error
-	UpdateFeedError(feedID int64, errMsg string) error
-	GetFeedByID(feedID int64) (*model.Feed, error)
-	DeleteFeed(feedID int64) error
-	MoveFeedToFolder(feedID int64, folderID *int64) error
+	GetFeeds(ctx context.Context, folderID *int64) ([]model.Feed, error)
+	GetAllFeeds(ctx context.Context) ([]model.Feed, error)
+	GetFeedsByFolderID(ctx context.Context, folderID int64) ([]model.Feed, error)
+	GetUnfiledFeeds(ctx context.Context) ([]model.Feed, error)
+	GetFoldersWithFeeds(ctx context.Context) ([]model.FolderWithFeeds, error)
+	CreateFeed(ctx context.Context, folderID *int64, title, url string) (int64, error)
+	GetOrCreateFeed(ctx context.Context, folderID *int64, title, url string) (int64, bool, error)
+	CreateInboxFeed(ctx context.Context, folderID *int64, title, token string) (int64, error)
+	GetFeedByInboxToken(ctx context.Context, token string) (*model.Feed, error)
+	UpdateFeedLastFetched(ctx context.Context, feedID int64, t time.Time) error
+	UpdateFeedNextFetch(ctx context.Context, feedID int64, t time.Time) error
+	UpdateFeedTitle(ctx context.Context, feedID int64, title string) error
+	UpdateFeedMetadata(ctx context.Context, feedID int64, title, siteURL, description, iconURL string) error
+	UpdateFeedOptions(ctx context.Context, feedID int64, opts model.FeedOptions) error
+	UpdateFeedError(ctx context.Context, feedID int64, fe model.FetchError, t time.Time) error
+	SetFeedSuggestedURL(ctx context.Context, feedID int64, url string) error
+	UpdateFeedURL(ctx context.Context, feedID int64, url string) error
+	SetFeedIcon(ctx context.Context, icon model.FeedIcon) error
+	GetFeedIcon(ctx context.Context, feedID int64) (*model.FeedIcon, error)
+	DeleteFeedIcon(ctx context.Context, feedID int64) error
+	AddFetchLog(ctx context.Context, e model.FetchLogEntry) error
+	GetFetchStats(ctx context.Context) ([]model.FetchStats, error)
+	PruneFetchLog(ctx context.Context, before time.Time) (int64, error)
+	SetFeedHealth(ctx context.Context, scores map[int64]int) error
+	GetFeedByID(ctx context.Context, feedID int64) (*model.Feed, error)
+	SearchFeeds(ctx context.Context, query string) ([]model.Feed, error)
+	DeleteFeed(ctx context.Context, feedID int64) error
+	MoveFeedToFolder(ctx context.Context, feedID int64, folderID *int64) error
+	SetSidebarOrder(ctx context.Context, folderIDs, feedIDs []int64) error
+
+	// ImportFeeds subscribes to feeds, creating their folders as needed,
+	// in one transaction: if it fails, nothing is imported. Results are
+	// ImportAdded or ImportExists, in the order of feeds. progress, if not
+	// nil, is called with the number of feeds done after each one.
+	ImportFeeds(ctx context.Context, feeds []model.ImportFeed, progress func(done int)) ([]model.ImportResult, error)
 
 	// Item operations
-	AddItem(item *model.Item) (int64, bool, error)
-	GetItems(feedID int64, onlyUnread bool) ([]model.Item, error)
-	GetAllItems(onlyUnread bool) ([]model.Item, error)
-	GetItemsByFolderID(folderID int64, onlyUnread bool) ([]model.Item, error)
-	MarkItemRead(itemID int64) error
-	MarkItemsRead(itemIDs []int64) error
-	DeleteReadItems(itemIDs []int64) error
-	CleanupReadItems() (int64, error)
+	AddItem(ctx context.Context, item *model.Item) (int64, bool, error)
+	// AddItems adds items in bulk, for large imports. Besides what AddItem
+	// stores it keeps their read state, note, summary and Wayback URL. It
+	// returns the ID of each item, 0 where its feed already had its GUID.
+	AddItems(ctx context.Context, items []model.Item) ([]int64, error)
+	GetItems(ctx context.Context, feedID int64, onlyUnread bool) ([]model.Item, error)
+	GetAllItems(ctx context.Context, onlyUnread bool) ([]model.Item, error)
+	GetItemsByFolderID(ctx context.Context, folderID int64, onlyUnread bool) ([]model.Item, error)
+	QueryItems(ctx context.Context, filter model.ItemFilter) ([]model.Item, error)
+	GetItemByID(ctx context.Context, itemID int64) (*model.Item, error)
+	SetItemNote(ctx context.Context, itemID int64, note string) error
+	SetItemPosition(ctx context.Context, itemID int64, percent float64) error
+	SetItemSummary(ctx context.Context, itemID int64, summary string) error
+	SetItemStarred(ctx context.Context, itemID int64, starred bool) error
+	GetItemTags(ctx context.Context, itemID int64) ([]string, error)
+	SetItemWaybackURL(ctx context.Context, itemID int64, waybackURL string) error
+	SetItemMedia(ctx context.Context, m model.ItemMedia) error
+	GetItemMedia(ctx context.Context, itemID int64) (*model.ItemMedia, error)
+	GetPendingMedia(ctx context.Context, limit int) ([]model.Item, error)
+	SetLinkCheck(ctx context.Context, c model.LinkCheck) error
+	GetLinkCheck(ctx context.Context, itemID int64) (*model.LinkCheck, error)
+	// GetLinkCheckItems returns up to limit starred or archived items whose
+	// link was never checked or is due for a check at now, never checked
+	// first, then longest due.
+	GetLinkCheckItems(ctx context.Context, now time.Time, limit int) ([]model.Item, error)
+	SetItemEnclosures(ctx context.Context, itemID int64, encs []model.Enclosure) error
+	// GetItemEnclosures returns the enclosures of the items, by item ID.
+	GetItemEnclosures(ctx context.Context, itemIDs []int64) (map[int64][]model.Enclosure, error)
+	SaveItemArchive(ctx context.Context, a model.ItemArchive) error
+	GetItemArchive(ctx context.Context, itemID int64) (*model.ItemArchive, error)
+	SearchItemNotes(ctx context.Context, query string) ([]model.Item, error)
+	GetAuthors(ctx context.Context, query string, limit int) ([]model.Author, error)
+	// GetDomains returns up to limit domains containing query, the most
+	// linked to first. An empty query matches every domain.
+	GetDomains(ctx context.Context, query string, limit int) ([]model.Domain, error)
+	MarkItemRead(ctx context.Context, itemID int64) error
+	MarkItemsRead(ctx context.Context, itemIDs []int64) error
+	MarkReadByFilter(ctx context.Context, filter model.ItemFilter) (int64, error)
+	// GetReadActivity returns the items read since a time, including
+	// trashed ones, and the unread items.
+	GetReadActivity(ctx context.Context, since time.Time) ([]model.ItemActivity, error)
+	DeleteReadItems(ctx context.Context, itemIDs []int64) error
+	// MergeItems saves keep's read state, star and note, gives it the tags
+	// of the duplicates and moves the duplicates to the trash, in one
+	// transaction.
+	MergeItems(ctx context.Context, keep model.Item, duplicateIDs []int64) error
+	CleanupReadItems(ctx context.Context) (int64, error)
+
+	// Trash operations
+	GetTrashedFeeds(ctx context.Context) ([]model.TrashedFeed, error)
+	GetTrashedItems(ctx context.Context, limit int) ([]model.TrashedItem, error)
+	RestoreFeed(ctx context.Context, feedID int64) error
+	RestoreItems(ctx context.Context, itemIDs []int64) (int64, error)
+	PurgeTrash(ctx context.Context, before time.Time) (feeds, items int64, err error)
+
+	// Tag operations
+	AddItemTags(ctx context.Context, itemID int64, tags []string) error
+	GetTags(ctx context.Context) ([]model.Tag, error)
+	// GetFeedTags returns up to perFeed tags of each feed's items by feed
+	// ID, the tags carried by most items first.
+	GetFeedTags(ctx context.Context, perFeed int) (map[int64][]string, error)
+	// SetFeedLabels replaces the labels a reader put on a feed.
+	SetFeedLabels(ctx context.Context, feedID int64, labels []string) error
+	// GetFeedLabels returns the labels of each feed outside the trash by
+	// feed ID, sorted by name.
+	GetFeedLabels(ctx context.Context) (map[int64][]string, error)
+
+	// Interest operations
+	MarkItemOpened(ctx context.Context, itemID int64) error
+	RecordSkippedItems(ctx context.Context, itemIDs []int64) error
+	GetInterestEvents(ctx context.Context, limit int) ([]model.InterestEvent, error)
+	SetInterestScores(ctx context.Context, scores map[int64]float64) error
+
+	// Audit operations
+	AddAuditEntry(ctx context.Context, e model.AuditEntry) error
+	GetAuditLog(ctx context.Context, limit, offset int) ([]model.AuditEntry, error)
+
+	// Job operations
+	AddJob(ctx context.Context, job *model.Job) (int64, error)
+	GetJob(ctx context.Context, jobID int64) (*model.Job, error)
+	GetJobs(ctx context.Context, limit int) ([]model.Job, error) // newest first
+	UpdateJob(ctx context.Context, job *model.Job) error
+	// GetStaleJobs returns the running jobs that showed no sign of life
+	// since a time, because the instance running them stopped.
+	GetStaleJobs(ctx context.Context, since time.Time) ([]model.Job, error)
+	// ClaimJob restarts a job that is still stale, counting the attempt. It
+	// reports false if the job finished or was claimed since, e.g. by
+	// another instance.
+	ClaimJob(ctx context.Context, jobID int64, stale, now time.Time) (bool, error)
+	// PruneJobs deletes the jobs finished before a time.
+	PruneJobs(ctx context.Context, before time.Time) (int64, error)
+
+	// Maintain checks and compacts the database.
+	Maintain(ctx context.Context) (*model.MaintenanceReport, error)
+
+	// GetStorageReport counts the items, by feed, and measures the space
+	// they and the database take.
+	GetStorageReport(ctx context.Context) (*model.StorageReport, error)
+
+	// FindOrphans reports rows left behind by deleted ones; FixOrphans
+	// removes them, or for folders moves them to the top level, and reports
+	// what it changed.
+	FindOrphans(ctx context.Context) (*model.OrphanReport, error)
+	FixOrphans(ctx context.Context) (*model.OrphanReport, error)
 
 	// Settings operations
-	GetSetting(key string) (string, error)
-	SetSetting(key, value string) error
-	GetPollingInterval() (int, error)
+	GetSetting(ctx context.Context, key string) (string, error)
+	SetSetting(ctx context.Context, key, value string) error
+	SetSettings(ctx context.Context, values map[string]string) error // all or none
+	GetPollingInterval(ctx context.Context) (int, error)
+}
+
+// Cluster is implemented by stores that several app instances can share
+// (PostgreSQL). Stores that don't implement it serve a single instance.
+type Cluster interface {
+	// TryLock takes the cluster-wide lock called name without waiting.
+	// It returns nil if another instance holds the lock.
+	TryLock(ctx context.Context, name string) (Lock, error)
+
+	// Notify sends payload to every instance listening on channel,
+	// including this one.
+	Notify(channel, payload string) error
+
+	// Listen calls handle for each payload sent on channel until ctx is
+	// done. After a lost connection handle is called with "", since
+	// notifications may have been missed.
+	Listen(ctx context.Context, channel string, handle func(payload string)) error
+}
+
+// Lock is a cluster-wide lock held by this instance.
+type Lock interface {
+	// Check returns an error if the lock has been lost.
+	Check(ctx context.Context) error
+	// Release gives up the lock.
+	Release() error
+}
+
+// sidebarSort returns the configured sidebar sort mode.
+func sidebarSort(ctx context.Context, s Store) string {
+	mode, _ := s.GetSetting(ctx, model.SettingSidebarSort)
+	return mode
+}
+
+// folderSort returns the configured sort mode for sidebar folders.
+func folderSort(ctx context.Context, s Store) string {
+	if mode, _ := s.GetSetting(ctx, model.SettingSidebarFolderSort); mode != "" {
+		return mode
+	}
+	return sidebarSort(ctx, s)
+}
+
+// GetIntSetting reads an integer setting, returning def when the setting is
+// missing or malformed.
+func GetIntSetting(ctx context.Context, s Store, key string, def int) int {
+	val, err := s.GetSetting(ctx, key)
+	if err != nil {
+		return def
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return def
+	}
+	return n
 }
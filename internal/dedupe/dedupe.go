@@ -0,0 +1,278 @@
+// Package dedupe finds articles stored more than once in a feed, e.g. after
+// the feed changed its GUIDs or moved, and merges the copies. A Policy,
+// configured through the dedupe_mode and dedupe_window_hours settings,
+// decides which items count as the same article, both here and when new
+// items are stored.
+package dedupe
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/feedurl"
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// Modes accepted by the dedupe_mode setting.
+const (
+	// ModeGUID stores every entry with a new GUID. Duplicates found later
+	// are compared by link, or by title for items without a link.
+	ModeGUID = "guid"
+	// ModeLink also skips new entries linking to an article the feed
+	// already has, and compares duplicates by link only.
+	ModeLink = "link"
+	// ModeTitle also skips new entries titled like an article the feed
+	// already has, and compares duplicates by title only.
+	ModeTitle = "title"
+)
+
+// ValidMode reports whether mode is a dedupe mode, "" meaning ModeGUID.
+func ValidMode(mode string) bool {
+	return mode == "" || mode == ModeGUID || mode == ModeLink || mode == ModeTitle
+}
+
+// Policy decides which items of a feed are the same article.
+type Policy struct {
+	Mode string
+	// Window, if not zero, is how far apart the publish dates of two
+	// copies may be. Articles republished later under the same link or
+	// title are then kept apart.
+	Window time.Duration
+}
+
+// PolicyFromSettings returns the policy configured in db.
+func PolicyFromSettings(ctx context.Context, db database.Store) Policy {
+	mode, _ := db.GetSetting(ctx, model.SettingDedupeMode)
+	if !ValidMode(mode) || mode == "" {
+		mode = ModeGUID
+	}
+	hours := database.GetIntSetting(ctx, db, model.SettingDedupeWindowHours, 0)
+	return Policy{Mode: mode, Window: time.Duration(max(hours, 0)) * time.Hour}
+}
+
+// Key returns the key under which the policy compares items of a feed, or
+// "" if the item can't be compared.
+func (p Policy) Key(it model.Item) string {
+	switch p.Mode {
+	case ModeLink:
+		return linkKey(it.Link)
+	case ModeTitle:
+		return titleKey(it.Title)
+	}
+	return Key(it)
+}
+
+// near reports whether two copies were published close enough to be the
+// same article.
+func (p Policy) near(a, b model.Item) bool {
+	if p.Window <= 0 {
+		return true
+	}
+	d := a.PublishedAt.Sub(b.PublishedAt)
+	return d <= p.Window && d >= -p.Window
+}
+
+// Group is an article stored several times in one feed. Keep is the copy
+// fetched first; the others are its duplicates.
+type Group struct {
+	Keep       model.Item
+	Duplicates []model.Item
+}
+
+// Key returns the key under which items of a feed are compared: the link,
+// ignoring the differences feedurl.Key ignores, or for items without a link
+// the title, case-folded with its whitespace collapsed. Empty if the item
+// has neither.
+func Key(it model.Item) string {
+	if k := linkKey(it.Link); k != "" {
+		return k
+	}
+	return titleKey(it.Title)
+}
+
+func linkKey(link string) string {
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return ""
+	}
+	return "link:" + feedurl.Key(link)
+}
+
+func titleKey(title string) string {
+	if title = strings.Join(strings.Fields(strings.ToLower(title)), " "); title != "" {
+		return "title:" + title
+	}
+	return ""
+}
+
+// Find groups the items that share a feed and a key under the policy, and
+// were published within its window of the group's kept item. Groups are
+// ordered by their kept item.
+func (p Policy) Find(items []model.Item) []Group {
+	type groupKey struct {
+		feedID int64
+		key    string
+	}
+	byKey := make(map[groupKey][]model.Item)
+	for _, it := range items {
+		if k := p.Key(it); k != "" {
+			gk := groupKey{it.FeedID, k}
+			byKey[gk] = append(byKey[gk], it)
+		}
+	}
+
+	var groups []Group
+	for _, copies := range byKey {
+		if len(copies) < 2 {
+			continue
+		}
+		sort.Slice(copies, func(i, j int) bool { return older(copies[i], copies[j]) })
+		var found []Group
+	next:
+		for _, c := range copies {
+			for n := range found {
+				if p.near(found[n].Keep, c) {
+					found[n].Duplicates = append(found[n].Duplicates, c)
+					continue next
+				}
+			}
+			found = append(found, Group{Keep: c})
+		}
+		for _, g := range found {
+			if len(g.Duplicates) > 0 {
+				groups = append(groups, g)
+			}
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Keep.ID < groups[j].Keep.ID })
+	return groups
+}
+
+// older reports whether a was stored before b.
+func older(a, b model.Item) bool {
+	if !a.FetchedAt.Equal(b.FetchedAt) {
+		return a.FetchedAt.Before(b.FetchedAt)
+	}
+	return a.ID < b.ID
+}
+
+// Merged returns the kept item with the state of its duplicates folded in:
+// read or starred if any copy is, with the distinct notes of all copies.
+func (g Group) Merged() model.Item {
+	keep := g.Keep
+	notes := []string{}
+	if keep.Note != "" {
+		notes = append(notes, keep.Note)
+	}
+	for _, d := range g.Duplicates {
+		keep.IsRead = keep.IsRead || d.IsRead
+		keep.Starred = keep.Starred || d.Starred
+		if d.Note != "" && !contains(notes, d.Note) {
+			notes = append(notes, d.Note)
+		}
+	}
+	keep.Note = strings.Join(notes, "\n\n")
+	return keep
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Run finds the duplicates among the items outside the trash under the
+// configured policy and, unless dryRun is set, merges each group into its
+// kept item, moving the duplicates to the trash. It returns the groups
+// found, or on error the groups merged before it.
+func Run(ctx context.Context, db database.Store, dryRun bool) ([]Group, error) {
+	items, err := db.QueryItems(ctx, model.ItemFilter{})
+	if err != nil {
+		return nil, err
+	}
+	groups := PolicyFromSettings(ctx, db).Find(items)
+	if dryRun {
+		return groups, nil
+	}
+	for n, g := range groups {
+		ids := make([]int64, len(g.Duplicates))
+		for i, d := range g.Duplicates {
+			ids[i] = d.ID
+		}
+		if err := db.MergeItems(ctx, g.Merged(), ids); err != nil {
+			return groups[:n], err
+		}
+	}
+	return groups, nil
+}
+
+// Index holds the items of a feed, to recognize new entries that duplicate
+// one of them under a policy.
+type Index struct {
+	policy Policy
+	byKey  map[string][]model.Item
+}
+
+// NewIndex returns an index of a feed's items. It returns nil for
+// ModeGUID, under which the store's GUID check is all there is.
+func NewIndex(p Policy, items []model.Item) *Index {
+	if p.Mode != ModeLink && p.Mode != ModeTitle {
+		return nil
+	}
+	idx := &Index{policy: p, byKey: make(map[string][]model.Item)}
+	for _, it := range items {
+		idx.Add(it)
+	}
+	return idx
+}
+
+// Add records an item stored in the feed.
+func (idx *Index) Add(it model.Item) {
+	if idx == nil {
+		return
+	}
+	if k := idx.policy.Key(it); k != "" {
+		idx.byKey[k] = append(idx.byKey[k], it)
+	}
+}
+
+// Duplicates reports whether an entry is a copy, under another GUID, of an
+// item in the index. An entry with the GUID of a stored item is the same
+// item, not a copy. A nil index finds no copies.
+func (idx *Index) Duplicates(it model.Item) bool {
+	if idx == nil {
+		return false
+	}
+	for _, other := range idx.byKey[idx.policy.Key(it)] {
+		if other.GUID != it.GUID && idx.policy.near(other, it) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadIndex returns the index of a feed's items under the configured
+// policy, for storing entries published at or after oldest. Items further
+// back than the policy's window can't match those entries and are left out.
+// It returns nil under ModeGUID.
+func LoadIndex(ctx context.Context, db database.Store, feedID int64, oldest time.Time) (*Index, error) {
+	p := PolicyFromSettings(ctx, db)
+	if p.Mode != ModeLink && p.Mode != ModeTitle {
+		return nil, nil
+	}
+	filter := model.ItemFilter{FeedID: &feedID}
+	if p.Window > 0 {
+		filter.Since = oldest.Add(-p.Window)
+	}
+	items, err := db.QueryItems(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return NewIndex(p, items), nil
+}
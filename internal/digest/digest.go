@@ -0,0 +1,214 @@
+// Package digest holds back the items of low-priority folders from the main
+// stream and delivers them once a day as a single grouped item in a virtual
+// "Daily Digest" feed.
+package digest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// DefaultHour is the local hour the digest is delivered at unless
+// digest_hour says otherwise.
+const DefaultHour = 7
+
+// CheckInterval is how often the background job checks whether the digest
+// is due.
+const CheckInterval = 15 * time.Minute
+
+// FeedTitle is the title of the virtual feed digests are delivered to.
+const FeedTitle = "Daily Digest"
+
+// firstWindow is how far back the first digest reaches.
+const firstWindow = 24 * time.Hour
+
+// Folders returns the IDs of the folders held back for the digest.
+func Folders(ctx context.Context, db database.Store) []int64 {
+	val, err := db.GetSetting(ctx, model.SettingDigestFolders)
+	if err != nil {
+		return nil
+	}
+	var ids []int64
+	if err := json.Unmarshal([]byte(val), &ids); err != nil {
+		return nil
+	}
+	return ids
+}
+
+// Hour returns the local hour the digest is delivered at.
+func Hour(ctx context.Context, db database.Store) int {
+	hour := database.GetIntSetting(ctx, db, model.SettingDigestHour, DefaultHour)
+	if hour < 0 || hour > 23 {
+		return DefaultHour
+	}
+	return hour
+}
+
+// lastRun returns when the last digest was made, zero if never.
+func lastRun(ctx context.Context, db database.Store) time.Time {
+	raw, _ := db.GetSetting(ctx, model.SettingDigestLastRun)
+	t, _ := time.Parse(time.RFC3339, raw)
+	return t
+}
+
+// Due reports whether today's digest should be made now: some folders are
+// held back, the digest hour has passed, and no digest was made since.
+func Due(ctx context.Context, db database.Store, now time.Time) bool {
+	if len(Folders(ctx, db)) == 0 {
+		return false
+	}
+	y, m, d := now.Date()
+	at := time.Date(y, m, d, Hour(ctx, db), 0, 0, 0, now.Location())
+	return !now.Before(at) && lastRun(ctx, db).Before(at)
+}
+
+// Run delivers the items of the digest folders fetched since the last
+// digest as one item, and records the run. It returns the new item's ID and
+// how many items it lists; with nothing to list no item is made and the ID
+// is 0.
+func Run(ctx context.Context, db database.Store, now time.Time) (int64, int, error) {
+	since := lastRun(ctx, db)
+	if since.IsZero() {
+		since = now.Add(-firstWindow)
+	}
+	var items []model.Item
+	for _, folderID := range Folders(ctx, db) {
+		found, err := db.QueryItems(ctx, model.ItemFilter{FolderID: &folderID, FetchedSince: since})
+		if err != nil {
+			return 0, 0, err
+		}
+		items = append(items, found...)
+	}
+
+	var itemID int64
+	if len(items) > 0 {
+		feeds, err := db.GetAllFeeds(ctx)
+		if err != nil {
+			return 0, 0, err
+		}
+		titles := make(map[int64]string, len(feeds))
+		for _, f := range feeds {
+			titles[f.ID] = f.Title
+		}
+		feedID, _, err := db.GetOrCreateFeed(ctx, nil, FeedTitle, model.DigestURLPrefix)
+		if err != nil {
+			return 0, 0, err
+		}
+		itemID, _, err = db.AddItem(ctx, &model.Item{
+			FeedID:      feedID,
+			GUID:        model.DigestURLPrefix + now.UTC().Format(time.RFC3339),
+			Title:       fmt.Sprintf("%s for %s", FeedTitle, now.Format("Monday, 2 January")),
+			Content:     render(items, titles),
+			PublishedAt: now,
+			FetchedAt:   now,
+		})
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if err := db.SetSetting(ctx, model.SettingDigestLastRun, now.UTC().Format(time.RFC3339)); err != nil {
+		return 0, 0, err
+	}
+	return itemID, len(items), nil
+}
+
+// render lists items as HTML grouped by feed, feeds by title and items
+// newest first.
+func render(items []model.Item, titles map[int64]string) string {
+	byFeed := make(map[int64][]model.Item)
+	for _, it := range items {
+		byFeed[it.FeedID] = append(byFeed[it.FeedID], it)
+	}
+	feedIDs := make([]int64, 0, len(byFeed))
+	for id := range byFeed {
+		feedIDs = append(feedIDs, id)
+	}
+	sort.Slice(feedIDs, func(i, j int) bool {
+		return titles[feedIDs[i]] < titles[feedIDs[j]]
+	})
+
+	var b strings.Builder
+	for _, id := range feedIDs {
+		fmt.Fprintf(&b, "<h3>%s</h3>\n<ul>\n", html.EscapeString(titles[id]))
+		list := byFeed[id]
+		sort.Slice(list, func(i, j int) bool { return list[i].PublishedAt.After(list[j].PublishedAt) })
+		for _, it := range list {
+			if it.Link != "" {
+				fmt.Fprintf(&b, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(it.Link), html.EscapeString(it.Title))
+			} else {
+				fmt.Fprintf(&b, "<li>%s</li>\n", html.EscapeString(it.Title))
+			}
+		}
+		b.WriteString("</ul>\n")
+	}
+	return b.String()
+}
+
+// Job delivers the digest each day at the digest hour.
+type Job struct {
+	db       database.Store
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+
+	// Deliver, if set, delivers a due digest instead of Run, e.g. as a
+	// recorded job. It should return once the digest is delivered.
+	Deliver func()
+}
+
+// NewJob creates a digest job.
+func NewJob(db database.Store) *Job {
+	return &Job{
+		db:       db,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins the digest loop.
+func (j *Job) Start() {
+	j.stopChan = make(chan struct{})
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		ctx := context.Background()
+		for {
+			if Due(ctx, j.db, time.Now()) {
+				j.run()
+			}
+			select {
+			case <-j.stopChan:
+				return
+			case <-time.After(CheckInterval):
+			}
+		}
+	}()
+}
+
+func (j *Job) run() {
+	if j.Deliver != nil {
+		j.Deliver()
+		return
+	}
+	ctx := context.Background()
+	_, n, err := Run(ctx, j.db, time.Now())
+	if err != nil {
+		log.Printf("Digest: %v", err)
+		return
+	}
+	log.Printf("Digest: delivered %d items", n)
+}
+
+// Stop stops the job gracefully.
+func (j *Job) Stop() {
+	close(j.stopChan)
+	j.wg.Wait()
+}
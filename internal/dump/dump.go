@@ -0,0 +1,527 @@
+// Package dump writes the whole dataset (folders, feeds, items with their
+// read and star state, tags and settings) as versioned JSON lines, and reads
+// such a dump back into any store. It only uses the Store interface, so a
+// dump made from one backend can be loaded into another.
+package dump
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// Version is the format version written in the header record.
+const Version = 1
+
+// ContentType is the media type of a dump.
+const ContentType = "application/x-ndjson"
+
+// Record types. A dump starts with one header record, followed by the
+// folders (parents first), the feeds, the items and the settings.
+const (
+	TypeHeader  = "header"
+	TypeFolder  = "folder"
+	TypeFeed    = "feed"
+	TypeItem    = "item"
+	TypeSetting = "setting"
+)
+
+// itemPage is how many items are loaded from the store at a time.
+const itemPage = 500
+
+// folderListSettings hold JSON lists of folder IDs, which are renumbered on
+// import.
+var folderListSettings = map[string]bool{
+	model.SettingCollapsedFolders: true,
+	model.SettingDigestFolders:    true,
+	model.SettingBlogrollFolders:  true,
+	model.SettingNotifyFolders:    true,
+}
+
+// folderMapSettings hold JSON objects whose values are folder IDs, which are
+// renumbered on import.
+var folderMapSettings = map[string]bool{
+	model.SettingFolderFeedTokens:     true,
+	model.SettingFolderCalendarTokens: true,
+}
+
+// Header identifies a dump.
+type Header struct {
+	Type       string    `json:"type"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+// Folder is a folder record. IDs are those of the exporting store and only
+// link the records of one dump.
+type Folder struct {
+	Type     string `json:"type"`
+	ID       int64  `json:"id"`
+	ParentID *int64 `json:"parent_id"`
+	Name     string `json:"name"`
+}
+
+// Feed is a feed record.
+type Feed struct {
+	Type        string            `json:"type"`
+	ID          int64             `json:"id"`
+	FolderID    *int64            `json:"folder_id"`
+	Title       string            `json:"title"`
+	URL         string            `json:"url"`
+	SiteURL     string            `json:"site_url,omitempty"`
+	Description string            `json:"description,omitempty"`
+	IconURL     string            `json:"icon_url,omitempty"`
+	InboxToken  string            `json:"inbox_token,omitempty"`
+	Options     model.FeedOptions `json:"options"`
+	Icon        *Icon             `json:"icon,omitempty"`
+	Labels      []string          `json:"labels,omitempty"`
+}
+
+// Icon is a feed's chosen emoji or uploaded image.
+type Icon struct {
+	Emoji       string `json:"emoji,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Data        []byte `json:"data,omitempty"`
+}
+
+// Item is an item record.
+type Item struct {
+	Type          string            `json:"type"`
+	FeedID        int64             `json:"feed_id"`
+	GUID          string            `json:"guid"`
+	Title         string            `json:"title"`
+	RawTitle      string            `json:"raw_title,omitempty"`
+	Content       string            `json:"content,omitempty"`
+	Link          string            `json:"link,omitempty"`
+	AuthorName    string            `json:"author_name,omitempty"`
+	AuthorEmail   string            `json:"author_email,omitempty"`
+	PublishedAt   time.Time         `json:"published_at"`
+	FetchedAt     time.Time         `json:"fetched_at"`
+	Read          bool              `json:"read"`
+	Starred       bool              `json:"starred"`
+	Note          string            `json:"note,omitempty"`
+	Summary       string            `json:"summary,omitempty"`
+	WaybackURL    string            `json:"wayback_url,omitempty"`
+	EnclosureURL  string            `json:"enclosure_url,omitempty"`
+	EnclosureType string            `json:"enclosure_type,omitempty"`
+	CommentsURL   string            `json:"comments_url,omitempty"`
+	CommentsFeed  string            `json:"comments_feed,omitempty"`
+	Tags          []string          `json:"tags,omitempty"`
+	Enclosures    []model.Enclosure `json:"enclosures,omitempty"`
+}
+
+// Setting is a setting record holding the raw stored value.
+type Setting struct {
+	Type  string `json:"type"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Report counts what a dump held or what reading it changed.
+type Report struct {
+	Folders  int `json:"folders"`
+	Feeds    int `json:"feeds"`
+	Items    int `json:"items"`
+	Existing int `json:"existing"` // items already in the store, left as they were
+	Settings int `json:"settings"`
+}
+
+// Write dumps the contents of db to w. Trashed feeds and items are left out.
+func Write(ctx context.Context, w io.Writer, db database.Store, now time.Time) (*Report, error) {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(Header{Type: TypeHeader, Version: Version, ExportedAt: now.UTC()}); err != nil {
+		return nil, err
+	}
+	report := &Report{}
+
+	folders, err := db.GetFolders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range parentsFirst(folders) {
+		if err := enc.Encode(Folder{Type: TypeFolder, ID: f.ID, ParentID: f.ParentID, Name: f.Name}); err != nil {
+			return nil, err
+		}
+		report.Folders++
+	}
+
+	feeds, err := db.GetAllFeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := db.GetFeedLabels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range feeds {
+		rec := Feed{Type: TypeFeed, ID: f.ID, FolderID: f.FolderID, Title: f.Title, URL: f.URL,
+			SiteURL: f.SiteURL, Description: f.Description, IconURL: f.IconURL,
+			InboxToken: f.InboxToken, Options: f.FeedOptions, Labels: labels[f.ID]}
+		if f.IconEmoji != "" || f.CustomIcon {
+			icon, err := db.GetFeedIcon(ctx, f.ID)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return nil, err
+			}
+			if icon != nil {
+				rec.Icon = &Icon{Emoji: icon.Emoji, ContentType: icon.ContentType, Data: icon.Data}
+			}
+		}
+		if err := enc.Encode(rec); err != nil {
+			return nil, err
+		}
+		report.Feeds++
+	}
+
+	for offset := 0; ; offset += itemPage {
+		items, err := db.QueryItems(ctx, model.ItemFilter{Limit: itemPage, Offset: offset})
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]int64, len(items))
+		for n, it := range items {
+			ids[n] = it.ID
+		}
+		encs, err := db.GetItemEnclosures(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, it := range items {
+			tags, err := db.GetItemTags(ctx, it.ID)
+			if err != nil {
+				return nil, err
+			}
+			rec := Item{Type: TypeItem, FeedID: it.FeedID, GUID: it.GUID, Title: it.Title, RawTitle: it.RawTitle, Content: it.Content,
+				Link: it.Link, AuthorName: it.AuthorName, AuthorEmail: it.AuthorEmail,
+				PublishedAt: it.PublishedAt.UTC(), FetchedAt: it.FetchedAt.UTC(),
+				Read: it.IsRead, Starred: it.Starred, Note: it.Note, Summary: it.Summary,
+				WaybackURL: it.WaybackURL, EnclosureURL: it.EnclosureURL, EnclosureType: it.EnclosureType,
+				CommentsURL: it.CommentsURL, CommentsFeed: it.CommentsFeed, Tags: tags, Enclosures: encs[it.ID]}
+			if err := enc.Encode(rec); err != nil {
+				return nil, err
+			}
+			report.Items++
+		}
+		if len(items) < itemPage {
+			break
+		}
+	}
+
+	for _, key := range model.KnownSettings {
+		value, err := db.GetSetting(ctx, key)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := enc.Encode(Setting{Type: TypeSetting, Key: key, Value: value}); err != nil {
+			return nil, err
+		}
+		report.Settings++
+	}
+	return report, nil
+}
+
+// parentsFirst orders folders so that each comes after its parent.
+func parentsFirst(folders []model.Folder) []model.Folder {
+	children := make(map[int64][]model.Folder)
+	known := make(map[int64]bool, len(folders))
+	for _, f := range folders {
+		known[f.ID] = true
+	}
+	var ordered []model.Folder
+	for _, f := range folders {
+		if f.ParentID != nil && known[*f.ParentID] {
+			children[*f.ParentID] = append(children[*f.ParentID], f)
+		} else {
+			ordered = append(ordered, f)
+		}
+	}
+	for i := 0; i < len(ordered); i++ {
+		ordered = append(ordered, children[ordered[i].ID]...)
+	}
+	return ordered
+}
+
+// Read loads a dump made by Write into db, merging it with what db holds:
+// folders are matched by name and parent, feeds by URL and items by GUID.
+// Items already in db keep their state. Settings this version doesn't know
+// are skipped. Reading stops at the first error; what was loaded until then
+// stays.
+func Read(ctx context.Context, r io.Reader, db database.Store) (*Report, error) {
+	dec := json.NewDecoder(r)
+	var header Header
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	if header.Type != TypeHeader {
+		return nil, errors.New("not an infovore dump")
+	}
+	if header.Version != Version {
+		return nil, fmt.Errorf("unsupported dump version %d", header.Version)
+	}
+
+	l := &loader{
+		db:       db,
+		folders:  make(map[int64]int64),
+		feeds:    make(map[int64]int64),
+		settings: make(map[string]string),
+		report:   &Report{},
+	}
+	for n := 2; ; n++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return l.report, fmt.Errorf("record %d: %w", n, err)
+		}
+		if err := l.load(ctx, raw); err != nil {
+			return l.report, fmt.Errorf("record %d: %w", n, err)
+		}
+	}
+	if err := l.flushItems(ctx); err != nil {
+		return l.report, err
+	}
+	if err := l.saveSettings(ctx); err != nil {
+		return l.report, err
+	}
+	return l.report, nil
+}
+
+// itemBatch is how many items are added to db at once.
+const itemBatch = 1000
+
+// loader reads the records of one dump, mapping the dump's IDs to db's.
+type loader struct {
+	db       database.Store
+	folders  map[int64]int64
+	feeds    map[int64]int64
+	settings map[string]string
+	report   *Report
+	// items are item records waiting to be added in a batch, with the
+	// items to add for them.
+	items   []Item
+	pending []model.Item
+}
+
+func (l *loader) load(ctx context.Context, raw json.RawMessage) error {
+	var rec struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		return err
+	}
+	switch rec.Type {
+	case TypeFolder:
+		var f Folder
+		if err := json.Unmarshal(raw, &f); err != nil {
+			return err
+		}
+		return l.loadFolder(ctx, f)
+	case TypeFeed:
+		var f Feed
+		if err := json.Unmarshal(raw, &f); err != nil {
+			return err
+		}
+		return l.loadFeed(ctx, f)
+	case TypeItem:
+		var it Item
+		if err := json.Unmarshal(raw, &it); err != nil {
+			return err
+		}
+		return l.loadItem(ctx, it)
+	case TypeSetting:
+		var s Setting
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+		l.settings[s.Key] = s.Value
+		return nil
+	default:
+		return fmt.Errorf("unknown record type %q", rec.Type)
+	}
+}
+
+// folderID maps a folder ID of the dump to db's.
+func (l *loader) folderID(id *int64) (*int64, error) {
+	if id == nil {
+		return nil, nil
+	}
+	mapped, ok := l.folders[*id]
+	if !ok {
+		return nil, fmt.Errorf("unknown folder %d", *id)
+	}
+	return &mapped, nil
+}
+
+func (l *loader) loadFolder(ctx context.Context, f Folder) error {
+	parentID, err := l.folderID(f.ParentID)
+	if err != nil {
+		return err
+	}
+	id, err := l.db.GetOrCreateFolder(ctx, f.Name, parentID)
+	if err != nil {
+		return err
+	}
+	l.folders[f.ID] = id
+	l.report.Folders++
+	return nil
+}
+
+func (l *loader) loadFeed(ctx context.Context, f Feed) error {
+	folderID, err := l.folderID(f.FolderID)
+	if err != nil {
+		return err
+	}
+	var id int64
+	isNew := false
+	if f.InboxToken != "" {
+		existing, err := l.db.GetFeedByInboxToken(ctx, f.InboxToken)
+		switch {
+		case err == nil:
+			id = existing.ID
+		case errors.Is(err, sql.ErrNoRows):
+			if id, err = l.db.CreateInboxFeed(ctx, folderID, f.Title, f.InboxToken); err != nil {
+				return err
+			}
+			isNew = true
+		default:
+			return err
+		}
+	} else if id, isNew, err = l.db.GetOrCreateFeed(ctx, folderID, f.Title, f.URL); err != nil {
+		return err
+	}
+	l.feeds[f.ID] = id
+	l.report.Feeds++
+	if !isNew {
+		return nil
+	}
+
+	if err := l.db.UpdateFeedMetadata(ctx, id, f.Title, f.SiteURL, f.Description, f.IconURL); err != nil {
+		return err
+	}
+	if err := l.db.UpdateFeedOptions(ctx, id, f.Options); err != nil {
+		return err
+	}
+	if f.Icon != nil {
+		icon := model.FeedIcon{FeedID: id, Emoji: f.Icon.Emoji, ContentType: f.Icon.ContentType,
+			Data: f.Icon.Data, UpdatedAt: time.Now()}
+		if err := l.db.SetFeedIcon(ctx, icon); err != nil {
+			return err
+		}
+	}
+	if len(f.Labels) > 0 {
+		if err := l.db.SetFeedLabels(ctx, id, f.Labels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *loader) loadItem(ctx context.Context, it Item) error {
+	feedID, ok := l.feeds[it.FeedID]
+	if !ok {
+		return fmt.Errorf("unknown feed %d", it.FeedID)
+	}
+	l.items = append(l.items, it)
+	l.pending = append(l.pending, model.Item{FeedID: feedID, GUID: it.GUID, Title: it.Title, RawTitle: it.RawTitle,
+		Content: it.Content, Link: it.Link, AuthorName: it.AuthorName, AuthorEmail: it.AuthorEmail,
+		PublishedAt: it.PublishedAt, FetchedAt: it.FetchedAt, IsRead: it.Read, Note: it.Note, Summary: it.Summary,
+		WaybackURL: it.WaybackURL, EnclosureURL: it.EnclosureURL, EnclosureType: it.EnclosureType,
+		CommentsURL: it.CommentsURL, CommentsFeed: it.CommentsFeed})
+	if len(l.pending) >= itemBatch {
+		return l.flushItems(ctx)
+	}
+	return nil
+}
+
+// flushItems adds the items waiting for a batch, then stars, tags and
+// attaches enclosures to the new ones.
+func (l *loader) flushItems(ctx context.Context) error {
+	if len(l.pending) == 0 {
+		return nil
+	}
+	ids, err := l.db.AddItems(ctx, l.pending)
+	if err != nil {
+		return err
+	}
+	for n, it := range l.items {
+		id := ids[n]
+		if id == 0 {
+			l.report.Existing++
+			continue
+		}
+		l.report.Items++
+
+		if it.Starred {
+			if err := l.db.SetItemStarred(ctx, id, true); err != nil {
+				return err
+			}
+		}
+		if len(it.Tags) > 0 {
+			if err := l.db.AddItemTags(ctx, id, it.Tags); err != nil {
+				return err
+			}
+		}
+		if len(it.Enclosures) > 0 {
+			if err := l.db.SetItemEnclosures(ctx, id, it.Enclosures); err != nil {
+				return err
+			}
+		}
+	}
+	l.items, l.pending = l.items[:0], l.pending[:0]
+	return nil
+}
+
+// saveSettings stores the known settings of the dump together, with folder
+// lists and maps renumbered to db's folders.
+func (l *loader) saveSettings(ctx context.Context) error {
+	values := make(map[string]string)
+	for _, key := range model.KnownSettings {
+		value, ok := l.settings[key]
+		if !ok {
+			continue
+		}
+		if folderListSettings[key] && value != "" {
+			var ids []int64
+			if err := json.Unmarshal([]byte(value), &ids); err != nil {
+				return fmt.Errorf("setting %s: %w", key, err)
+			}
+			mapped := []int64{}
+			for _, id := range ids {
+				if newID, ok := l.folders[id]; ok {
+					mapped = append(mapped, newID)
+				}
+			}
+			data, _ := json.Marshal(mapped)
+			value = string(data)
+		}
+		if folderMapSettings[key] && value != "" {
+			var ids map[string]int64
+			if err := json.Unmarshal([]byte(value), &ids); err != nil {
+				return fmt.Errorf("setting %s: %w", key, err)
+			}
+			mapped := map[string]int64{}
+			for k, id := range ids {
+				if newID, ok := l.folders[id]; ok {
+					mapped[k] = newID
+				}
+			}
+			data, _ := json.Marshal(mapped)
+			value = string(data)
+		}
+		values[key] = value
+	}
+	if err := l.db.SetSettings(ctx, values); err != nil {
+		return err
+	}
+	l.report.Settings = len(values)
+	return nil
+}
@@ -0,0 +1,161 @@
+// Package export renders items to portable archives.
+package export
+
+import (
+	"archive/zip"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// Archive formats.
+const (
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+)
+
+// Entry is an item together with the metadata written alongside it.
+type Entry struct {
+	Item      model.Item
+	FeedTitle string
+	Tags      []string
+}
+
+// ValidFormat reports whether format is a supported archive format.
+func ValidFormat(format string) bool {
+	return format == FormatMarkdown || format == FormatHTML
+}
+
+// WriteZip writes one file per entry to w as a ZIP archive. Files are named
+// after the publish date and title, e.g. 2024-05-01-hello-world.md.
+func WriteZip(w io.Writer, entries []Entry, format string) error {
+	ext := ".md"
+	if format == FormatHTML {
+		ext = ".html"
+	}
+	zw := zip.NewWriter(w)
+	used := make(map[string]bool)
+	for _, e := range entries {
+		name := FileName(e.Item, used) + ext
+		f, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: e.Item.PublishedAt,
+		})
+		if err != nil {
+			return err
+		}
+		var doc string
+		if format == FormatHTML {
+			doc = HTMLDocument(e)
+		} else {
+			doc = MarkdownDocument(e)
+		}
+		if _, err := io.WriteString(f, doc); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// MarkdownDocument renders an entry as Markdown with YAML front-matter.
+func MarkdownDocument(e Entry) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "title: %s\n", yamlString(e.Item.Title))
+	if e.Item.Link != "" {
+		fmt.Fprintf(&b, "url: %s\n", yamlString(e.Item.Link))
+	}
+	fmt.Fprintf(&b, "feed: %s\n", yamlString(e.FeedTitle))
+	if !e.Item.PublishedAt.IsZero() {
+		fmt.Fprintf(&b, "published: %s\n", e.Item.PublishedAt.UTC().Format(time.RFC3339))
+	}
+	if len(e.Tags) > 0 {
+		quoted := make([]string, len(e.Tags))
+		for i, t := range e.Tags {
+			quoted[i] = yamlString(t)
+		}
+		fmt.Fprintf(&b, "tags: [%s]\n", strings.Join(quoted, ", "))
+	}
+	fmt.Fprintf(&b, "starred: %t\n", e.Item.Starred)
+	if e.Item.Note != "" {
+		fmt.Fprintf(&b, "note: %s\n", yamlString(e.Item.Note))
+	}
+	b.WriteString("---\n\n")
+	b.WriteString("# " + escapeMarkdown(e.Item.Title) + "\n\n")
+	b.WriteString(Markdown(e.Item.Content))
+	return b.String()
+}
+
+// HTMLDocument renders an entry as a standalone HTML page, with the
+// metadata in <meta> tags.
+func HTMLDocument(e Entry) string {
+	esc := html.EscapeString
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&b, "<title>%s</title>\n", esc(e.Item.Title))
+	meta := func(name, content string) {
+		if content != "" {
+			fmt.Fprintf(&b, "<meta name=\"%s\" content=\"%s\">\n", name, esc(content))
+		}
+	}
+	meta("infovore:url", e.Item.Link)
+	meta("infovore:feed", e.FeedTitle)
+	if !e.Item.PublishedAt.IsZero() {
+		meta("infovore:published", e.Item.PublishedAt.UTC().Format(time.RFC3339))
+	}
+	meta("infovore:tags", strings.Join(e.Tags, ", "))
+	meta("infovore:starred", strconv.FormatBool(e.Item.Starred))
+	meta("infovore:note", e.Item.Note)
+	b.WriteString("<style>body{max-width:40em;margin:2em auto;padding:0 1em;font-family:sans-serif;line-height:1.5}img{max-width:100%}.meta{color:#666}</style>\n")
+	b.WriteString("</head>\n<body>\n<article>\n")
+	fmt.Fprintf(&b, "<h1>%s</h1>\n<p class=\"meta\">%s", esc(e.Item.Title), esc(e.FeedTitle))
+	if !e.Item.PublishedAt.IsZero() {
+		fmt.Fprintf(&b, " &middot; %s", e.Item.PublishedAt.Format("2006-01-02"))
+	}
+	if e.Item.Link != "" {
+		fmt.Fprintf(&b, " &middot; <a href=\"%s\">Original</a>", esc(e.Item.Link))
+	}
+	b.WriteString("</p>\n")
+	if e.Item.Note != "" {
+		fmt.Fprintf(&b, "<blockquote class=\"note\">%s</blockquote>\n", esc(e.Item.Note))
+	}
+	b.WriteString(e.Item.Content)
+	b.WriteString("\n</article>\n</body>\n</html>\n")
+	return b.String()
+}
+
+// nonSlug matches runs of characters not allowed in a file name slug.
+var nonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+// FileName returns a unique base name (without extension) for an item,
+// recording it in used.
+func FileName(item model.Item, used map[string]bool) string {
+	slug := strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(item.Title), "-"), "-")
+	if len(slug) > 60 {
+		slug = strings.TrimRight(slug[:60], "-")
+	}
+	if slug == "" {
+		slug = "item-" + strconv.FormatInt(item.ID, 10)
+	}
+	if !item.PublishedAt.IsZero() {
+		slug = item.PublishedAt.Format("2006-01-02") + "-" + slug
+	}
+	name := slug
+	for n := 2; used[name]; n++ {
+		name = slug + "-" + strconv.Itoa(n)
+	}
+	used[name] = true
+	return name
+}
+
+// yamlString renders s as a double-quoted YAML scalar.
+func yamlString(s string) string {
+	return strconv.Quote(s)
+}
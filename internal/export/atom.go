@@ -0,0 +1,137 @@
+package export
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AtomContentType is the media type of an Atom feed.
+const AtomContentType = "application/atom+xml; charset=utf-8"
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomPerson  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomSource struct {
+	Title string `xml:"title"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      atomText       `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published,omitempty"`
+	Links      []atomLink     `xml:"link"`
+	Author     *atomPerson    `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary"`
+	Content    *atomText      `xml:"content"`
+	Source     *atomSource    `xml:"source"`
+}
+
+// WriteAtom writes the entries to w as an Atom feed titled title. self is
+// the feed's own URL, which also serves as its ID. Entries keep the GUID
+// given by their feed as ID where it is a URI, and are credited to their
+// item author or, failing that, to their feed.
+func WriteAtom(w io.Writer, title, self string, entries []Entry) error {
+	feed := atomFeed{
+		ID:     self,
+		Title:  title,
+		Links:  []atomLink{{Rel: "self", Href: self}},
+		Author: atomPerson{Name: "Infovore"},
+	}
+	var updated time.Time
+	for _, e := range entries {
+		it := e.Item
+		published := it.PublishedAt
+		if published.IsZero() {
+			published = it.FetchedAt
+		}
+		if published.After(updated) {
+			updated = published
+		}
+		entry := atomEntry{
+			ID:      entryID(e),
+			Title:   atomText{Type: "text", Body: it.Title},
+			Updated: atomTime(published),
+			Source:  &atomSource{Title: e.FeedTitle},
+		}
+		if !it.PublishedAt.IsZero() {
+			entry.Published = atomTime(it.PublishedAt)
+		}
+		if it.Link != "" {
+			entry.Links = append(entry.Links, atomLink{Rel: "alternate", Href: it.Link})
+		}
+		if it.AuthorName != "" {
+			entry.Author = &atomPerson{Name: it.AuthorName}
+		} else if e.FeedTitle != "" {
+			entry.Author = &atomPerson{Name: e.FeedTitle}
+		}
+		for _, tag := range e.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		if it.Summary != "" {
+			entry.Summary = &atomText{Type: "text", Body: it.Summary}
+		}
+		if it.Content != "" {
+			entry.Content = &atomText{Type: "html", Body: it.Content}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	feed.Updated = atomTime(updated)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// entryID returns the GUID of an entry if it is a URI, as Atom requires, or
+// a tag URI derived from the item ID otherwise.
+func entryID(e Entry) string {
+	for _, scheme := range []string{"http:", "https:", "urn:", "tag:"} {
+		if strings.HasPrefix(e.Item.GUID, scheme) {
+			return e.Item.GUID
+		}
+	}
+	return "tag:infovore,2024:item:" + strconv.FormatInt(e.Item.ID, 10)
+}
+
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
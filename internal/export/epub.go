@@ -0,0 +1,249 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// EPUBContentType is the media type of an EPUB file.
+const EPUBContentType = "application/epub+zip"
+
+// WriteEPUB writes the entries to w as an EPUB 3 book with one chapter per
+// entry. An NCX table of contents is included for older readers such as
+// Kindle. Remote images are replaced by their alt text so the book reads
+// fully offline.
+func WriteEPUB(w io.Writer, title string, entries []Entry) error {
+	zw := zip.NewWriter(w)
+
+	// The mimetype file must come first, stored uncompressed and without a
+	// data descriptor so readers can sniff it at a fixed offset.
+	now := time.Now()
+	f, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		Modified:           now,
+		CRC32:              crc32.ChecksumIEEE([]byte(EPUBContentType)),
+		CompressedSize64:   uint64(len(EPUBContentType)),
+		UncompressedSize64: uint64(len(EPUBContentType)),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, EPUBContentType); err != nil {
+		return err
+	}
+
+	files := map[string]string{
+		"META-INF/container.xml": epubContainer,
+		"OEBPS/content.opf":      epubPackage(title, entries),
+		"OEBPS/nav.xhtml":        epubNav(title, entries),
+		"OEBPS/toc.ncx":          epubNCX(title, entries),
+	}
+	for i, e := range entries {
+		files[chapterName(i)] = epubChapter(e)
+	}
+	names := []string{"META-INF/container.xml", "OEBPS/content.opf", "OEBPS/nav.xhtml", "OEBPS/toc.ncx"}
+	for i := range entries {
+		names = append(names, chapterName(i))
+	}
+	for _, name := range names {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, files[name]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+const epubContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+func chapterName(i int) string {
+	return fmt.Sprintf("OEBPS/item%04d.xhtml", i+1)
+}
+
+// bookID derives a stable identifier from the entries in the book.
+func bookID(entries []Entry) string {
+	h := sha1.New()
+	for _, e := range entries {
+		fmt.Fprintf(h, "%d\n", e.Item.ID)
+	}
+	return "urn:infovore:" + hex.EncodeToString(h.Sum(nil))
+}
+
+func epubPackage(title string, entries []Entry) string {
+	esc := html.EscapeString
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="bookid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+`)
+	fmt.Fprintf(&b, "    <dc:identifier id=\"bookid\">%s</dc:identifier>\n", bookID(entries))
+	fmt.Fprintf(&b, "    <dc:title>%s</dc:title>\n", esc(title))
+	b.WriteString("    <dc:creator>Infovore</dc:creator>\n    <dc:language>en</dc:language>\n")
+	fmt.Fprintf(&b, "    <meta property=\"dcterms:modified\">%s</meta>\n", time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+	b.WriteString(`  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+`)
+	for i := range entries {
+		fmt.Fprintf(&b, "    <item id=\"item%d\" href=\"item%04d.xhtml\" media-type=\"application/xhtml+xml\"/>\n", i+1, i+1)
+	}
+	b.WriteString("  </manifest>\n  <spine toc=\"ncx\">\n")
+	for i := range entries {
+		fmt.Fprintf(&b, "    <itemref idref=\"item%d\"/>\n", i+1)
+	}
+	b.WriteString("  </spine>\n</package>\n")
+	return b.String()
+}
+
+func epubNav(title string, entries []Entry) string {
+	esc := html.EscapeString
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>`)
+	b.WriteString(esc(title))
+	b.WriteString("</title></head>\n<body>\n<nav epub:type=\"toc\" id=\"toc\">\n<h1>Contents</h1>\n<ol>\n")
+	for i, e := range entries {
+		fmt.Fprintf(&b, "<li><a href=\"item%04d.xhtml\">%s</a></li>\n", i+1, esc(e.Item.Title))
+	}
+	b.WriteString("</ol>\n</nav>\n</body>\n</html>\n")
+	return b.String()
+}
+
+func epubNCX(title string, entries []Entry) string {
+	esc := html.EscapeString
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <head>
+`)
+	fmt.Fprintf(&b, "    <meta name=\"dtb:uid\" content=\"%s\"/>\n", bookID(entries))
+	fmt.Fprintf(&b, "  </head>\n  <docTitle><text>%s</text></docTitle>\n  <navMap>\n", esc(title))
+	for i, e := range entries {
+		fmt.Fprintf(&b, "    <navPoint id=\"nav%d\" playOrder=\"%d\"><navLabel><text>%s</text></navLabel><content src=\"item%04d.xhtml\"/></navPoint>\n",
+			i+1, i+1, esc(e.Item.Title), i+1)
+	}
+	b.WriteString("  </navMap>\n</ncx>\n")
+	return b.String()
+}
+
+func epubChapter(e Entry) string {
+	esc := html.EscapeString
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>`)
+	b.WriteString(esc(e.Item.Title))
+	b.WriteString("</title></head>\n<body>\n")
+	fmt.Fprintf(&b, "<h1>%s</h1>\n<p><em>%s", esc(e.Item.Title), esc(e.FeedTitle))
+	if !e.Item.PublishedAt.IsZero() {
+		fmt.Fprintf(&b, " &#183; %s", e.Item.PublishedAt.Format("2006-01-02"))
+	}
+	b.WriteString("</em></p>\n")
+	b.WriteString(XHTML(e.Item.Content))
+	if e.Item.Link != "" {
+		fmt.Fprintf(&b, "\n<p><a href=\"%s\">Original article</a></p>", esc(e.Item.Link))
+	}
+	b.WriteString("\n</body>\n</html>\n")
+	return b.String()
+}
+
+// xmlName matches element and attribute names that are valid in XHTML
+// without namespace declarations.
+var xmlName = regexp.MustCompile(`^[a-zA-Z_][-a-zA-Z0-9_.]*$`)
+
+// XHTML converts an HTML fragment to well-formed XHTML body content,
+// dropping scripts, embeds, event handlers and images.
+func XHTML(fragment string) string {
+	body := &xhtml.Node{Type: xhtml.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := xhtml.ParseFragment(strings.NewReader(fragment), body)
+	if err != nil {
+		return "<p>" + html.EscapeString(fragment) + "</p>"
+	}
+	for _, n := range nodes {
+		body.AppendChild(n)
+	}
+	cleanXHTML(body)
+	var b bytes.Buffer
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		xhtml.Render(&b, c)
+	}
+	return b.String()
+}
+
+// dropElement reports whether an element is removed from EPUB content.
+func dropElement(n *xhtml.Node) bool {
+	if n.Type != xhtml.ElementNode {
+		return n.Type == xhtml.CommentNode
+	}
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Iframe, atom.Object, atom.Embed, atom.Form,
+		atom.Input, atom.Button, atom.Video, atom.Audio, atom.Source, atom.Picture, atom.Svg:
+		return true
+	}
+	return false
+}
+
+// cleanXHTML strips dropped elements and invalid attributes below n, and
+// replaces images with their alt text.
+func cleanXHTML(n *xhtml.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case dropElement(c):
+			n.RemoveChild(c)
+		case c.Type == xhtml.ElementNode && !xmlName.MatchString(c.Data):
+			// Unknown prefixed tags such as Word's <o:p>: keep the content.
+			cleanXHTML(c)
+			for gc := c.FirstChild; gc != nil; gc = c.FirstChild {
+				c.RemoveChild(gc)
+				n.InsertBefore(gc, c)
+			}
+			n.RemoveChild(c)
+		case c.Type == xhtml.ElementNode && c.DataAtom == atom.Img:
+			if alt := strings.TrimSpace(attr(c, "alt")); alt != "" {
+				n.InsertBefore(&xhtml.Node{Type: xhtml.TextNode, Data: "[" + alt + "]"}, c)
+			}
+			n.RemoveChild(c)
+		default:
+			cleanXHTML(c)
+		}
+		c = next
+	}
+	if n.Type != xhtml.ElementNode {
+		return
+	}
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		if a.Namespace != "" || !xmlName.MatchString(a.Key) || a.Key == "xmlns" || strings.HasPrefix(a.Key, "on") {
+			continue
+		}
+		attrs = append(attrs, a)
+	}
+	n.Attr = attrs
+}
@@ -0,0 +1,202 @@
+package export
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bryan-buckman/infovore/internal/textutil"
+)
+
+// ICalContentType is the media type of an iCalendar feed.
+const ICalContentType = "text/calendar; charset=utf-8"
+
+// icalDescriptionLength bounds the text of an event description.
+const icalDescriptionLength = 500
+
+// Dates in titles. Month names may be abbreviated, days may carry an
+// ordinal suffix and be followed by the last day of a span, and the year
+// may be left out.
+var (
+	titleMonth   = `(jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|june?|july?|aug(?:ust)?|sep(?:t(?:ember)?)?|oct(?:ober)?|nov(?:ember)?|dec(?:ember)?)\.?`
+	titleDay     = `(\d{1,2})(?:st|nd|rd|th)?`
+	titleSpanEnd = `(?:\s*(?:-|–|—|to|until)\s*(\d{1,2})(?:st|nd|rd|th)?)?`
+	// "March 3, 2026", "Nov 3–5 2026", "Sept. 14"
+	titleMDY = regexp.MustCompile(`(?i)\b` + titleMonth + `\s+` + titleDay + titleSpanEnd + `(?:,?\s+(\d{4}))?\b`)
+	// "3 March 2026", "3-5 November", "14th Sept"
+	titleDMY = regexp.MustCompile(`(?i)\b` + titleDay + titleSpanEnd + `\s+(?:of\s+)?` + titleMonth + `(?:,?\s+(\d{4}))?\b`)
+	// "2026-03-03"
+	titleISO = regexp.MustCompile(`\b(\d{4})-(\d{2})-(\d{2})\b`)
+)
+
+// TitleDate finds the first date named in an item title, such as
+// "CFP closes March 3, 2026" or "Go 1.26 (2026-02-10)". It returns the
+// first day and the day after the last, which differ by more than a day
+// for a span such as "Nov 3–5". A date without a year is taken to be the
+// one within six months of published.
+func TitleDate(title string, published time.Time) (start, end time.Time, ok bool) {
+	pos := -1
+	consider := func(at int, year, month, day, lastDay int) {
+		if pos >= 0 && at >= pos {
+			return
+		}
+		if year == 0 {
+			year = published.Year()
+			candidate := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+			switch {
+			case candidate.Before(published.AddDate(0, -6, 0)):
+				year++
+			case candidate.After(published.AddDate(0, 6, 0)):
+				year--
+			}
+		}
+		first, valid := civilDate(year, month, day)
+		if !valid {
+			return
+		}
+		last := first
+		if lastDay != 0 {
+			if last, valid = civilDate(year, month, lastDay); !valid || last.Before(first) {
+				return
+			}
+		}
+		pos, start, end, ok = at, first, last.AddDate(0, 0, 1), true
+	}
+
+	for _, m := range titleMDY.FindAllStringSubmatchIndex(title, -1) {
+		consider(m[0], atoi(title, m[8], m[9]), monthNumber(title[m[2]:m[3]]), atoi(title, m[4], m[5]), atoi(title, m[6], m[7]))
+	}
+	for _, m := range titleDMY.FindAllStringSubmatchIndex(title, -1) {
+		consider(m[0], atoi(title, m[8], m[9]), monthNumber(title[m[6]:m[7]]), atoi(title, m[2], m[3]), atoi(title, m[4], m[5]))
+	}
+	for _, m := range titleISO.FindAllStringSubmatchIndex(title, -1) {
+		consider(m[0], atoi(title, m[2], m[3]), atoi(title, m[4], m[5]), atoi(title, m[6], m[7]), 0)
+	}
+	return start, end, ok
+}
+
+// civilDate returns the date as midnight UTC, reporting whether it exists.
+func civilDate(year, month, day int) (time.Time, bool) {
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	return t, year > 0 && t.Year() == year && int(t.Month()) == month && t.Day() == day
+}
+
+// atoi parses the submatch s[start:end], returning 0 for an empty one.
+func atoi(s string, start, end int) int {
+	if start < 0 {
+		return 0
+	}
+	n, _ := strconv.Atoi(s[start:end])
+	return n
+}
+
+// monthNumber returns the number of a month name matched by titleMonth, or
+// 0 for a lowercase "may", which is more likely the verb.
+func monthNumber(name string) int {
+	if name == "may" {
+		return 0
+	}
+	prefix := strings.ToLower(name)[:3]
+	for m := time.January; m <= time.December; m++ {
+		if strings.ToLower(m.String())[:3] == prefix {
+			return int(m)
+		}
+	}
+	return 0
+}
+
+// WriteICal writes the entries to w as an iCalendar (RFC 5545) calendar
+// named name, one event per entry. An entry whose title names a date, see
+// TitleDate, is an all-day event on that date; any other is an event at the
+// time it was published.
+func WriteICal(w io.Writer, name string, entries []Entry, now time.Time) error {
+	bw := bufio.NewWriter(w)
+	line := func(property, value string) {
+		writeFolded(bw, property+":"+value)
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//Infovore//Infovore//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("X-WR-CALNAME", icalText(name))
+
+	for _, e := range entries {
+		it := e.Item
+		published := it.PublishedAt
+		if published.IsZero() {
+			published = it.FetchedAt
+		}
+		line("BEGIN", "VEVENT")
+		line("UID", "item-"+strconv.FormatInt(it.ID, 10)+"@infovore")
+		line("DTSTAMP", icalTime(now))
+		if start, end, ok := TitleDate(it.Title, published); ok {
+			line("DTSTART;VALUE=DATE", start.Format("20060102"))
+			line("DTEND;VALUE=DATE", end.Format("20060102"))
+			line("TRANSP", "TRANSPARENT")
+		} else {
+			line("DTSTART", icalTime(published))
+		}
+		line("SUMMARY", icalText(it.Title))
+		description := it.Summary
+		if description == "" {
+			description = textutil.Snippet(textutil.PlainText(it.Content), icalDescriptionLength)
+		}
+		if e.FeedTitle != "" {
+			description = strings.TrimSpace(e.FeedTitle + "\n\n" + description)
+		}
+		if description != "" {
+			line("DESCRIPTION", icalText(description))
+		}
+		if it.Link != "" {
+			line("URL", it.Link)
+		}
+		if len(e.Tags) > 0 {
+			tags := make([]string, len(e.Tags))
+			for i, tag := range e.Tags {
+				tags[i] = icalText(tag)
+			}
+			line("CATEGORIES", strings.Join(tags, ","))
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return bw.Flush()
+}
+
+// icalText escapes a TEXT value.
+func icalText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+func icalTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// writeFolded writes a content line ended by CRLF, folding it into lines of
+// at most 75 octets without splitting a character.
+func writeFolded(w *bufio.Writer, s string) {
+	const limit = 75
+	for first := true; ; first = false {
+		n := limit
+		if !first {
+			w.WriteByte(' ')
+			n--
+		}
+		if len(s) <= n {
+			w.WriteString(s)
+			w.WriteString("\r\n")
+			return
+		}
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		w.WriteString(s[:n])
+		w.WriteString("\r\n")
+		s = s[n:]
+	}
+}
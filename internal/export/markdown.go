@@ -0,0 +1,199 @@
+package export
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// blankLines matches runs of blank lines to collapse.
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// Markdown converts an HTML fragment to Markdown. It covers the elements
+// feed content commonly uses; unknown elements contribute only their text.
+func Markdown(fragment string) string {
+	doc, err := html.Parse(strings.NewReader(fragment))
+	if err != nil {
+		return fragment
+	}
+	var b strings.Builder
+	mdChildren(&b, doc, mdState{})
+	return strings.TrimSpace(blankLines.ReplaceAllString(b.String(), "\n\n")) + "\n"
+}
+
+// mdState carries the context inherited by nested elements.
+type mdState struct {
+	pre    bool   // inside <pre>: keep whitespace verbatim
+	indent string // prefix for continuation lines in lists and quotes
+}
+
+func mdChildren(b *strings.Builder, n *html.Node, st mdState) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		mdNode(b, c, st)
+	}
+}
+
+func mdNode(b *strings.Builder, n *html.Node, st mdState) {
+	switch n.Type {
+	case html.TextNode:
+		if st.pre {
+			b.WriteString(n.Data)
+			return
+		}
+		text := strings.Join(strings.Fields(n.Data), " ")
+		if text == "" {
+			if strings.TrimSpace(n.Data) == "" && n.Data != "" && !strings.HasSuffix(b.String(), " ") && !strings.HasSuffix(b.String(), "\n") {
+				b.WriteString(" ")
+			}
+			return
+		}
+		if n.Data[0] == ' ' || n.Data[0] == '\n' || n.Data[0] == '\t' {
+			if s := b.String(); s != "" && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString(escapeMarkdown(text))
+		if last := n.Data[len(n.Data)-1]; last == ' ' || last == '\n' || last == '\t' {
+			b.WriteString(" ")
+		}
+		return
+	case html.ElementNode:
+	default:
+		mdChildren(b, n, st)
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Head:
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Figure, atom.Header, atom.Footer:
+		block(b, st)
+		mdChildren(b, n, st)
+		block(b, st)
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		block(b, st)
+		level, _ := strconv.Atoi(n.Data[1:])
+		b.WriteString(strings.Repeat("#", level) + " ")
+		mdChildren(b, n, st)
+		block(b, st)
+	case atom.Br:
+		b.WriteString("  \n" + st.indent)
+	case atom.Hr:
+		block(b, st)
+		b.WriteString("---")
+		block(b, st)
+	case atom.Strong, atom.B:
+		inline(b, n, st, "**")
+	case atom.Em, atom.I:
+		inline(b, n, st, "_")
+	case atom.Del, atom.S:
+		inline(b, n, st, "~~")
+	case atom.Code:
+		if st.pre {
+			mdChildren(b, n, st)
+		} else {
+			b.WriteString("`" + textOf(n) + "`")
+		}
+	case atom.Pre:
+		block(b, st)
+		b.WriteString("```\n")
+		st.pre = true
+		mdChildren(b, n, st)
+		b.WriteString("\n```")
+		block(b, mdState{indent: st.indent})
+	case atom.A:
+		href := attr(n, "href")
+		if href == "" {
+			mdChildren(b, n, st)
+			return
+		}
+		b.WriteString("[")
+		mdChildren(b, n, st)
+		b.WriteString("](" + href + ")")
+	case atom.Img:
+		if src := attr(n, "src"); src != "" {
+			b.WriteString("![" + escapeMarkdown(attr(n, "alt")) + "](" + src + ")")
+		}
+	case atom.Blockquote:
+		block(b, st)
+		inner := mdState{indent: st.indent + "> "}
+		b.WriteString("> ")
+		mdChildren(b, n, inner)
+		block(b, st)
+	case atom.Ul, atom.Ol:
+		block(b, st)
+		num := 0
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode || c.DataAtom != atom.Li {
+				continue
+			}
+			marker := "- "
+			if n.DataAtom == atom.Ol {
+				num++
+				marker = strconv.Itoa(num) + ". "
+			}
+			if !strings.HasSuffix(b.String(), "\n"+st.indent) && !strings.HasSuffix(b.String(), "\n") {
+				b.WriteString("\n" + st.indent)
+			}
+			b.WriteString(marker)
+			mdChildren(b, c, mdState{indent: st.indent + strings.Repeat(" ", len(marker))})
+		}
+		block(b, st)
+	default:
+		mdChildren(b, n, st)
+	}
+}
+
+// block ends the current block with a blank line.
+func block(b *strings.Builder, st mdState) {
+	s := b.String()
+	if s == "" || strings.HasSuffix(s, "\n\n"+st.indent) {
+		return
+	}
+	b.WriteString("\n\n" + st.indent)
+}
+
+// inline wraps the element's content in a Markdown delimiter.
+func inline(b *strings.Builder, n *html.Node, st mdState, delim string) {
+	var inner strings.Builder
+	mdChildren(&inner, n, st)
+	text := strings.TrimSpace(inner.String())
+	if text == "" {
+		return
+	}
+	b.WriteString(delim + text + delim)
+}
+
+// textOf returns the concatenated text inside a node.
+func textOf(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// markdownEscaper escapes characters that would otherwise start Markdown syntax.
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`)
+
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
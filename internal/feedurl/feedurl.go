@@ -0,0 +1,78 @@
+// Package feedurl normalizes feed URLs so the same feed isn't subscribed to
+// twice under slightly different spellings.
+package feedurl
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// defaultPorts maps schemes to the port that is implied when none is given.
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// Normalize returns the canonical form of an http(s) feed URL: scheme and
+// host lowercased, default port and fragment removed, trailing slashes
+// dropped from the path (the root path is "/"). With upgradeHTTPS, http is
+// rewritten to https. URLs that don't parse as http(s) are returned trimmed
+// but otherwise unchanged.
+func Normalize(raw string, upgradeHTTPS bool) string {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if _, ok := defaultPorts[u.Scheme]; !ok {
+		return raw
+	}
+	if upgradeHTTPS {
+		u.Scheme = "https"
+	}
+
+	host, port := u.Hostname(), u.Port()
+	host = strings.ToLower(host)
+	if port == "" || port == defaultPorts[u.Scheme] || (upgradeHTTPS && port == defaultPorts["http"]) {
+		u.Host = host
+		if strings.Contains(host, ":") {
+			u.Host = "[" + host + "]" // IPv6 literal
+		}
+	} else {
+		u.Host = net.JoinHostPort(host, port)
+	}
+
+	u.Fragment, u.RawFragment = "", ""
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = strings.TrimRight(u.RawPath, "/")
+	if u.Path == "" {
+		u.Path, u.RawPath = "/", ""
+	}
+	return u.String()
+}
+
+// trackingParams are query parameters that only say where a link was
+// shared; utm_ parameters are tracking too.
+var trackingParams = map[string]bool{"fbclid": true, "gclid": true, "mc_cid": true, "mc_eid": true}
+
+// Key returns a comparison key for a feed URL that ignores the differences
+// Normalize removes as well as the http/https scheme, tracking parameters
+// and the order of query parameters.
+func Key(raw string) string {
+	n := Normalize(raw, false)
+	if u, err := url.Parse(n); err == nil && u.RawQuery != "" {
+		q := u.Query()
+		for name := range q {
+			if lower := strings.ToLower(name); trackingParams[lower] || strings.HasPrefix(lower, "utm_") {
+				q.Del(name)
+			}
+		}
+		u.RawQuery = q.Encode()
+		n = u.String()
+	}
+	if i := strings.Index(n, "://"); i >= 0 {
+		if _, ok := defaultPorts[n[:i]]; ok {
+			return n[i+3:]
+		}
+	}
+	return n
+}
@@ -0,0 +1,147 @@
+// Package health grades how well each feed is doing, from its recent fetch
+// success rate and latency and how recently it published.
+package health
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// Window is how far back fetches count towards a feed's grade. Older
+// fetches are pruned from the log.
+const Window = 14 * 24 * time.Hour
+
+// RefreshInterval is how often the background job regrades the feeds.
+const RefreshInterval = time.Hour
+
+// Weights of the parts of a score; they add up to 1.
+const (
+	successWeight = 0.5
+	recencyWeight = 0.3
+	latencyWeight = 0.2
+)
+
+// Thresholds between which the latency and recency parts fall from full
+// to no marks.
+const (
+	fastFetch = time.Second
+	slowFetch = 10 * time.Second
+	freshPost = 14 * 24 * time.Hour
+	stalePost = 180 * 24 * time.Hour
+)
+
+// Score grades a feed from 0 to 100. It returns false if the feed has no
+// fetches to grade.
+func Score(s model.FetchStats, now time.Time) (int, bool) {
+	if s.Attempts == 0 {
+		return 0, false
+	}
+	success := float64(s.Successes) / float64(s.Attempts)
+	latency := 0.0
+	if s.Successes > 0 {
+		latency = falloff(s.AvgDuration, fastFetch, slowFetch)
+	}
+	recency := 0.0
+	if !s.LastPublished.IsZero() {
+		recency = falloff(now.Sub(s.LastPublished), freshPost, stalePost)
+	}
+	score := successWeight*success + recencyWeight*recency + latencyWeight*latency
+	return int(score*100 + 0.5), true
+}
+
+// falloff returns 1 for d up to full, 0 from none on and falls linearly in
+// between.
+func falloff(d, full, none time.Duration) float64 {
+	switch {
+	case d <= full:
+		return 1
+	case d >= none:
+		return 0
+	default:
+		return float64(none-d) / float64(none-full)
+	}
+}
+
+// Refresh prunes the fetch log to the window and regrades every feed.
+// Returns the number of feeds graded.
+func Refresh(ctx context.Context, db database.Store) (int, error) {
+	now := time.Now()
+	if _, err := db.PruneFetchLog(ctx, now.Add(-Window)); err != nil {
+		return 0, err
+	}
+	stats, err := db.GetFetchStats(ctx)
+	if err != nil {
+		return 0, err
+	}
+	scores := make(map[int64]int, len(stats))
+	for _, s := range stats {
+		if score, ok := Score(s, now); ok {
+			scores[s.FeedID] = score
+		}
+	}
+	if err := db.SetFeedHealth(ctx, scores); err != nil {
+		return 0, err
+	}
+	return len(scores), nil
+}
+
+// Job periodically regrades the feeds. Trigger requests an early run, e.g.
+// after feeds were fetched.
+type Job struct {
+	db       database.Store
+	trigger  chan struct{}
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewJob creates a grading job.
+func NewJob(db database.Store) *Job {
+	return &Job{
+		db:       db,
+		trigger:  make(chan struct{}, 1),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins the grading loop.
+func (j *Job) Start() {
+	j.stopChan = make(chan struct{})
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		ctx := context.Background()
+		for {
+			if n, err := Refresh(ctx, j.db); err != nil {
+				log.Printf("Health: grading error: %v", err)
+			} else {
+				log.Printf("Health: graded %d feeds", n)
+			}
+
+			select {
+			case <-j.stopChan:
+				return
+			case <-j.trigger:
+			case <-time.After(RefreshInterval):
+			}
+		}
+	}()
+}
+
+// Trigger schedules a regrade without blocking.
+func (j *Job) Trigger() {
+	select {
+	case j.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Stop stops the job gracefully.
+func (j *Job) Stop() {
+	close(j.stopChan)
+	j.wg.Wait()
+}
@@ -0,0 +1,161 @@
+// Package interest ranks items by how likely the reader is to open them,
+// using a naive Bayes model trained on opened and skipped items.
+package interest
+
+import (
+	"context"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/textutil"
+)
+
+// MaxTrainingEvents bounds how many recent events are used for training.
+const MaxTrainingEvents = 5000
+
+// RetrainInterval is how often the background job retrains and rescores.
+const RetrainInterval = time.Hour
+
+// Tokens returns the features for an item: lowercased title words plus a
+// token identifying its feed, so per-feed preferences are learned too.
+func Tokens(feedID int64, title string) []string {
+	return append([]string{"feed:" + strconv.FormatInt(feedID, 10)}, textutil.Keywords(title)...)
+}
+
+// Model is a two-class multinomial naive Bayes classifier.
+type Model struct {
+	counts [2]map[string]int // token counts per class: 0 skipped, 1 opened
+	totals [2]int            // total tokens per class
+	docs   [2]int            // events per class
+	vocab  map[string]bool
+}
+
+// Train builds a model from interest events.
+func Train(events []model.InterestEvent) *Model {
+	m := &Model{
+		counts: [2]map[string]int{make(map[string]int), make(map[string]int)},
+		vocab:  make(map[string]bool),
+	}
+	for _, e := range events {
+		class := 0
+		if e.Positive {
+			class = 1
+		}
+		m.docs[class]++
+		for _, t := range Tokens(e.FeedID, e.Title) {
+			m.counts[class][t]++
+			m.totals[class]++
+			m.vocab[t] = true
+		}
+	}
+	return m
+}
+
+// Trained reports whether the model has seen both opened and skipped items.
+func (m *Model) Trained() bool {
+	return m.docs[0] > 0 && m.docs[1] > 0
+}
+
+// Score returns the probability (0-1) that an item will be opened. An
+// untrained model scores everything 0.5.
+func (m *Model) Score(feedID int64, title string) float64 {
+	if !m.Trained() {
+		return 0.5
+	}
+	v := float64(len(m.vocab))
+	var logp [2]float64
+	for c := 0; c < 2; c++ {
+		logp[c] = math.Log(float64(m.docs[c]) / float64(m.docs[0]+m.docs[1]))
+		for _, t := range Tokens(feedID, title) {
+			if !m.vocab[t] {
+				continue // never seen in training, no evidence either way
+			}
+			// Laplace smoothing keeps tokens seen in only one class from zeroing the other.
+			logp[c] += math.Log((float64(m.counts[c][t]) + 1) / (float64(m.totals[c]) + v))
+		}
+	}
+	return 1 / (1 + math.Exp(logp[0]-logp[1]))
+}
+
+// Retrain trains a model from recent events and rescores all unread items.
+// Returns the number of items scored.
+func Retrain(ctx context.Context, db database.Store) (int, error) {
+	events, err := db.GetInterestEvents(ctx, MaxTrainingEvents)
+	if err != nil {
+		return 0, err
+	}
+	m := Train(events)
+	items, err := db.QueryItems(ctx, model.ItemFilter{OnlyUnread: true})
+	if err != nil {
+		return 0, err
+	}
+	scores := make(map[int64]float64, len(items))
+	for _, it := range items {
+		scores[it.ID] = m.Score(it.FeedID, it.Title)
+	}
+	if err := db.SetInterestScores(ctx, scores); err != nil {
+		return 0, err
+	}
+	return len(scores), nil
+}
+
+// Job periodically retrains the model. Trigger requests an early run, e.g.
+// after new items were fetched.
+type Job struct {
+	db       database.Store
+	trigger  chan struct{}
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewJob creates a retraining job.
+func NewJob(db database.Store) *Job {
+	return &Job{
+		db:       db,
+		trigger:  make(chan struct{}, 1),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins the retraining loop.
+func (j *Job) Start() {
+	j.stopChan = make(chan struct{})
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		ctx := context.Background()
+		for {
+			if n, err := Retrain(ctx, j.db); err != nil {
+				log.Printf("Interest: retrain error: %v", err)
+			} else {
+				log.Printf("Interest: scored %d items", n)
+			}
+
+			select {
+			case <-j.stopChan:
+				return
+			case <-j.trigger:
+			case <-time.After(RetrainInterval):
+			}
+		}
+	}()
+}
+
+// Trigger schedules a retrain without blocking.
+func (j *Job) Trigger() {
+	select {
+	case j.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Stop stops the job gracefully.
+func (j *Job) Stop() {
+	close(j.stopChan)
+	j.wg.Wait()
+}
@@ -0,0 +1,361 @@
+// Package jobs runs background work recorded in the database. A job's
+// status and progress can be looked up by ID while it runs and after it
+// finishes, and a job cut short because its instance stopped is run again
+// from the start.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+)
+
+const (
+	// HeartbeatInterval is how often a running job records that it is
+	// still alive.
+	HeartbeatInterval = 30 * time.Second
+	// StaleAfter is how long a running job may go without a heartbeat
+	// before it counts as abandoned and is run again.
+	StaleAfter = 2 * time.Minute
+	// SweepInterval is how often the runner looks for abandoned jobs.
+	SweepInterval = time.Minute
+	// MaxAttempts is how many times a job is started before it is given up
+	// on, so that a job crashing its instance doesn't do so forever.
+	MaxAttempts = 3
+	// Retention is how long finished jobs stay queryable.
+	Retention = 7 * 24 * time.Hour
+
+	// progressInterval is the least time between progress writes.
+	progressInterval = time.Second
+)
+
+// Handler runs a job of one kind and returns its result, stored as JSON. It
+// should stop when ctx is done. An interrupted job is run again from the
+// start, so a handler must be safe to repeat.
+type Handler func(ctx context.Context, job *Job) (interface{}, error)
+
+// Job is a job being run by this instance, as its handler sees it.
+type Job struct {
+	ID   int64
+	Kind string
+
+	t *task
+}
+
+// Decode unmarshals the job's payload into v.
+func (j *Job) Decode(v interface{}) error {
+	j.t.mu.Lock()
+	payload := j.t.job.Payload
+	j.t.mu.Unlock()
+	return json.Unmarshal([]byte(payload), v)
+}
+
+// Progress records that done of total units of work are finished; total
+// is 0 if unknown.
+func (j *Job) Progress(done, total int) {
+	j.t.update(func(job *model.Job) {
+		job.Done, job.Total = done, total
+	}, false)
+}
+
+// task is the state of a job running on this instance.
+type task struct {
+	db        database.Store
+	ctx       context.Context // the job's, for logging
+	mu        sync.Mutex
+	job       model.Job
+	saved     time.Time // last write to the database
+	cancel    context.CancelFunc
+	cancelled bool
+	done      chan struct{} // closed once the outcome is recorded
+
+	// watchMu is held while watchers are called, so a watcher removed by
+	// Wait is never called after Wait returns.
+	watchMu  sync.Mutex
+	watchers map[int]func(model.Job)
+	nextID   int
+}
+
+// update changes the job and tells its watchers. The change is saved if
+// force is set or the last save was long enough ago.
+func (t *task) update(change func(job *model.Job), force bool) {
+	t.mu.Lock()
+	change(&t.job)
+	now := time.Now()
+	if force || now.Sub(t.saved) >= progressInterval {
+		t.job.UpdatedAt = now
+		t.saved = now
+		// Not cancelled with the job, so a cancelled job's outcome is saved.
+		if err := t.db.UpdateJob(context.WithoutCancel(t.ctx), &t.job); err != nil {
+			reqid.Logf(t.ctx, "Jobs: failed to save job %d: %v", t.job.ID, err)
+		}
+	}
+	job := t.job
+	t.mu.Unlock()
+
+	t.watchMu.Lock()
+	defer t.watchMu.Unlock()
+	for _, watch := range t.watchers {
+		watch(job)
+	}
+}
+
+// Runner runs jobs with the handlers registered for their kinds.
+type Runner struct {
+	db       database.Store
+	mu       sync.Mutex
+	handlers map[string]Handler
+	tasks    map[int64]*task // running on this instance, by job ID
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewRunner creates a runner. Jobs can be enqueued right away; abandoned
+// jobs are only picked up once Start is called.
+func NewRunner(db database.Store) *Runner {
+	return &Runner{
+		db:       db,
+		handlers: make(map[string]Handler),
+		tasks:    make(map[int64]*task),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Register sets the handler running jobs of a kind.
+func (r *Runner) Register(kind string, h Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[kind] = h
+}
+
+// Enqueue records a job of a kind with payload as its input, marshalled to
+// JSON, and starts running it on this instance. The job outlives ctx but
+// keeps its request ID, for its log lines and fetches.
+func (r *Runner) Enqueue(ctx context.Context, kind string, payload interface{}) (int64, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	job := model.Job{
+		Kind:      kind,
+		State:     model.JobRunning,
+		Payload:   string(data),
+		Attempts:  1,
+		CreatedAt: now,
+		StartedAt: now,
+		UpdatedAt: now,
+	}
+	job.ID, err = r.db.AddJob(ctx, &job)
+	if err != nil {
+		return 0, err
+	}
+	r.start(reqid.From(ctx), job)
+	return job.ID, nil
+}
+
+// start runs a job recorded as running in the background, under a request
+// ID if not empty.
+func (r *Runner) start(requestID string, job model.Job) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if requestID != "" {
+		ctx = reqid.With(ctx, requestID)
+	}
+	t := &task{db: r.db, ctx: ctx, job: job, saved: job.UpdatedAt, cancel: cancel, done: make(chan struct{})}
+	r.mu.Lock()
+	r.tasks[job.ID] = t
+	h := r.handlers[job.Kind]
+	r.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		heartbeat := time.NewTicker(HeartbeatInterval)
+		stopped := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-stopped:
+					return
+				case <-heartbeat.C:
+					t.update(func(*model.Job) {}, true)
+				}
+			}
+		}()
+
+		result, err := call(ctx, h, &Job{ID: job.ID, Kind: job.Kind, t: t})
+		heartbeat.Stop()
+		close(stopped)
+
+		t.update(func(j *model.Job) {
+			switch {
+			case t.cancelled:
+				j.State = model.JobCancelled
+			case err != nil:
+				j.State = model.JobFailed
+				j.Error = err.Error()
+			default:
+				j.State = model.JobDone
+				if data, err := json.Marshal(result); err == nil {
+					j.Result = string(data)
+				}
+			}
+			j.FinishedAt = time.Now()
+		}, true)
+		r.mu.Lock()
+		delete(r.tasks, job.ID)
+		r.mu.Unlock()
+		close(t.done)
+	}()
+}
+
+// call runs a handler, turning a panic into an error.
+func call(ctx context.Context, h Handler, job *Job) (result interface{}, err error) {
+	if h == nil {
+		return nil, fmt.Errorf("no handler for jobs of kind %q", job.Kind)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			reqid.Logf(ctx, "Jobs: job %d (%s) panicked: %v", job.ID, job.Kind, p)
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+	return h(ctx, job)
+}
+
+// Wait waits until a job running on this instance finishes, or ctx is done,
+// and returns the job. watch, if not nil, is called with the job on every
+// update until then, from the goroutine running the job. A job not running
+// here is returned as stored.
+func (r *Runner) Wait(ctx context.Context, jobID int64, watch func(model.Job)) (*model.Job, error) {
+	r.mu.Lock()
+	t := r.tasks[jobID]
+	r.mu.Unlock()
+	if t == nil {
+		return r.db.GetJob(ctx, jobID)
+	}
+	if watch != nil {
+		t.watchMu.Lock()
+		if t.watchers == nil {
+			t.watchers = make(map[int]func(model.Job))
+		}
+		id := t.nextID
+		t.nextID++
+		t.watchers[id] = watch
+		t.watchMu.Unlock()
+		defer func() {
+			t.watchMu.Lock()
+			delete(t.watchers, id)
+			t.watchMu.Unlock()
+		}()
+	}
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	job := t.job
+	return &job, nil
+}
+
+// ErrNotRunning is returned when cancelling a job this instance isn't
+// running.
+var ErrNotRunning = errors.New("job is not running on this instance")
+
+// Cancel stops a job running on this instance. It is recorded as cancelled
+// and not run again.
+func (r *Runner) Cancel(jobID int64) error {
+	r.mu.Lock()
+	t := r.tasks[jobID]
+	r.mu.Unlock()
+	if t == nil {
+		return ErrNotRunning
+	}
+	t.mu.Lock()
+	t.cancelled = true
+	t.mu.Unlock()
+	t.cancel()
+	return nil
+}
+
+// Start begins looking for abandoned jobs to run again. In a cluster only
+// one instance should do so.
+func (r *Runner) Start() {
+	r.stopChan = make(chan struct{})
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ctx := context.Background()
+		for {
+			r.sweep(ctx, time.Now())
+
+			select {
+			case <-r.stopChan:
+				return
+			case <-time.After(SweepInterval):
+			}
+		}
+	}()
+}
+
+// sweep runs the abandoned jobs again, or gives up on those started
+// MaxAttempts times, and deletes finished jobs older than Retention.
+func (r *Runner) sweep(ctx context.Context, now time.Time) {
+	stale := now.Add(-StaleAfter)
+	abandoned, err := r.db.GetStaleJobs(ctx, stale)
+	if err != nil {
+		log.Printf("Jobs: failed to look for abandoned jobs: %v", err)
+		return
+	}
+	for _, job := range abandoned {
+		r.mu.Lock()
+		_, running := r.tasks[job.ID]
+		r.mu.Unlock()
+		if running {
+			continue // its heartbeat failed to save, but it runs here
+		}
+		ok, err := r.db.ClaimJob(ctx, job.ID, stale, now)
+		if err != nil {
+			log.Printf("Jobs: failed to claim job %d: %v", job.ID, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		job.Attempts++
+		job.StartedAt, job.UpdatedAt = now, now
+		if job.Attempts > MaxAttempts {
+			job.State = model.JobFailed
+			job.Error = fmt.Sprintf("abandoned after %d attempts", MaxAttempts)
+			job.FinishedAt = now
+			if err := r.db.UpdateJob(ctx, &job); err != nil {
+				log.Printf("Jobs: failed to save job %d: %v", job.ID, err)
+			}
+			log.Printf("Jobs: gave up on job %d (%s)", job.ID, job.Kind)
+			continue
+		}
+		log.Printf("Jobs: resuming job %d (%s), attempt %d", job.ID, job.Kind, job.Attempts)
+		r.start("", job)
+	}
+
+	if n, err := r.db.PruneJobs(ctx, now.Add(-Retention)); err != nil {
+		log.Printf("Jobs: failed to delete old jobs: %v", err)
+	} else if n > 0 {
+		log.Printf("Jobs: deleted %d finished jobs", n)
+	}
+}
+
+// Stop stops looking for abandoned jobs. Jobs already running carry on.
+func (r *Runner) Stop() {
+	close(r.stopChan)
+	r.wg.Wait()
+}
@@ -0,0 +1,206 @@
+// Package linkrot rechecks the links of starred and archived items, which
+// were kept to be read again, and flags the ones that are gone so that the
+// UI can open a stored copy instead.
+package linkrot
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// CheckInterval is how often the background job looks for links due for a
+// check.
+const CheckInterval = time.Hour
+
+// DefaultDays is how many days apart a link is checked unless
+// link_check_days says otherwise.
+const DefaultDays = 7
+
+// UserAgent is sent with link checks.
+const UserAgent = "Infovore/1.0 (link checker)"
+
+const (
+	batchSize      = 50               // links checked per run
+	pause          = time.Second      // between two checks of a run
+	requestTimeout = 20 * time.Second // of one request
+	deadAfter      = 2                // checks finding a link gone before it counts as dead
+	retryAfter     = 24 * time.Hour   // until a link found gone is checked again
+)
+
+// Days returns the number of days between checks of a link, 0 if link
+// checks are off.
+func Days(ctx context.Context, db database.Store) int {
+	return max(database.GetIntSetting(ctx, db, model.SettingLinkCheckDays, DefaultDays), 0)
+}
+
+// Check requests link and returns the status it answered with, 0 if there
+// was no answer, and whether it is gone: answered 404 or 410, or is on a
+// host that no longer resolves or refuses connections. A HEAD request is
+// tried first and a GET when that fails, as some servers mishandle HEAD.
+// An error for a link that isn't gone means the check was inconclusive,
+// e.g. a timeout or a server error.
+func Check(ctx context.Context, client *http.Client, link string) (status int, gone bool, err error) {
+	status, err = request(ctx, client, http.MethodHead, link)
+	if err == nil && status < 400 {
+		return status, false, nil
+	}
+	status, err = request(ctx, client, http.MethodGet, link)
+	switch {
+	case err != nil:
+		var dnsErr *net.DNSError
+		gone = errors.As(err, &dnsErr) && dnsErr.IsNotFound || errors.Is(err, syscall.ECONNREFUSED)
+		return 0, gone, err
+	case status == http.StatusNotFound || status == http.StatusGone:
+		return status, true, fmt.Errorf("HTTP %d", status)
+	case status >= 400:
+		return status, false, fmt.Errorf("HTTP %d", status)
+	}
+	return status, false, nil
+}
+
+func request(ctx context.Context, client *http.Client, method, link string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, link, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// Next returns the check that follows prev, which is nil for a link never
+// checked, given the outcome of Check at now. A link counts as dead once
+// deadAfter checks in a row found it gone, and alive again as soon as one
+// finds it working; an inconclusive check changes neither.
+func Next(prev *model.LinkCheck, itemID int64, status int, gone bool, err error, now time.Time, days int) model.LinkCheck {
+	c := model.LinkCheck{ItemID: itemID}
+	if prev != nil {
+		c = *prev
+	}
+	c.Status, c.Error, c.CheckedAt = status, "", now
+	c.NextCheckAt = now.AddDate(0, 0, days)
+	if err != nil {
+		c.Error = err.Error()
+	}
+	switch {
+	case gone:
+		c.Failures++
+		if c.Failures >= deadAfter && c.DeadSince.IsZero() {
+			c.DeadSince = now
+		}
+		if c.DeadSince.IsZero() {
+			c.NextCheckAt = now.Add(retryAfter)
+		}
+	case err == nil:
+		c.Failures, c.DeadSince = 0, time.Time{}
+	}
+	return c
+}
+
+// Run checks the links due for a check, up to a batch, and returns how
+// many it checked and how many of those are dead.
+func Run(ctx context.Context, db database.Store, client *http.Client) (checked, dead int, err error) {
+	days := Days(ctx, db)
+	if days == 0 {
+		return 0, 0, nil
+	}
+	items, err := db.GetLinkCheckItems(ctx, time.Now(), batchSize)
+	if err != nil {
+		return 0, 0, err
+	}
+	for i, item := range items {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return checked, dead, ctx.Err()
+			case <-time.After(pause):
+			}
+		}
+		prev, err := db.GetLinkCheck(ctx, item.ID)
+		if err != nil && err != sql.ErrNoRows {
+			return checked, dead, err
+		}
+		status, gone, checkErr := Check(ctx, client, item.Link)
+		if ctx.Err() != nil {
+			return checked, dead, ctx.Err()
+		}
+		c := Next(prev, item.ID, status, gone, checkErr, time.Now(), days)
+		if err := db.SetLinkCheck(ctx, c); err != nil {
+			return checked, dead, err
+		}
+		checked++
+		if !c.DeadSince.IsZero() {
+			dead++
+			if prev == nil || prev.DeadSince.IsZero() {
+				log.Printf("Link check: item %d link %s is dead: %s", item.ID, item.Link, c.Error)
+			}
+		}
+	}
+	return checked, dead, nil
+}
+
+// Job checks links every CheckInterval.
+type Job struct {
+	db       database.Store
+	client   *http.Client
+	cancel   context.CancelFunc
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewJob creates a link checking job.
+func NewJob(db database.Store) *Job {
+	return &Job{
+		db:       db,
+		client:   &http.Client{},
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins the checking loop.
+func (j *Job) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	j.cancel = cancel
+	j.stopChan = make(chan struct{})
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		for {
+			if checked, dead, err := Run(ctx, j.db, j.client); err != nil && ctx.Err() == nil {
+				log.Printf("Link check: %v", err)
+			} else if checked > 0 {
+				log.Printf("Link check: checked %d links, %d dead", checked, dead)
+			}
+
+			select {
+			case <-j.stopChan:
+				return
+			case <-time.After(CheckInterval):
+			}
+		}
+	}()
+}
+
+// Stop stops the job gracefully, abandoning a run in progress.
+func (j *Job) Stop() {
+	j.cancel()
+	close(j.stopChan)
+	j.wg.Wait()
+}
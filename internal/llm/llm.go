@@ -0,0 +1,129 @@
+// Package llm provides a minimal client for OpenAI-compatible chat completion APIs.
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNotConfigured is returned when no LLM endpoint has been configured.
+var ErrNotConfigured = errors.New("llm: no endpoint configured (set LLM_BASE_URL)")
+
+// DefaultModel is used when LLM_MODEL is not set.
+const DefaultModel = "gpt-4o-mini"
+
+// maxInputChars bounds the article text sent to the model.
+const maxInputChars = 12000
+
+// Client calls an OpenAI-compatible /chat/completions endpoint.
+type Client struct {
+	BaseURL string // e.g. https://api.openai.com/v1
+	APIKey  string
+	Model   string
+	HTTP    *http.Client
+}
+
+// NewFromEnv builds a client from LLM_BASE_URL, LLM_API_KEY, and LLM_MODEL.
+// Returns nil if LLM_BASE_URL is not set.
+func NewFromEnv() *Client {
+	baseURL := strings.TrimRight(os.Getenv("LLM_BASE_URL"), "/")
+	if baseURL == "" {
+		return nil
+	}
+	model := os.Getenv("LLM_MODEL")
+	if model == "" {
+		model = DefaultModel
+	}
+	return &Client{
+		BaseURL: baseURL,
+		APIKey:  os.Getenv("LLM_API_KEY"),
+		Model:   model,
+		HTTP:    &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Temperature float64       `json:"temperature"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Complete sends a system and user prompt and returns the model's reply.
+func (c *Client) Complete(ctx context.Context, system, prompt string) (string, error) {
+	if c == nil {
+		return "", ErrNotConfigured
+	}
+	body, err := json.Marshal(chatRequest{
+		Model: c.Model,
+		Messages: []chatMessage{
+			{Role: "system", Content: system},
+			{Role: "user", Content: prompt},
+		},
+		Temperature: 0.2,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("llm request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var out chatResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&out); err != nil {
+		return "", fmt.Errorf("llm response (status %d): %w", resp.StatusCode, err)
+	}
+	if out.Error != nil {
+		return "", fmt.Errorf("llm error: %s", out.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("llm error: status %d", resp.StatusCode)
+	}
+	if len(out.Choices) == 0 {
+		return "", errors.New("llm error: empty response")
+	}
+	return strings.TrimSpace(out.Choices[0].Message.Content), nil
+}
+
+// Summarize returns a two to three sentence summary of an article.
+func (c *Client) Summarize(ctx context.Context, title, text string) (string, error) {
+	if len(text) > maxInputChars {
+		text = text[:maxInputChars]
+	}
+	return c.Complete(ctx,
+		"You summarize articles for a feed reader. Reply with a plain-text summary of two to three sentences and nothing else.",
+		fmt.Sprintf("Title: %s\n\n%s", title, text))
+}
@@ -0,0 +1,110 @@
+// Package maintenance checks and compacts the database, on demand or on a
+// schedule.
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// CheckInterval is how often the background job checks whether scheduled
+// maintenance is due.
+const CheckInterval = time.Hour
+
+// Run maintains the database and records when it last ran.
+func Run(ctx context.Context, db database.Store) (*model.MaintenanceReport, error) {
+	report, err := db.Maintain(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.SetSetting(ctx, model.SettingMaintenanceLastRun, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		log.Printf("Maintenance: failed to record run: %v", err)
+	}
+	return report, nil
+}
+
+// Summary describes a report for logs and the audit log.
+func Summary(r *model.MaintenanceReport) string {
+	integrity := r.Integrity
+	if integrity == "" {
+		integrity = "not checked"
+	}
+	return fmt.Sprintf("integrity %s, reclaimed %d bytes", integrity, r.Reclaimed)
+}
+
+// Due reports whether scheduled maintenance should run now.
+func Due(ctx context.Context, db database.Store, now time.Time) bool {
+	days := database.GetIntSetting(ctx, db, model.SettingMaintenanceDays, 0)
+	if days <= 0 {
+		return false
+	}
+	raw, _ := db.GetSetting(ctx, model.SettingMaintenanceLastRun)
+	last, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return true // never ran
+	}
+	return !now.Before(last.AddDate(0, 0, days))
+}
+
+// Job runs maintenance every maintenance_days days.
+type Job struct {
+	db       database.Store
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewJob creates a maintenance job.
+func NewJob(db database.Store) *Job {
+	return &Job{
+		db:       db,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins the maintenance loop.
+func (j *Job) Start() {
+	j.stopChan = make(chan struct{})
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		ctx := context.Background()
+		for {
+			if Due(ctx, j.db, time.Now()) {
+				j.run()
+			}
+
+			select {
+			case <-j.stopChan:
+				return
+			case <-time.After(CheckInterval):
+			}
+		}
+	}()
+}
+
+func (j *Job) run() {
+	ctx := context.Background()
+	report, err := Run(ctx, j.db)
+	if err != nil {
+		log.Printf("Maintenance: %v", err)
+		return
+	}
+	summary := Summary(report)
+	log.Printf("Maintenance: %s", summary)
+	err = j.db.AddAuditEntry(ctx, model.AuditEntry{Actor: model.AuditActorSystem, Action: model.AuditMaintenance, Target: summary, CreatedAt: time.Now()})
+	if err != nil {
+		log.Printf("Maintenance: failed to record run: %v", err)
+	}
+}
+
+// Stop stops the job gracefully.
+func (j *Job) Stop() {
+	close(j.stopChan)
+	j.wg.Wait()
+}
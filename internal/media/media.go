@@ -0,0 +1,251 @@
+// Package media downloads item enclosures, such as podcast episodes, to a
+// local directory so they stay available after leaving the origin feed.
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+)
+
+// MaxFileSize bounds the size of a downloaded enclosure.
+const MaxFileSize = 2 << 30
+
+// CheckInterval is how often the downloader looks for queued enclosures
+// when not triggered.
+const CheckInterval = time.Minute
+
+// PruneInterval is how often files of purged items are removed.
+const PruneInterval = 6 * time.Hour
+
+// downloadTimeout bounds a single download.
+const downloadTimeout = 30 * time.Minute
+
+// batchSize is how many queued enclosures are loaded at a time.
+const batchSize = 10
+
+// ErrNotConfigured is returned when no media directory is configured.
+var ErrNotConfigured = errors.New("media: no media directory configured (set MEDIA_DIR)")
+
+// Downloader fetches queued enclosures one at a time.
+type Downloader struct {
+	db       database.Store
+	dir      string
+	trigger  chan struct{}
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewFromEnv creates a downloader storing files under MEDIA_DIR. Returns
+// nil if MEDIA_DIR is not set.
+func NewFromEnv(db database.Store) (*Downloader, error) {
+	dir := os.Getenv("MEDIA_DIR")
+	if dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("MEDIA_DIR: %w", err)
+	}
+	return &Downloader{
+		db:       db,
+		dir:      dir,
+		trigger:  make(chan struct{}, 1),
+		stopChan: make(chan struct{}),
+	}, nil
+}
+
+// Start begins the download loop.
+func (d *Downloader) Start() {
+	d.stopChan = make(chan struct{})
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			<-d.stopChan
+			cancel()
+		}()
+
+		var lastPrune time.Time
+		for {
+			d.downloadPending(ctx)
+			if time.Since(lastPrune) >= PruneInterval {
+				if n, err := d.Prune(ctx); err != nil {
+					log.Printf("Media: prune error: %v", err)
+				} else if n > 0 {
+					log.Printf("Media: removed %d files of purged items", n)
+				}
+				lastPrune = time.Now()
+			}
+
+			select {
+			case <-d.stopChan:
+				return
+			case <-d.trigger:
+			case <-time.After(CheckInterval):
+			}
+		}
+	}()
+}
+
+// Trigger schedules a download pass without blocking.
+func (d *Downloader) Trigger() {
+	select {
+	case d.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Stop stops the loop, cancelling any download in progress.
+func (d *Downloader) Stop() {
+	close(d.stopChan)
+	d.wg.Wait()
+}
+
+// downloadPending downloads queued enclosures until none are left.
+func (d *Downloader) downloadPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		items, err := d.db.GetPendingMedia(ctx, batchSize)
+		if err != nil {
+			log.Printf("Media: error loading queue: %v", err)
+			return
+		}
+		if len(items) == 0 {
+			return
+		}
+		for _, item := range items {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := d.Download(ctx, item); err != nil {
+				log.Printf("Media: download of item %d failed: %v", item.ID, err)
+			}
+		}
+	}
+}
+
+// Download fetches an item's enclosure and records the outcome.
+func (d *Downloader) Download(ctx context.Context, item model.Item) error {
+	file, size, err := d.fetch(ctx, item)
+	m := model.ItemMedia{ItemID: item.ID, Status: model.MediaDone, File: file, Size: size, UpdatedAt: time.Now()}
+	if err != nil {
+		if ctx.Err() != nil {
+			return err // shutting down; leave it queued
+		}
+		m.Status, m.Error = model.MediaFailed, err.Error()
+	}
+	if serr := d.db.SetItemMedia(ctx, m); serr != nil {
+		return serr
+	}
+	return err
+}
+
+// fetch downloads the enclosure to <feed ID>/<item ID><ext> and returns
+// that relative path and the file size.
+func (d *Downloader) fetch(ctx context.Context, item model.Item) (string, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, item.EnclosureURL, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	reqid.Set(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", 0, fmt.Errorf("http error: %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	feedDir := strconv.FormatInt(item.FeedID, 10)
+	if err := os.MkdirAll(filepath.Join(d.dir, feedDir), 0o755); err != nil {
+		return "", 0, err
+	}
+	rel := path.Join(feedDir, strconv.FormatInt(item.ID, 10)+extension(item, resp.Header.Get("Content-Type")))
+	tmp, err := os.CreateTemp(filepath.Join(d.dir, feedDir), ".download-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, io.LimitReader(resp.Body, MaxFileSize+1))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if size > MaxFileSize {
+		return "", 0, fmt.Errorf("file exceeds %d bytes", int64(MaxFileSize))
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(d.dir, filepath.FromSlash(rel))); err != nil {
+		return "", 0, err
+	}
+	return rel, size, nil
+}
+
+// extension picks a file extension from the enclosure URL, falling back to
+// its media type.
+func extension(item model.Item, contentType string) string {
+	if u, err := url.Parse(item.EnclosureURL); err == nil {
+		if ext := path.Ext(u.Path); len(ext) > 1 && len(ext) <= 6 {
+			return strings.ToLower(ext)
+		}
+	}
+	for _, t := range []string{item.EnclosureType, contentType} {
+		mediaType, _, _ := mime.ParseMediaType(t)
+		if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			return exts[0]
+		}
+	}
+	return ".bin"
+}
+
+// Path returns the absolute location of a downloaded enclosure.
+func (d *Downloader) Path(m *model.ItemMedia) string {
+	return filepath.Join(d.dir, filepath.FromSlash(m.File))
+}
+
+// Prune removes files whose item no longer exists, e.g. after the trash
+// was emptied. Returns the number of files removed.
+func (d *Downloader) Prune(ctx context.Context) (int, error) {
+	removed := 0
+	err := filepath.WalkDir(d.dir, func(p string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		name := entry.Name()
+		id, err := strconv.ParseInt(strings.TrimSuffix(name, filepath.Ext(name)), 10, 64)
+		if err != nil {
+			return nil // not ours, e.g. an interrupted download
+		}
+		if _, err := d.db.GetItemMedia(ctx, id); errors.Is(err, sql.ErrNoRows) {
+			if err := os.Remove(p); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	return removed, err
+}
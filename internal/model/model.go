@@ -1,7 +1,11 @@
 // Package model defines shared data structures.
 package model
 
-import "time"
+import (
+	"net/url"
+	"strings"
+	"time"
+)
 
 // Folder represents a hierarchical folder for organizing feeds.
 type Folder struct {
@@ -17,11 +21,106 @@ type Feed struct {
 	Title       string
 	URL         string
 	IconURL     string
-	LastFetched time.Time
-	LastError   string // stores last fetch error, empty if successful
-	ItemCount   int    // number of items in feed (for UI warning display)
+	IconEmoji   string // chosen emoji shown instead of the icon, empty if none
+	CustomIcon  bool   // an uploaded FeedIcon image replaces IconURL
+	SiteURL     string // homepage of the site publishing the feed
+	Description string
+	LastAttempt time.Time // last fetch, successful or not; zero if never fetched
+	LastSuccess time.Time // last successful fetch, zero if none
+	LastError   string    // stores last fetch error, empty if successful
+	HealthScore int       // 0 to 100, meaningful only if HealthGrade is set
+	HealthGrade string    // "A" to "F", empty until graded
+	NextFetch   time.Time // earliest time the publisher wants it polled again, zero if any time
+	ItemCount   int       // number of items in feed (for UI warning display)
+	UnreadCount int       // unread items outside the trash
+	InboxToken  string    // set for virtual feeds whose items are pushed in, never polled
+
+	// LastErrorStatus is the HTTP status of the last failed fetch, 0 if it
+	// got no response, and LastErrorClass the kind of failure, one of the
+	// FetchError* constants.
+	LastErrorStatus int
+	LastErrorClass  string
+	ErrorStreak     int    // failed fetches since the last successful one
+	SuggestedURL    string // feed URL found by rediscovery after repeated 404s, empty if none
+
+	// Labels are the user's labels on the feed, sorted. Only set by
+	// listings that load them, see Store.GetFeedLabels.
+	Labels []string
+
+	FeedOptions
+}
+
+// Placeholder URL prefixes for virtual feeds.
+const (
+	InboxURLPrefix      = "inbox:"  // followed by the inbox token
+	NewsletterURLPrefix = "mailto:" // followed by the sender address
+	SavedURLPrefix      = "saved:"  // followed by the folder ID, or "unfiled"
+	DigestURLPrefix     = "digest:" // the daily digest feed
+	AlertsURLPrefix     = "alerts:" // the feed items matching alerts are copied to
+)
+
+// IsVirtual reports whether the feed receives pushed items instead of being polled.
+func (f Feed) IsVirtual() bool {
+	for _, prefix := range []string{InboxURLPrefix, NewsletterURLPrefix, SavedURLPrefix, DigestURLPrefix, AlertsURLPrefix} {
+		if strings.HasPrefix(f.URL, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// FeedOptions holds per-feed behaviour toggles editable through the feed settings API.
+type FeedOptions struct {
+	// BackfillArchives walks RFC 5005 archive pages on the first fetch.
+	BackfillArchives bool `json:"backfill_archives"`
+	// AutoSummarize generates an LLM summary for each new item.
+	AutoSummarize bool `json:"auto_summarize"`
+	// ArchivePages stores a cleaned snapshot of each new item's linked page.
+	ArchivePages bool `json:"archive_pages"`
+	// DownloadEnclosures downloads each new item's enclosure (e.g. podcast
+	// episode) to the media directory.
+	DownloadEnclosures bool `json:"download_enclosures"`
+	// IngestCategories tags each new item with the categories the feed
+	// assigns to it.
+	IngestCategories bool `json:"ingest_categories"`
+	// EmbedVideos shows video links and players in item content as
+	// click-to-load embeds, which contact the video site only when played.
+	EmbedVideos bool `json:"embed_videos"`
+	// Notify sends a browser push notification for each new item, see
+	// package webpush.
+	Notify bool `json:"notify"`
+	// FetchStrategy selects how the feed is requested, one of the Fetch*
+	// constants. Empty means direct.
+	FetchStrategy string `json:"fetch_strategy"`
+	// Notes is the user's own note on the feed, such as why they subscribed.
+	Notes string `json:"notes"`
+	// Transforms rewrite the content of each fetched item, in order, before
+	// it is stored. See package transform.
+	Transforms []ContentTransform `json:"transforms"`
 }
 
+// ContentTransform is one step of the rewriting of a feed's item content.
+type ContentTransform struct {
+	Op       string `json:"op"`                 // one of the Transform* constants
+	Selector string `json:"selector,omitempty"` // CSS selector of TransformStripSelector
+	Pattern  string `json:"pattern,omitempty"`  // regular expression of TransformRegexReplace
+	Replace  string `json:"replace,omitempty"`  // replacement of TransformRegexReplace, may refer to groups as $1
+}
+
+// Content transform operations, see ContentTransform.
+const (
+	TransformStripSelector  = "strip-selector"  // remove the elements matching Selector
+	TransformRegexReplace   = "regex-replace"   // replace matches of Pattern in the HTML with Replace
+	TransformAbsolutizeURLs = "absolutize-urls" // resolve relative links and image sources against the item link again, e.g. after a regex-replace
+)
+
+// Feed fetch strategies, see FeedOptions.FetchStrategy.
+const (
+	FetchDirect  = "direct"
+	FetchProxy   = "proxy"   // through the proxy set in FETCH_PROXY_URL
+	FetchService = "service" // through the fetch service set in FETCH_SERVICE_URL
+)
+
 // Item represents a single article/entry from a feed.
 type Item struct {
 	ID          int64
@@ -30,18 +129,520 @@ type Item struct {
 	Title       string
 	Content     string
 	Link        string
+	AuthorName  string
+	AuthorEmail string
 	PublishedAt time.Time
 	FetchedAt   time.Time
 	IsRead      bool
+	Note        string // private annotation, empty if none
+	WordCount   int
+	ReadingTime int    // estimated reading time in minutes
+	Summary     string // generated summary, empty if none
+	Snippet     string // start of Content as plain text, shown by item lists
+	Starred     bool
+	Archived    bool   // a page snapshot is stored, see ItemArchive
+	WaybackURL  string // Wayback Machine capture of the link, empty if none
+	// EnclosureURL and EnclosureType describe the attached media file,
+	// e.g. a podcast episode. Empty if the item has none.
+	EnclosureURL  string
+	EnclosureType string
+	MediaStatus   string // one of the Media* constants, empty if not downloaded
+	LinkDead      bool   // Link was found gone, see LinkCheck
+	// CommentsURL is the item's discussion page and CommentsFeed a feed of
+	// its comments. Empty if the feed doesn't name them.
+	CommentsURL  string
+	CommentsFeed string
+	// Domain is the site the item links to, see LinkDomain. It is derived
+	// from Link when the item is stored.
+	Domain string
+	// Enclosures are all the media files the feed attaches to the item. They
+	// are set while fetching and by item listings that load them.
+	Enclosures []Enclosure
+	// Categories are the feed's categories for the item. They are only set
+	// while fetching and are not stored; see FeedOptions.IngestCategories.
+	Categories []string
+	// InterestScore is the estimated probability (0-1) that the item will be opened.
+	InterestScore float64
+	// ReadPosition is how far the item has been scrolled through, in percent,
+	// so that a long read can be resumed on another device. 0 if not started.
+	ReadPosition float64
+	// RawTitle is the title as the feed gave it, when normalizing it for
+	// display changed it; empty otherwise.
+	RawTitle string
+}
+
+// Item sort modes.
+const (
+	SortNewest   = "newest"
+	SortOldest   = "oldest"
+	SortFetched  = "fetched" // most recently fetched first
+	SortLongest  = "longest"
+	SortShortest = "shortest"
+	SortInterest = "interest"
+	SortRandom   = "random" // shuffled by ItemFilter.Seed
+)
+
+// MaxSortSeed bounds ItemFilter.Seed.
+const MaxSortSeed = 1<<32 - 1
+
+// ShuffleKey returns the position of an item in the SortRandom order of a
+// seed. The SQL stores compute the same key in their queries. Every operand
+// is reduced modulo the prime 2^31-1 before it is multiplied by a factor
+// below 2^31, so no product leaves the int64 range the databases compute in.
+func ShuffleKey(itemID, seed int64) int64 {
+	h := itemID % 2147483647 * 1103515245 % 2147483647
+	return (h ^ seed) % 2147483647 * 48271 % 2147483647
+}
+
+// ItemFilter narrows and orders an item listing. Zero values mean no filter.
+type ItemFilter struct {
+	FeedID         *int64
+	FolderID       *int64
+	OnlyUnread     bool
+	OnlyRead       bool
+	MinWords       int
+	MaxWords       int
+	Tag            string    // only items carrying this tag
+	FeedLabel      string    // only items of feeds carrying this label
+	Author         string    // only items by this author (case-insensitive)
+	Domain         string    // only items linking to this site, see LinkDomain
+	Starred        bool      // only starred items
+	DeadLinks      bool      // only items whose link was found gone
+	Since          time.Time // only items published at or after this time
+	Until          time.Time // only items published before this time
+	FetchedSince   time.Time // only items fetched at or after this time
+	ExcludeFolders []int64   // hide the items of feeds in these folders
+	OlderThan      int64     // only items listed after this item, newest first
+	NewerThan      int64     // only items listed before this item, newest first
+	Sort           string    // one of the Sort* constants, newest first if empty
+	Seed           int64     // shuffle of SortRandom, 0 to MaxSortSeed; pages of a listing must share it
+	Limit          int       // at most this many items, all if 0
+	Offset         int       // items skipped before the first, with Limit only
+}
+
+// Tag is a topic label attached to items.
+type Tag struct {
+	ID        int64
+	Name      string
+	ItemCount int
+}
+
+// FeedLabel is a label the user put on feeds, independent of folders.
+type FeedLabel struct {
+	Name      string
+	FeedCount int
+}
+
+// Author is an item author with the number of items credited to them.
+type Author struct {
+	Name      string
+	ItemCount int
+}
+
+// Domain is a site items link to, with the number of items and of feeds
+// linking to it.
+type Domain struct {
+	Name      string
+	ItemCount int
+	FeedCount int
+}
+
+// LinkDomain returns the site a link points to: its lowercased host name
+// without a leading "www.", so that www.example.com and example.com are
+// grouped. It returns "" for links without a host.
+func LinkDomain(link string) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// InterestEvent records whether the reader opened or skipped an item. Events
+// outlive the items they describe and are used to train the interest model.
+type InterestEvent struct {
+	FeedID    int64
+	Title     string
+	Positive  bool // true if opened, false if skipped
+	CreatedAt time.Time
+}
+
+// ItemActivity is when an item arrived and when it was read, for reading
+// statistics.
+type ItemActivity struct {
+	FeedID    int64
+	FetchedAt time.Time
+	ReadAt    *time.Time // nil while unread
+}
+
+// AuditEntry records an administrative or destructive action.
+type AuditEntry struct {
+	ID        int64
+	Actor     string // client address, or AuditActorSystem for background jobs
+	Action    string // one of the Audit* action constants
+	Target    string // what was acted on, e.g. "feed 12 (Example)"
+	CreatedAt time.Time
+}
+
+// Audited actions.
+const (
+	AuditActorSystem    = "system"
+	AuditDeleteFeed     = "delete_feed"
+	AuditDeleteFolder   = "delete_folder"
+	AuditDeleteItems    = "delete_items"
+	AuditCleanup        = "cleanup"
+	AuditPurgeTrash     = "purge_trash"
+	AuditUpdateSettings = "update_settings"
+	AuditImportOPML     = "import_opml"
+	AuditImportDump     = "import_dump"
+	AuditMaintenance    = "maintenance"
+	AuditMergeItems     = "merge_items"
+	AuditFixOrphans     = "fix_orphans"
+	AuditFolderFeed     = "folder_feed"
+	AuditBlogroll       = "blogroll"
+	AuditFolderCalendar = "folder_calendar"
+)
+
+// Job is a unit of background work recorded in the database, so its status
+// can be looked up by ID and it is run again if the instance running it
+// stops before it finishes.
+type Job struct {
+	ID         int64
+	Kind       string // names the handler that runs it
+	State      string // one of the Job* states
+	Payload    string // JSON input of the handler
+	Result     string // JSON output of the handler once done
+	Error      string // why it failed
+	Done       int    // progress: units of work finished
+	Total      int    // progress: units of work in all, 0 if unknown
+	Attempts   int    // times it was started
+	CreatedAt  time.Time
+	StartedAt  time.Time // when the last attempt started
+	UpdatedAt  time.Time // last sign of life while running
+	FinishedAt time.Time // zero until done, failed or cancelled
+}
+
+// Job states.
+const (
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// MaintenanceReport describes a database maintenance run.
+type MaintenanceReport struct {
+	// Integrity is "ok" or the problems found by the integrity check;
+	// empty if the backend has no such check.
+	Integrity  string `json:"integrity"`
+	SizeBefore int64  `json:"size_before"` // bytes on disk, including the WAL
+	SizeAfter  int64  `json:"size_after"`
+	Reclaimed  int64  `json:"reclaimed"` // SizeBefore - SizeAfter, never negative
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// StorageReport describes what the database holds and the space it takes.
+type StorageReport struct {
+	Items        int64         `json:"items"`         // including trashed ones
+	TrashedItems int64         `json:"trashed_items"` // awaiting purge
+	Size         int64         `json:"size"`          // bytes on disk, including the WAL; 0 if not on disk
+	Tables       []TableSize   `json:"tables"`        // largest first
+	Feeds        []FeedStorage `json:"feeds"`         // largest first
+}
+
+// TableSize is the space a table takes, with its indexes.
+type TableSize struct {
+	Name  string `json:"name"`
+	Bytes int64  `json:"bytes"`
+}
+
+// FeedStorage counts a feed's items and the bytes of text they store:
+// titles, content, summaries, snippets, notes and archived pages. Trashed
+// feeds and items are included until purged.
+type FeedStorage struct {
+	FeedID       int64  `json:"feed_id"`
+	Title        string `json:"title"`
+	Items        int64  `json:"items"`
+	TrashedItems int64  `json:"trashed_items"`
+	Bytes        int64  `json:"bytes"`
+}
+
+// OrphanReport describes rows left behind by deleted ones, as found by a
+// check or removed by a fix. Backends enforcing foreign keys only collect
+// them from before they did.
+type OrphanReport struct {
+	Folders  []int64  `json:"folders"`   // subfolders of missing folders, moved to the top level by a fix
+	Items    int64    `json:"items"`     // items of missing feeds
+	TagLinks int64    `json:"tag_links"` // item tags linking missing items or tags
+	Settings []string `json:"settings"`  // stored settings not in KnownSettings
+}
+
+// TrashedFeed is a deleted feed awaiting purge. ItemCount counts the items
+// deleted with it.
+type TrashedFeed struct {
+	Feed
+	DeletedAt time.Time
+}
+
+// TrashedItem is a deleted item awaiting purge.
+type TrashedItem struct {
+	Item
+	DeletedAt time.Time
+}
+
+// ItemArchive is a stored snapshot of the page an item links to.
+type ItemArchive struct {
+	ItemID    int64
+	URL       string // final URL after redirects
+	Title     string
+	HTML      string // cleaned page content
+	FetchedAt time.Time
+}
+
+// Enclosure download states.
+const (
+	MediaPending = "pending"
+	MediaDone    = "done"
+	MediaFailed  = "failed"
+)
+
+// ItemMedia tracks the local copy of an item's enclosure.
+type ItemMedia struct {
+	ItemID    int64
+	Status    string // one of the Media* constants
+	File      string // path relative to the media directory, set once done
+	Size      int64
+	Error     string
+	UpdatedAt time.Time
+}
+
+// LinkCheck is the latest check of whether an item's link still works, see
+// package linkrot.
+type LinkCheck struct {
+	ItemID      int64
+	Status      int       // HTTP status of the answer, 0 if there was none
+	Error       string    // why the check failed, empty if the link works
+	Failures    int       // consecutive checks that found the link gone
+	DeadSince   time.Time // zero until the link counts as dead
+	CheckedAt   time.Time
+	NextCheckAt time.Time
+}
+
+// Enclosure is a media file attached to an item, from an RSS enclosure, an
+// Atom enclosure link or a Media RSS media:content element.
+type Enclosure struct {
+	URL       string `json:"url"`
+	Type      string `json:"type,omitempty"`      // MIME type
+	Medium    string `json:"medium,omitempty"`    // "image", "audio", "video", ... if given
+	Size      int64  `json:"size,omitempty"`      // bytes, 0 if unknown
+	Duration  int    `json:"duration,omitempty"`  // seconds, 0 if unknown
+	Thumbnail string `json:"thumbnail,omitempty"` // preview image URL
+}
+
+// FeedIcon is a feed icon chosen by the user: an emoji, or an uploaded
+// image with its content type.
+type FeedIcon struct {
+	FeedID      int64
+	Emoji       string
+	ContentType string
+	Data        []byte
+	UpdatedAt   time.Time
+}
+
+// Classes of fetch errors.
+const (
+	FetchErrorDNS        = "dns"        // the host name didn't resolve
+	FetchErrorConnection = "connection" // the connection was refused or dropped
+	FetchErrorTLS        = "tls"        // the TLS handshake or certificate check failed
+	FetchErrorTimeout    = "timeout"    // no complete response in time
+	FetchErrorHTTP       = "http"       // a response without a 2xx status
+	FetchErrorParse      = "parse"      // the response isn't a readable feed
+	FetchErrorOther      = "other"
+)
+
+// FetchError describes a failed fetch of a feed.
+type FetchError struct {
+	Message    string
+	StatusCode int    // HTTP status, 0 if there was no response
+	Class      string // one of the FetchError* constants
+}
+
+// FetchLogEntry records one fetch of a feed, kept for a while to grade the
+// feed's health.
+type FetchLogEntry struct {
+	FeedID    int64
+	FetchedAt time.Time
+	OK        bool
+	Duration  time.Duration
+}
+
+// FetchStats summarizes the logged fetches of a feed.
+type FetchStats struct {
+	FeedID        int64
+	Attempts      int
+	Successes     int
+	AvgDuration   time.Duration // over successful fetches
+	LastPublished time.Time     // newest item, zero if the feed has none
+}
+
+// HealthGrade returns the letter grade for a feed health score.
+func HealthGrade(score int) string {
+	switch {
+	case score >= 90:
+		return "A"
+	case score >= 75:
+		return "B"
+	case score >= 60:
+		return "C"
+	case score >= 40:
+		return "D"
+	default:
+		return "F"
+	}
+}
+
+// ImportFeed is one feed of a batch import.
+type ImportFeed struct {
+	FolderPath []string // nested folder names, outermost first
+	Title      string
+	URL        string
+}
+
+// Import outcomes.
+const (
+	ImportAdded   = "added"
+	ImportExists  = "exists"
+	ImportInvalid = "invalid"
+)
+
+// ImportResult reports what a batch import did with one feed.
+type ImportResult struct {
+	URL    string `json:"url"`
+	Title  string `json:"title"`
+	Status string `json:"status"` // one of the Import* constants
+	FeedID int64  `json:"feed_id,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// ResolvedURL is where URL redirects, when that made the entry a feed
+	// already subscribed to or a repeat of an earlier entry.
+	ResolvedURL string `json:"resolved_url,omitempty"`
 }
 
 // FolderWithFeeds represents a folder containing its feeds for UI rendering.
 type FolderWithFeeds struct {
 	Folder
-	Feeds []Feed
+	Feeds     []Feed
+	Collapsed bool // folder is collapsed in the sidebar
+	Digest    bool // items are held back for the daily digest
+	Blogroll  bool // feeds are listed on the public blogroll
+	Notify    bool // new items send push notifications
+}
+
+// DomainLimit overrides the request rate limits for one domain and its
+// subdomains. Nil fields use the global settings.
+type DomainLimit struct {
+	MaxConcurrency *int `json:"max_concurrency,omitempty"`
+	DelayMs        *int `json:"delay_ms,omitempty"`
+}
+
+// DomainBudget is a rate limit the fetcher learned for a domain by backing
+// off after 429 and 403 responses. It narrows the configured limit and is
+// relaxed a step at a time while the domain answers normally.
+type DomainBudget struct {
+	MaxConcurrency int       `json:"max_concurrency"`
+	DelayMs        int       `json:"delay_ms"`
+	ChangedAt      time.Time `json:"changed_at"`
 }
 
 // Settings key constants.
 const (
-	SettingPollingInterval = "polling_interval_minutes"
+	SettingPollingInterval         = "polling_interval_minutes"
+	SettingArchiveBackfillMaxPages = "archive_backfill_max_pages"
+	SettingClassifierBackend       = "classifier_backend" // "", "keywords" or "llm"
+	SettingClassifierRules         = "classifier_rules"   // JSON object: topic -> keywords
+	SettingClassifierTopics        = "classifier_topics"  // JSON array of topics for the LLM backend
+	SettingPipelineStages          = "pipeline_stages"    // JSON object: stage name -> pipeline.StageConfig
+	SettingTrashRetentionDays      = "trash_retention_days"
+	SettingUpgradeFeedsToHTTPS     = "upgrade_feeds_to_https" // "1" rewrites new feed URLs from http to https
+	SettingSidebarSort             = "sidebar_sort"           // one of the SidebarSort* constants
+	SettingSidebarFolderSort       = "sidebar_folder_sort"    // SidebarSort* constant for folders, sidebar_sort if empty
+	SettingSidebarHideEmpty        = "sidebar_hide_empty"     // "1" hides feeds without unread items from the sidebar
+	SettingCollapsedFolders        = "collapsed_folders"      // JSON array of folder IDs collapsed in the sidebar
+	SettingKindleEmail             = "kindle_email"           // address EPUB exports are mailed to
+	SettingWaybackStarred          = "wayback_starred"        // "1" saves starred items to the Wayback Machine
+	SettingDomainMaxConcurrency    = "domain_max_concurrency" // parallel requests allowed per domain
+	SettingDomainDelayMs           = "domain_delay_ms"        // minimum delay between requests to a domain
+	SettingDomainLimits            = "domain_limits"          // JSON object: domain -> DomainLimit
+	SettingDomainBudgets           = "domain_budgets"         // JSON object: host -> DomainBudget learned from 429 and 403 responses
+	SettingFetchWorkers            = "fetch_workers"          // parallel feed fetches, 0 uses the database default
+	SettingFetchTimeoutSeconds     = "fetch_timeout_seconds"  // HTTP timeout of a single feed or page request
+	SettingMaintenanceDays         = "maintenance_days"       // days between scheduled database maintenance runs, 0 disables
+	SettingMaintenanceLastRun      = "maintenance_last_run"   // RFC 3339 time of the last maintenance run
+	SettingLinkCheckDays           = "link_check_days"        // days between checks of the links of starred and archived items, 0 disables
+	SettingDigestFolders           = "digest_folders"         // JSON array of folder IDs held back for the daily digest
+	SettingDigestHour              = "digest_hour"            // local hour the daily digest is delivered at
+	SettingDigestLastRun           = "digest_last_run"        // RFC 3339 time of the last digest
+	SettingFolderFeedTokens        = "folder_feed_tokens"     // JSON object: secret token -> ID of the folder its Atom feed lists
+	SettingFolderCalendarTokens    = "folder_calendar_tokens" // JSON object: secret token -> ID of the folder its iCalendar feed lists
+	SettingAlerts                  = "alerts"                 // JSON array of keyword alerts, see package alerts
+	SettingDedupeMode              = "dedupe_mode"            // what makes two items of a feed the same article, see package dedupe
+	SettingDedupeWindowHours       = "dedupe_window_hours"    // hours apart copies may be published, 0 for any time
+	SettingSnippetLength           = "snippet_length"         // characters of item previews in lists, 0 lists full content
+	SettingKeyboardShortcuts       = "keyboard_shortcuts"     // JSON object: keyboard shortcut action -> key, overriding the defaults
+	SettingRediscoverAutoApply     = "rediscover_auto_apply"  // "1" moves feeds that keep returning 404 to the feed rediscovered on their site
+	SettingBlogrollFolders         = "blogroll_folders"       // JSON array of folder IDs whose feeds the public blogroll lists
+	SettingNotifyFolders           = "notify_folders"         // JSON array of folder IDs whose new items send push notifications
+	SettingWebPushKey              = "webpush_key"            // base64 PKCS #8 VAPID private key push requests are signed with
+	SettingWebPushSubscriptions    = "webpush_subscriptions"  // JSON array of webpush.Subscription
+)
+
+// KnownSettings lists the settings keys above. Stored settings missing from
+// it are left over from removed features and dropped by the orphan fix, so
+// new keys must be added here too.
+var KnownSettings = []string{
+	SettingPollingInterval,
+	SettingArchiveBackfillMaxPages,
+	SettingClassifierBackend,
+	SettingClassifierRules,
+	SettingClassifierTopics,
+	SettingPipelineStages,
+	SettingTrashRetentionDays,
+	SettingUpgradeFeedsToHTTPS,
+	SettingSidebarSort,
+	SettingSidebarFolderSort,
+	SettingSidebarHideEmpty,
+	SettingCollapsedFolders,
+	SettingKindleEmail,
+	SettingWaybackStarred,
+	SettingDomainMaxConcurrency,
+	SettingDomainDelayMs,
+	SettingDomainLimits,
+	SettingDomainBudgets,
+	SettingFetchWorkers,
+	SettingFetchTimeoutSeconds,
+	SettingMaintenanceDays,
+	SettingMaintenanceLastRun,
+	SettingLinkCheckDays,
+	SettingDigestFolders,
+	SettingDigestHour,
+	SettingDigestLastRun,
+	SettingFolderFeedTokens,
+	SettingFolderCalendarTokens,
+	SettingAlerts,
+	SettingDedupeMode,
+	SettingDedupeWindowHours,
+	SettingSnippetLength,
+	SettingKeyboardShortcuts,
+	SettingRediscoverAutoApply,
+	SettingBlogrollFolders,
+	SettingNotifyFolders,
+	SettingWebPushKey,
+	SettingWebPushSubscriptions,
+}
+
+// Sidebar sort modes for folders and feeds.
+const (
+	SidebarSortName    = "name"    // alphabetical (default)
+	SidebarSortManual  = "manual"  // the order saved by drag and drop
+	SidebarSortUnread  = "unread"  // most unread items first
+	SidebarSortUpdated = "updated" // most recently published item first
 )
@@ -0,0 +1,304 @@
+// Package newsletter turns emails from an IMAP mailbox into items, with one
+// virtual feed per sender.
+package newsletter
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/imap"
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/rss"
+	"github.com/mmcdole/gofeed"
+	"golang.org/x/net/html/charset"
+)
+
+// ProcessedFlag is the IMAP keyword set on messages once they are ingested.
+const ProcessedFlag = "$Infovore"
+
+// FolderName is the folder newsletter feeds are created in.
+const FolderName = "Newsletters"
+
+// MaxPerPoll bounds how many messages are ingested in one poll.
+const MaxPerPoll = 50
+
+// DefaultPollMinutes is the polling interval when none is configured.
+const DefaultPollMinutes = 15
+
+// ErrNotConfigured is returned when no mailbox is configured.
+var ErrNotConfigured = errors.New("newsletter: no mailbox configured (set NEWSLETTER_IMAP_URL)")
+
+// Message is the part of an email that becomes an item.
+type Message struct {
+	FromName  string
+	FromAddr  string
+	Subject   string
+	MessageID string
+	Date      time.Time
+	HTML      string
+}
+
+// Poller periodically ingests new messages from a mailbox.
+type Poller struct {
+	cfg      imap.Config
+	interval time.Duration
+	db       database.Store
+	fetcher  *rss.Fetcher
+	mu       sync.Mutex // serializes polls
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewFromEnv creates a poller from NEWSLETTER_IMAP_URL and
+// NEWSLETTER_POLL_MINUTES. Returns nil if no mailbox is configured.
+func NewFromEnv(db database.Store, fetcher *rss.Fetcher) (*Poller, error) {
+	raw := os.Getenv("NEWSLETTER_IMAP_URL")
+	if raw == "" {
+		return nil, nil
+	}
+	cfg, err := imap.ParseURL(raw)
+	if err != nil {
+		return nil, fmt.Errorf("NEWSLETTER_IMAP_URL: %w", err)
+	}
+	minutes := DefaultPollMinutes
+	if m, err := strconv.Atoi(os.Getenv("NEWSLETTER_POLL_MINUTES")); err == nil && m > 0 {
+		minutes = m
+	}
+	return &Poller{
+		cfg:      cfg,
+		interval: time.Duration(minutes) * time.Minute,
+		db:       db,
+		fetcher:  fetcher,
+		stopChan: make(chan struct{}),
+	}, nil
+}
+
+// Start begins the polling loop.
+func (p *Poller) Start() {
+	p.stopChan = make(chan struct{})
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+			n, err := p.Poll(ctx)
+			cancel()
+			if err != nil {
+				log.Printf("Newsletter: poll error: %v", err)
+			} else if n > 0 {
+				log.Printf("Newsletter: ingested %d messages", n)
+			}
+
+			select {
+			case <-p.stopChan:
+				return
+			case <-time.After(p.interval):
+			}
+		}
+	}()
+}
+
+// Stop stops the polling loop gracefully.
+func (p *Poller) Stop() {
+	close(p.stopChan)
+	p.wg.Wait()
+}
+
+// Poll ingests unprocessed messages and flags them as processed. Returns the
+// number of messages ingested.
+func (p *Poller) Poll(ctx context.Context) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c, err := imap.Dial(p.cfg)
+	if err != nil {
+		return 0, fmt.Errorf("connect: %w", err)
+	}
+	defer c.Logout()
+	if err := c.Login(p.cfg.Username, p.cfg.Password); err != nil {
+		return 0, err
+	}
+	if err := c.Select(p.cfg.Mailbox); err != nil {
+		return 0, err
+	}
+	uids, err := c.UIDSearch("NOT KEYWORD " + ProcessedFlag)
+	if err != nil {
+		return 0, err
+	}
+	if len(uids) > MaxPerPoll {
+		uids = uids[:MaxPerPoll] // oldest first; the rest are picked up next poll
+	}
+
+	folderID, err := p.db.GetOrCreateFolder(ctx, FolderName, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, uid := range uids {
+		if ctx.Err() != nil {
+			return count, ctx.Err()
+		}
+		raw, err := c.FetchMessage(uid)
+		if err != nil {
+			return count, err
+		}
+		if msg, err := ParseMessage(raw); err != nil {
+			// Flag it anyway so one malformed message isn't retried forever.
+			log.Printf("Newsletter: skipping message %d: %v", uid, err)
+		} else if err := p.ingest(ctx, folderID, msg); err != nil {
+			return count, err
+		} else {
+			count++
+		}
+		if err := c.AddFlags(uid, `\Seen `+ProcessedFlag); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// ingest stores a message as an item of its sender's feed.
+func (p *Poller) ingest(ctx context.Context, folderID int64, msg *Message) error {
+	title := msg.FromName
+	if title == "" {
+		title = msg.FromAddr
+	}
+	feedID, _, err := p.db.GetOrCreateFeed(ctx, &folderID, title, model.NewsletterURLPrefix+msg.FromAddr)
+	if err != nil {
+		return err
+	}
+	feed, err := p.db.GetFeedByID(ctx, feedID)
+	if err != nil {
+		return err
+	}
+	guid := msg.MessageID
+	if guid == "" {
+		guid = fmt.Sprintf("%s-%d", msg.FromAddr, msg.Date.Unix())
+	}
+	date := msg.Date
+	p.fetcher.IngestItems(ctx, *feed, []*gofeed.Item{{
+		Title:           msg.Subject,
+		Content:         msg.HTML,
+		GUID:            guid,
+		PublishedParsed: &date,
+	}})
+	return nil
+}
+
+// ParseMessage extracts the sender, subject and body of an email. The HTML
+// part is preferred; plain text bodies are escaped and line breaks kept.
+func ParseMessage(raw []byte) (*Message, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	dec := &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+
+	from, err := mail.ParseAddress(m.Header.Get("From"))
+	if err != nil {
+		return nil, fmt.Errorf("parse From: %w", err)
+	}
+	msg := &Message{
+		FromName:  from.Name,
+		FromAddr:  strings.ToLower(from.Address),
+		MessageID: strings.Trim(m.Header.Get("Message-Id"), "<> "),
+	}
+	if msg.Subject, err = dec.DecodeHeader(m.Header.Get("Subject")); err != nil {
+		msg.Subject = m.Header.Get("Subject")
+	}
+	if msg.Subject == "" {
+		msg.Subject = "(no subject)"
+	}
+	if msg.Date, err = m.Header.Date(); err != nil {
+		msg.Date = time.Now()
+	}
+
+	htmlBody, textBody, err := readBody(m.Header.Get("Content-Type"), m.Header.Get("Content-Transfer-Encoding"), m.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case htmlBody != "":
+		msg.HTML = htmlBody
+	case textBody != "":
+		msg.HTML = strings.ReplaceAll(html.EscapeString(textBody), "\n", "<br>")
+	default:
+		return nil, errors.New("no text or HTML body")
+	}
+	return msg, nil
+}
+
+// readBody walks a MIME entity, returning the first HTML and plain text
+// parts it finds, decoded to UTF-8.
+func readBody(contentType, encoding string, body io.Reader) (htmlBody, textBody string, err error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return htmlBody, textBody, nil
+			}
+			if err != nil {
+				return htmlBody, textBody, err
+			}
+			if strings.HasPrefix(part.Header.Get("Content-Disposition"), "attachment") {
+				continue
+			}
+			h, t, err := readBody(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err != nil {
+				return htmlBody, textBody, err
+			}
+			if htmlBody == "" {
+				htmlBody = h
+			}
+			if textBody == "" {
+				textBody = t
+			}
+		}
+	}
+
+	if mediaType != "text/html" && mediaType != "text/plain" {
+		return "", "", nil
+	}
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	if cs := params["charset"]; cs != "" {
+		if body, err = charset.NewReaderLabel(cs, body); err != nil {
+			return "", "", err
+		}
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", "", err
+	}
+	if mediaType == "text/html" {
+		return string(data), "", nil
+	}
+	return "", string(data), nil
+}
@@ -35,6 +35,7 @@ type Outline struct {
 	Type     string    `xml:"type,attr,omitempty"`
 	XMLURL   string    `xml:"xmlUrl,attr,omitempty"`
 	HTMLURL  string    `xml:"htmlUrl,attr,omitempty"`
+	Category string    `xml:"category,attr,omitempty"`
 	Outlines []Outline `xml:"outline,omitempty"`
 }
 
@@ -43,6 +44,11 @@ type FeedEntry struct {
 	FolderPath []string // e.g., ["Tech", "Google"]
 	Title      string
 	URL        string
+	HTMLURL    string // homepage of the site, empty if unknown
+	// Categories are the values of the outline's category attribute, a
+	// comma-separated list. By convention those starting with "/" are
+	// folder paths, such as "/Tech/Google", and the others tags.
+	Categories []string
 }
 
 // Parse reads an OPML document and returns a flat list of FeedEntry.
@@ -61,11 +67,19 @@ func Parse(r io.Reader) ([]FeedEntry, error) {
 				if title == "" {
 					title = o.Text
 				}
-				entries = append(entries, FeedEntry{
+				e := FeedEntry{
 					FolderPath: append([]string{}, path...),
 					Title:      title,
 					URL:        o.XMLURL,
-				})
+					HTMLURL:    o.HTMLURL,
+					Categories: splitCategories(o.Category),
+				}
+				if len(path) == 0 {
+					// Readers that don't nest outlines put the folder
+					// in a category instead.
+					e.FolderPath = categoryFolder(e.Categories)
+				}
+				entries = append(entries, e)
 			} else if len(o.Outlines) > 0 {
 				// It's a folder.
 				name := o.Text
@@ -80,6 +94,37 @@ func Parse(r io.Reader) ([]FeedEntry, error) {
 	return entries, nil
 }
 
+// splitCategories splits a category attribute into its categories.
+func splitCategories(attr string) []string {
+	var categories []string
+	for _, c := range strings.Split(attr, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			categories = append(categories, c)
+		}
+	}
+	return categories
+}
+
+// categoryFolder returns the folder path named by the first category that is
+// one, or nil.
+func categoryFolder(categories []string) []string {
+	for _, c := range categories {
+		if !strings.HasPrefix(c, "/") {
+			continue
+		}
+		var path []string
+		for _, name := range strings.Split(c, "/") {
+			if name = strings.TrimSpace(name); name != "" {
+				path = append(path, name)
+			}
+		}
+		if len(path) > 0 {
+			return path
+		}
+	}
+	return nil
+}
+
 // Export generates an OPML document from a nested map structure.
 // folders should be a map of folder name -> sub-items.
 func Export(title string, folders map[string][]FeedEntry) ([]byte, error) {
@@ -99,10 +144,12 @@ func Export(title string, folders map[string][]FeedEntry) ([]byte, error) {
 	for _, entries := range folders {
 		for _, e := range entries {
 			feedOutline := Outline{
-				Text:   e.Title,
-				Title:  e.Title,
-				Type:   "rss",
-				XMLURL: e.URL,
+				Text:     e.Title,
+				Title:    e.Title,
+				Type:     "rss",
+				XMLURL:   e.URL,
+				HTMLURL:  e.HTMLURL,
+				Category: strings.Join(e.Categories, ","),
 			}
 			if len(e.FolderPath) == 0 {
 				rootOutlines = append(rootOutlines, feedOutline)
@@ -0,0 +1,353 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/alerts"
+	"github.com/bryan-buckman/infovore/internal/classify"
+	"github.com/bryan-buckman/infovore/internal/llm"
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+	"github.com/bryan-buckman/infovore/internal/snapshot"
+	"github.com/bryan-buckman/infovore/internal/textutil"
+	"github.com/bryan-buckman/infovore/internal/transform"
+	"github.com/bryan-buckman/infovore/internal/webpush"
+)
+
+// Built-in stage names.
+const (
+	StageClassify   = "classify"
+	StageSummarize  = "summarize"
+	StageWebhook    = "webhook"
+	StageArchive    = "archive"
+	StageDownload   = "download"
+	StageCategories = "categories"
+	StageAlerts     = "alerts"
+	StageWebPush    = "webpush"
+	StageTransform  = "transform"
+)
+
+func init() {
+	Register(StageTransform, true, newTransformStage)
+	Register(StageClassify, true, newClassifyStage)
+	Register(StageSummarize, true, newSummarizeStage)
+	Register(StageWebhook, false, newWebhookStage)
+	Register(StageArchive, true, newArchiveStage)
+	Register(StageDownload, true, newDownloadStage)
+	Register(StageCategories, true, newCategoriesStage)
+	Register(StageAlerts, true, newAlertsStage)
+	Register(StageWebPush, true, newWebPushStage)
+}
+
+// transformStage rewrites the content of fetched items with their feed's
+// transforms, see FeedOptions.Transforms. It runs before the other filters,
+// which see the rewritten content.
+type transformStage struct {
+	chains map[int64]*transform.Chain // by feed ID, nil if the feed's list is invalid
+}
+
+func newTransformStage(context.Context, Deps, json.RawMessage) (interface{}, error) {
+	return &transformStage{chains: make(map[int64]*transform.Chain)}, nil
+}
+
+func (s *transformStage) Filter(_ context.Context, feed model.Feed, item *model.Item) (bool, error) {
+	if len(feed.Transforms) == 0 {
+		return true, nil
+	}
+	chain, ok := s.chains[feed.ID]
+	if !ok {
+		var err error
+		chain, err = transform.Compile(feed.Transforms)
+		s.chains[feed.ID] = chain
+		if err != nil {
+			return true, err
+		}
+	}
+	if chain != nil {
+		item.Content = chain.Apply(item.Content, transform.Base(item.Link, feed))
+	}
+	return true, nil
+}
+
+// classifyStage tags new items using the classifier selected in settings.
+type classifyStage struct {
+	deps       Deps
+	classifier classify.Classifier
+}
+
+func newClassifyStage(ctx context.Context, deps Deps, _ json.RawMessage) (interface{}, error) {
+	c := classify.FromSettings(ctx, deps.DB, deps.LLM)
+	if c == nil {
+		return nil, nil
+	}
+	return &classifyStage{deps: deps, classifier: c}, nil
+}
+
+func (s *classifyStage) Enrich(ctx context.Context, _ model.Feed, item *model.Item) error {
+	labels, err := s.classifier.Classify(ctx, item.Title, textutil.PlainText(item.Content))
+	if err != nil {
+		return err
+	}
+	return s.deps.DB.AddItemTags(ctx, item.ID, labels)
+}
+
+// summarizeStage generates LLM summaries for new items of feeds with
+// auto-summarize enabled, or for every feed when configured with all_feeds.
+type summarizeStage struct {
+	deps     Deps
+	AllFeeds bool `json:"all_feeds"`
+}
+
+func newSummarizeStage(_ context.Context, deps Deps, config json.RawMessage) (interface{}, error) {
+	if deps.LLM == nil {
+		return nil, nil
+	}
+	s := &summarizeStage{deps: deps}
+	if err := decodeConfig(config, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *summarizeStage) Enrich(ctx context.Context, feed model.Feed, item *model.Item) error {
+	if !feed.AutoSummarize && !s.AllFeeds {
+		return nil
+	}
+	_, err := Summarize(ctx, s.deps, item)
+	return err
+}
+
+// Summarize generates a summary for an item and stores it. Returns
+// llm.ErrNotConfigured if no LLM endpoint is configured.
+func Summarize(ctx context.Context, deps Deps, item *model.Item) (string, error) {
+	if deps.LLM == nil {
+		return "", llm.ErrNotConfigured
+	}
+	ctx, cancel := context.WithTimeout(ctx, 90*time.Second)
+	defer cancel()
+	summary, err := deps.LLM.Summarize(ctx, item.Title, textutil.PlainText(item.Content))
+	if err != nil {
+		return "", err
+	}
+	if err := deps.DB.SetItemSummary(ctx, item.ID, summary); err != nil {
+		return "", err
+	}
+	return summary, nil
+}
+
+// archiveStage stores a snapshot of the linked page for new items of feeds
+// with page archiving enabled.
+type archiveStage struct {
+	deps Deps
+}
+
+func newArchiveStage(_ context.Context, deps Deps, _ json.RawMessage) (interface{}, error) {
+	return &archiveStage{deps: deps}, nil
+}
+
+func (s *archiveStage) Enrich(ctx context.Context, feed model.Feed, item *model.Item) error {
+	if !feed.ArchivePages || item.Link == "" {
+		return nil
+	}
+	return Archive(ctx, s.deps, item)
+}
+
+// Archive downloads the page an item links to and stores a cleaned snapshot.
+func Archive(ctx context.Context, deps Deps, item *model.Item) error {
+	if item.Link == "" {
+		return errors.New("item has no link")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	page, err := snapshot.Fetch(ctx, item.Link)
+	if err != nil {
+		return err
+	}
+	err = deps.DB.SaveItemArchive(ctx, model.ItemArchive{
+		ItemID:    item.ID,
+		URL:       page.URL,
+		Title:     page.Title,
+		HTML:      page.HTML,
+		FetchedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	item.Archived = true
+	return nil
+}
+
+// downloadStage queues the enclosures of new items of feeds with enclosure
+// downloads enabled. The media downloader fetches them in the background.
+type downloadStage struct {
+	deps Deps
+}
+
+func newDownloadStage(_ context.Context, deps Deps, _ json.RawMessage) (interface{}, error) {
+	return &downloadStage{deps: deps}, nil
+}
+
+func (s *downloadStage) Enrich(ctx context.Context, feed model.Feed, item *model.Item) error {
+	if !feed.DownloadEnclosures || item.EnclosureURL == "" {
+		return nil
+	}
+	err := s.deps.DB.SetItemMedia(ctx, model.ItemMedia{ItemID: item.ID, Status: model.MediaPending, UpdatedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	item.MediaStatus = model.MediaPending
+	return nil
+}
+
+// categoriesStage tags new items of feeds with category ingestion enabled
+// with the categories the feed assigns to them.
+type categoriesStage struct {
+	deps Deps
+}
+
+func newCategoriesStage(_ context.Context, deps Deps, _ json.RawMessage) (interface{}, error) {
+	return &categoriesStage{deps: deps}, nil
+}
+
+func (s *categoriesStage) Enrich(ctx context.Context, feed model.Feed, item *model.Item) error {
+	if !feed.IngestCategories {
+		return nil
+	}
+	return s.deps.DB.AddItemTags(ctx, item.ID, categoryTags(item.Categories))
+}
+
+// maxCategoryTagLen bounds tag names taken from feed categories.
+const maxCategoryTagLen = 64
+
+// categoryTags normalizes feed categories into tag names: lower-cased with
+// collapsed whitespace, without empty, overlong or duplicate entries.
+// Categories holding several comma-separated values are split.
+func categoryTags(categories []string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, c := range categories {
+		for _, part := range strings.Split(c, ",") {
+			tag := strings.ToLower(strings.Join(strings.Fields(part), " "))
+			if tag == "" || len(tag) > maxCategoryTagLen || seen[tag] {
+				continue
+			}
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// alertsStage copies new items matching the saved keyword alerts into the
+// Alerts feed and notifies the alerts' webhooks.
+type alertsStage struct {
+	deps   Deps
+	alerts []alerts.Alert
+}
+
+func newAlertsStage(ctx context.Context, deps Deps, _ json.RawMessage) (interface{}, error) {
+	list := alerts.Load(ctx, deps.DB)
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return &alertsStage{deps: deps, alerts: list}, nil
+}
+
+func (s *alertsStage) Notify(ctx context.Context, feed model.Feed, item model.Item) error {
+	return alerts.Deliver(ctx, s.deps.DB, feed, item, alerts.Matching(s.alerts, item))
+}
+
+// maxPushesPerFetch caps the notifications one fetch of a feed sends, so a
+// feed publishing in bulk doesn't flood the browsers.
+const maxPushesPerFetch = 5
+
+// webPushStage sends a push notification to the subscribed browsers for new
+// items of feeds flagged to notify or in folders flagged to notify.
+type webPushStage struct {
+	deps    Deps
+	folders map[int64]bool
+	sent    map[int64]int // notifications per feed
+}
+
+func newWebPushStage(ctx context.Context, deps Deps, _ json.RawMessage) (interface{}, error) {
+	if len(webpush.Subscriptions(ctx, deps.DB)) == 0 {
+		return nil, nil
+	}
+	s := &webPushStage{deps: deps, folders: make(map[int64]bool), sent: make(map[int64]int)}
+	for _, id := range webpush.Folders(ctx, deps.DB) {
+		s.folders[id] = true
+	}
+	return s, nil
+}
+
+func (s *webPushStage) Notify(ctx context.Context, feed model.Feed, item model.Item) error {
+	if !feed.Notify && (feed.FolderID == nil || !s.folders[*feed.FolderID]) {
+		return nil
+	}
+	if s.sent[feed.ID] >= maxPushesPerFetch {
+		return nil
+	}
+	s.sent[feed.ID]++
+	url := item.Link
+	if url == "" {
+		url = fmt.Sprintf("/feed/%d", feed.ID)
+	}
+	_, err := webpush.Send(ctx, s.deps.DB, webpush.Message{
+		Title: feed.Title,
+		Body:  item.Title,
+		URL:   url,
+		Tag:   fmt.Sprintf("feed-%d", feed.ID),
+	})
+	return err
+}
+
+// webhookStage posts each new item as JSON to a configured URL.
+type webhookStage struct {
+	URL string `json:"url"`
+}
+
+func newWebhookStage(_ context.Context, _ Deps, config json.RawMessage) (interface{}, error) {
+	s := &webhookStage{}
+	if err := decodeConfig(config, s); err != nil {
+		return nil, err
+	}
+	if s.URL == "" {
+		return nil, errors.New("url is required")
+	}
+	return s, nil
+}
+
+func (s *webhookStage) Notify(ctx context.Context, feed model.Feed, item model.Item) error {
+	body, _ := json.Marshal(map[string]interface{}{
+		"feed_id":      feed.ID,
+		"feed_title":   feed.Title,
+		"item_id":      item.ID,
+		"title":        item.Title,
+		"link":         item.Link,
+		"published_at": item.PublishedAt,
+	})
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	reqid.Set(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+// Package pipeline runs pluggable processing stages on fetched items.
+//
+// A stage implements one or more of Filter, Enricher and Notifier. Filters
+// run on every fetched item before it is stored and may modify or drop it.
+// Enrichers and notifiers run, in that order, only on newly stored items.
+// Stages are registered by name with a Factory and can be enabled, disabled
+// and configured through the pipeline_stages setting.
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/llm"
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// Deps are the shared services available to stage factories.
+type Deps struct {
+	DB  database.Store
+	LLM *llm.Client // nil if no LLM endpoint is configured
+}
+
+// Filter stages run before an item is stored. Returning false drops the item.
+type Filter interface {
+	Filter(ctx context.Context, feed model.Feed, item *model.Item) (bool, error)
+}
+
+// Enricher stages run on newly stored items, which have their ID set.
+type Enricher interface {
+	Enrich(ctx context.Context, feed model.Feed, item *model.Item) error
+}
+
+// Notifier stages run after all enrichers on newly stored items.
+type Notifier interface {
+	Notify(ctx context.Context, feed model.Feed, item model.Item) error
+}
+
+// Factory builds a stage from its JSON configuration, which is nil when
+// none is set. The stage must implement at least one of Filter, Enricher or
+// Notifier. A nil stage means the stage has nothing to do and is skipped.
+type Factory func(ctx context.Context, deps Deps, config json.RawMessage) (interface{}, error)
+
+// StageConfig is the per-stage entry in the pipeline_stages setting.
+type StageConfig struct {
+	Enabled *bool           `json:"enabled,omitempty"` // nil uses the stage's default
+	Config  json.RawMessage `json:"config,omitempty"`
+}
+
+// StageInfo describes a registered stage and its current configuration.
+type StageInfo struct {
+	Name    string          `json:"name"`
+	Enabled bool            `json:"enabled"`
+	Config  json.RawMessage `json:"config,omitempty"`
+}
+
+type registration struct {
+	name           string
+	factory        Factory
+	defaultEnabled bool
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []registration
+)
+
+// Register adds a stage. Stages run in registration order within each kind.
+// Registering the same name twice panics.
+func Register(name string, defaultEnabled bool, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, r := range registry {
+		if r.name == name {
+			panic("pipeline: stage registered twice: " + name)
+		}
+	}
+	registry = append(registry, registration{name: name, factory: factory, defaultEnabled: defaultEnabled})
+}
+
+// Registered reports whether a stage with the given name exists.
+func Registered(name string) bool {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, r := range registry {
+		if r.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadConfig reads the pipeline_stages setting. A missing or malformed
+// setting yields an empty configuration.
+func LoadConfig(ctx context.Context, db database.Store) map[string]StageConfig {
+	cfg := make(map[string]StageConfig)
+	if raw, err := db.GetSetting(ctx, model.SettingPipelineStages); err == nil && raw != "" {
+		if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+			log.Printf("Pipeline: ignoring malformed %s setting: %v", model.SettingPipelineStages, err)
+		}
+	}
+	return cfg
+}
+
+// SaveConfig writes the pipeline_stages setting.
+func SaveConfig(ctx context.Context, db database.Store, cfg map[string]StageConfig) error {
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return db.SetSetting(ctx, model.SettingPipelineStages, string(raw))
+}
+
+// Stages lists all registered stages with their effective configuration.
+func Stages(ctx context.Context, db database.Store) []StageInfo {
+	cfg := LoadConfig(ctx, db)
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	infos := make([]StageInfo, 0, len(registry))
+	for _, r := range registry {
+		c := cfg[r.name]
+		infos = append(infos, StageInfo{Name: r.name, Enabled: enabled(r, c), Config: c.Config})
+	}
+	return infos
+}
+
+func enabled(r registration, c StageConfig) bool {
+	if c.Enabled != nil {
+		return *c.Enabled
+	}
+	return r.defaultEnabled
+}
+
+// Pipeline is a built set of stages ready to process items.
+type Pipeline struct {
+	filters   []named[Filter]
+	enrichers []named[Enricher]
+	notifiers []named[Notifier]
+}
+
+type named[T any] struct {
+	name  string
+	stage T
+}
+
+// Build instantiates every enabled stage. Stages that fail to build are
+// logged and skipped so one misconfigured stage doesn't stop fetching.
+func Build(ctx context.Context, deps Deps) *Pipeline {
+	cfg := LoadConfig(ctx, deps.DB)
+	registryMu.Lock()
+	regs := append([]registration(nil), registry...)
+	registryMu.Unlock()
+
+	p := &Pipeline{}
+	for _, r := range regs {
+		c := cfg[r.name]
+		if !enabled(r, c) {
+			continue
+		}
+		stage, err := r.factory(ctx, deps, c.Config)
+		if err != nil {
+			log.Printf("Pipeline: stage %s disabled: %v", r.name, err)
+			continue
+		}
+		if stage == nil {
+			continue
+		}
+		matched := false
+		if s, ok := stage.(Filter); ok {
+			p.filters = append(p.filters, named[Filter]{r.name, s})
+			matched = true
+		}
+		if s, ok := stage.(Enricher); ok {
+			p.enrichers = append(p.enrichers, named[Enricher]{r.name, s})
+			matched = true
+		}
+		if s, ok := stage.(Notifier); ok {
+			p.notifiers = append(p.notifiers, named[Notifier]{r.name, s})
+			matched = true
+		}
+		if !matched {
+			log.Printf("Pipeline: stage %s implements no stage interface", r.name)
+		}
+	}
+	return p
+}
+
+// Filter runs all filters on an item, reporting whether it should be
+// stored. A filter error is logged and the item is kept.
+func (p *Pipeline) Filter(ctx context.Context, feed model.Feed, item *model.Item) bool {
+	for _, f := range p.filters {
+		keep, err := f.stage.Filter(ctx, feed, item)
+		if err != nil {
+			log.Printf("Pipeline: filter %s failed on %s: %v", f.name, item.GUID, err)
+			continue
+		}
+		if !keep {
+			return false
+		}
+	}
+	return true
+}
+
+// Process runs enrichers and then notifiers on a newly stored item. Errors
+// are logged and don't stop later stages.
+func (p *Pipeline) Process(ctx context.Context, feed model.Feed, item *model.Item) {
+	for _, e := range p.enrichers {
+		if err := e.stage.Enrich(ctx, feed, item); err != nil {
+			log.Printf("Pipeline: enricher %s failed on %s: %v", e.name, item.GUID, err)
+		}
+	}
+	for _, n := range p.notifiers {
+		if err := n.stage.Notify(ctx, feed, *item); err != nil {
+			log.Printf("Pipeline: notifier %s failed on %s: %v", n.name, item.GUID, err)
+		}
+	}
+}
+
+// decodeConfig unmarshals a stage config into v, leaving v untouched when
+// no config is set.
+func decodeConfig(config json.RawMessage, v interface{}) error {
+	if len(config) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(config, v); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	return nil
+}
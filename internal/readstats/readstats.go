@@ -0,0 +1,116 @@
+// Package readstats summarizes how many items are read over time, from which
+// feeds, and how the unread backlog changes.
+package readstats
+
+import (
+	"sort"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// maxTopFeeds bounds the feed list in a report.
+const maxTopFeeds = 10
+
+// Day is one calendar day of reading.
+type Day struct {
+	Date    string `json:"date"` // YYYY-MM-DD
+	Read    int    `json:"read"`
+	Backlog int    `json:"backlog"` // unread items at the end of the day
+}
+
+// Week is one calendar week of reading, starting on Monday.
+type Week struct {
+	Start string `json:"start"` // YYYY-MM-DD
+	Read  int    `json:"read"`
+}
+
+// FeedCount is how many items of a feed were read.
+type FeedCount struct {
+	FeedID int64  `json:"feed_id"`
+	Title  string `json:"title"`
+	Read   int    `json:"read"`
+}
+
+// Report summarizes reading over a number of days up to now.
+type Report struct {
+	Since    time.Time   `json:"since"`
+	Read     int         `json:"read"`   // items read since Since
+	Unread   int         `json:"unread"` // items unread now
+	Days     []Day       `json:"days"`   // oldest first, today last
+	Weeks    []Week      `json:"weeks"`  // oldest first, this week last
+	TopFeeds []FeedCount `json:"top_feeds"`
+}
+
+// Since returns the start of the day days-1 days before now, the first
+// moment a report over days days covers.
+func Since(now time.Time, days int) time.Time {
+	y, m, d := now.Date()
+	return time.Date(y, m, d-days+1, 0, 0, 0, 0, now.Location())
+}
+
+// Compute builds the report over days days ending now, in now's time zone,
+// from the activity returned by GetReadActivity(Since(now, days)). titles
+// names the feeds; feeds missing from it are left out of TopFeeds.
+func Compute(acts []model.ItemActivity, titles map[int64]string, days int, now time.Time) *Report {
+	since := Since(now, days)
+	r := &Report{Since: since, Days: make([]Day, days)}
+	ends := make([]time.Time, days)
+	for i := range r.Days {
+		start := since.AddDate(0, 0, i)
+		r.Days[i].Date = start.Format(time.DateOnly)
+		ends[i] = start.AddDate(0, 0, 1)
+	}
+	ends[days-1] = now
+
+	perFeed := make(map[int64]int)
+	for _, a := range acts {
+		if a.ReadAt == nil {
+			r.Unread++
+		} else if !a.ReadAt.Before(since) && a.ReadAt.Before(now) {
+			r.Read++
+			perFeed[a.FeedID]++
+			r.Days[dayIndex(ends, *a.ReadAt)].Read++
+		}
+		for i, end := range ends {
+			if a.FetchedAt.Before(end) && (a.ReadAt == nil || !a.ReadAt.Before(end)) {
+				r.Days[i].Backlog++
+			}
+		}
+	}
+
+	for _, d := range r.Days {
+		start, _ := time.ParseInLocation(time.DateOnly, d.Date, now.Location())
+		week := start.AddDate(0, 0, -(int(start.Weekday())+6)%7).Format(time.DateOnly)
+		if n := len(r.Weeks); n == 0 || r.Weeks[n-1].Start != week {
+			r.Weeks = append(r.Weeks, Week{Start: week})
+		}
+		r.Weeks[len(r.Weeks)-1].Read += d.Read
+	}
+
+	for id, n := range perFeed {
+		if title, ok := titles[id]; ok {
+			r.TopFeeds = append(r.TopFeeds, FeedCount{FeedID: id, Title: title, Read: n})
+		}
+	}
+	sort.Slice(r.TopFeeds, func(i, j int) bool {
+		if r.TopFeeds[i].Read != r.TopFeeds[j].Read {
+			return r.TopFeeds[i].Read > r.TopFeeds[j].Read
+		}
+		return r.TopFeeds[i].Title < r.TopFeeds[j].Title
+	})
+	if len(r.TopFeeds) > maxTopFeeds {
+		r.TopFeeds = r.TopFeeds[:maxTopFeeds]
+	}
+	return r
+}
+
+// dayIndex returns the index of the day ending after t.
+func dayIndex(ends []time.Time, t time.Time) int {
+	for i, end := range ends {
+		if t.Before(end) {
+			return i
+		}
+	}
+	return len(ends) - 1
+}
@@ -0,0 +1,74 @@
+// Package reqid carries a request ID through a context, so that the log
+// lines and outgoing requests of one operation, however many steps it takes,
+// can be told apart from those of others.
+package reqid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Header is the HTTP header a request ID is read from and sent in.
+const Header = "X-Request-ID"
+
+// maxLen bounds the length of an ID taken from a client.
+const maxLen = 64
+
+type contextKey struct{}
+
+// New returns a random request ID.
+func New() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Valid reports whether an ID supplied by a client is safe to use: short,
+// and made of letters, digits and a few punctuation characters, so it can't
+// forge log lines or headers.
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '/':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// With returns a context carrying a request ID.
+func With(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// From returns the request ID carried by ctx, or "".
+func From(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Logf logs a line prefixed with the request ID carried by ctx, if any, the
+// way the request log shows it.
+func Logf(ctx context.Context, format string, args ...interface{}) {
+	if id := From(ctx); id != "" {
+		format = fmt.Sprintf("[%s] %s", id, format)
+	}
+	log.Printf(format, args...)
+}
+
+// Set adds the request ID carried by the context of an outgoing request to
+// its headers.
+func Set(req *http.Request) {
+	if id := From(req.Context()); id != "" {
+		req.Header.Set(Header, id)
+	}
+}
@@ -0,0 +1,166 @@
+package rss
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+)
+
+// DefaultArchiveBackfillMaxPages caps how many archive pages are walked per
+// feed when no setting is configured.
+const DefaultArchiveBackfillMaxPages = 10
+
+// BackfillArchives walks a feed's RFC 5005 archive chain (rel="prev-archive",
+// falling back to paged rel="next" links) and stores the older items it finds.
+// It stops after the configured page cap. Returns the number of new items.
+func (f *Fetcher) BackfillArchives(ctx context.Context, feed model.Feed) (int, error) {
+	if archiveMaxPages(ctx, f.db) <= 0 {
+		return 0, nil
+	}
+	body, _, err := f.fetchResponse(ctx, feed.URL, feed.FetchStrategy)
+	if err != nil {
+		return 0, err
+	}
+	return f.walkArchives(ctx, feed, archiveLink(body, feed.URL))
+}
+
+// archiveMaxPages returns the page cap of an archive walk, 0 or less if
+// walks are off.
+func archiveMaxPages(ctx context.Context, db database.Store) int {
+	return database.GetIntSetting(ctx, db, model.SettingArchiveBackfillMaxPages, DefaultArchiveBackfillMaxPages)
+}
+
+// walkArchives is BackfillArchives starting from next, the archive link of
+// the feed document, for callers that have already fetched it.
+func (f *Fetcher) walkArchives(ctx context.Context, feed model.Feed, next string) (int, error) {
+	maxPages := archiveMaxPages(ctx, f.db)
+	visited := map[string]bool{feed.URL: true}
+	total := 0
+	for page := 0; page < maxPages && next != ""; page++ {
+		if visited[next] {
+			break
+		}
+		visited[next] = true
+
+		body, header, err := f.fetchResponse(ctx, next, feed.FetchStrategy)
+		if err != nil {
+			return total, err
+		}
+		parsed, err := f.parse(ctx, body, header)
+		if err != nil {
+			return total, fmt.Errorf("parse archive page %s: %w", next, err)
+		}
+		count, err := f.storeItemsBulk(ctx, feed, parsed.Items, time.Now())
+		if err != nil {
+			return total, fmt.Errorf("store archive page %s: %w", next, err)
+		}
+		total += count
+		reqid.Logf(ctx, "Backfilled %d items from archive page %s", count, next)
+
+		next = archiveLink(body, next)
+	}
+	return total, nil
+}
+
+// fetchResponse downloads a document using a feed fetch strategy and
+// returns it with the response headers. The rate limit applies to the host
+// actually contacted, which is the fetch service's for FetchService.
+func (f *Fetcher) fetchResponse(ctx context.Context, docURL, strategy string) ([]byte, http.Header, error) {
+	body, header, _, err := f.fetchTimed(ctx, docURL, strategy)
+	return body, header, err
+}
+
+// fetchTimed is fetchResponse that also returns how long the request took,
+// not counting any wait for the rate limiter.
+func (f *Fetcher) fetchTimed(ctx context.Context, docURL, strategy string) ([]byte, http.Header, time.Duration, error) {
+	reqURL, client, err := f.strategyRequest(docURL, strategy)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("fetch %s: %w", docURL, err)
+	}
+	domain := extractDomain(reqURL)
+	release, err := f.domainLimiter.acquire(ctx, domain)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("rate limit cancelled for %s: %w", docURL, err)
+	}
+	defer release()
+
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	reqid.Set(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, time.Since(start), err
+	}
+	defer resp.Body.Close()
+	f.domainLimiter.observe(domain, resp.StatusCode)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, nil, time.Since(start), &httpError{url: docURL, statusCode: resp.StatusCode}
+	}
+	body, err := readBody(resp)
+	if err != nil {
+		return nil, nil, time.Since(start), fmt.Errorf("fetch %s: %w", docURL, err)
+	}
+	return body, resp.Header, time.Since(start), nil
+}
+
+// archiveLink returns the absolute URL of the next older page referenced by a
+// feed document, preferring rel="prev-archive" over paged rel="next".
+func archiveLink(doc []byte, base string) string {
+	links := make(map[string]string)
+	dec := xml.NewDecoder(bytes.NewReader(doc))
+	dec.Strict = false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local != "link" {
+			continue
+		}
+		var rel, href string
+		for _, attr := range se.Attr {
+			switch attr.Name.Local {
+			case "rel":
+				rel = strings.ToLower(attr.Value)
+			case "href":
+				href = attr.Value
+			}
+		}
+		if href != "" && rel != "" {
+			if _, seen := links[rel]; !seen {
+				links[rel] = href
+			}
+		}
+	}
+
+	href := links["prev-archive"]
+	if href == "" {
+		href = links["next"]
+	}
+	if href == "" {
+		return ""
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return href
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	return baseURL.ResolveReference(ref).String()
+}
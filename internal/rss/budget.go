@@ -0,0 +1,150 @@
+package rss
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+)
+
+// Adaptive domain budgets: a domain answering 429 or 403 gets half its
+// parallel requests and twice its delay, and a step of that back each
+// budgetRecoveryInterval it answers normally, until its limit is reached.
+const (
+	// budgetMinDelay is the delay after backing off from a limit without one.
+	budgetMinDelay = 2 * time.Second
+	// budgetBackoffInterval keeps the responses to one burst of requests
+	// from backing off more than once.
+	budgetBackoffInterval = time.Minute
+	// budgetRecoveryInterval is how long a budget stays before a normal
+	// response relaxes it a step.
+	budgetRecoveryInterval = 15 * time.Minute
+)
+
+// domainBudget is the learned limit of a domain, applied on top of the
+// configured one.
+type domainBudget struct {
+	concurrency int
+	delay       time.Duration
+	changedAt   time.Time
+}
+
+// apply returns limit narrowed to the budget.
+func (b domainBudget) apply(limit domainLimit) domainLimit {
+	limit.concurrency = min(limit.concurrency, b.concurrency)
+	limit.delay = max(limit.delay, b.delay)
+	return limit
+}
+
+// observe adjusts the budget of a domain to the status of a response from it.
+func (dl *domainLimiter) observe(domain string, status int) {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+
+	now := time.Now()
+	limit := dl.limitFor(domain)
+	b, ok := dl.budgets[domain]
+	if !ok {
+		b = domainBudget{concurrency: limit.concurrency, delay: limit.delay}
+	}
+	switch {
+	case status == http.StatusTooManyRequests || status == http.StatusForbidden:
+		if ok && now.Sub(b.changedAt) < budgetBackoffInterval {
+			return
+		}
+		b.concurrency = max(b.concurrency/2, 1)
+		b.delay = min(max(b.delay*2, budgetMinDelay), maxDomainDelayMs*time.Millisecond)
+		log.Printf("Backing off %s after HTTP %d: %d parallel requests, %s apart", domain, status, b.concurrency, b.delay)
+	case ok && status < 400 && now.Sub(b.changedAt) >= budgetRecoveryInterval:
+		b.concurrency = min(b.concurrency+1, limit.concurrency)
+		b.delay = max(b.delay/2, limit.delay)
+		if b.concurrency >= limit.concurrency && b.delay <= limit.delay {
+			delete(dl.budgets, domain)
+			dl.budgetsChanged = true
+			return
+		}
+	default:
+		return
+	}
+	b.changedAt = now
+	dl.budgets[domain] = b
+	dl.budgetsChanged = true
+}
+
+// setBudgets replaces the budgets with stored ones.
+func (dl *domainLimiter) setBudgets(stored map[string]model.DomainBudget) {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	dl.budgets = make(map[string]domainBudget, len(stored))
+	for domain, b := range stored {
+		dl.budgets[domain] = domainBudget{
+			concurrency: min(max(b.MaxConcurrency, 1), maxDomainConcurrency),
+			delay:       time.Duration(min(max(b.DelayMs, 0), maxDomainDelayMs)) * time.Millisecond,
+			changedAt:   b.ChangedAt,
+		}
+	}
+	dl.budgetsChanged = false
+}
+
+// snapshotBudgets returns the budgets for storing or listing.
+func (dl *domainLimiter) snapshotBudgets() map[string]model.DomainBudget {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	return dl.budgetsLocked()
+}
+
+// changedBudgets returns the budgets for storing if they changed since they
+// were last loaded or returned by it.
+func (dl *domainLimiter) changedBudgets() (map[string]model.DomainBudget, bool) {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	if !dl.budgetsChanged {
+		return nil, false
+	}
+	dl.budgetsChanged = false
+	return dl.budgetsLocked(), true
+}
+
+// budgetsLocked converts the budgets for storing. dl.mu must be held.
+func (dl *domainLimiter) budgetsLocked() map[string]model.DomainBudget {
+	budgets := make(map[string]model.DomainBudget, len(dl.budgets))
+	for domain, b := range dl.budgets {
+		budgets[domain] = model.DomainBudget{MaxConcurrency: b.concurrency,
+			DelayMs: int(b.delay / time.Millisecond), ChangedAt: b.changedAt}
+	}
+	return budgets
+}
+
+// DomainBudgets returns the limits the fetcher learned for domains that
+// answered 429 or 403, keyed by host.
+func (f *Fetcher) DomainBudgets() map[string]model.DomainBudget {
+	return f.domainLimiter.snapshotBudgets()
+}
+
+// loadBudgets restores the domain budgets stored by saveBudgets.
+func (f *Fetcher) loadBudgets(ctx context.Context) {
+	var stored map[string]model.DomainBudget
+	if raw, err := f.db.GetSetting(ctx, model.SettingDomainBudgets); err == nil && raw != "" {
+		if err := json.Unmarshal([]byte(raw), &stored); err != nil {
+			log.Printf("Ignoring invalid %s setting: %v", model.SettingDomainBudgets, err)
+		}
+	}
+	f.domainLimiter.setBudgets(stored)
+}
+
+// saveBudgets stores the domain budgets if they changed, so they outlive
+// a restart.
+func (f *Fetcher) saveBudgets(ctx context.Context) {
+	budgets, changed := f.domainLimiter.changedBudgets()
+	if !changed {
+		return
+	}
+	data, _ := json.Marshal(budgets)
+	if err := f.db.SetSetting(ctx, model.SettingDomainBudgets, string(data)); err != nil {
+		reqid.Logf(ctx, "Failed to save domain budgets: %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+package rss
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+
+	// xmlDeclEncoding matches the encoding in an XML declaration; group 1
+	// is the value.
+	xmlDeclEncoding = regexp.MustCompile(`^<\?xml[^>]*?\bencoding\s*=\s*["']([^"']*)["']`)
+	// charRef matches a numeric character reference; group 1 is the
+	// hexadecimal value, group 2 the decimal one.
+	charRef = regexp.MustCompile(`&#(?:[xX]([0-9a-fA-F]{1,8})|([0-9]{1,10}));`)
+)
+
+// normalizeDocument prepares a fetched feed document for the parser, which
+// only reads UTF-8 and the encodings its XML declaration names, and gives
+// up on the first character XML doesn't allow. It converts the document to
+// UTF-8, see toUTF8, trying the declared encoding and then the charset of
+// contentType, and drops anything before the first tag and the characters
+// and character references XML forbids. It also returns notes on what it
+// changed, for debugging; a clean UTF-8 document gets none.
+func normalizeDocument(doc []byte, contentType string) ([]byte, []string) {
+	var notes []string
+	var bomCharset string
+	switch {
+	case bytes.HasPrefix(doc, utf8BOM):
+		doc = doc[len(utf8BOM):]
+	case bytes.HasPrefix(doc, utf16LEBOM):
+		doc, bomCharset = doc[len(utf16LEBOM):], "utf-16le"
+	case bytes.HasPrefix(doc, utf16BEBOM):
+		doc, bomCharset = doc[len(utf16BEBOM):], "utf-16be"
+	}
+	if bomCharset != "" {
+		enc, _ := charset.Lookup(bomCharset)
+		decoded, err := enc.NewDecoder().Bytes(doc)
+		if err != nil {
+			return doc, nil
+		}
+		doc = decoded
+		notes = append(notes, "transcoded from "+bomCharset)
+	}
+
+	// JSON feeds are UTF-8 by definition.
+	trimmed := bytes.TrimLeft(doc, " \t\r\n")
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		return trimmed, notes
+	}
+	if i := bytes.IndexByte(doc, '<'); i > 0 {
+		if len(bytes.TrimSpace(doc[:i])) > 0 {
+			notes = append(notes, fmt.Sprintf("skipped %d bytes before the document", i))
+		}
+		doc = doc[i:]
+	}
+
+	declared := ""
+	if m := xmlDeclEncoding.FindSubmatchIndex(doc); m != nil {
+		declared = string(doc[m[2]:m[3]])
+	}
+	if bomCharset == "" && !utf8.Valid(doc) {
+		var note string
+		doc, note = toUTF8(doc, declared, mediaCharset(contentType))
+		notes = append(notes, note)
+	}
+	if m := xmlDeclEncoding.FindSubmatchIndex(doc); m != nil && !isUTF8(string(doc[m[2]:m[3]])) {
+		// The document is UTF-8 now, whatever it declared.
+		doc = append(append(append([]byte{}, doc[:m[2]]...), "UTF-8"...), doc[m[3]:]...)
+	}
+
+	if n := countIllegal(doc); n > 0 {
+		doc = removeIllegal(doc)
+		notes = append(notes, fmt.Sprintf("removed %d characters not allowed in XML", n))
+	}
+	return doc, notes
+}
+
+// toUTF8 converts a document that is not valid UTF-8. A document that is
+// mostly UTF-8 gets its invalid bytes replaced; any other is transcoded
+// from the first of charsets that names a known encoding, or else from the
+// one guessCharset picks. It returns the document with a note on what was
+// done.
+func toUTF8(doc []byte, charsets ...string) ([]byte, string) {
+	if mostlyUTF8(doc) {
+		return bytes.ToValidUTF8(doc, []byte(string(utf8.RuneError))), "replaced invalid UTF-8 sequences"
+	}
+	for _, label := range charsets {
+		if label == "" || isUTF8(label) {
+			continue
+		}
+		enc, name := charset.Lookup(label)
+		if enc == nil {
+			continue
+		}
+		if decoded, err := enc.NewDecoder().Bytes(doc); err == nil {
+			return decoded, "transcoded from " + name
+		}
+	}
+	guess := guessCharset(doc)
+	enc, _ := charset.Lookup(guess)
+	decoded, _ := enc.NewDecoder().Bytes(doc)
+	return decoded, "transcoded from " + guess + ", guessed as no usable charset was declared"
+}
+
+// guessCharset picks the encoding of an 8-bit document that doesn't declare
+// one: windows-1251 if most of its non-ASCII bytes come in runs, as the
+// letters of Cyrillic words do, else windows-1252, where the accented
+// letters of Western European text mostly stand alone. ISO-8859-1 text
+// reads the same as windows-1252.
+func guessCharset(doc []byte) string {
+	high, runs := 0, 0
+	for i, b := range doc {
+		if b < 0x80 {
+			continue
+		}
+		high++
+		if i > 0 && doc[i-1] >= 0x80 || i+1 < len(doc) && doc[i+1] >= 0x80 {
+			runs++
+		}
+	}
+	if runs*2 > high {
+		return "windows-1251"
+	}
+	return "windows-1252"
+}
+
+// mediaCharset returns the charset parameter of a Content-Type header.
+func mediaCharset(contentType string) string {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return params["charset"]
+}
+
+// isUTF8 reports whether a charset label names UTF-8 or its ASCII subset.
+func isUTF8(label string) bool {
+	switch strings.ToLower(strings.TrimSpace(label)) {
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		return true
+	}
+	return false
+}
+
+// mostlyUTF8 reports whether doc has more valid multi-byte UTF-8 sequences
+// than invalid bytes, as a UTF-8 document with a few stray bytes does.
+func mostlyUTF8(doc []byte) bool {
+	valid, invalid := 0, 0
+	for len(doc) > 0 {
+		r, size := utf8.DecodeRune(doc)
+		switch {
+		case r == utf8.RuneError && size == 1:
+			invalid++
+		case size > 1:
+			valid++
+		}
+		doc = doc[size:]
+	}
+	return valid > invalid
+}
+
+// legalXMLRune reports whether XML 1.0 allows r in a document.
+func legalXMLRune(r rune) bool {
+	return r == '\t' || r == '\n' || r == '\r' ||
+		r >= 0x20 && r <= 0xD7FF || r >= 0xE000 && r <= 0xFFFD || r >= 0x10000 && r <= 0x10FFFF
+}
+
+// countIllegal returns the number of characters and character references
+// in a UTF-8 document that XML doesn't allow.
+func countIllegal(doc []byte) int {
+	n := 0
+	for _, r := range string(doc) {
+		if !legalXMLRune(r) {
+			n++
+		}
+	}
+	for _, m := range charRef.FindAllSubmatch(doc, -1) {
+		if !legalCharRef(m) {
+			n++
+		}
+	}
+	return n
+}
+
+// removeIllegal drops what countIllegal counts.
+func removeIllegal(doc []byte) []byte {
+	doc = bytes.Map(func(r rune) rune {
+		if !legalXMLRune(r) {
+			return -1
+		}
+		return r
+	}, doc)
+	return charRef.ReplaceAllFunc(doc, func(ref []byte) []byte {
+		if legalCharRef(charRef.FindSubmatch(ref)) {
+			return ref
+		}
+		return nil
+	})
+}
+
+// legalCharRef reports whether a charRef match refers to a character XML
+// allows.
+func legalCharRef(m [][]byte) bool {
+	var r uint64
+	var err error
+	if len(m[1]) > 0 {
+		r, err = strconv.ParseUint(string(m[1]), 16, 32)
+	} else {
+		r, err = strconv.ParseUint(string(m[2]), 10, 32)
+	}
+	return err == nil && r <= utf8.MaxRune && legalXMLRune(rune(r))
+}
@@ -0,0 +1,99 @@
+package rss
+
+import (
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/mmcdole/gofeed/atom"
+	ext "github.com/mmcdole/gofeed/extensions"
+	gofeedrss "github.com/mmcdole/gofeed/rss"
+)
+
+// Keys of gofeed.Item.Custom holding an entry's comment links, which the
+// default translators drop.
+const (
+	customComments     = "infovore:comments"
+	customCommentsFeed = "infovore:comments_feed"
+)
+
+// rssTranslator keeps the <comments> and wfw:commentRss links of RSS items.
+type rssTranslator struct {
+	gofeed.DefaultRSSTranslator
+}
+
+func (t *rssTranslator) Translate(feed interface{}) (*gofeed.Feed, error) {
+	result, err := t.DefaultRSSTranslator.Translate(feed)
+	if err != nil {
+		return nil, err
+	}
+	src := feed.(*gofeedrss.Feed)
+	for i, item := range result.Items {
+		if i < len(src.Items) {
+			setComments(item, src.Items[i].Comments, commentRSS(src.Items[i].Extensions))
+		}
+	}
+	return result, nil
+}
+
+// atomTranslator keeps the replies links (RFC 4685) and wfw:commentRss of
+// Atom entries.
+type atomTranslator struct {
+	gofeed.DefaultAtomTranslator
+}
+
+func (t *atomTranslator) Translate(feed interface{}) (*gofeed.Feed, error) {
+	result, err := t.DefaultAtomTranslator.Translate(feed)
+	if err != nil {
+		return nil, err
+	}
+	src := feed.(*atom.Feed)
+	for i, item := range result.Items {
+		if i >= len(src.Entries) {
+			break
+		}
+		entry := src.Entries[i]
+		var page, commentsFeed string
+		for _, l := range entry.Links {
+			if l.Rel != "replies" || l.Href == "" {
+				continue
+			}
+			if strings.Contains(l.Type, "html") {
+				page = l.Href
+			} else if commentsFeed == "" {
+				commentsFeed = l.Href
+			}
+		}
+		if commentsFeed == "" {
+			commentsFeed = commentRSS(entry.Extensions)
+		}
+		setComments(item, page, commentsFeed)
+	}
+	return result, nil
+}
+
+// commentRSS returns the wfw:commentRss link among an entry's extensions.
+func commentRSS(exts ext.Extensions) string {
+	for _, e := range exts["wfw"]["commentRss"] {
+		if v := strings.TrimSpace(e.Value); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// setComments records an entry's comment page and comments feed.
+func setComments(item *gofeed.Item, page, commentsFeed string) {
+	page, commentsFeed = strings.TrimSpace(page), strings.TrimSpace(commentsFeed)
+	if page == "" && commentsFeed == "" {
+		return
+	}
+	if item.Custom == nil {
+		item.Custom = make(map[string]string)
+	}
+	if page != "" {
+		item.Custom[customComments] = page
+	}
+	if commentsFeed != "" {
+		item.Custom[customCommentsFeed] = commentsFeed
+	}
+}
@@ -0,0 +1,214 @@
+package rss
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+	"github.com/mmcdole/gofeed"
+)
+
+// Bounds on a debug fetch report.
+const (
+	debugMaxRedirects = 10
+	debugPreviewBytes = 1024
+	debugMaxItems     = 20
+)
+
+// FetchDebug reports a single fetch of a feed in detail, for finding out why
+// it fails. See DebugFetch.
+type FetchDebug struct {
+	URL         string      `json:"url"`
+	Strategy    string      `json:"strategy"`
+	RequestURL  string      `json:"request_url"` // differs from URL for the fetch service
+	Redirects   []string    `json:"redirects"`   // URLs redirected to, in order
+	Status      int         `json:"status,omitempty"`
+	Headers     http.Header `json:"headers,omitempty"`
+	DurationMs  int64       `json:"duration_ms"`
+	Size        int         `json:"size"`
+	SniffedType string      `json:"sniffed_type,omitempty"` // from the first bytes, see http.DetectContentType
+	FeedFormat  string      `json:"feed_format,omitempty"`  // "rss", "atom", "json" or "unknown"
+	Preview     string      `json:"preview,omitempty"`      // start of the body
+	Error       string      `json:"error,omitempty"`        // the request or parse failure, as the feed would record it
+	ErrorClass  string      `json:"error_class,omitempty"`  // one of the model.FetchError* constants
+	// Repairs are the changes made to the document before parsing, such
+	// as transcoding it to UTF-8; see normalizeDocument.
+	Repairs []string `json:"repairs,omitempty"`
+	// XMLError locates the first syntax error of an XML document that
+	// failed to parse, which the parser's own message often doesn't.
+	XMLError string          `json:"xml_error,omitempty"`
+	Feed     *FetchDebugFeed `json:"feed,omitempty"`
+}
+
+// FetchDebugFeed is what the parser made of a fetched feed.
+type FetchDebugFeed struct {
+	Title       string           `json:"title"`
+	Type        string           `json:"type"`
+	Version     string           `json:"version"`
+	Link        string           `json:"link,omitempty"`
+	ItemCount   int              `json:"item_count"`
+	Items       []FetchDebugItem `json:"items"`                   // the first debugMaxItems
+	NextFetchAt *time.Time       `json:"next_fetch_at,omitempty"` // when the feed asks to be polled again
+}
+
+// FetchDebugItem is a parsed feed entry.
+type FetchDebugItem struct {
+	Title     string     `json:"title"`
+	GUID      string     `json:"guid"`
+	Link      string     `json:"link"`
+	Published *time.Time `json:"published,omitempty"`
+}
+
+// DebugFetch fetches and parses a feed the way FetchFeed does, honouring the
+// feed's fetch strategy and the domain rate limit, and reports each step.
+// Nothing is stored: neither items, nor the fetch log, nor the feed's error.
+// The error is only for a feed that cannot be fetched at all; failures of
+// the fetch itself are in the report.
+func (f *Fetcher) DebugFetch(ctx context.Context, feed model.Feed) (*FetchDebug, error) {
+	if feed.IsVirtual() {
+		return nil, fmt.Errorf("virtual feeds are not fetched")
+	}
+	strategy := feed.FetchStrategy
+	if strategy == "" {
+		strategy = model.FetchDirect
+	}
+	report := &FetchDebug{URL: feed.URL, Strategy: strategy, Redirects: []string{}}
+	reqURL, client, err := f.strategyRequest(feed.URL, feed.FetchStrategy)
+	if err != nil {
+		return nil, err
+	}
+	report.RequestURL = reqURL
+
+	// Follow redirects on a copy of the client, noting each hop.
+	traced := *client
+	traced.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= debugMaxRedirects {
+			return fmt.Errorf("stopped after %d redirects", debugMaxRedirects)
+		}
+		report.Redirects = append(report.Redirects, req.URL.String())
+		return nil
+	}
+
+	domain := extractDomain(reqURL)
+	release, err := f.domainLimiter.acquire(ctx, domain)
+	if err != nil {
+		return nil, fmt.Errorf("rate limit cancelled for %s: %w", feed.URL, err)
+	}
+	defer release()
+
+	start := time.Now()
+	body, err := f.debugRequest(ctx, &traced, domain, reqURL, report)
+	report.DurationMs = time.Since(start).Milliseconds()
+	parsing := err == nil
+	if parsing {
+		var parsed *gofeed.Feed
+		normalized, repairs := normalizeDocument(body, report.Headers.Get("Content-Type"))
+		report.Repairs = repairs
+		if parsed, err = f.parse(ctx, body, report.Headers); err == nil {
+			report.Feed = debugFeed(parsed, body, report.Headers)
+		} else if report.FeedFormat != "json" {
+			report.XMLError = xmlSyntaxError(normalized)
+		}
+	}
+	if err != nil {
+		fe := classifyError(fmt.Errorf("parse feed %s: %w", feed.URL, err), parsing)
+		report.Error, report.ErrorClass = fe.Message, fe.Class
+	}
+	return report, nil
+}
+
+// debugRequest requests a feed for DebugFetch, filling in the response
+// fields of report, and returns the body of a 2xx response.
+func (f *Fetcher) debugRequest(ctx context.Context, client *http.Client, domain, reqURL string, report *FetchDebug) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	reqid.Set(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	f.domainLimiter.observe(domain, resp.StatusCode)
+	report.Status = resp.StatusCode
+	report.Headers = resp.Header
+
+	// Read error bodies too, they often say why the request was refused.
+	body, readErr := readBody(resp)
+	report.Size = len(body)
+	if len(body) > 0 {
+		report.SniffedType = http.DetectContentType(body)
+		report.FeedFormat = feedFormat(body)
+		preview := body[:min(len(body), debugPreviewBytes)]
+		report.Preview = strings.ToValidUTF8(string(preview), string(utf8.RuneError))
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &httpError{url: report.URL, statusCode: resp.StatusCode}
+	}
+	if readErr != nil {
+		return nil, fmt.Errorf("fetch %s: %w", report.URL, readErr)
+	}
+	return body, nil
+}
+
+// debugFeed summarizes a parsed feed for a debug report.
+func debugFeed(parsed *gofeed.Feed, body []byte, header http.Header) *FetchDebugFeed {
+	d := &FetchDebugFeed{Title: parsed.Title, Type: parsed.FeedType, Version: parsed.FeedVersion,
+		Link: parsed.Link, ItemCount: len(parsed.Items), Items: []FetchDebugItem{}}
+	for _, item := range parsed.Items[:min(len(parsed.Items), debugMaxItems)] {
+		d.Items = append(d.Items, FetchDebugItem{Title: item.Title, GUID: item.GUID, Link: item.Link,
+			Published: item.PublishedParsed})
+	}
+	if next := nextFetch(time.Now(), parsed.FeedType, body, header); !next.IsZero() {
+		d.NextFetchAt = &next
+	}
+	return d
+}
+
+// feedFormat names the feed format gofeed detects in a document.
+func feedFormat(body []byte) string {
+	switch gofeed.DetectFeedType(bytes.NewReader(body)) {
+	case gofeed.FeedTypeRSS:
+		return "rss"
+	case gofeed.FeedTypeAtom:
+		return "atom"
+	case gofeed.FeedTypeJSON:
+		return "json"
+	default:
+		return "unknown"
+	}
+}
+
+// xmlSyntaxError describes the first syntax error of an XML document, or
+// returns "" if a strict reading finds none.
+func xmlSyntaxError(doc []byte) string {
+	dec := xml.NewDecoder(bytes.NewReader(doc))
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		// Only the structure matters here; read any charset as bytes.
+		return input, nil
+	}
+	for {
+		_, err := dec.Token()
+		if err == io.EOF {
+			return ""
+		}
+		var se *xml.SyntaxError
+		if errors.As(err, &se) {
+			return fmt.Sprintf("line %d: %s", se.Line, se.Msg)
+		}
+		if err != nil {
+			return err.Error()
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package rss
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+	"golang.org/x/net/html"
+)
+
+// feedTypes are the <link rel="alternate"> media types treated as feeds.
+var feedTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+	"application/json":      true,
+	"text/xml":              true,
+	"application/xml":       true,
+}
+
+// Discovered is a feed found by Discover.
+type Discovered struct {
+	URL   string // the feed's own URL
+	Title string
+}
+
+// Discover validates that pageURL is a feed, or finds the feed an HTML page
+// advertises with <link rel="alternate">. Alternates are tried in document
+// order until one parses.
+func (f *Fetcher) Discover(ctx context.Context, pageURL string) (*Discovered, error) {
+	body, header, err := f.fetchResponse(ctx, pageURL, model.FetchDirect)
+	if err != nil {
+		return nil, err
+	}
+	if parsed, err := f.parse(ctx, body, header); err == nil {
+		return &Discovered{URL: pageURL, Title: strings.TrimSpace(parsed.Title)}, nil
+	}
+
+	for _, alt := range alternateLinks(body, pageURL) {
+		body, header, err := f.fetchResponse(ctx, alt, model.FetchDirect)
+		if err != nil {
+			continue
+		}
+		if parsed, err := f.parse(ctx, body, header); err == nil {
+			return &Discovered{URL: alt, Title: strings.TrimSpace(parsed.Title)}, nil
+		}
+	}
+	return nil, fmt.Errorf("no feed found at %s", pageURL)
+}
+
+// Resolve returns the URL feedURL ends up at after redirects, without
+// reading the document.
+func (f *Fetcher) Resolve(ctx context.Context, feedURL string) (string, error) {
+	domain := extractDomain(feedURL)
+	release, err := f.domainLimiter.acquire(ctx, domain)
+	if err != nil {
+		return "", fmt.Errorf("rate limit cancelled for %s: %w", feedURL, err)
+	}
+	defer release()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	reqid.Set(req)
+	resp, err := f.httpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	f.domainLimiter.observe(domain, resp.StatusCode)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", &httpError{url: feedURL, statusCode: resp.StatusCode}
+	}
+	return resp.Request.URL.String(), nil
+}
+
+// alternateLinks returns the absolute URLs of feeds advertised in an HTML
+// page's <link rel="alternate"> elements.
+func alternateLinks(doc []byte, base string) []string {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return nil
+	}
+	z := html.NewTokenizer(bytes.NewReader(doc))
+	var links []string
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return links
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			if string(name) == "body" {
+				return links
+			}
+			if string(name) != "link" {
+				continue
+			}
+			var rel, typ, href string
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				switch string(key) {
+				case "rel":
+					rel = strings.ToLower(string(val))
+				case "type":
+					typ = strings.ToLower(strings.TrimSpace(string(val)))
+				case "href":
+					href = strings.TrimSpace(string(val))
+				}
+			}
+			if href == "" || !feedTypes[typ] || !hasRel(rel, "alternate") {
+				continue
+			}
+			if ref, err := url.Parse(href); err == nil {
+				links = append(links, baseURL.ResolveReference(ref).String())
+			}
+		}
+	}
+}
+
+// hasRel reports whether a space-separated rel attribute contains want.
+func hasRel(rel, want string) bool {
+	for _, r := range strings.Fields(rel) {
+		if r == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package rss
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+)
+
+// itemEnclosures collects every media file of an entry: RSS enclosures and
+// Atom enclosure links, then Media RSS media:content elements, alone or in
+// a media:group. Files listed twice are kept once, merging what each
+// listing tells about them.
+func itemEnclosures(item *gofeed.Item) []model.Enclosure {
+	var encs []model.Enclosure
+	index := make(map[string]int)
+	add := func(e model.Enclosure) {
+		e.URL = strings.TrimSpace(e.URL)
+		if e.URL == "" {
+			return
+		}
+		n, ok := index[e.URL]
+		if !ok {
+			index[e.URL] = len(encs)
+			encs = append(encs, e)
+			return
+		}
+		old := &encs[n]
+		if old.Type == "" {
+			old.Type = e.Type
+		}
+		if old.Medium == "" {
+			old.Medium = e.Medium
+		}
+		if old.Size == 0 {
+			old.Size = e.Size
+		}
+		if old.Duration == 0 {
+			old.Duration = e.Duration
+		}
+		if old.Thumbnail == "" {
+			old.Thumbnail = e.Thumbnail
+		}
+	}
+
+	for _, enc := range item.Enclosures {
+		if enc == nil {
+			continue
+		}
+		size, _ := strconv.ParseInt(strings.TrimSpace(enc.Length), 10, 64)
+		add(model.Enclosure{URL: enc.URL, Type: enc.Type, Size: max(size, 0)})
+	}
+	media := item.Extensions["media"]
+	thumbnail := mediaThumbnail(media)
+	for _, c := range media["content"] {
+		add(mediaContent(c, thumbnail))
+	}
+	for _, g := range media["group"] {
+		groupThumb := mediaThumbnail(g.Children)
+		if groupThumb == "" {
+			groupThumb = thumbnail
+		}
+		for _, c := range g.Children["content"] {
+			add(mediaContent(c, groupThumb))
+		}
+	}
+
+	// An iTunes duration describes the episode, i.e. the first audio or
+	// video file.
+	if item.ITunesExt != nil {
+		if secs := parseDuration(item.ITunesExt.Duration); secs > 0 {
+			for n := range encs {
+				if strings.HasPrefix(encs[n].Type, "audio/") || strings.HasPrefix(encs[n].Type, "video/") {
+					if encs[n].Duration == 0 {
+						encs[n].Duration = secs
+					}
+					break
+				}
+			}
+		}
+	}
+	return encs
+}
+
+// mediaContent converts a media:content element. thumbnail is used if the
+// element has no media:thumbnail of its own.
+func mediaContent(c ext.Extension, thumbnail string) model.Enclosure {
+	e := model.Enclosure{
+		URL:       c.Attrs["url"],
+		Type:      c.Attrs["type"],
+		Medium:    c.Attrs["medium"],
+		Thumbnail: mediaThumbnail(c.Children),
+	}
+	if e.Thumbnail == "" {
+		e.Thumbnail = thumbnail
+	}
+	if size, err := strconv.ParseInt(c.Attrs["fileSize"], 10, 64); err == nil && size > 0 {
+		e.Size = size
+	}
+	if secs, err := strconv.ParseFloat(c.Attrs["duration"], 64); err == nil && secs > 0 {
+		e.Duration = int(secs)
+	}
+	return e
+}
+
+// mediaThumbnail returns the URL of the first media:thumbnail among exts.
+func mediaThumbnail(exts map[string][]ext.Extension) string {
+	for _, t := range exts["thumbnail"] {
+		if u := strings.TrimSpace(t.Attrs["url"]); u != "" {
+			return u
+		}
+	}
+	return ""
+}
+
+// parseDuration parses an iTunes duration: seconds, MM:SS or HH:MM:SS.
+// It returns 0 if s is not a duration.
+func parseDuration(s string) int {
+	secs := 0
+	for _, part := range strings.Split(strings.TrimSpace(s), ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0
+		}
+		secs = secs*60 + n
+	}
+	return secs
+}
@@ -3,14 +3,24 @@ package rss
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/dedupe"
+	"github.com/bryan-buckman/infovore/internal/llm"
 	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/pipeline"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+	"github.com/bryan-buckman/infovore/internal/textutil"
+	"github.com/bryan-buckman/infovore/internal/transform"
 	"github.com/mmcdole/gofeed"
 )
 
@@ -23,17 +33,61 @@ const (
 	MaxConcurrencyPostgres = 10
 	// MaxConcurrencySQLite is the number of parallel fetches for SQLite (limited due to locking)
 	MaxConcurrencySQLite = 1
-	// MaxConcurrencyPerDomain limits parallel requests to any single domain
+	// MaxConcurrencyPerDomain is the default limit of parallel requests to any single domain
 	MaxConcurrencyPerDomain = 2
-	// DelayBetweenDomainRequests is the minimum delay between requests to the same domain
+	// DelayBetweenDomainRequests is the default minimum delay between requests to the same domain
 	DelayBetweenDomainRequests = 500 * time.Millisecond
+	// MaxFetchWorkers is the highest configurable number of parallel fetches
+	MaxFetchWorkers = 50
+	// DefaultFetchTimeout bounds a single feed or page request
+	DefaultFetchTimeout = 30 * time.Second
+	// MaxFetchTimeoutSeconds is the highest configurable request timeout
+	MaxFetchTimeoutSeconds = 300
 )
 
+// Worker count and request timeout given by SetDefaults, 0 if not given.
+var (
+	startupWorkers int
+	startupTimeout time.Duration
+)
+
+// SetDefaults sets the worker count and request timeout of fetchers created
+// from then on when the fetch_workers and fetch_timeout_seconds settings are
+// unset, replacing the defaults for the database and DefaultFetchTimeout.
+// Zero keeps the built-in default; other values are clamped to the ranges
+// the settings allow.
+func SetDefaults(workers int, timeout time.Duration) {
+	startupWorkers = min(max(workers, 0), MaxFetchWorkers)
+	startupTimeout = min(max(timeout, 0), MaxFetchTimeoutSeconds*time.Second)
+}
+
+// userAgent is sent with every request. It is gofeed's default, so feed and
+// page requests identify the same way.
+const userAgent = "Gofeed/1.0"
+
+// Bounds for configured domain limits.
+const (
+	maxDomainConcurrency = 20
+	maxDomainDelayMs     = 60000
+)
+
+// domainLimit is a resolved per-domain rate limit.
+type domainLimit struct {
+	concurrency int
+	delay       time.Duration
+}
+
 // domainLimiter controls rate limiting per domain to avoid overwhelming hosts.
 type domainLimiter struct {
 	mu          sync.Mutex
 	semaphores  map[string]chan struct{}
 	lastRequest map[string]time.Time
+	defaults    domainLimit
+	overrides   map[string]domainLimit
+
+	// budgets are learned from responses, see observe.
+	budgets        map[string]domainBudget
+	budgetsChanged bool // since last stored
 }
 
 // newDomainLimiter creates a new per-domain rate limiter.
@@ -41,16 +95,53 @@ func newDomainLimiter() *domainLimiter {
 	return &domainLimiter{
 		semaphores:  make(map[string]chan struct{}),
 		lastRequest: make(map[string]time.Time),
+		defaults:    domainLimit{concurrency: MaxConcurrencyPerDomain, delay: DelayBetweenDomainRequests},
+		budgets:     make(map[string]domainBudget),
 	}
 }
 
-// acquire gets a slot for the domain, blocking if necessary.
-// It also enforces the minimum delay between requests to the same domain.
-func (dl *domainLimiter) acquire(ctx context.Context, domain string) error {
+// configure replaces the limits. Requests already holding a slot keep it.
+func (dl *domainLimiter) configure(defaults domainLimit, overrides map[string]domainLimit) {
 	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	dl.defaults = defaults
+	dl.overrides = overrides
+}
+
+// limitFor returns the limit for a domain: the override for the host or
+// its closest configured parent domain, else the defaults. dl.mu must be held.
+func (dl *domainLimiter) limitFor(domain string) domainLimit {
+	host := strings.ToLower(domain)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for name := host; name != ""; {
+		if l, ok := dl.overrides[name]; ok {
+			return l
+		}
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[i+1:]
+	}
+	return dl.defaults
+}
+
+// acquire gets a slot for the domain, blocking if necessary, and returns the
+// function that releases it. It also enforces the minimum delay between
+// requests to the same domain. The domain's budget, if any, narrows its limit.
+func (dl *domainLimiter) acquire(ctx context.Context, domain string) (func(), error) {
+	dl.mu.Lock()
+	limit := dl.limitFor(domain)
+	if b, ok := dl.budgets[domain]; ok {
+		limit = b.apply(limit)
+	}
 	sem, ok := dl.semaphores[domain]
-	if !ok {
-		sem = make(chan struct{}, MaxConcurrencyPerDomain)
+	if !ok || cap(sem) != limit.concurrency {
+		// Slots held on a replaced semaphore are released to it, so a
+		// changed limit takes effect for new requests right away.
+		sem = make(chan struct{}, limit.concurrency)
 		dl.semaphores[domain] = sem
 	}
 	dl.mu.Unlock()
@@ -59,7 +150,7 @@ func (dl *domainLimiter) acquire(ctx context.Context, domain string) error {
 	select {
 	case sem <- struct{}{}:
 	case <-ctx.Done():
-		return ctx.Err()
+		return nil, ctx.Err()
 	}
 
 	// Enforce delay between requests to same domain
@@ -69,30 +160,106 @@ func (dl *domainLimiter) acquire(ctx context.Context, domain string) error {
 
 	if !lastReq.IsZero() {
 		elapsed := time.Since(lastReq)
-		if elapsed < DelayBetweenDomainRequests {
-			delay := DelayBetweenDomainRequests - elapsed
+		if elapsed < limit.delay {
+			delay := limit.delay - elapsed
 			select {
 			case <-time.After(delay):
 			case <-ctx.Done():
 				// Release the semaphore on cancel
 				<-sem
-				return ctx.Err()
+				return nil, ctx.Err()
 			}
 		}
 	}
 
-	return nil
+	return func() { dl.release(domain, sem) }, nil
 }
 
-// release returns a slot for the domain and records the request time.
-func (dl *domainLimiter) release(domain string) {
+// release returns a slot to the domain's semaphore and records the request time.
+func (dl *domainLimiter) release(domain string, sem chan struct{}) {
 	dl.mu.Lock()
 	defer dl.mu.Unlock()
 
 	dl.lastRequest[domain] = time.Now()
-	if sem, ok := dl.semaphores[domain]; ok {
-		<-sem
+	<-sem
+}
+
+// DomainLimits returns the configured global domain rate limit and the
+// per-domain overrides, keyed by lower-cased domain.
+func DomainLimits(ctx context.Context, db database.Store) (model.DomainLimit, map[string]model.DomainLimit) {
+	concurrency := database.GetIntSetting(ctx, db, model.SettingDomainMaxConcurrency, MaxConcurrencyPerDomain)
+	delayMs := database.GetIntSetting(ctx, db, model.SettingDomainDelayMs, int(DelayBetweenDomainRequests/time.Millisecond))
+	global := model.DomainLimit{MaxConcurrency: &concurrency, DelayMs: &delayMs}
+
+	overrides := make(map[string]model.DomainLimit)
+	if raw, err := db.GetSetting(ctx, model.SettingDomainLimits); err == nil && raw != "" {
+		var stored map[string]model.DomainLimit
+		if err := json.Unmarshal([]byte(raw), &stored); err != nil {
+			log.Printf("Ignoring invalid %s setting: %v", model.SettingDomainLimits, err)
+		}
+		for domain, l := range stored {
+			overrides[strings.ToLower(domain)] = l
+		}
 	}
+	return global, overrides
+}
+
+// ValidateDomainLimit checks that the set fields of a limit are in range.
+func ValidateDomainLimit(l model.DomainLimit) error {
+	if l.MaxConcurrency != nil && (*l.MaxConcurrency < 1 || *l.MaxConcurrency > maxDomainConcurrency) {
+		return fmt.Errorf("max_concurrency must be between 1 and %d", maxDomainConcurrency)
+	}
+	if l.DelayMs != nil && (*l.DelayMs < 0 || *l.DelayMs > maxDomainDelayMs) {
+		return fmt.Errorf("delay_ms must be between 0 and %d", maxDomainDelayMs)
+	}
+	return nil
+}
+
+// resolveDomainLimit fills the unset fields of l from base, clamping out-of-range values.
+func resolveDomainLimit(l model.DomainLimit, base domainLimit) domainLimit {
+	if l.MaxConcurrency != nil {
+		base.concurrency = min(max(*l.MaxConcurrency, 1), maxDomainConcurrency)
+	}
+	if l.DelayMs != nil {
+		base.delay = time.Duration(min(max(*l.DelayMs, 0), maxDomainDelayMs)) * time.Millisecond
+	}
+	return base
+}
+
+// LoadSettings applies the fetch concurrency, timeout, snippet length and
+// domain rate limits stored in settings.
+func (f *Fetcher) LoadSettings(ctx context.Context) {
+	concurrency := f.defaultConcurrency
+	if n := database.GetIntSetting(ctx, f.db, model.SettingFetchWorkers, 0); n > 0 {
+		concurrency = min(n, MaxFetchWorkers)
+	}
+	timeout := f.defaultTimeout
+	if n := database.GetIntSetting(ctx, f.db, model.SettingFetchTimeoutSeconds, 0); n > 0 {
+		timeout = time.Duration(min(n, MaxFetchTimeoutSeconds)) * time.Second
+	}
+	snippetLength := max(database.GetIntSetting(ctx, f.db, model.SettingSnippetLength, textutil.DefaultSnippetLength), 0)
+	f.mu.Lock()
+	f.concurrency = concurrency
+	f.snippetLength = snippetLength
+	if f.client == nil || f.client.Timeout != timeout {
+		// Replace rather than modify the clients; requests in flight keep
+		// using the one they started with.
+		f.client = &http.Client{Timeout: timeout}
+		if f.strategies.proxyURL != nil {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.Proxy = http.ProxyURL(f.strategies.proxyURL)
+			f.proxyClient = &http.Client{Timeout: timeout, Transport: transport}
+		}
+	}
+	f.mu.Unlock()
+
+	global, stored := DomainLimits(ctx, f.db)
+	defaults := resolveDomainLimit(global, domainLimit{concurrency: MaxConcurrencyPerDomain, delay: DelayBetweenDomainRequests})
+	overrides := make(map[string]domainLimit, len(stored))
+	for domain, l := range stored {
+		overrides[domain] = resolveDomainLimit(l, defaults)
+	}
+	f.domainLimiter.configure(defaults, overrides)
 }
 
 // extractDomain gets the host from a URL.
@@ -106,170 +273,568 @@ func extractDomain(feedURL string) string {
 
 // Fetcher handles RSS feed fetching.
 type Fetcher struct {
-	db            database.Store
-	parser        *gofeed.Parser
+	db                 database.Store
+	defaultConcurrency int           // worker count when fetch_workers is unset
+	defaultTimeout     time.Duration // request timeout when fetch_timeout_seconds is unset
+	domainLimiter      *domainLimiter
+	llmClient          *llm.Client // nil when no LLM endpoint is configured
+	strategies         fetchStrategies
+
+	mu            sync.Mutex // guards concurrency, snippetLength and the clients
 	concurrency   int
-	domainLimiter *domainLimiter
+	snippetLength int // 0 if items get no snippets
+	client        *http.Client
+	proxyClient   *http.Client // nil unless FETCH_PROXY_URL is set
 }
 
-// NewFetcher creates a new fetcher with concurrency based on database type.
+// NewFetcher creates a new fetcher with concurrency based on database type,
+// unless overridden in settings.
 func NewFetcher(db database.Store) *Fetcher {
 	concurrency := MaxConcurrencySQLite
 	if db.SupportsHighConcurrency() {
 		concurrency = MaxConcurrencyPostgres
 	}
-	return &Fetcher{
-		db:            db,
-		parser:        gofeed.NewParser(),
-		concurrency:   concurrency,
-		domainLimiter: newDomainLimiter(),
+	if startupWorkers > 0 {
+		concurrency = startupWorkers
 	}
+	timeout := DefaultFetchTimeout
+	if startupTimeout > 0 {
+		timeout = startupTimeout
+	}
+	f := &Fetcher{
+		db:                 db,
+		defaultConcurrency: concurrency,
+		defaultTimeout:     timeout,
+		domainLimiter:      newDomainLimiter(),
+		llmClient:          llm.NewFromEnv(),
+		strategies:         strategiesFromEnv(),
+	}
+	f.LoadSettings(context.Background())
+	f.loadBudgets(context.Background())
+	return f
+}
+
+// httpClient returns the client for feed and page requests.
+func (f *Fetcher) httpClient() *http.Client {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.client
+}
+
+// parser returns a feed parser using the fetcher's HTTP client. Parsers keep
+// state while parsing, so each fetch gets its own.
+func (f *Fetcher) parser() *gofeed.Parser {
+	p := gofeed.NewParser()
+	p.Client = f.httpClient()
+	p.UserAgent = userAgent
+	p.RSSTranslator = &rssTranslator{}
+	p.AtomTranslator = &atomTranslator{}
+	return p
 }
 
 // FetchFeed fetches and parses a single feed, storing new items.
 // Returns the number of new items added.
 func (f *Fetcher) FetchFeed(ctx context.Context, feed model.Feed) (int, error) {
-	// Apply per-domain rate limiting
-	domain := extractDomain(feed.URL)
-	if err := f.domainLimiter.acquire(ctx, domain); err != nil {
-		return 0, fmt.Errorf("rate limit cancelled for %s: %w", feed.URL, err)
+	// Virtual feeds have nothing to poll; their items are pushed in.
+	if feed.IsVirtual() {
+		return 0, nil
 	}
-	defer f.domainLimiter.release(domain)
 
-	parsed, err := f.parser.ParseURLWithContext(feed.URL, ctx)
+	start := time.Now()
+	body, header, elapsed, err := f.fetchTimed(ctx, feed.URL, feed.FetchStrategy)
+	var parsed *gofeed.Feed
+	parsing := err == nil
+	if parsing {
+		parsed, err = f.parse(ctx, body, header)
+	}
+	// Log the fetch for the feed's health grade, unless the whole run was
+	// cancelled or timed out, which is no fault of the feed.
+	if ctx.Err() == nil {
+		entry := model.FetchLogEntry{FeedID: feed.ID, FetchedAt: start, OK: err == nil, Duration: elapsed}
+		if err := f.db.AddFetchLog(ctx, entry); err != nil {
+			reqid.Logf(ctx, "Error logging fetch of feed %d: %v", feed.ID, err)
+		}
+	}
 	if err != nil {
-		// Record the error for UI display.
-		errMsg := err.Error()
-		if len(errMsg) > 200 {
-			errMsg = errMsg[:200]
+		// Record the error for UI display, unless the run was stopped.
+		if ctx.Err() == nil {
+			fe := classifyError(err, parsing)
+			_ = f.db.UpdateFeedError(ctx, feed.ID, fe, time.Now())
+			if streak := feed.ErrorStreak + 1; gone(fe) && streak%RediscoverAfter == 0 {
+				f.rediscover(ctx, feed)
+			}
 		}
-		_ = f.db.UpdateFeedError(feed.ID, errMsg)
 		return 0, fmt.Errorf("parse feed %s: %w", feed.URL, err)
 	}
 
 	// Update feed title from RSS if it differs and isn't just the URL.
 	if parsed.Title != "" && parsed.Title != feed.Title && feed.Title == feed.URL {
-		if err := f.db.UpdateFeedTitle(feed.ID, parsed.Title); err != nil {
-			log.Printf("Error updating title for feed %d: %v", feed.ID, err)
+		if err := f.db.UpdateFeedTitle(ctx, feed.ID, parsed.Title); err != nil {
+			reqid.Logf(ctx, "Error updating title for feed %d: %v", feed.ID, err)
 		} else {
-			log.Printf("Updated feed title: %s -> %s", feed.URL, parsed.Title)
+			reqid.Logf(ctx, "Updated feed title: %s -> %s", feed.URL, parsed.Title)
+			feed.Title = parsed.Title
+		}
+	}
+
+	// Keep the homepage and description current, writing only on change.
+	if siteURL, description := siteInfo(feed, parsed); siteURL != feed.SiteURL || description != feed.Description {
+		if err := f.db.UpdateFeedMetadata(ctx, feed.ID, feed.Title, siteURL, description, feed.IconURL); err != nil {
+			reqid.Logf(ctx, "Error updating site info for feed %d: %v", feed.ID, err)
+		} else {
+			feed.SiteURL, feed.Description = siteURL, description
 		}
 	}
 
 	now := time.Now()
-	newCount := 0
-	for _, item := range parsed.Items {
-		guid := item.GUID
-		if guid == "" {
-			guid = item.Link
+	newCount := f.storeItems(ctx, feed, parsed.Items, now)
+
+	// Walk archive pages once, right after subscribing, if the feed opted in.
+	// The walk starts from the document just fetched rather than fetching it
+	// again.
+	if feed.BackfillArchives && feed.LastSuccess.IsZero() {
+		count, err := f.walkArchives(ctx, feed, archiveLink(body, feed.URL))
+		if err != nil {
+			reqid.Logf(ctx, "Archive backfill for %s stopped: %v", feed.URL, err)
 		}
-		if guid == "" {
+		newCount += count
+	}
+
+	// Update last fetched time (and clear any previous error).
+	if err := f.db.UpdateFeedLastFetched(ctx, feed.ID, now); err != nil {
+		reqid.Logf(ctx, "Error updating last_fetched for feed %d: %v", feed.ID, err)
+	}
+	if err := f.db.UpdateFeedNextFetch(ctx, feed.ID, nextFetch(now, parsed.FeedType, body, header)); err != nil {
+		reqid.Logf(ctx, "Error updating next_fetch_at for feed %d: %v", feed.ID, err)
+	}
+
+	return newCount, nil
+}
+
+// storeItems converts parsed entries to items and stores them.
+// Returns the number of items that were new.
+func (f *Fetcher) storeItems(ctx context.Context, feed model.Feed, items []*gofeed.Item, now time.Time) int {
+	p := pipeline.Build(ctx, pipeline.Deps{DB: f.db, LLM: f.llmClient})
+	idx := f.dedupeIndex(ctx, feed, items, now)
+	newCount := 0
+	for _, item := range items {
+		_, isNew, err := f.storeItem(ctx, p, idx, feed, item, now)
+		if err != nil {
+			reqid.Logf(ctx, "Error adding item %s: %v", item.GUID, err)
 			continue
 		}
-		pubDate := now
-		if item.PublishedParsed != nil {
-			pubDate = *item.PublishedParsed
+		if isNew {
+			newCount++
+		}
+	}
+	return newCount
+}
+
+// storeItemsBulk is storeItems for archive pages, which may hold many
+// historical items: it inserts the items kept in one AddItems call rather
+// than one at a time. Returns the number of new items.
+func (f *Fetcher) storeItemsBulk(ctx context.Context, feed model.Feed, items []*gofeed.Item, now time.Time) (int, error) {
+	p := pipeline.Build(ctx, pipeline.Deps{DB: f.db, LLM: f.llmClient})
+	idx := f.dedupeIndex(ctx, feed, items, now)
+	var kept []model.Item
+	for _, item := range items {
+		if dbItem := f.prepareItem(ctx, p, idx, feed, item, now); dbItem != nil {
+			// Index it now, so later items of the batch are checked against it.
+			idx.Add(*dbItem)
+			kept = append(kept, *dbItem)
 		}
-		dbItem := &model.Item{
-			FeedID:      feed.ID,
-			GUID:        guid,
-			Title:       item.Title,
-			Content:     item.Content,
-			Link:        item.Link,
-			PublishedAt: pubDate,
-			FetchedAt:   now,
+	}
+	ids, err := f.db.AddItems(ctx, kept)
+	if err != nil {
+		return 0, err
+	}
+	newCount := 0
+	for n, id := range ids {
+		if id != 0 {
+			f.addedItem(ctx, p, nil, feed, &kept[n], id)
+			newCount++
 		}
-		if dbItem.Content == "" {
-			dbItem.Content = item.Description
+	}
+	return newCount, nil
+}
+
+// dedupeIndex loads the items of feed that entries as old as the oldest of
+// items may duplicate. Returns nil, which checks nothing, on error.
+func (f *Fetcher) dedupeIndex(ctx context.Context, feed model.Feed, items []*gofeed.Item, now time.Time) *dedupe.Index {
+	oldest := now
+	for _, item := range items {
+		if item.PublishedParsed != nil && item.PublishedParsed.Before(oldest) {
+			oldest = *item.PublishedParsed
 		}
-		_, isNew, err := f.db.AddItem(dbItem)
-		if err != nil {
-			log.Printf("Error adding item %s: %v", guid, err)
+	}
+	idx, err := dedupe.LoadIndex(ctx, f.db, feed.ID, oldest)
+	if err != nil {
+		reqid.Logf(ctx, "Error loading items of feed %d to deduplicate: %v", feed.ID, err)
+	}
+	return idx
+}
+
+// storeItem converts a parsed entry to an item, runs it through the
+// pipeline and stores it. Returns a nil item if the entry has no identifier,
+// duplicates an item of idx under another GUID or was dropped by a filter;
+// the item's ID is only set if it was new.
+func (f *Fetcher) storeItem(ctx context.Context, p *pipeline.Pipeline, idx *dedupe.Index, feed model.Feed, item *gofeed.Item, now time.Time) (*model.Item, bool, error) {
+	dbItem := f.prepareItem(ctx, p, idx, feed, item, now)
+	if dbItem == nil {
+		return nil, false, nil
+	}
+	id, isNew, err := f.db.AddItem(ctx, dbItem)
+	if err != nil {
+		return nil, false, err
+	}
+	if isNew {
+		f.addedItem(ctx, p, idx, feed, dbItem, id)
+	}
+	return dbItem, isNew, nil
+}
+
+// prepareItem converts a parsed entry to an item ready to be stored, or
+// returns nil if storeItem would skip it.
+func (f *Fetcher) prepareItem(ctx context.Context, p *pipeline.Pipeline, idx *dedupe.Index, feed model.Feed, item *gofeed.Item, now time.Time) *model.Item {
+	guid := item.GUID
+	if guid == "" {
+		guid = item.Link
+	}
+	if guid == "" {
+		return nil
+	}
+	pubDate := now
+	if item.PublishedParsed != nil {
+		pubDate = *item.PublishedParsed
+	}
+	dbItem := &model.Item{
+		FeedID:      feed.ID,
+		GUID:        guid,
+		Title:       textutil.Title(item.Title),
+		Content:     item.Content,
+		Link:        transform.ResolveLink(item.Link, feed),
+		PublishedAt: pubDate,
+		FetchedAt:   now,
+		Categories:  item.Categories,
+	}
+	if dbItem.Title != item.Title {
+		dbItem.RawTitle = item.Title
+	}
+	if dbItem.Content == "" {
+		dbItem.Content = item.Description
+	}
+	// Relative links and images would point at this server once rendered.
+	dbItem.Content = transform.Absolutize(dbItem.Content, transform.Base(item.Link, feed))
+	if author := itemAuthor(item); author != nil {
+		dbItem.AuthorName = strings.TrimSpace(author.Name)
+		dbItem.AuthorEmail = strings.TrimSpace(author.Email)
+		if dbItem.AuthorName == "" {
+			dbItem.AuthorName = dbItem.AuthorEmail
+		}
+	}
+	if enc := mediaEnclosure(item.Enclosures); enc != nil {
+		dbItem.EnclosureURL = enc.URL
+		dbItem.EnclosureType = enc.Type
+	}
+	dbItem.Enclosures = itemEnclosures(item)
+	dbItem.CommentsURL = item.Custom[customComments]
+	dbItem.CommentsFeed = item.Custom[customCommentsFeed]
+	if idx.Duplicates(*dbItem) {
+		return nil
+	}
+	if !p.Filter(ctx, feed, dbItem) {
+		return nil
+	}
+	text := textutil.PlainText(dbItem.Content)
+	dbItem.WordCount = textutil.WordCount(text)
+	dbItem.ReadingTime = textutil.ReadingMinutes(dbItem.WordCount)
+	f.mu.Lock()
+	snippetLength := f.snippetLength
+	f.mu.Unlock()
+	if snippetLength > 0 {
+		dbItem.Snippet = textutil.Snippet(text, snippetLength)
+	}
+	return dbItem
+}
+
+// addedItem finishes an item just stored under id: it adds the item to idx,
+// which may be nil, stores its enclosures and runs the pipeline's processors.
+func (f *Fetcher) addedItem(ctx context.Context, p *pipeline.Pipeline, idx *dedupe.Index, feed model.Feed, dbItem *model.Item, id int64) {
+	dbItem.ID = id
+	idx.Add(*dbItem)
+	if len(dbItem.Enclosures) > 0 {
+		if err := f.db.SetItemEnclosures(ctx, id, dbItem.Enclosures); err != nil {
+			reqid.Logf(ctx, "Error storing enclosures of item %d: %v", id, err)
+		}
+	}
+	p.Process(ctx, feed, dbItem)
+}
+
+// itemAuthor returns the first named author of an entry, or nil.
+func itemAuthor(item *gofeed.Item) *gofeed.Person {
+	if item.Author != nil && (item.Author.Name != "" || item.Author.Email != "") {
+		return item.Author
+	}
+	for _, a := range item.Authors {
+		if a != nil && (a.Name != "" || a.Email != "") {
+			return a
+		}
+	}
+	return nil
+}
+
+// mediaEnclosure picks the enclosure to keep for an item, preferring audio
+// and video over other attachments.
+func mediaEnclosure(encs []*gofeed.Enclosure) *gofeed.Enclosure {
+	var first *gofeed.Enclosure
+	for _, enc := range encs {
+		if enc == nil || enc.URL == "" {
 			continue
 		}
-		if isNew {
-			newCount++
+		if strings.HasPrefix(enc.Type, "audio/") || strings.HasPrefix(enc.Type, "video/") {
+			return enc
+		}
+		if first == nil {
+			first = enc
 		}
 	}
+	return first
+}
 
-	// Update last fetched time (and clear any previous error).
-	if err := f.db.UpdateFeedLastFetched(feed.ID, now); err != nil {
-		log.Printf("Error updating last_fetched for feed %d: %v", feed.ID, err)
+// IngestItems stores items pushed into a virtual feed, running them through
+// the same processing as fetched items. Returns the number of new items.
+func (f *Fetcher) IngestItems(ctx context.Context, feed model.Feed, items []*gofeed.Item) int {
+	return f.storeItems(ctx, feed, items, time.Now())
+}
+
+// IngestItem stores a single pushed item and reports whether it was new.
+// Returns a nil item if it duplicates a stored item or a pipeline filter
+// dropped it.
+func (f *Fetcher) IngestItem(ctx context.Context, feed model.Feed, item *gofeed.Item) (*model.Item, bool, error) {
+	p := pipeline.Build(ctx, pipeline.Deps{DB: f.db, LLM: f.llmClient})
+	now := time.Now()
+	oldest := now
+	if item.PublishedParsed != nil && item.PublishedParsed.Before(now) {
+		oldest = *item.PublishedParsed
 	}
+	idx, err := dedupe.LoadIndex(ctx, f.db, feed.ID, oldest)
+	if err != nil {
+		return nil, false, err
+	}
+	return f.storeItem(ctx, p, idx, feed, item, now)
+}
 
-	return newCount, nil
+// SummarizeItem generates a summary for an item with the configured LLM
+// and stores it. Returns llm.ErrNotConfigured if summarization is disabled.
+func (f *Fetcher) SummarizeItem(ctx context.Context, item *model.Item) (string, error) {
+	return pipeline.Summarize(ctx, pipeline.Deps{DB: f.db, LLM: f.llmClient}, item)
+}
+
+// ArchiveItem stores a snapshot of the page an item links to.
+func (f *Fetcher) ArchiveItem(ctx context.Context, item *model.Item) error {
+	return pipeline.Archive(ctx, pipeline.Deps{DB: f.db, LLM: f.llmClient}, item)
+}
+
+// RefreshMetadata re-fetches a feed and updates its title, site URL,
+// description, and icon without storing any items.
+func (f *Fetcher) RefreshMetadata(ctx context.Context, feed model.Feed) (*model.Feed, error) {
+	if feed.IsVirtual() {
+		return nil, fmt.Errorf("feed %d is virtual and has no source to refresh", feed.ID)
+	}
+	body, header, err := f.fetchResponse(ctx, feed.URL, feed.FetchStrategy)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := f.parse(ctx, body, header)
+	if err != nil {
+		return nil, fmt.Errorf("parse feed %s: %w", feed.URL, err)
+	}
+
+	if title := strings.TrimSpace(parsed.Title); title != "" {
+		feed.Title = title
+	}
+	feed.SiteURL, feed.Description = siteInfo(feed, parsed)
+	if parsed.Image != nil && parsed.Image.URL != "" {
+		feed.IconURL = parsed.Image.URL
+	}
+
+	if err := f.db.UpdateFeedMetadata(ctx, feed.ID, feed.Title, feed.SiteURL, feed.Description, feed.IconURL); err != nil {
+		return nil, fmt.Errorf("update metadata for feed %d: %w", feed.ID, err)
+	}
+	return &feed, nil
+}
+
+// siteInfo returns the homepage and description a parsed feed gives for
+// itself, keeping feed's current values where it gives none. A relative
+// homepage is resolved against the feed URL.
+func siteInfo(feed model.Feed, parsed *gofeed.Feed) (siteURL, description string) {
+	siteURL, description = feed.SiteURL, feed.Description
+	if link := strings.TrimSpace(parsed.Link); link != "" {
+		siteURL = link
+		if base, err := url.Parse(feed.URL); err == nil {
+			if ref, err := base.Parse(link); err == nil {
+				siteURL = ref.String()
+			}
+		}
+	}
+	if d := strings.TrimSpace(parsed.Description); d != "" {
+		description = d
+	}
+	return siteURL, description
 }
 
 // FetchResult holds the result of fetching a single feed.
 type FetchResult struct {
 	FeedID   int64
+	Title    string
 	NewItems int
 	Error    error
+	// Retrying is set if Error is transient and the feed will be fetched
+	// again at the end of the run.
+	Retrying bool
 }
 
+// ProgressFunc is called as each feed of a run finishes, with the number of
+// feeds finished so far and the number in the run. A feed that will be
+// retried is reported on every attempt but only counts as finished on the
+// last. Calls are not concurrent.
+type ProgressFunc func(r FetchResult, done, total int)
+
 // FetchAll fetches all feeds with configurable concurrency.
 // Uses parallel workers for PostgreSQL, sequential for SQLite.
 // Returns a map of feed ID -> new item count.
 func (f *Fetcher) FetchAll(ctx context.Context) (map[int64]int, error) {
-	feeds, err := f.db.GetAllFeeds()
+	return f.FetchAllProgress(ctx, nil)
+}
+
+// FetchAllProgress is FetchAll reporting each feed to progress, if not nil.
+func (f *Fetcher) FetchAllProgress(ctx context.Context, progress ProgressFunc) (map[int64]int, error) {
+	feeds, err := f.db.GetAllFeeds(ctx)
 	if err != nil {
 		return nil, err
 	}
+	return f.fetchFeeds(ctx, feeds, progress)
+}
+
+// FetchDue is FetchAll restricted to feeds whose publisher doesn't ask to
+// be polled later (see Feed.NextFetch).
+func (f *Fetcher) FetchDue(ctx context.Context) (map[int64]int, error) {
+	feeds, err := f.db.GetAllFeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	due := feeds[:0]
+	for _, feed := range feeds {
+		if !feed.NextFetch.After(now) {
+			due = append(due, feed)
+		}
+	}
+	if skipped := len(feeds) - len(due); skipped > 0 {
+		reqid.Logf(ctx, "Skipping %d feeds not due for polling yet", skipped)
+	}
+	return f.fetchFeeds(ctx, due, nil)
+}
+
+// fetchFeeds fetches the given feeds with the configured concurrency. Feeds
+// failing with a transient error are fetched again after the others, after
+// each of retryDelays.
+func (f *Fetcher) fetchFeeds(ctx context.Context, feeds []model.Feed, progress ProgressFunc) (map[int64]int, error) {
+	if progress == nil {
+		progress = func(FetchResult, int, int) {}
+	}
+	// Pick up settings changed since the last run.
+	f.LoadSettings(ctx)
+	defer f.saveBudgets(context.WithoutCancel(ctx))
 
 	if len(feeds) == 0 {
 		return make(map[int64]int), nil
 	}
 
-	log.Printf("Fetching %d feeds with concurrency=%d", len(feeds), f.concurrency)
+	f.mu.Lock()
+	concurrency := f.concurrency
+	f.mu.Unlock()
+	reqid.Logf(ctx, "Fetching %d feeds with concurrency=%d", len(feeds), concurrency)
 
-	// For sequential fetching (SQLite), use simple loop
-	if f.concurrency <= 1 {
-		return f.fetchSequential(ctx, feeds)
+	byID := make(map[int64]model.Feed, len(feeds))
+	for _, feed := range feeds {
+		byID[feed.ID] = feed
 	}
+	results := make(map[int64]int)
+	done := 0
+	pending := feeds
+	for round := 0; ; round++ {
+		var retry []model.Feed
+		report := func(r FetchResult) {
+			if r.Error != nil && round < len(retryDelays) && ctx.Err() == nil && transient(r.Error) {
+				r.Retrying = true
+				retry = append(retry, byID[r.FeedID])
+			} else {
+				done++
+			}
+			progress(r, done, len(feeds))
+			if r.Error != nil {
+				return
+			}
+			results[r.FeedID] = r.NewItems
+			if len(results)%50 == 0 {
+				reqid.Logf(ctx, "Progress: %d/%d feeds fetched", len(results), len(feeds))
+			}
+		}
 
-	// For parallel fetching (PostgreSQL), use worker pool
-	return f.fetchParallel(ctx, feeds)
-}
+		var err error
+		if concurrency <= 1 {
+			// For sequential fetching (SQLite), use simple loop
+			err = f.fetchSequential(ctx, pending, report)
+		} else {
+			// For parallel fetching (PostgreSQL), use worker pool
+			err = f.fetchParallel(ctx, pending, concurrency, report)
+		}
+		if err != nil || len(retry) == 0 {
+			return results, err
+		}
 
-// fetchSequential fetches feeds one at a time (for SQLite).
-func (f *Fetcher) fetchSequential(ctx context.Context, feeds []model.Feed) (map[int64]int, error) {
-	results := make(map[int64]int)
+		delay := retryDelays[round]
+		reqid.Logf(ctx, "Retrying %d feeds with transient errors in %s", len(retry), delay)
+		select {
+		case <-ctx.Done():
+			return results, ctx.Err()
+		case <-time.After(delay):
+		}
+		pending = retry
+	}
+}
 
+// fetchSequential fetches feeds one at a time (for SQLite), passing each
+// result to report.
+func (f *Fetcher) fetchSequential(ctx context.Context, feeds []model.Feed, report func(FetchResult)) error {
 	for i, feed := range feeds {
 		select {
 		case <-ctx.Done():
-			log.Printf("FetchAll cancelled after %d/%d feeds", i, len(feeds))
-			return results, ctx.Err()
+			reqid.Logf(ctx, "FetchAll cancelled after %d/%d feeds", i, len(feeds))
+			return ctx.Err()
 		default:
 		}
 
 		count, err := f.FetchFeed(ctx, feed)
 		if err != nil {
-			log.Printf("Failed to fetch %s: %v", feed.URL, err)
-			continue
-		}
-		results[feed.ID] = count
-
-		// Progress logging every 50 feeds
-		if (i+1)%50 == 0 {
-			log.Printf("Progress: %d/%d feeds fetched", i+1, len(feeds))
+			reqid.Logf(ctx, "Failed to fetch %s: %v", feed.URL, err)
 		}
+		report(FetchResult{FeedID: feed.ID, Title: feed.Title, NewItems: count, Error: err})
 	}
-
-	return results, nil
+	return nil
 }
 
-// fetchParallel fetches feeds using a worker pool (for PostgreSQL).
-func (f *Fetcher) fetchParallel(ctx context.Context, feeds []model.Feed) (map[int64]int, error) {
+// fetchParallel fetches feeds using a worker pool (for PostgreSQL), passing
+// each result to report from the calling goroutine.
+func (f *Fetcher) fetchParallel(ctx context.Context, feeds []model.Feed, concurrency int, report func(FetchResult)) error {
 	var wg sync.WaitGroup
-	var mu sync.Mutex
 
-	results := make(map[int64]int)
 	feedChan := make(chan model.Feed, len(feeds))
 	resultChan := make(chan FetchResult, len(feeds))
 
 	// Start workers
-	for i := 0; i < f.concurrency; i++ {
+	for i := 0; i < concurrency; i++ {
 		wg.Add(1)
 		go func(workerID int) {
 			defer wg.Done()
@@ -283,6 +848,7 @@ func (f *Fetcher) fetchParallel(ctx context.Context, feeds []model.Feed) (map[in
 				count, err := f.FetchFeed(ctx, feed)
 				resultChan <- FetchResult{
 					FeedID:   feed.ID,
+					Title:    feed.Title,
 					NewItems: count,
 					Error:    err,
 				}
@@ -309,36 +875,40 @@ func (f *Fetcher) fetchParallel(ctx context.Context, feeds []model.Feed) (map[in
 	}()
 
 	// Process results
-	completed := 0
 	for result := range resultChan {
-		if result.Error != nil {
-			// Error already logged in FetchFeed
-			continue
-		}
-		mu.Lock()
-		results[result.FeedID] = result.NewItems
-		completed++
-		if completed%50 == 0 {
-			log.Printf("Progress: %d/%d feeds fetched", completed, len(feeds))
-		}
-		mu.Unlock()
+		report(result)
 	}
 
-	return results, nil
+	return nil
+}
+
+// PollStatus describes the last run of a Poller.
+type PollStatus struct {
+	LastRun  time.Time `json:"last_run"` // zero before the first run
+	Feeds    int       `json:"feeds"`    // feeds fetched successfully
+	NewItems int       `json:"new_items"`
+	Error    string    `json:"error,omitempty"`
 }
 
 // Poller runs continuous polling.
 type Poller struct {
+	// AfterPoll, if set before Start, is called after every run.
+	AfterPoll func(PollStatus)
+
 	fetcher  *Fetcher
 	db       database.Store
+	mu       sync.Mutex
+	status   PollStatus
 	stopChan chan struct{}
 	wg       sync.WaitGroup
 }
 
-// NewPoller creates a background poller.
-func NewPoller(db database.Store) *Poller {
+// NewPoller creates a background poller fetching with fetcher. Sharing the
+// fetcher that serves manual refreshes gives both one set of domain limits
+// and learned budgets.
+func NewPoller(db database.Store, fetcher *Fetcher) *Poller {
 	return &Poller{
-		fetcher:  NewFetcher(db),
+		fetcher:  fetcher,
 		db:       db,
 		stopChan: make(chan struct{}),
 	}
@@ -346,28 +916,44 @@ func NewPoller(db database.Store) *Poller {
 
 // Start begins the polling loop.
 func (p *Poller) Start() {
+	p.stopChan = make(chan struct{})
 	p.wg.Add(1)
 	go func() {
 		defer p.wg.Done()
 		for {
-			interval, _ := p.db.GetPollingInterval()
+			interval, _ := p.db.GetPollingInterval(context.Background())
 			if interval < MinPollingIntervalMinutes {
 				interval = MinPollingIntervalMinutes
 			}
-			log.Printf("Poller: Fetching all feeds (interval: %dm)", interval)
-
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-			results, err := p.fetcher.FetchAll(ctx)
+			// Each run gets its own request ID, to tell its log lines apart.
+			ctx, cancel := context.WithTimeout(reqid.With(context.Background(), reqid.New()), 10*time.Minute)
+			reqid.Logf(ctx, "Poller: Fetching all feeds (interval: %dm)", interval)
+			go func() {
+				// Stopping interrupts a run in progress.
+				select {
+				case <-p.stopChan:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+			results, err := p.fetcher.FetchDue(ctx)
 			cancel()
 
+			st := PollStatus{LastRun: time.Now(), Feeds: len(results)}
 			if err != nil {
-				log.Printf("Poller error: %v", err)
+				st.Error = err.Error()
+				reqid.Logf(ctx, "Poller error: %v", err)
 			} else {
-				total := 0
 				for _, c := range results {
-					total += c
+					st.NewItems += c
 				}
-				log.Printf("Poller: Fetched %d new items from %d feeds", total, len(results))
+				reqid.Logf(ctx, "Poller: Fetched %d new items from %d feeds", st.NewItems, len(results))
+			}
+			p.mu.Lock()
+			p.status = st
+			p.mu.Unlock()
+			if p.AfterPoll != nil {
+				p.AfterPoll(st)
 			}
 
 			select {
@@ -379,6 +965,13 @@ func (p *Poller) Start() {
 	}()
 }
 
+// Status returns the outcome of the last run.
+func (p *Poller) Status() PollStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
 // Stop stops the poller gracefully.
 func (p *Poller) Stop() {
 	close(p.stopChan)
@@ -0,0 +1,102 @@
+package rss
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Limits on fetched documents, which may come from hostile servers.
+const (
+	// MaxDocumentSize bounds a fetched feed or page. It applies after
+	// decompression, so a small compressed response can't expand to
+	// gigabytes either.
+	MaxDocumentSize = 20 << 20
+	// ParseTimeout bounds parsing one feed document.
+	ParseTimeout = 30 * time.Second
+	// maxXMLDepth bounds the element nesting of a feed document.
+	maxXMLDepth = 256
+)
+
+// Errors for documents over the limits.
+var (
+	ErrDocumentTooLarge = errors.New("document too large")
+	ErrParseTimeout     = errors.New("parse timed out")
+	ErrNestedTooDeep    = errors.New("elements nested too deeply")
+)
+
+// readBody reads a response body of at most MaxDocumentSize bytes.
+func readBody(resp *http.Response) ([]byte, error) {
+	if resp.ContentLength > MaxDocumentSize {
+		return nil, fmt.Errorf("%w: %d bytes, limit %d", ErrDocumentTooLarge, resp.ContentLength, MaxDocumentSize)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxDocumentSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > MaxDocumentSize {
+		return nil, fmt.Errorf("%w: over %d bytes", ErrDocumentTooLarge, MaxDocumentSize)
+	}
+	return body, nil
+}
+
+// parse parses a feed document served with header, nil if unknown, after
+// normalizeDocument. It refuses deeply nested XML and gives up after
+// ParseTimeout or when ctx is done.
+func (f *Fetcher) parse(ctx context.Context, body []byte, header http.Header) (*gofeed.Feed, error) {
+	body, _ = normalizeDocument(body, header.Get("Content-Type"))
+	if err := checkDepth(body); err != nil {
+		return nil, err
+	}
+	type result struct {
+		feed *gofeed.Feed
+		err  error
+	}
+	// The parser can't be interrupted; on timeout it finishes in the
+	// background, bounded by the document size.
+	done := make(chan result, 1)
+	go func() {
+		parsed, err := f.parser().Parse(bytes.NewReader(body))
+		done <- result{parsed, err}
+	}()
+	timer := time.NewTimer(ParseTimeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.feed, r.err
+	case <-timer.C:
+		return nil, ErrParseTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// checkDepth returns ErrNestedTooDeep if the XML elements of doc nest more
+// than maxXMLDepth levels. Malformed XML is left for the parser to report.
+func checkDepth(doc []byte) error {
+	dec := xml.NewDecoder(bytes.NewReader(doc))
+	dec.Strict = false
+	depth := 0
+	for {
+		tok, err := dec.RawToken()
+		if err != nil {
+			return nil
+		}
+		switch tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth > maxXMLDepth {
+				return fmt.Errorf("%w: over %d levels", ErrNestedTooDeep, maxXMLDepth)
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package rss
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/feedurl"
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+)
+
+// RediscoverAfter is how many fetches of a feed must fail in a row, the last
+// finding it gone, before its site is searched for a new feed URL. The
+// search is repeated every RediscoverAfter failures while the feed is gone.
+const RediscoverAfter = 3
+
+// ErrURLInUse is returned by MoveFeedURL when another feed has the URL.
+var ErrURLInUse = errors.New("another feed has that URL")
+
+// gone reports whether a failed fetch found no feed at the URL.
+func gone(fe model.FetchError) bool {
+	return fe.StatusCode == http.StatusNotFound || fe.StatusCode == http.StatusGone
+}
+
+// rediscover searches the site of a feed that keeps returning 404 for the
+// feed it now advertises. A new feed URL is suggested to the user, or
+// applied right away if the rediscover_auto_apply setting is on. Nothing
+// happens if the site itself can't be fetched.
+func (f *Fetcher) rediscover(ctx context.Context, feed model.Feed) {
+	site := siteRoot(feed)
+	if site == "" {
+		return
+	}
+	found, err := f.Discover(ctx, site)
+	if err != nil {
+		reqid.Logf(ctx, "Rediscovery for feed %d found nothing at %s: %v", feed.ID, site, err)
+		return
+	}
+	if feedurl.Key(found.URL) == feedurl.Key(feed.URL) || found.URL == feed.SuggestedURL {
+		return
+	}
+
+	if database.GetIntSetting(ctx, f.db, model.SettingRediscoverAutoApply, 0) != 0 {
+		err := f.MoveFeedURL(ctx, feed.ID, found.URL)
+		if err == nil {
+			reqid.Logf(ctx, "Moved feed %d from %s to rediscovered %s", feed.ID, feed.URL, found.URL)
+			return
+		}
+		reqid.Logf(ctx, "Error moving feed %d to %s: %v", feed.ID, found.URL, err)
+	}
+	if err := f.db.SetFeedSuggestedURL(ctx, feed.ID, found.URL); err != nil {
+		reqid.Logf(ctx, "Error saving suggested URL of feed %d: %v", feed.ID, err)
+		return
+	}
+	reqid.Logf(ctx, "Suggested %s as the new URL of feed %d", found.URL, feed.ID)
+}
+
+// siteRoot returns the page to search for a feed's new URL: its site URL, or
+// else the root of the host it is served from.
+func siteRoot(feed model.Feed) string {
+	if feed.SiteURL != "" {
+		return feed.SiteURL
+	}
+	u, err := url.Parse(feed.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host + "/"
+}
+
+// MoveFeedURL points a feed at a new URL, unless another feed, spelled the
+// same way or not, already has it.
+func (f *Fetcher) MoveFeedURL(ctx context.Context, feedID int64, newURL string) error {
+	feeds, err := f.db.GetAllFeeds(ctx)
+	if err != nil {
+		return err
+	}
+	key := feedurl.Key(newURL)
+	for _, other := range feeds {
+		if other.ID != feedID && feedurl.Key(other.URL) == key {
+			return ErrURLInUse
+		}
+	}
+	return f.db.UpdateFeedURL(ctx, feedID, newURL)
+}
@@ -0,0 +1,79 @@
+package rss
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// retryDelays are the waits before each extra round of a run, in which the
+// feeds that failed with a transient error in the round before are fetched
+// again. A feed is tried at most len(retryDelays)+1 times per run.
+var retryDelays = []time.Duration{5 * time.Second, 20 * time.Second}
+
+// httpError is returned for a response without a 2xx status.
+type httpError struct {
+	url        string
+	statusCode int
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("fetch %s: http error: %d %s", e.url, e.statusCode, http.StatusText(e.statusCode))
+}
+
+// transient reports whether a fetch error may go away if the fetch is
+// retried shortly: a timeout or a 5xx response.
+func transient(err error) bool {
+	var he *httpError
+	if errors.As(err, &he) {
+		return he.statusCode >= 500
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// maxErrorMessage bounds the error message stored with a feed.
+const maxErrorMessage = 200
+
+// classifyError describes a failed fetch for the feed's record: its HTTP
+// status, if there was a response, and what kind of failure it was. parsing
+// is set if the document was fetched but couldn't be parsed.
+func classifyError(err error, parsing bool) model.FetchError {
+	fe := model.FetchError{Message: err.Error(), Class: model.FetchErrorOther}
+	if len(fe.Message) > maxErrorMessage {
+		fe.Message = fe.Message[:maxErrorMessage]
+	}
+	var he *httpError
+	var dnsErr *net.DNSError
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidCert x509.CertificateInvalidError
+	var ne net.Error
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &he):
+		fe.StatusCode = he.statusCode
+		fe.Class = model.FetchErrorHTTP
+	case errors.As(err, &ne) && ne.Timeout(), errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrParseTimeout):
+		fe.Class = model.FetchErrorTimeout
+	case parsing:
+		fe.Class = model.FetchErrorParse
+	case errors.As(err, &dnsErr):
+		fe.Class = model.FetchErrorDNS
+	case errors.As(err, &certErr), errors.As(err, &recordErr), errors.As(err, &unknownAuthority),
+		errors.As(err, &hostnameErr), errors.As(err, &invalidCert):
+		fe.Class = model.FetchErrorTLS
+	case errors.As(err, &opErr):
+		fe.Class = model.FetchErrorConnection
+	}
+	return fe
+}
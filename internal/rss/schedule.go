@@ -0,0 +1,107 @@
+package rss
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	gofeedrss "github.com/mmcdole/gofeed/rss"
+)
+
+// maxFetchDelay caps how far a ttl or caching header may postpone the next
+// poll, so a misconfigured publisher can't silence a feed for weeks.
+const maxFetchDelay = 24 * time.Hour
+
+// nextFetch returns the earliest time a feed fetched at now should be polled
+// again according to its publisher: the RSS ttl, skipHours and skipDays
+// elements and the Cache-Control max-age or Expires response headers.
+// Returns the zero time if the feed gives no hints.
+func nextFetch(now time.Time, feedType string, body []byte, header http.Header) time.Time {
+	delay, hinted := cacheDelay(now, header)
+	var skipHours map[int]bool
+	var skipDays map[time.Weekday]bool
+	if feedType == "rss" {
+		if channel, err := (&gofeedrss.Parser{}).Parse(bytes.NewReader(body)); err == nil {
+			if ttl, err := strconv.Atoi(strings.TrimSpace(channel.TTL)); err == nil && ttl > 0 {
+				delay = max(delay, time.Duration(ttl)*time.Minute)
+				hinted = true
+			}
+			skipHours = parseSkipHours(channel.SkipHours)
+			skipDays = parseSkipDays(channel.SkipDays)
+		}
+	}
+	if !hinted && len(skipHours) == 0 && len(skipDays) == 0 {
+		return time.Time{}
+	}
+
+	next := now.Add(min(delay, maxFetchDelay))
+	skipped := func(t time.Time) bool {
+		t = t.UTC() // skipHours and skipDays are in GMT
+		return skipHours[t.Hour()] || skipDays[t.Weekday()]
+	}
+	// Move to the start of the first hour outside the skip windows. If
+	// the publisher skips every hour of the week, ignore the windows.
+	t := next
+	for i := 0; i < 7*24 && skipped(t); i++ {
+		t = t.UTC().Truncate(time.Hour).Add(time.Hour)
+	}
+	if skipped(t) {
+		return next
+	}
+	return t
+}
+
+// cacheDelay returns how long a response may be cached according to its
+// Cache-Control max-age or, failing that, its Expires header.
+func cacheDelay(now time.Time, header http.Header) (time.Duration, bool) {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache", "no-store":
+			return 0, false
+		case "max-age":
+			if secs, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && secs > 0 {
+				return time.Duration(secs) * time.Second, true
+			}
+		}
+	}
+	expires, err := http.ParseTime(header.Get("Expires"))
+	if err != nil {
+		return 0, false
+	}
+	// Measure against the server's Date to be immune to clock skew.
+	base := now
+	if date, err := http.ParseTime(header.Get("Date")); err == nil {
+		base = date
+	}
+	if d := expires.Sub(base); d > 0 {
+		return d, true
+	}
+	return 0, false
+}
+
+// parseSkipHours reads RSS skipHours values (0-23, GMT; 24 is taken as 0).
+func parseSkipHours(values []string) map[int]bool {
+	hours := make(map[int]bool)
+	for _, v := range values {
+		if h, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && h >= 0 && h <= 24 {
+			hours[h%24] = true
+		}
+	}
+	return hours
+}
+
+// parseSkipDays reads RSS skipDays values (English weekday names).
+func parseSkipDays(values []string) map[time.Weekday]bool {
+	days := make(map[time.Weekday]bool)
+	for _, v := range values {
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if strings.EqualFold(strings.TrimSpace(v), d.String()) {
+				days[d] = true
+			}
+		}
+	}
+	return days
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bryan-buckman/infovore/internal/alerts"
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// handleGetAlerts lists the keyword alerts.
+func (s *Server) handleGetAlerts(w http.ResponseWriter, r *http.Request) {
+	list := alerts.Load(r.Context(), s.db)
+	if list == nil {
+		list = []alerts.Alert{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"alerts": list,
+	})
+}
+
+// handleSaveAlerts replaces the keyword alerts with {"alerts": [...]}. They
+// apply to items fetched from then on.
+func (s *Server) handleSaveAlerts(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Alerts []alerts.Alert `json:"alerts"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	list, err := alerts.Validate(req.Alerts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, _ := json.Marshal(list)
+	if err := s.db.SetSetting(r.Context(), model.SettingAlerts, string(data)); err != nil {
+		http.Error(w, "Failed to save alerts", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, model.AuditUpdateSettings, "alerts")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"alerts": list,
+	})
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/bryan-buckman/infovore/internal/jobs"
+)
+
+// archiveCSP keeps stored snapshots inert: no scripts, frames or forms.
+const archiveCSP = "default-src 'none'; img-src * data:; media-src *; style-src 'unsafe-inline'"
+
+// handleArchivePage serves the stored snapshot of an item's linked page.
+func (s *Server) handleArchivePage(w http.ResponseWriter, r *http.Request) {
+	itemID, err := urlID(r, "itemID")
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+	archive, err := s.db.GetItemArchive(r.Context(), itemID)
+	if err != nil {
+		storeError(w, r, err, "Archive")
+		return
+	}
+	if archive.Title == "" {
+		if item, err := s.db.GetItemByID(r.Context(), itemID); err == nil {
+			archive.Title = item.Title
+		}
+	}
+	w.Header().Set("Content-Security-Policy", archiveCSP)
+	s.render(w, r, "archive.html", archive)
+}
+
+// itemJob is the payload of the jobs acting on one item.
+type itemJob struct {
+	ItemID int64 `json:"item_id"`
+}
+
+// runArchiveJob snapshots the linked page of the item in its payload,
+// replacing any earlier snapshot.
+func (s *Server) runArchiveJob(ctx context.Context, j *jobs.Job) (interface{}, error) {
+	var p itemJob
+	if err := j.Decode(&p); err != nil {
+		return nil, err
+	}
+	item, err := s.db.GetItemByID(ctx, p.ItemID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.fetcher.ArchiveItem(ctx, item); err != nil {
+		return nil, err
+	}
+	return map[string]string{"archive_url": fmt.Sprintf("/archive/%d", item.ID)}, nil
+}
+
+// handleArchiveItem snapshots an item's linked page now, regardless of the
+// feed's archive_pages option.
+func (s *Server) handleArchiveItem(w http.ResponseWriter, r *http.Request) {
+	itemID, err := urlID(r, "itemID")
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+	item, err := s.db.GetItemByID(r.Context(), itemID)
+	if err != nil {
+		storeError(w, r, err, "Item")
+		return
+	}
+	if item.Link == "" {
+		http.Error(w, "Item has no link", http.StatusBadRequest)
+		return
+	}
+	job, err := s.runJob(r, jobArchive, itemJob{ItemID: itemID}, nil)
+	if err := jobOutcome(job, err, nil); err != nil {
+		http.Error(w, fmt.Sprintf("Archive error: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      "ok",
+		"archive_url": fmt.Sprintf("/archive/%d", itemID),
+	})
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+)
+
+// maxAuditPage caps the page size of the audit log endpoint.
+const maxAuditPage = 200
+
+// audit records an action taken by the client of r. Failures are logged
+// rather than failing the action itself.
+func (s *Server) audit(r *http.Request, action, target string) {
+	actor := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(actor); err == nil {
+		actor = host
+	}
+	err := s.db.AddAuditEntry(r.Context(), model.AuditEntry{Actor: actor, Action: action, Target: target, CreatedAt: time.Now()})
+	if err != nil {
+		reqid.Logf(r.Context(), "Audit: failed to record %s %s: %v", action, target, err)
+	}
+}
+
+// handleGetAuditLog returns a page of the audit log, newest first, selected
+// with ?limit= (default 50) and ?offset=.
+func (s *Server) handleGetAuditLog(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+	limit = min(limit, maxAuditPage)
+	offset, err := strconv.Atoi(q.Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	// Fetch one extra entry to learn whether there is a next page.
+	entries, err := s.db.GetAuditLog(r.Context(), limit+1, offset)
+	if err != nil {
+		http.Error(w, "Failed to load audit log", http.StatusInternalServerError)
+		return
+	}
+	hasMore := len(entries) > limit
+	if hasMore {
+		entries = entries[:limit]
+	}
+
+	resp := map[string]interface{}{
+		"entries": entries,
+		"offset":  offset,
+		"limit":   limit,
+	}
+	if hasMore {
+		resp["next_offset"] = offset + limit
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
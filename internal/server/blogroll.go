@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/opml"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+)
+
+// blogrollTitle heads the blogroll page and its OPML.
+const blogrollTitle = "Blogroll"
+
+// blogrollFolders returns the IDs of the folders published on the blogroll.
+func (s *Server) blogrollFolders(ctx context.Context) map[int64]bool {
+	published := make(map[int64]bool)
+	if val, err := s.db.GetSetting(ctx, model.SettingBlogrollFolders); err == nil && val != "" {
+		var ids []int64
+		json.Unmarshal([]byte(val), &ids)
+		for _, id := range ids {
+			published[id] = true
+		}
+	}
+	return published
+}
+
+// handleSetFolderBlogroll publishes a folder's feeds on the blogroll, or
+// takes them off it.
+func (s *Server) handleSetFolderBlogroll(w http.ResponseWriter, r *http.Request) {
+	folderID, err := urlID(r, "folderID")
+	if err != nil {
+		http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Published bool `json:"published"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	folder, err := s.db.GetFolderByID(r.Context(), folderID)
+	if err != nil {
+		storeError(w, r, err, "Folder")
+		return
+	}
+	folders, err := s.db.GetFolders(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to load folders", http.StatusInternalServerError)
+		return
+	}
+
+	// Rewrite the whole list, dropping folders that no longer exist.
+	state := s.blogrollFolders(r.Context())
+	state[folderID] = req.Published
+	ids := []int64{}
+	for _, f := range folders {
+		if state[f.ID] {
+			ids = append(ids, f.ID)
+		}
+	}
+	data, _ := json.Marshal(ids)
+	if err := s.db.SetSetting(r.Context(), model.SettingBlogrollFolders, string(data)); err != nil {
+		http.Error(w, "Failed to save", http.StatusInternalServerError)
+		return
+	}
+	action := "unpublished"
+	if req.Published {
+		action = "published"
+	}
+	s.audit(r, model.AuditBlogroll, fmt.Sprintf("folder %d (%s): %s", folderID, folder.Name, action))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":           "ok",
+		"blogroll_folders": ids,
+		"path":             "/blogroll",
+	})
+}
+
+// blogrollSection is a published folder as the blogroll lists it.
+type blogrollSection struct {
+	Name  string
+	Feeds []model.Feed
+}
+
+// blogroll returns the published folders in sidebar order, each with the
+// feeds it holds itself; subfolders are published on their own. Virtual
+// feeds, which no one else could subscribe to, are left out, and so are
+// folders left with no feeds.
+func (s *Server) blogroll(ctx context.Context) ([]blogrollSection, error) {
+	published := s.blogrollFolders(ctx)
+	if len(published) == 0 {
+		return nil, nil
+	}
+	folders, err := s.db.GetFoldersWithFeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var sections []blogrollSection
+	for _, folder := range folders {
+		if !published[folder.ID] {
+			continue
+		}
+		section := blogrollSection{Name: folder.Name}
+		for _, feed := range folder.Feeds {
+			if !feed.IsVirtual() {
+				section.Feeds = append(section.Feeds, feed)
+			}
+		}
+		if len(section.Feeds) > 0 {
+			sections = append(sections, section)
+		}
+	}
+	return sections, nil
+}
+
+// handleBlogroll serves the blogroll: the title, site and description of
+// each feed in the published folders. It is a 404 until a folder is
+// published.
+func (s *Server) handleBlogroll(w http.ResponseWriter, r *http.Request) {
+	sections, err := s.blogroll(r.Context())
+	if err != nil {
+		reqid.Logf(r.Context(), "Blogroll: %v", err)
+		http.Error(w, "Failed to load blogroll", http.StatusInternalServerError)
+		return
+	}
+	if len(sections) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	s.render(w, r, "blogroll.html", map[string]interface{}{
+		"Title":    blogrollTitle,
+		"Sections": sections,
+	})
+}
+
+// handleBlogrollOPML serves the blogroll as OPML, a folder outline for each
+// published folder.
+func (s *Server) handleBlogrollOPML(w http.ResponseWriter, r *http.Request) {
+	sections, err := s.blogroll(r.Context())
+	if err != nil {
+		reqid.Logf(r.Context(), "Blogroll: %v", err)
+		http.Error(w, "Failed to load blogroll", http.StatusInternalServerError)
+		return
+	}
+	if len(sections) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	grouped := make(map[string][]opml.FeedEntry)
+	for _, section := range sections {
+		for _, feed := range section.Feeds {
+			grouped[section.Name] = append(grouped[section.Name], opml.FeedEntry{
+				Title:      feed.Title,
+				URL:        feed.URL,
+				HTMLURL:    feed.SiteURL,
+				FolderPath: []string{section.Name},
+			})
+		}
+	}
+	data, err := opml.Export(blogrollTitle, grouped)
+	if err != nil {
+		http.Error(w, "Failed to export", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write(data)
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/export"
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+	"github.com/go-chi/chi/v5"
+)
+
+// folderCalendarItems is how many of a folder's newest items its calendar
+// lists.
+const folderCalendarItems = 200
+
+// folderCalendarPath returns the path of the iCalendar feed a token opens.
+func folderCalendarPath(token string) string {
+	return "/ical/" + token
+}
+
+// handleGetFolderCalendar tells whether a folder has an iCalendar feed, and
+// where.
+func (s *Server) handleGetFolderCalendar(w http.ResponseWriter, r *http.Request) {
+	folderID, err := urlID(r, "folderID")
+	if err != nil {
+		http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.db.GetFolderByID(r.Context(), folderID); err != nil {
+		storeError(w, r, err, "Folder")
+		return
+	}
+	resp := map[string]interface{}{"enabled": false}
+	if token := s.folderToken(r.Context(), model.SettingFolderCalendarTokens, folderID); token != "" {
+		resp = map[string]interface{}{"enabled": true, "path": folderCalendarPath(token)}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleSetFolderCalendar gives a folder an iCalendar feed at a new secret
+// URL, replacing the one it had, or with {"enabled": false} takes it away.
+// Like the private Atom feed, anyone holding the URL can read the folder's
+// items.
+func (s *Server) handleSetFolderCalendar(w http.ResponseWriter, r *http.Request) {
+	folderID, err := urlID(r, "folderID")
+	if err != nil {
+		http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	folder, err := s.db.GetFolderByID(r.Context(), folderID)
+	if err != nil {
+		storeError(w, r, err, "Folder")
+		return
+	}
+	token, err := s.setFolderToken(r.Context(), model.SettingFolderCalendarTokens, folderID, req.Enabled)
+	if err != nil {
+		http.Error(w, "Failed to save", http.StatusInternalServerError)
+		return
+	}
+	action := "revoked"
+	if req.Enabled {
+		action = "new URL"
+	}
+	s.audit(r, model.AuditFolderCalendar, fmt.Sprintf("folder %d (%s): %s", folderID, folder.Name, action))
+
+	resp := map[string]interface{}{"status": "ok", "enabled": req.Enabled}
+	if req.Enabled {
+		resp["path"] = folderCalendarPath(token)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleFolderCalendar serves the iCalendar feed of the folder a token
+// opens: an event for each of the newest items of its feeds, on the date
+// its title names or else when it was published. Unknown tokens get the
+// same 404 as any missing page.
+func (s *Server) handleFolderCalendar(w http.ResponseWriter, r *http.Request) {
+	folderID, ok := s.folderTokens(r.Context(), model.SettingFolderCalendarTokens)[chi.URLParam(r, "token")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	folder, err := s.db.GetFolderByID(r.Context(), folderID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	entries, err := s.exportEntries(r.Context(), model.ItemFilter{FolderID: &folderID, Limit: folderCalendarItems})
+	if err != nil {
+		http.Error(w, "Failed to load items", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", export.ICalContentType)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	if err := export.WriteICal(w, folder.Name, entries, time.Now()); err != nil {
+		reqid.Logf(r.Context(), "Folder calendar %d: %v", folderID, err)
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+
+	"github.com/bryan-buckman/infovore/internal/cluster"
+)
+
+// startJobs starts the background jobs. With a shared database only the
+// leader instance runs them.
+func (s *Server) startJobs() {
+	// Note: Poller is NOT started automatically to avoid 403 errors from aggressive polling.
+	// Users should use the manual Refresh button instead.
+	s.interest.Start()
+	s.health.Start()
+	s.trash.Start()
+	s.maintain.Start()
+	s.digest.Start()
+	s.linkrot.Start()
+	s.jobs.Start()
+	if s.newsletter != nil {
+		s.newsletter.Start()
+	}
+	if s.media != nil {
+		s.media.Start()
+	}
+}
+
+// stopJobs stops the jobs started by startJobs.
+func (s *Server) stopJobs() {
+	s.interest.Stop()
+	s.health.Stop()
+	s.trash.Stop()
+	s.maintain.Stop()
+	s.digest.Stop()
+	s.linkrot.Stop()
+	s.jobs.Stop()
+	if s.newsletter != nil {
+		s.newsletter.Stop()
+	}
+	if s.media != nil {
+		s.media.Stop()
+	}
+}
+
+// invalidate drops state cached by this instance after another instance (or
+// this one) published event. The job triggers reach the jobs only on the
+// leader; elsewhere they are no-ops.
+func (s *Server) invalidate(event string) {
+	if event == cluster.EventSettings || event == cluster.EventAll {
+		s.fetcher.LoadSettings(context.Background())
+	}
+	if event == cluster.EventItems || event == cluster.EventAll {
+		s.trending.Invalidate()
+		s.interest.Trigger()
+		s.health.Trigger()
+		s.triggerDownloads()
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/textutil"
+	"github.com/bryan-buckman/infovore/internal/video"
+)
+
+// prepareContent post-processes the content of items about to be rendered
+// as HTML. Stored content is left as fetched; per-feed display options are
+// applied here so that changing them affects existing items too.
+func (s *Server) prepareContent(ctx context.Context, items []model.Item) {
+	if len(items) == 0 {
+		return
+	}
+	feeds, err := s.db.GetAllFeeds(ctx)
+	if err != nil {
+		return
+	}
+	embed := make(map[int64]bool)
+	for _, f := range feeds {
+		if f.EmbedVideos {
+			embed[f.ID] = true
+		}
+	}
+	if len(embed) == 0 {
+		return
+	}
+	for i := range items {
+		if embed[items[i].FeedID] {
+			items[i].Content = video.Embed(items[i].Content)
+		}
+	}
+}
+
+// snippetLength returns the configured length of item snippets, 0 if lists
+// show full content.
+func snippetLength(ctx context.Context, db database.Store) int {
+	return database.GetIntSetting(ctx, db, model.SettingSnippetLength, textutil.DefaultSnippetLength)
+}
+
+// useSnippets drops the content of items about to be listed, leaving their
+// snippets, unless snippets are turned off. The page loads an item's content
+// when it is expanded. Items stored without a snippet get one here.
+func (s *Server) useSnippets(ctx context.Context, items []model.Item) {
+	n := snippetLength(ctx, s.db)
+	if n <= 0 {
+		return
+	}
+	for i := range items {
+		if items[i].Snippet == "" {
+			items[i].Snippet = textutil.Snippet(textutil.PlainText(items[i].Content), n)
+		}
+		items[i].Content = ""
+	}
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/cluster"
+	"github.com/bryan-buckman/infovore/internal/digest"
+	"github.com/bryan-buckman/infovore/internal/jobs"
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+)
+
+// holdBackDigest hides the items of digest folders from listings that
+// aren't limited to a feed, folder, tag, author or domain: the main stream
+// and the smart views. Those items reach the main stream in the daily
+// digest.
+func (s *Server) holdBackDigest(ctx context.Context, filter *model.ItemFilter) {
+	if filter.FeedID != nil || filter.FolderID != nil || filter.Tag != "" || filter.Author != "" || filter.Domain != "" {
+		return
+	}
+	filter.ExcludeFolders = digest.Folders(ctx, s.db)
+}
+
+func (s *Server) digestFolders(ctx context.Context) map[int64]bool {
+	held := make(map[int64]bool)
+	for _, id := range digest.Folders(ctx, s.db) {
+		held[id] = true
+	}
+	return held
+}
+
+// handleSetFolderDigest moves a folder into or out of the daily digest.
+func (s *Server) handleSetFolderDigest(w http.ResponseWriter, r *http.Request) {
+	folderID, err := urlID(r, "folderID")
+	if err != nil {
+		http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Digest bool `json:"digest"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.db.GetFolderByID(r.Context(), folderID); err != nil {
+		storeError(w, r, err, "Folder")
+		return
+	}
+	folders, err := s.db.GetFolders(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to load folders", http.StatusInternalServerError)
+		return
+	}
+
+	// Rewrite the whole list, dropping folders that no longer exist.
+	state := s.digestFolders(r.Context())
+	state[folderID] = req.Digest
+	ids := []int64{}
+	for _, f := range folders {
+		if state[f.ID] {
+			ids = append(ids, f.ID)
+		}
+	}
+	data, _ := json.Marshal(ids)
+	if err := s.db.SetSetting(r.Context(), model.SettingDigestFolders, string(data)); err != nil {
+		http.Error(w, "Failed to save", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":         "ok",
+		"digest_folders": ids,
+	})
+}
+
+// digestResult is the outcome of a digest job.
+type digestResult struct {
+	ItemID int64 `json:"item_id"` // 0 if there was nothing to deliver
+	Items  int   `json:"items"`
+}
+
+// runDigestJob delivers the digest. Items already delivered aren't
+// delivered again, so running it twice is harmless.
+func (s *Server) runDigestJob(ctx context.Context, j *jobs.Job) (interface{}, error) {
+	itemID, n, err := digest.Run(ctx, s.db, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if itemID != 0 {
+		s.caches.Publish(cluster.EventItems)
+	}
+	return digestResult{ItemID: itemID, Items: n}, nil
+}
+
+// deliverDigest delivers the scheduled digest as a job and waits for it.
+func (s *Server) deliverDigest() {
+	jobID, err := s.jobs.Enqueue(context.Background(), jobDigest, nil)
+	if err != nil {
+		log.Printf("Digest: %v", err)
+		return
+	}
+	job, err := s.jobs.Wait(context.Background(), jobID, nil)
+	var res digestResult
+	if err := jobOutcome(job, err, &res); err != nil {
+		log.Printf("Digest: %v", err)
+		return
+	}
+	log.Printf("Digest: delivered %d items", res.Items)
+}
+
+// handleRunDigest delivers the digest now instead of waiting for the digest
+// hour.
+func (s *Server) handleRunDigest(w http.ResponseWriter, r *http.Request) {
+	job, err := s.runJob(r, jobDigest, nil, nil)
+	var res digestResult
+	if err := jobOutcome(job, err, &res); err != nil {
+		reqid.Logf(r.Context(), "Digest failed: %v", err)
+		http.Error(w, "Failed to make the digest", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"item_id": res.ItemID,
+		"items":   res.Items,
+		"job_id":  job.ID,
+	})
+}
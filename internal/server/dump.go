@@ -0,0 +1,48 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/cluster"
+	"github.com/bryan-buckman/infovore/internal/dump"
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+)
+
+// handleExportDump downloads the whole dataset as a JSON-lines dump.
+func (s *Server) handleExportDump(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	name := fmt.Sprintf("infovore-dump-%s.jsonl", now.Format("2006-01-02"))
+	w.Header().Set("Content-Type", dump.ContentType)
+	w.Header().Set("Content-Disposition", "attachment; filename="+name)
+	// Headers are sent with the first record, so a failure can only cut
+	// the download short.
+	if _, err := dump.Write(r.Context(), w, s.db, now); err != nil {
+		reqid.Logf(r.Context(), "Export: dump failed: %v", err)
+	}
+}
+
+// handleImportDump loads a dump made by handleExportDump, merging it with
+// the existing data.
+func (s *Server) handleImportDump(w http.ResponseWriter, r *http.Request) {
+	report, err := dump.Read(r.Context(), r.Body, s.db)
+	if report != nil && (report.Folders > 0 || report.Feeds > 0 || report.Items > 0) {
+		s.caches.Publish(cluster.EventItems)
+	}
+	if err != nil {
+		reqid.Logf(r.Context(), "Dump import failed: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.caches.Publish(cluster.EventSettings)
+	s.audit(r, model.AuditImportDump, fmt.Sprintf("%d feeds, %d items", report.Feeds, report.Items))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"report": report,
+	})
+}
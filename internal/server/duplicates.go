@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/cluster"
+	"github.com/bryan-buckman/infovore/internal/dedupe"
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+)
+
+// duplicateItem is one copy of an article in a duplicates report.
+type duplicateItem struct {
+	ID        int64     `json:"id"`
+	Title     string    `json:"title"`
+	Link      string    `json:"link"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// duplicateGroup is an article stored several times in a feed.
+type duplicateGroup struct {
+	FeedID     int64           `json:"feed_id"`
+	Keep       duplicateItem   `json:"keep"`
+	Duplicates []duplicateItem `json:"duplicates"`
+}
+
+// handleFindDuplicates reports the articles stored more than once in a
+// feed without changing anything.
+func (s *Server) handleFindDuplicates(w http.ResponseWriter, r *http.Request) {
+	groups, err := dedupe.Run(r.Context(), s.db, true)
+	if err != nil {
+		reqid.Logf(r.Context(), "Finding duplicates failed: %v", err)
+		http.Error(w, "Failed to find duplicates", http.StatusInternalServerError)
+		return
+	}
+	writeDuplicates(w, groups, true)
+}
+
+// handleMergeDuplicates merges every article stored more than once in a
+// feed into its oldest copy and moves the other copies to the trash.
+func (s *Server) handleMergeDuplicates(w http.ResponseWriter, r *http.Request) {
+	groups, err := dedupe.Run(r.Context(), s.db, false)
+	if len(groups) > 0 {
+		s.audit(r, model.AuditMergeItems, fmt.Sprintf("%d duplicates of %d items", countDuplicates(groups), len(groups)))
+		s.caches.Publish(cluster.EventItems)
+	}
+	if err != nil {
+		reqid.Logf(r.Context(), "Merging duplicates failed: %v", err)
+		http.Error(w, "Failed to merge duplicates", http.StatusInternalServerError)
+		return
+	}
+	writeDuplicates(w, groups, false)
+}
+
+// writeDuplicates writes a duplicates report.
+func writeDuplicates(w http.ResponseWriter, groups []dedupe.Group, dryRun bool) {
+	report := make([]duplicateGroup, 0, len(groups))
+	for _, g := range groups {
+		dg := duplicateGroup{FeedID: g.Keep.FeedID, Keep: newDuplicateItem(g.Keep)}
+		for _, d := range g.Duplicates {
+			dg.Duplicates = append(dg.Duplicates, newDuplicateItem(d))
+		}
+		report = append(report, dg)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     "ok",
+		"dry_run":    dryRun,
+		"groups":     report,
+		"duplicates": countDuplicates(groups),
+	})
+}
+
+func newDuplicateItem(it model.Item) duplicateItem {
+	return duplicateItem{ID: it.ID, Title: it.Title, Link: it.Link, FetchedAt: it.FetchedAt}
+}
+
+// countDuplicates returns the number of copies beyond the kept ones.
+func countDuplicates(groups []dedupe.Group) int {
+	n := 0
+	for _, g := range groups {
+		n += len(g.Duplicates)
+	}
+	return n
+}
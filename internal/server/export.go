@@ -0,0 +1,231 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/export"
+	"github.com/bryan-buckman/infovore/internal/jobs"
+	"github.com/bryan-buckman/infovore/internal/mailer"
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+)
+
+// maxEPUBItems bounds the number of chapters in an EPUB export.
+const maxEPUBItems = 200
+
+// handleExportArchive downloads starred items, or the items carrying ?tag=,
+// as a ZIP of Markdown (default) or standalone HTML files.
+func (s *Server) handleExportArchive(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatMarkdown
+	}
+	if !export.ValidFormat(format) {
+		http.Error(w, "Unknown format", http.StatusBadRequest)
+		return
+	}
+	filter := model.ItemFilter{Starred: true}
+	if tag := strings.TrimSpace(r.URL.Query().Get("tag")); tag != "" {
+		filter = model.ItemFilter{Tag: tag}
+	}
+
+	entries, err := s.exportEntries(r.Context(), filter)
+	if err != nil {
+		http.Error(w, "Failed to get items", http.StatusInternalServerError)
+		return
+	}
+
+	name := fmt.Sprintf("infovore-%s-%s.zip", format, time.Now().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename="+name)
+	if err := export.WriteZip(w, entries, format); err != nil {
+		reqid.Logf(r.Context(), "Export: archive failed: %v", err)
+	}
+}
+
+// handleExportEPUB bundles a folder's unread items (?folder_id=) or, by
+// default, the starred items into an EPUB. With ?send=kindle the book is
+// mailed to the Kindle address from settings instead of downloaded.
+func (s *Server) handleExportEPUB(w http.ResponseWriter, r *http.Request) {
+	var folderID *int64
+	if raw := r.URL.Query().Get("folder_id"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+			return
+		}
+		if _, err := s.db.GetFolderByID(r.Context(), id); err != nil {
+			storeError(w, r, err, "Folder")
+			return
+		}
+		folderID = &id
+	}
+	if r.URL.Query().Get("send") == "kindle" {
+		s.sendToKindle(w, r, folderID)
+		return
+	}
+
+	book, err := s.buildEPUB(r.Context(), folderID)
+	if err != nil {
+		reqid.Logf(r.Context(), "Export: EPUB failed: %v", err)
+		http.Error(w, "Failed to build EPUB", http.StatusInternalServerError)
+		return
+	}
+	if book == nil {
+		http.Error(w, "No items to export", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", export.EPUBContentType)
+	w.Header().Set("Content-Disposition", "attachment; filename="+book.name)
+	w.Write(book.data)
+}
+
+// epubBook is an EPUB export.
+type epubBook struct {
+	title string
+	name  string // file name
+	items int
+	data  []byte
+}
+
+// buildEPUB bundles a folder's unread items, or the starred items if
+// folderID is nil, into an EPUB. It returns nil if there are no items.
+func (s *Server) buildEPUB(ctx context.Context, folderID *int64) (*epubBook, error) {
+	filter := model.ItemFilter{Starred: true}
+	title := "Infovore: Starred"
+	if folderID != nil {
+		folder, err := s.db.GetFolderByID(ctx, *folderID)
+		if err != nil {
+			return nil, err
+		}
+		filter = model.ItemFilter{FolderID: folderID, OnlyUnread: true}
+		title = "Infovore: " + folder.Name
+	}
+
+	entries, err := s.exportEntries(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	if len(entries) > maxEPUBItems {
+		entries = entries[:maxEPUBItems]
+	}
+	title += " " + time.Now().Format("2006-01-02")
+
+	var buf bytes.Buffer
+	if err := export.WriteEPUB(&buf, title, entries); err != nil {
+		return nil, err
+	}
+	return &epubBook{
+		title: title,
+		name:  export.FileName(model.Item{Title: title}, map[string]bool{}) + ".epub",
+		items: len(entries),
+		data:  buf.Bytes(),
+	}, nil
+}
+
+// kindleJob is the payload of a job mailing an EPUB to the Kindle address.
+type kindleJob struct {
+	FolderID *int64 `json:"folder_id,omitempty"` // nil for the starred items
+}
+
+// kindleResult is the outcome of a Kindle job.
+type kindleResult struct {
+	Items int    `json:"items"` // 0 if there was nothing to send
+	Sent  string `json:"sent,omitempty"`
+}
+
+// sendToKindle mails the EPUB export to the Kindle address, in a job.
+func (s *Server) sendToKindle(w http.ResponseWriter, r *http.Request, folderID *int64) {
+	if s.mailer == nil {
+		http.Error(w, mailer.ErrNotConfigured.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if to, _ := s.db.GetSetting(r.Context(), model.SettingKindleEmail); to == "" {
+		http.Error(w, "No Kindle address configured", http.StatusBadRequest)
+		return
+	}
+	job, err := s.runJob(r, jobSendKindle, kindleJob{FolderID: folderID}, nil)
+	var res kindleResult
+	if err := jobOutcome(job, err, &res); err != nil {
+		http.Error(w, fmt.Sprintf("Send error: %v", err), http.StatusBadGateway)
+		return
+	}
+	if res.Items == 0 {
+		http.Error(w, "No items to export", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"items":  res.Items,
+		"sent":   res.Sent,
+	})
+}
+
+// runSendKindleJob builds the EPUB export described by its payload and
+// mails it to the Kindle address. An interrupted job may mail the book
+// twice.
+func (s *Server) runSendKindleJob(ctx context.Context, j *jobs.Job) (interface{}, error) {
+	var p kindleJob
+	if err := j.Decode(&p); err != nil {
+		return nil, err
+	}
+	if s.mailer == nil {
+		return nil, mailer.ErrNotConfigured
+	}
+	to, _ := s.db.GetSetting(ctx, model.SettingKindleEmail)
+	if to == "" {
+		return nil, errors.New("no Kindle address configured")
+	}
+	book, err := s.buildEPUB(ctx, p.FolderID)
+	if err != nil || book == nil {
+		return kindleResult{}, err
+	}
+	err = s.mailer.Send(to, book.title, fmt.Sprintf("%d items from Infovore.", book.items), mailer.Attachment{
+		Name:        book.name,
+		ContentType: export.EPUBContentType,
+		Data:        book.data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return kindleResult{Items: book.items, Sent: to}, nil
+}
+
+// exportEntries loads the items matching filter with their feed titles and tags.
+func (s *Server) exportEntries(ctx context.Context, filter model.ItemFilter) ([]export.Entry, error) {
+	items, err := s.db.QueryItems(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	feeds, err := s.db.GetAllFeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	titles := make(map[int64]string, len(feeds))
+	for _, f := range feeds {
+		titles[f.ID] = f.Title
+	}
+
+	entries := make([]export.Entry, 0, len(items))
+	for _, item := range items {
+		tags, err := s.db.GetItemTags(ctx, item.ID)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, export.Entry{Item: item, FeedTitle: titles[item.FeedID], Tags: tags})
+	}
+	return entries, nil
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+	"github.com/bryan-buckman/infovore/internal/rss"
+)
+
+// feedErrorEntry is a failing feed in the JSON errors list.
+type feedErrorEntry struct {
+	ID              int64      `json:"id"`
+	Title           string     `json:"title"`
+	URL             string     `json:"url"`
+	Error           string     `json:"error"`
+	StatusCode      int        `json:"status_code,omitempty"` // 0 if there was no response
+	ErrorClass      string     `json:"error_class"`
+	ErrorStreak     int        `json:"error_streak"`
+	SuggestedURL    string     `json:"suggested_url,omitempty"`
+	LastAttemptedAt *time.Time `json:"last_attempted_at"` // nil if never fetched
+	LastSuccessAt   *time.Time `json:"last_success_at"`   // nil if never fetched successfully
+}
+
+// handleFeedErrors lists the feeds whose last fetch failed, stalest first:
+// feeds that never fetched successfully, then by the age of their last
+// successful fetch. The list can be narrowed to one error class (?class=) or
+// HTTP status (?status=); the counts per class are of all failing feeds.
+func (s *Server) handleFeedErrors(w http.ResponseWriter, r *http.Request) {
+	class := r.URL.Query().Get("class")
+	status := 0
+	if v := r.URL.Query().Get("status"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 100 || n > 599 {
+			http.Error(w, "Invalid status", http.StatusBadRequest)
+			return
+		}
+		status = n
+	}
+	feeds, err := s.db.GetAllFeeds(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to load feeds", http.StatusInternalServerError)
+		return
+	}
+
+	classes := make(map[string]int)
+	failing := feeds[:0]
+	for _, f := range feeds {
+		if f.LastError == "" {
+			continue
+		}
+		if f.LastErrorClass == "" {
+			f.LastErrorClass = model.FetchErrorOther // recorded before classes were
+		}
+		classes[f.LastErrorClass]++
+		if (class == "" || f.LastErrorClass == class) && (status == 0 || f.LastErrorStatus == status) {
+			failing = append(failing, f)
+		}
+	}
+	sort.SliceStable(failing, func(i, j int) bool {
+		a, b := failing[i], failing[j]
+		if !a.LastSuccess.Equal(b.LastSuccess) {
+			return a.LastSuccess.Before(b.LastSuccess) // zero sorts first
+		}
+		return a.ID < b.ID
+	})
+
+	list := make([]feedErrorEntry, 0, len(failing))
+	for _, f := range failing {
+		list = append(list, feedErrorEntry{
+			ID:              f.ID,
+			Title:           f.Title,
+			URL:             f.URL,
+			Error:           f.LastError,
+			StatusCode:      f.LastErrorStatus,
+			ErrorClass:      f.LastErrorClass,
+			ErrorStreak:     f.ErrorStreak,
+			SuggestedURL:    f.SuggestedURL,
+			LastAttemptedAt: optionalTime(f.LastAttempt),
+			LastSuccessAt:   optionalTime(f.LastSuccess),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"feeds":   list,
+		"classes": classes,
+	})
+}
+
+// handleApplySuggestedURL moves a feed to the URL rediscovery suggested for
+// it. The new URL is fetched on the next refresh.
+func (s *Server) handleApplySuggestedURL(w http.ResponseWriter, r *http.Request) {
+	feedID, err := urlID(r, "feedID")
+	if err != nil {
+		http.Error(w, "Invalid feed ID", http.StatusBadRequest)
+		return
+	}
+	feed, err := s.db.GetFeedByID(r.Context(), feedID)
+	if err != nil {
+		storeError(w, r, err, "Feed")
+		return
+	}
+	if feed.SuggestedURL == "" {
+		http.Error(w, "Feed has no suggested URL", http.StatusConflict)
+		return
+	}
+	if err := s.fetcher.MoveFeedURL(r.Context(), feedID, feed.SuggestedURL); err != nil {
+		if errors.Is(err, rss.ErrURLInUse) {
+			http.Error(w, "Another feed already has the suggested URL", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to update feed", http.StatusInternalServerError)
+		return
+	}
+	reqid.Logf(r.Context(), "Moved feed %d from %s to suggested %s", feedID, feed.URL, feed.SuggestedURL)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"url":    feed.SuggestedURL,
+	})
+}
+
+// handleDismissSuggestedURL discards the URL rediscovery suggested for a
+// feed.
+func (s *Server) handleDismissSuggestedURL(w http.ResponseWriter, r *http.Request) {
+	feedID, err := urlID(r, "feedID")
+	if err != nil {
+		http.Error(w, "Invalid feed ID", http.StatusBadRequest)
+		return
+	}
+	if err := s.db.SetFeedSuggestedURL(r.Context(), feedID, ""); err != nil {
+		http.Error(w, "Failed to update feed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok"})
+}
+
+// optionalTime returns nil for the zero time, so that it encodes as null.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
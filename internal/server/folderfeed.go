@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/bryan-buckman/infovore/internal/export"
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+	"github.com/go-chi/chi/v5"
+)
+
+// folderFeedItems is how many of a folder's newest items its Atom feed lists.
+const folderFeedItems = 50
+
+// folderFeedPath returns the path of the Atom feed a token opens.
+func folderFeedPath(token string) string {
+	return "/atom/" + token
+}
+
+// folderTokens returns the secret tokens stored in the setting key, mapping
+// each token to the ID of the folder it opens.
+func (s *Server) folderTokens(ctx context.Context, key string) map[string]int64 {
+	tokens := make(map[string]int64)
+	if val, err := s.db.GetSetting(ctx, key); err == nil && val != "" {
+		json.Unmarshal([]byte(val), &tokens)
+	}
+	return tokens
+}
+
+// folderToken returns the token of a folder in the setting key, or "" if
+// the folder has none.
+func (s *Server) folderToken(ctx context.Context, key string, folderID int64) string {
+	for token, id := range s.folderTokens(ctx, key) {
+		if id == folderID {
+			return token
+		}
+	}
+	return ""
+}
+
+// setFolderToken gives a folder a new random token in the setting key,
+// replacing the one it had, or with enabled false takes it away. Tokens of
+// folders that no longer exist are dropped. It returns the new token.
+func (s *Server) setFolderToken(ctx context.Context, key string, folderID int64, enabled bool) (string, error) {
+	folders, err := s.db.GetFolders(ctx)
+	if err != nil {
+		return "", err
+	}
+	exists := make(map[int64]bool, len(folders))
+	for _, f := range folders {
+		exists[f.ID] = true
+	}
+	tokens := make(map[string]int64)
+	for token, id := range s.folderTokens(ctx, key) {
+		if exists[id] && id != folderID {
+			tokens[token] = id
+		}
+	}
+	var token string
+	if enabled {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		token = hex.EncodeToString(b)
+		tokens[token] = folderID
+	}
+	data, _ := json.Marshal(tokens)
+	return token, s.db.SetSetting(ctx, key, string(data))
+}
+
+// handleGetFolderFeed tells whether a folder has an Atom feed, and where.
+func (s *Server) handleGetFolderFeed(w http.ResponseWriter, r *http.Request) {
+	folderID, err := urlID(r, "folderID")
+	if err != nil {
+		http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.db.GetFolderByID(r.Context(), folderID); err != nil {
+		storeError(w, r, err, "Folder")
+		return
+	}
+	resp := map[string]interface{}{"enabled": false}
+	if token := s.folderToken(r.Context(), model.SettingFolderFeedTokens, folderID); token != "" {
+		resp = map[string]interface{}{"enabled": true, "path": folderFeedPath(token)}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleSetFolderFeed gives a folder an Atom feed at a new secret URL,
+// replacing the one it had, or with {"enabled": false} takes it away.
+// Anyone holding the URL can read the folder's items, so rotating the token
+// is how access is revoked.
+func (s *Server) handleSetFolderFeed(w http.ResponseWriter, r *http.Request) {
+	folderID, err := urlID(r, "folderID")
+	if err != nil {
+		http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	folder, err := s.db.GetFolderByID(r.Context(), folderID)
+	if err != nil {
+		storeError(w, r, err, "Folder")
+		return
+	}
+	token, err := s.setFolderToken(r.Context(), model.SettingFolderFeedTokens, folderID, req.Enabled)
+	if err != nil {
+		http.Error(w, "Failed to save", http.StatusInternalServerError)
+		return
+	}
+	action := "revoked"
+	if req.Enabled {
+		action = "new URL"
+	}
+	s.audit(r, model.AuditFolderFeed, fmt.Sprintf("folder %d (%s): %s", folderID, folder.Name, action))
+
+	resp := map[string]interface{}{"status": "ok", "enabled": req.Enabled}
+	if req.Enabled {
+		resp["path"] = folderFeedPath(token)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleFolderFeed serves the Atom feed of the folder a token opens: the
+// newest items of its feeds. Unknown tokens get the same 404 as any missing
+// page.
+func (s *Server) handleFolderFeed(w http.ResponseWriter, r *http.Request) {
+	folderID, ok := s.folderTokens(r.Context(), model.SettingFolderFeedTokens)[chi.URLParam(r, "token")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	folder, err := s.db.GetFolderByID(r.Context(), folderID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	entries, err := s.exportEntries(r.Context(), model.ItemFilter{FolderID: &folderID, Limit: folderFeedItems})
+	if err != nil {
+		http.Error(w, "Failed to load items", http.StatusInternalServerError)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	self := scheme + "://" + r.Host + r.URL.Path
+	w.Header().Set("Content-Type", export.AtomContentType)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	if err := export.WriteAtom(w, folder.Name, self, entries); err != nil {
+		reqid.Logf(r.Context(), "Folder feed %d: %v", folderID, err)
+	}
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// itemsQuery returns the query string selecting the items of filter from
+// /partials/items or /api/items. view names the smart view the filter was
+// made from, if any.
+func itemsQuery(filter model.ItemFilter, view string) string {
+	q := url.Values{}
+	if view != "" {
+		q.Set("view", view)
+	}
+	if filter.FeedID != nil {
+		q.Set("feed_id", strconv.FormatInt(*filter.FeedID, 10))
+	}
+	if filter.FolderID != nil {
+		q.Set("folder_id", strconv.FormatInt(*filter.FolderID, 10))
+	}
+	if filter.Tag != "" {
+		q.Set("tag", filter.Tag)
+	}
+	if filter.FeedLabel != "" {
+		q.Set("label", filter.FeedLabel)
+	}
+	if filter.Author != "" {
+		q.Set("author", filter.Author)
+	}
+	if filter.Domain != "" {
+		q.Set("domain", filter.Domain)
+	}
+	if filter.OnlyUnread {
+		q.Set("unread", "1")
+	}
+	if filter.MinWords > 0 {
+		q.Set("min_words", strconv.Itoa(filter.MinWords))
+	}
+	if filter.MaxWords > 0 {
+		q.Set("max_words", strconv.Itoa(filter.MaxWords))
+	}
+	if filter.Sort != "" {
+		q.Set("sort", filter.Sort)
+	}
+	if filter.Sort == model.SortRandom {
+		q.Set("seed", strconv.FormatInt(filter.Seed, 10))
+	}
+	return q.Encode()
+}
+
+// handleItemsFragment renders the item list selected by the parameters of
+// /api/items as an HTML fragment, to replace the contents of a page's item
+// container. Unlike /api/items, all items are listed unless ?limit= is
+// given.
+func (s *Server) handleItemsFragment(w http.ResponseWriter, r *http.Request) {
+	filter, ok := s.listFilter(w, r)
+	if !ok {
+		return
+	}
+	items, err := s.db.QueryItems(r.Context(), filter)
+	if err != nil {
+		storeError(w, r, err, "Items")
+		return
+	}
+	s.useSnippets(r.Context(), items)
+	s.prepareContent(r.Context(), items)
+	s.render(w, r, "item-list", map[string]interface{}{
+		"Items": items,
+	})
+}
+
+// handleItemFragment renders one item as an HTML fragment.
+func (s *Server) handleItemFragment(w http.ResponseWriter, r *http.Request) {
+	itemID, err := urlID(r, "itemID")
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+	item, err := s.db.GetItemByID(r.Context(), itemID)
+	if err != nil {
+		storeError(w, r, err, "Item")
+		return
+	}
+	items := []model.Item{*item}
+	s.prepareContent(r.Context(), items)
+	s.render(w, r, "item", items[0])
+}
+
+// handleSidebarFragment renders the sidebar navigation as an HTML fragment.
+// ?feed_id=, ?folder_id=, ?tag=, ?label= and ?view= mark the current page.
+func (s *Server) handleSidebarFragment(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	data := map[string]interface{}{}
+	feedID, err := queryID(q, "feed_id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if feedID != nil {
+		data["CurrentFeedID"] = *feedID
+	}
+	folderID, err := queryID(q, "folder_id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if folderID != nil {
+		data["CurrentFolderID"] = *folderID
+	}
+	if tag := strings.TrimSpace(q.Get("tag")); tag != "" {
+		data["CurrentTag"] = tag
+	}
+	if label := strings.TrimSpace(q.Get("label")); label != "" {
+		data["CurrentLabel"] = label
+	}
+	if view := q.Get("view"); view != "" {
+		if _, ok := viewTitles[view]; !ok {
+			http.Error(w, "Unknown view", http.StatusBadRequest)
+			return
+		}
+		data["CurrentView"] = view
+	}
+	if err := s.addSidebar(r.Context(), data); err != nil {
+		storeError(w, r, err, "Sidebar")
+		return
+	}
+	s.render(w, r, "sidebar-nav", data)
+}
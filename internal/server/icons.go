@@ -0,0 +1,162 @@
+package server
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// Custom feed icon limits.
+const (
+	maxIconSize  = 256 << 10
+	maxIconRunes = 10 // room for emoji sequences such as flags and families
+)
+
+// iconTypes are the image types accepted as feed icons, as sniffed from the
+// upload. SVG is left out since it can carry scripts.
+var iconTypes = map[string]bool{
+	"image/png":    true,
+	"image/jpeg":   true,
+	"image/gif":    true,
+	"image/webp":   true,
+	"image/x-icon": true,
+}
+
+// handleFeedIcon serves a feed's icon: the uploaded image if there is one,
+// otherwise a redirect to the icon detected from the feed.
+func (s *Server) handleFeedIcon(w http.ResponseWriter, r *http.Request) {
+	feedID, err := urlID(r, "feedID")
+	if err != nil {
+		http.Error(w, "Invalid feed ID", http.StatusBadRequest)
+		return
+	}
+	feed, err := s.db.GetFeedByID(r.Context(), feedID)
+	if err != nil {
+		storeError(w, r, err, "Feed")
+		return
+	}
+	icon, err := s.db.GetFeedIcon(r.Context(), feedID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		storeError(w, r, err, "Icon")
+		return
+	}
+	if icon != nil && icon.ContentType != "" {
+		w.Header().Set("Content-Type", icon.ContentType)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		http.ServeContent(w, r, "", icon.UpdatedAt, bytes.NewReader(icon.Data))
+		return
+	}
+	if feed.IconURL == "" {
+		http.Error(w, "Feed has no icon", http.StatusNotFound)
+		return
+	}
+	http.Redirect(w, r, feed.IconURL, http.StatusFound)
+}
+
+// handleSetFeedIcon sets the icon of a feed: an emoji given as JSON
+// ({"emoji": "🦀"}), or an image uploaded as the "icon" field of a
+// multipart form.
+func (s *Server) handleSetFeedIcon(w http.ResponseWriter, r *http.Request) {
+	feedID, err := urlID(r, "feedID")
+	if err != nil {
+		http.Error(w, "Invalid feed ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.db.GetFeedByID(r.Context(), feedID); err != nil {
+		storeError(w, r, err, "Feed")
+		return
+	}
+
+	icon := model.FeedIcon{FeedID: feedID, UpdatedAt: time.Now()}
+	r.Body = http.MaxBytesReader(w, r.Body, maxIconSize+64<<10) // room for the form around the file
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var req struct {
+			Emoji string `json:"emoji"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		icon.Emoji = strings.TrimSpace(req.Emoji)
+		if err := validateIconEmoji(icon.Emoji); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		file, _, err := r.FormFile("icon")
+		if err != nil {
+			http.Error(w, "No emoji or image provided", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		icon.Data, err = io.ReadAll(io.LimitReader(file, maxIconSize+1))
+		if err != nil {
+			http.Error(w, "Failed to read image", http.StatusBadRequest)
+			return
+		}
+		if len(icon.Data) > maxIconSize {
+			http.Error(w, "Image exceeds 256 KB", http.StatusRequestEntityTooLarge)
+			return
+		}
+		icon.ContentType = http.DetectContentType(icon.Data)
+		if !iconTypes[icon.ContentType] {
+			http.Error(w, "Image must be PNG, JPEG, GIF, WebP or ICO", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := s.db.SetFeedIcon(r.Context(), icon); err != nil {
+		http.Error(w, "Failed to save icon", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      "ok",
+		"emoji":       icon.Emoji,
+		"custom_icon": icon.ContentType != "",
+	})
+}
+
+// handleDeleteFeedIcon reverts a feed to its detected icon.
+func (s *Server) handleDeleteFeedIcon(w http.ResponseWriter, r *http.Request) {
+	feedID, err := urlID(r, "feedID")
+	if err != nil {
+		http.Error(w, "Invalid feed ID", http.StatusBadRequest)
+		return
+	}
+	if err := s.db.DeleteFeedIcon(r.Context(), feedID); err != nil {
+		http.Error(w, "Failed to reset icon", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+	})
+}
+
+// validateIconEmoji checks that an emoji label is short and printable. Any
+// short label is accepted, not just emoji.
+func validateIconEmoji(emoji string) error {
+	if emoji == "" {
+		return errors.New("Emoji is required")
+	}
+	if utf8.RuneCountInString(emoji) > maxIconRunes {
+		return errors.New("Emoji is too long")
+	}
+	for _, r := range emoji {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return errors.New("Emoji must not contain spaces or control characters")
+		}
+	}
+	return nil
+}
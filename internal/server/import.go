@@ -0,0 +1,258 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/feedurl"
+	"github.com/bryan-buckman/infovore/internal/jobs"
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/opml"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+)
+
+// OPML import limits.
+const (
+	maxOPMLPayload = 10 << 20
+	// importProgressEvery is how many feeds pass between progress events.
+	importProgressEvery = 25
+	// importResolveWorkers is how many new feeds are checked for
+	// redirects at once.
+	importResolveWorkers = 8
+)
+
+// importReport is the outcome of an OPML import.
+type importReport struct {
+	Status   string               `json:"status"`
+	Imported int                  `json:"imported"`
+	Exists   int                  `json:"exists"`
+	Invalid  int                  `json:"invalid"`
+	Total    int                  `json:"total"`
+	Results  []model.ImportResult `json:"results"`
+}
+
+// handleImportOPML subscribes to every feed of an uploaded OPML file in one
+// transaction and reports the outcome of each entry. The import runs as a
+// job, so it completes even if the client goes away or the server restarts.
+// Clients sending "Accept: text/event-stream" get "progress" events
+// ({"done", "total"}) while the import runs, then an "end" event with the
+// report or an "error" event with a message.
+func (s *Server) handleImportOPML(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxOPMLPayload)
+	file, _, err := r.FormFile("opml")
+	if err != nil {
+		http.Error(w, "No file provided", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	entries, err := opml.Parse(file)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to parse OPML: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var watch func(job model.Job)
+	stream := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	flusher, _ := w.(http.Flusher)
+	if stream && flusher != nil {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		watch = func(job model.Job) {
+			if job.State == model.JobRunning && job.Done > 0 && (job.Done%importProgressEvery == 0 || job.Done == job.Total) {
+				writeEvent(w, "progress", map[string]int{"done": job.Done, "total": job.Total})
+				flusher.Flush()
+			}
+		}
+	} else {
+		stream = false
+	}
+
+	job, err := s.runJob(r, jobImportOPML, entries, watch)
+	if r.Context().Err() != nil {
+		return // the client left; the job carries on
+	}
+	var report importReport
+	if err := jobOutcome(job, err, &report); err != nil {
+		reqid.Logf(r.Context(), "OPML import failed: %v", err)
+		if stream {
+			writeEvent(w, "error", map[string]string{"error": "Import failed, no feeds were imported"})
+			flusher.Flush()
+			return
+		}
+		http.Error(w, "Import failed, no feeds were imported", http.StatusInternalServerError)
+		return
+	}
+
+	// Note: We no longer auto-fetch after import to avoid 403 errors.
+	// Users should click the Refresh button manually.
+	s.audit(r, model.AuditImportOPML, fmt.Sprintf("%d of %d feeds imported", report.Imported, report.Total))
+
+	if stream {
+		writeEvent(w, "end", report)
+		flusher.Flush()
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// runImportOPMLJob imports the OPML entries of its payload. Importing them
+// again after an interruption is harmless, since feeds already subscribed
+// to are left alone.
+func (s *Server) runImportOPMLJob(ctx context.Context, j *jobs.Job) (interface{}, error) {
+	var entries []opml.FeedEntry
+	if err := j.Decode(&entries); err != nil {
+		return nil, err
+	}
+	existing, err := s.db.GetAllFeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.importFeeds(ctx, entries, existing, func(done int) {
+		j.Progress(done, len(entries))
+	})
+}
+
+// importFeeds imports OPML entries with a single Store batch. URLs are
+// normalized like in addFeed; entries matching an existing feed or an
+// earlier entry are reported as existing without touching the database, and
+// entries without an http(s) URL as invalid. So are entries that redirect
+// to an existing feed or to where an earlier entry leads, which are the same
+// feed under another URL. progress counts all entries.
+func (s *Server) importFeeds(ctx context.Context, entries []opml.FeedEntry, existing []model.Feed, progress func(done int)) (*importReport, error) {
+	upgrade := database.GetIntSetting(ctx, s.db, model.SettingUpgradeFeedsToHTTPS, 0) != 0
+	known := make(map[string]int64, len(existing)) // feed ID by URL key
+	for _, f := range existing {
+		known[feedurl.Key(f.URL)] = f.ID
+	}
+
+	results := make([]model.ImportResult, len(entries))
+	var pending []int         // result index of each entry not known yet
+	first := map[string]int{} // result index of the first entry per new URL key
+	dupes := map[int]int{}    // result index of a repeat -> of its first entry
+	for i, e := range entries {
+		res := model.ImportResult{URL: e.URL, Title: e.Title}
+		u, err := url.Parse(strings.TrimSpace(e.URL))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			res.Status, res.Error = model.ImportInvalid, "not an http(s) URL"
+			results[i] = res
+			continue
+		}
+		feedURL := feedurl.Normalize(strings.TrimSpace(e.URL), upgrade)
+		key := feedurl.Key(feedURL)
+		res.URL, res.Status = feedURL, model.ImportExists
+		if res.Title == "" {
+			res.Title = feedURL
+		}
+		if id, ok := known[key]; ok {
+			res.FeedID = id
+		} else if j, ok := first[key]; ok {
+			dupes[i] = j
+		} else {
+			first[key] = i
+			pending = append(pending, i)
+		}
+		results[i] = res
+	}
+
+	var batch []model.ImportFeed
+	var batchAt []int // result index of each batch entry
+	resolved := s.resolveImports(ctx, results, pending)
+	for k, i := range pending {
+		key := feedurl.Key(results[i].URL)
+		if resolved[k] != "" {
+			key = feedurl.Key(resolved[k])
+		}
+		if id, ok := known[key]; ok {
+			results[i].FeedID, results[i].ResolvedURL = id, resolved[k]
+		} else if j, ok := first[key]; ok && j != i {
+			dupes[i] = j
+			results[i].ResolvedURL = resolved[k]
+		} else {
+			first[key] = i
+			batch = append(batch, model.ImportFeed{FolderPath: entries[i].FolderPath, Title: results[i].Title, URL: results[i].URL})
+			batchAt = append(batchAt, i)
+		}
+	}
+
+	// Entries settled above count as done before the batch starts.
+	settled := len(entries) - len(batch)
+	var batchProgress func(done int)
+	if progress != nil {
+		batchProgress = func(done int) { progress(settled + done) }
+		if settled > 0 {
+			progress(settled)
+		}
+	}
+	added, err := s.db.ImportFeeds(ctx, batch, batchProgress)
+	if err != nil {
+		return nil, err
+	}
+	for k, res := range added {
+		results[batchAt[k]] = res
+	}
+	for i, j := range dupes {
+		// An entry repeated may itself have turned out to be a repeat.
+		for n := 0; n < len(dupes); n++ {
+			next, ok := dupes[j]
+			if !ok {
+				break
+			}
+			j = next
+		}
+		results[i].FeedID = results[j].FeedID
+	}
+
+	report := &importReport{Status: "ok", Total: len(entries), Results: results}
+	for _, res := range results {
+		switch res.Status {
+		case model.ImportAdded:
+			report.Imported++
+		case model.ImportExists:
+			report.Exists++
+		case model.ImportInvalid:
+			report.Invalid++
+		}
+	}
+	return report, nil
+}
+
+// resolveImports follows the redirects of the pending import entries and
+// returns where each one leads, or "" if it doesn't redirect elsewhere or
+// can't be reached.
+func (s *Server) resolveImports(ctx context.Context, results []model.ImportResult, pending []int) []string {
+	resolved := make([]string, len(pending))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(importResolveWorkers, len(pending)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range work {
+				feedURL := results[pending[k]].URL
+				final, err := s.fetcher.Resolve(ctx, feedURL)
+				if err != nil {
+					reqid.Logf(ctx, "OPML import: resolving %s: %v", feedURL, err)
+					continue
+				}
+				if feedurl.Key(final) != feedurl.Key(feedURL) {
+					resolved[k] = final
+				}
+			}
+		}()
+	}
+	for k := range pending {
+		work <- k
+	}
+	close(work)
+	wg.Wait()
+	return resolved
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/cluster"
+	"github.com/bryan-buckman/infovore/internal/newsletter"
+	"github.com/go-chi/chi/v5"
+	"github.com/mmcdole/gofeed"
+)
+
+// maxInboxPayload bounds the size of a pushed item.
+const maxInboxPayload = 1 << 20
+
+// inboxItem is the JSON body accepted by POST /api/inbox/{token}.
+type inboxItem struct {
+	Title       string     `json:"title"`
+	Link        string     `json:"link"`
+	Content     string     `json:"content"`
+	GUID        string     `json:"guid"`
+	PublishedAt *time.Time `json:"published_at"`
+}
+
+// githubRelease is the subset of a GitHub "release" webhook payload we use.
+type githubRelease struct {
+	Action  string `json:"action"`
+	Release struct {
+		Name        string     `json:"name"`
+		TagName     string     `json:"tag_name"`
+		HTMLURL     string     `json:"html_url"`
+		Body        string     `json:"body"`
+		PublishedAt *time.Time `json:"published_at"`
+	} `json:"release"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+func (s *Server) handleCreateInbox(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Title    string `json:"title"`
+		FolderID *int64 `json:"folder_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		http.Error(w, "Title is required", http.StatusBadRequest)
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	feedID, err := s.db.CreateInboxFeed(r.Context(), req.FolderID, title, token)
+	if err != nil {
+		http.Error(w, "Failed to create inbox", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "ok",
+		"feed_id":  feedID,
+		"token":    token,
+		"push_url": "/api/inbox/" + token,
+	})
+}
+
+func (s *Server) handleInboxPush(w http.ResponseWriter, r *http.Request) {
+	feed, err := s.db.GetFeedByInboxToken(r.Context(), chi.URLParam(r, "token"))
+	if err != nil {
+		storeError(w, r, err, "Inbox")
+		return
+	}
+
+	var item *gofeed.Item
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxInboxPayload))
+	switch event := r.Header.Get("X-GitHub-Event"); event {
+	case "":
+		var req inboxItem
+		if err := dec.Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(req.Title) == "" && strings.TrimSpace(req.Link) == "" {
+			http.Error(w, "Title or link is required", http.StatusBadRequest)
+			return
+		}
+		item = &gofeed.Item{
+			Title:           strings.TrimSpace(req.Title),
+			Link:            strings.TrimSpace(req.Link),
+			Content:         req.Content,
+			GUID:            req.GUID,
+			PublishedParsed: req.PublishedAt,
+		}
+		if item.Title == "" {
+			item.Title = item.Link
+		}
+	case "release":
+		var req githubRelease
+		if err := dec.Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if req.Action == "published" {
+			item = githubReleaseItem(req)
+		}
+	default:
+		// Other GitHub events (including "ping") are acknowledged and ignored.
+	}
+
+	added := 0
+	if item != nil {
+		if item.GUID == "" {
+			item.GUID = item.Link
+		}
+		if item.GUID == "" {
+			item.GUID = fmt.Sprintf("inbox-%d", time.Now().UnixNano())
+		}
+		added = s.fetcher.IngestItems(r.Context(), *feed, []*gofeed.Item{item})
+		s.caches.Publish(cluster.EventItems)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "ok",
+		"new_items": added,
+	})
+}
+
+func (s *Server) handlePollNewsletters(w http.ResponseWriter, r *http.Request) {
+	if s.newsletter == nil {
+		http.Error(w, newsletter.ErrNotConfigured.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
+	defer cancel()
+
+	count, err := s.newsletter.Poll(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Poll error: %v", err), http.StatusBadGateway)
+		return
+	}
+	if count > 0 {
+		s.caches.Publish(cluster.EventItems)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "ok",
+		"new_items": count,
+	})
+}
+
+// githubReleaseItem converts a published GitHub release into an item.
+func githubReleaseItem(ev githubRelease) *gofeed.Item {
+	name := ev.Release.Name
+	if name == "" {
+		name = ev.Release.TagName
+	}
+	body := strings.ReplaceAll(html.EscapeString(ev.Release.Body), "\n", "<br>")
+	return &gofeed.Item{
+		Title:           fmt.Sprintf("%s %s", ev.Repository.FullName, name),
+		Link:            ev.Release.HTMLURL,
+		Content:         body,
+		GUID:            ev.Release.HTMLURL,
+		PublishedParsed: ev.Release.PublishedAt,
+	}
+}
+
+// newToken returns a random URL-safe token.
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,390 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/mmcdole/gofeed"
+)
+
+// savedLinksTitle is the title of the virtual feeds holding hand-added items.
+const savedLinksTitle = "Saved Links"
+
+// Item listing page sizes.
+const (
+	defaultItemsPage = 50
+	maxItemsPage     = 500
+)
+
+// listItem is an item as listed by GET /api/items.
+type listItem struct {
+	ID            int64             `json:"id"`
+	FeedID        int64             `json:"feed_id"`
+	GUID          string            `json:"guid"`
+	Title         string            `json:"title"`
+	RawTitle      string            `json:"raw_title,omitempty"`
+	Content       string            `json:"content"`
+	Snippet       string            `json:"snippet,omitempty"`
+	Summary       string            `json:"summary,omitempty"`
+	Note          string            `json:"note,omitempty"`
+	Link          string            `json:"link"`
+	Domain        string            `json:"domain,omitempty"`
+	AuthorName    string            `json:"author_name,omitempty"`
+	AuthorEmail   string            `json:"author_email,omitempty"`
+	PublishedAt   time.Time         `json:"published_at"`
+	FetchedAt     time.Time         `json:"fetched_at"`
+	IsRead        bool              `json:"is_read"`
+	Starred       bool              `json:"starred"`
+	Archived      bool              `json:"archived"`
+	WaybackURL    string            `json:"wayback_url,omitempty"`
+	LinkDead      bool              `json:"link_dead"`
+	WordCount     int               `json:"word_count"`
+	ReadingTime   int               `json:"reading_time"`
+	ReadPosition  float64           `json:"read_position"`
+	InterestScore float64           `json:"interest_score"`
+	EnclosureURL  string            `json:"enclosure_url,omitempty"`
+	EnclosureType string            `json:"enclosure_type,omitempty"`
+	Enclosures    []model.Enclosure `json:"enclosures"`
+	MediaStatus   string            `json:"media_status,omitempty"`
+	CommentsURL   string            `json:"comments_url,omitempty"`
+	CommentsFeed  string            `json:"comments_feed,omitempty"`
+}
+
+// newListItem converts an item for GET /api/items.
+func newListItem(it model.Item) listItem {
+	encs := it.Enclosures
+	if encs == nil {
+		encs = []model.Enclosure{}
+	}
+	return listItem{
+		ID:            it.ID,
+		FeedID:        it.FeedID,
+		GUID:          it.GUID,
+		Title:         it.Title,
+		RawTitle:      it.RawTitle,
+		Content:       it.Content,
+		Snippet:       it.Snippet,
+		Summary:       it.Summary,
+		Note:          it.Note,
+		Link:          it.Link,
+		Domain:        it.Domain,
+		AuthorName:    it.AuthorName,
+		AuthorEmail:   it.AuthorEmail,
+		PublishedAt:   it.PublishedAt,
+		FetchedAt:     it.FetchedAt,
+		IsRead:        it.IsRead,
+		Starred:       it.Starred,
+		Archived:      it.Archived,
+		WaybackURL:    it.WaybackURL,
+		LinkDead:      it.LinkDead,
+		WordCount:     it.WordCount,
+		ReadingTime:   it.ReadingTime,
+		ReadPosition:  it.ReadPosition,
+		InterestScore: it.InterestScore,
+		EnclosureURL:  it.EnclosureURL,
+		EnclosureType: it.EnclosureType,
+		Enclosures:    encs,
+		MediaStatus:   it.MediaStatus,
+		CommentsURL:   it.CommentsURL,
+		CommentsFeed:  it.CommentsFeed,
+	}
+}
+
+// handleListItems lists items as JSON, filtered like the pages: ?feed_id=,
+// ?folder_id=, ?tag=, ?view= (a smart view), ?read=, ?starred= and the
+// parameters shared by all listings (see itemFilterFromQuery). ?limit= and
+// ?offset= page through the results; has_more tells whether another page
+// follows.
+func (s *Server) handleListItems(w http.ResponseWriter, r *http.Request) {
+	filter, ok := s.listFilter(w, r)
+	if !ok {
+		return
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultItemsPage
+	}
+
+	limit := filter.Limit
+	filter.Limit++ // one more tells whether there is a next page
+	items, err := s.db.QueryItems(r.Context(), filter)
+	if err != nil {
+		http.Error(w, "Failed to load items", http.StatusInternalServerError)
+		return
+	}
+	hasMore := len(items) > limit
+	if hasMore {
+		items = items[:limit]
+	}
+	ids := make([]int64, len(items))
+	for n, it := range items {
+		ids[n] = it.ID
+	}
+	encs, err := s.db.GetItemEnclosures(r.Context(), ids)
+	if err != nil {
+		http.Error(w, "Failed to load items", http.StatusInternalServerError)
+		return
+	}
+	list := make([]listItem, 0, len(items))
+	for _, it := range items {
+		it.Enclosures = encs[it.ID]
+		list = append(list, newListItem(it))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items":    list,
+		"limit":    limit,
+		"offset":   filter.Offset,
+		"has_more": hasMore,
+	})
+}
+
+// handleMarkItemsRead marks the items of a listing older or newer than an
+// anchor item as read: ?older_than= or ?newer_than= names the anchor, and the
+// other parameters select the listing like in handleListItems.
+func (s *Server) handleMarkItemsRead(w http.ResponseWriter, r *http.Request) {
+	filter, ok := s.listFilter(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	older, err := queryID(q, "older_than")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	newer, err := queryID(q, "newer_than")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if (older == nil) == (newer == nil) {
+		http.Error(w, "Exactly one of older_than and newer_than is required", http.StatusBadRequest)
+		return
+	}
+	anchor := older
+	if older != nil {
+		filter.OlderThan = *older
+	} else {
+		anchor = newer
+		filter.NewerThan = *newer
+	}
+	if _, err := s.db.GetItemByID(r.Context(), *anchor); err != nil {
+		storeError(w, r, err, "Item")
+		return
+	}
+
+	marked, err := s.db.MarkReadByFilter(r.Context(), filter)
+	if err != nil {
+		http.Error(w, "Failed to mark read", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"marked": marked,
+	})
+}
+
+// listFilter reads the item filter of an item listing request, checking that
+// the feed and folder it names exist. If it fails, the error has been
+// written to w.
+func (s *Server) listFilter(w http.ResponseWriter, r *http.Request) (model.ItemFilter, bool) {
+	filter, err := listFilterFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return filter, false
+	}
+	if filter.FeedID != nil {
+		if _, err := s.db.GetFeedByID(r.Context(), *filter.FeedID); err != nil {
+			storeError(w, r, err, "Feed")
+			return filter, false
+		}
+	}
+	if filter.FolderID != nil {
+		if _, err := s.db.GetFolderByID(r.Context(), *filter.FolderID); err != nil {
+			storeError(w, r, err, "Folder")
+			return filter, false
+		}
+	}
+	s.holdBackDigest(r.Context(), &filter)
+	return filter, true
+}
+
+// listFilterFromQuery reads the filter parameters of item listings. Limit is
+// 0 unless ?limit= is given.
+func listFilterFromQuery(r *http.Request) (model.ItemFilter, error) {
+	filter, err := itemFilterFromQuery(r)
+	if err != nil {
+		return filter, err
+	}
+	q := r.URL.Query()
+	if v := q.Get("view"); v != "" {
+		view, ok := viewFilter(v, time.Now())
+		if !ok {
+			return filter, fmt.Errorf("unknown view %q", v)
+		}
+		filter.Since, filter.Until = view.Since, view.Until
+		filter.OnlyUnread = filter.OnlyUnread || view.OnlyUnread
+		filter.Starred = view.Starred
+	}
+	if filter.FeedID, err = queryID(q, "feed_id"); err != nil {
+		return filter, err
+	}
+	if filter.FolderID, err = queryID(q, "folder_id"); err != nil {
+		return filter, err
+	}
+	filter.Tag = strings.TrimSpace(q.Get("tag"))
+	filter.FeedLabel = strings.TrimSpace(q.Get("label"))
+
+	read, ok, err := queryBool(q, "read")
+	if err != nil {
+		return filter, err
+	}
+	if ok {
+		filter.OnlyRead = read
+		filter.OnlyUnread = filter.OnlyUnread || !read
+	}
+	if filter.OnlyRead && filter.OnlyUnread {
+		return filter, fmt.Errorf("read=1 contradicts unread=1")
+	}
+	starred, _, err := queryBool(q, "starred")
+	if err != nil {
+		return filter, err
+	}
+	filter.Starred = filter.Starred || starred
+
+	if filter.Limit, err = queryCount(q, "limit"); err != nil {
+		return filter, err
+	}
+	if filter.Limit > maxItemsPage {
+		filter.Limit = maxItemsPage
+	}
+	filter.Offset, err = queryCount(q, "offset")
+	return filter, err
+}
+
+func (s *Server) handleCreateItem(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL      string `json:"url"`
+		Title    string `json:"title"`
+		Content  string `json:"content"`
+		FeedID   *int64 `json:"feed_id"`
+		FolderID *int64 `json:"folder_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	link := strings.TrimSpace(req.URL)
+	if u, err := url.Parse(link); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "A valid http(s) URL is required", http.StatusBadRequest)
+		return
+	}
+
+	var feed *model.Feed
+	var err error
+	if req.FeedID != nil {
+		if feed, err = s.db.GetFeedByID(r.Context(), *req.FeedID); err != nil {
+			storeError(w, r, err, "Feed")
+			return
+		}
+	} else {
+		if req.FolderID != nil {
+			if _, err := s.db.GetFolderByID(r.Context(), *req.FolderID); err != nil {
+				storeError(w, r, err, "Folder")
+				return
+			}
+		}
+		if feed, err = s.savedLinksFeed(r.Context(), req.FolderID); err != nil {
+			http.Error(w, "Failed to create Saved Links feed", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		title = link
+	}
+	item, isNew, err := s.fetcher.IngestItem(r.Context(), *feed, &gofeed.Item{
+		Title:   title,
+		Link:    link,
+		Content: req.Content,
+		GUID:    link,
+	})
+	if err != nil {
+		http.Error(w, "Failed to add item", http.StatusInternalServerError)
+		return
+	}
+	if item == nil {
+		http.Error(w, "Item was dropped by a pipeline filter", http.StatusUnprocessableEntity)
+		return
+	}
+	if !isNew {
+		http.Error(w, "Item already exists in this feed", http.StatusConflict)
+		return
+	}
+	s.interest.Trigger()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"item_id": item.ID,
+		"feed_id": feed.ID,
+	})
+}
+
+func (s *Server) handleStarItem(w http.ResponseWriter, r *http.Request) {
+	itemID, err := urlID(r, "itemID")
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Starred bool `json:"starred"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	item, err := s.db.GetItemByID(r.Context(), itemID)
+	if err != nil {
+		storeError(w, r, err, "Item")
+		return
+	}
+	if err := s.db.SetItemStarred(r.Context(), itemID, req.Starred); err != nil {
+		http.Error(w, "Failed to save star", http.StatusInternalServerError)
+		return
+	}
+	if req.Starred && !item.Starred && item.Link != "" && item.WaybackURL == "" && waybackStarredEnabled(r.Context(), s.db) {
+		s.saveStarredToWayback(r.Context(), item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"starred": req.Starred,
+	})
+}
+
+// savedLinksFeed returns the virtual feed for hand-added items in a folder
+// (or unfiled when folderID is nil), creating it on first use.
+func (s *Server) savedLinksFeed(ctx context.Context, folderID *int64) (*model.Feed, error) {
+	key := "unfiled"
+	if folderID != nil {
+		key = strconv.FormatInt(*folderID, 10)
+	}
+	feedID, _, err := s.db.GetOrCreateFeed(ctx, folderID, savedLinksTitle, model.SavedURLPrefix+key)
+	if err != nil {
+		return nil, err
+	}
+	return s.db.GetFeedByID(ctx, feedID)
+}
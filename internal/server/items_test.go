@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// TestListItemsKeys checks that GET /api/items names item fields in
+// snake_case like the other JSON endpoints.
+func TestListItemsKeys(t *testing.T) {
+	ctx := context.Background()
+	db := database.NewMemory()
+	s, err := New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feedID, err := db.CreateFeed(ctx, nil, "Feed", "http://example.com/feed.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.AddItem(ctx, &model.Item{FeedID: feedID, GUID: "1", Title: "One",
+		Link: "http://example.com/1", PublishedAt: time.Now(), FetchedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	s.handleListItems(w, httptest.NewRequest("GET", "/api/items", nil))
+	if w.Code != 200 {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Items []map[string]interface{} `json:"items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Items) != 1 {
+		t.Fatalf("listed %d items, want 1", len(resp.Items))
+	}
+	item := resp.Items[0]
+	for _, key := range []string{"id", "feed_id", "guid", "title", "link", "published_at", "is_read", "starred", "enclosures"} {
+		if _, ok := item[key]; !ok {
+			t.Errorf("item has no %q key", key)
+		}
+	}
+	for key := range item {
+		if key != strings.ToLower(key) {
+			t.Errorf("item key %q is not snake_case", key)
+		}
+	}
+}
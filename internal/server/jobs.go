@@ -0,0 +1,147 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bryan-buckman/infovore/internal/jobs"
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// Kinds of jobs run by the job runner.
+const (
+	jobRefresh    = "refresh"
+	jobImportOPML = "import_opml"
+	jobDigest     = "digest"
+	jobArchive    = "archive"
+	jobWayback    = "wayback"
+	jobSendKindle = "send_kindle"
+)
+
+// maxListedJobs bounds /api/jobs.
+const maxListedJobs = 100
+
+// registerJobs sets the handlers of the job kinds.
+func (s *Server) registerJobs() {
+	s.jobs.Register(jobRefresh, s.runRefreshJob)
+	s.jobs.Register(jobImportOPML, s.runImportOPMLJob)
+	s.jobs.Register(jobDigest, s.runDigestJob)
+	s.jobs.Register(jobArchive, s.runArchiveJob)
+	s.jobs.Register(jobWayback, s.runWaybackJob)
+	s.jobs.Register(jobSendKindle, s.runSendKindleJob)
+}
+
+// jobJSON describes a job for the API, with its payload and result as
+// JSON values.
+func jobJSON(j model.Job) map[string]interface{} {
+	v := map[string]interface{}{
+		"id":         j.ID,
+		"kind":       j.Kind,
+		"state":      j.State,
+		"done":       j.Done,
+		"total":      j.Total,
+		"attempts":   j.Attempts,
+		"created_at": j.CreatedAt,
+		"updated_at": j.UpdatedAt,
+	}
+	if j.Payload != "" && j.Payload != "null" {
+		v["payload"] = json.RawMessage(j.Payload)
+	}
+	if j.Result != "" && j.Result != "null" {
+		v["result"] = json.RawMessage(j.Result)
+	}
+	if j.Error != "" {
+		v["error"] = j.Error
+	}
+	if !j.StartedAt.IsZero() {
+		v["started_at"] = j.StartedAt
+	}
+	if !j.FinishedAt.IsZero() {
+		v["finished_at"] = j.FinishedAt
+	}
+	return v
+}
+
+// handleListJobs lists the newest jobs.
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	list, err := s.db.GetJobs(r.Context(), maxListedJobs)
+	if err != nil {
+		http.Error(w, "Failed to load jobs", http.StatusInternalServerError)
+		return
+	}
+	out := make([]map[string]interface{}, len(list))
+	for i, j := range list {
+		out[i] = jobJSON(j)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobs": out,
+	})
+}
+
+// handleGetJob returns a job's state, progress and, once done, result.
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	jobID, err := urlID(r, "jobID")
+	if err != nil {
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+	job, err := s.db.GetJob(r.Context(), jobID)
+	if err != nil {
+		storeError(w, r, err, "Job")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobJSON(*job))
+}
+
+// handleCancelJob cancels a job running on this instance.
+func (s *Server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	jobID, err := urlID(r, "jobID")
+	if err != nil {
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+	if err := s.jobs.Cancel(jobID); err != nil {
+		if errors.Is(err, jobs.ErrNotRunning) {
+			http.Error(w, "Job is not running here", http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"job_id": jobID,
+	})
+}
+
+// runJob enqueues a job and waits for it on behalf of a request. The job
+// carries on if the client goes away, so the outcome can be looked up at
+// /api/jobs/{id}. watch is passed to the runner's Wait.
+func (s *Server) runJob(r *http.Request, kind string, payload interface{}, watch func(model.Job)) (*model.Job, error) {
+	jobID, err := s.jobs.Enqueue(r.Context(), kind, payload)
+	if err != nil {
+		return nil, err
+	}
+	return s.jobs.Wait(r.Context(), jobID, watch)
+}
+
+// jobOutcome takes what runJob returned. If the job couldn't be run or
+// didn't succeed it returns why; otherwise it decodes the job's result into
+// v, if not nil.
+func jobOutcome(job *model.Job, err error, v interface{}) error {
+	switch {
+	case err != nil:
+		return err
+	case job.State == model.JobCancelled:
+		return errors.New("cancelled")
+	case job.State != model.JobDone:
+		return errors.New(job.Error)
+	case v == nil:
+		return nil
+	}
+	return json.Unmarshal([]byte(job.Result), v)
+}
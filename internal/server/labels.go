@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+)
+
+// Bounds on the labels of one feed.
+const (
+	maxFeedLabels      = 20
+	maxFeedLabelLength = 50
+)
+
+// normalizeFeedLabels lowercases and trims labels, dropping empty and
+// duplicate ones. The error describes the first label that cannot be used.
+func normalizeFeedLabels(labels []string) ([]string, error) {
+	seen := make(map[string]bool)
+	out := []string{}
+	for _, l := range labels {
+		l = strings.ToLower(strings.TrimSpace(l))
+		if l == "" || seen[l] {
+			continue
+		}
+		if len(l) > maxFeedLabelLength {
+			return nil, fmt.Errorf("label %q exceeds %d characters", l, maxFeedLabelLength)
+		}
+		if strings.Contains(l, "/") {
+			return nil, fmt.Errorf("label %q contains a slash", l)
+		}
+		seen[l] = true
+		out = append(out, l)
+	}
+	if len(out) > maxFeedLabels {
+		return nil, fmt.Errorf("at most %d labels per feed", maxFeedLabels)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// handleSetFeedLabels replaces the labels of a feed.
+func (s *Server) handleSetFeedLabels(w http.ResponseWriter, r *http.Request) {
+	feedID, err := urlID(r, "feedID")
+	if err != nil {
+		http.Error(w, "Invalid feed ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Labels []string `json:"labels"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	labels, err := normalizeFeedLabels(req.Labels)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	feed, err := s.db.GetFeedByID(r.Context(), feedID)
+	if err != nil {
+		storeError(w, r, err, "Feed")
+		return
+	}
+	if err := s.db.SetFeedLabels(r.Context(), feedID, labels); err != nil {
+		reqid.Logf(r.Context(), "Set labels of feed %d: %v", feedID, err)
+		http.Error(w, "Failed to save labels", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, model.AuditUpdateSettings, fmt.Sprintf("feed %d (%s): labels %s", feedID, feed.Title, strings.Join(labels, ", ")))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"labels": labels,
+	})
+}
+
+// addFeedLabels sets the labels of feeds from a GetFeedLabels result.
+func addFeedLabels(feeds []model.Feed, labels map[int64][]string) {
+	for i := range feeds {
+		feeds[i].Labels = labels[feeds[i].ID]
+	}
+}
+
+// labelCounts returns the labels of a GetFeedLabels result by name, each
+// with the number of feeds carrying it.
+func labelCounts(labels map[int64][]string) []model.FeedLabel {
+	counts := make(map[string]int)
+	for _, names := range labels {
+		for _, name := range names {
+			counts[name]++
+		}
+	}
+	list := make([]model.FeedLabel, 0, len(counts))
+	for name, n := range counts {
+		list = append(list, model.FeedLabel{Name: name, FeedCount: n})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
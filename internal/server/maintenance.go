@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/bryan-buckman/infovore/internal/cluster"
+	"github.com/bryan-buckman/infovore/internal/maintenance"
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+)
+
+// handleMaintenance checks and compacts the database now.
+func (s *Server) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	report, err := maintenance.Run(r.Context(), s.db)
+	if err != nil {
+		reqid.Logf(r.Context(), "Maintenance failed: %v", err)
+		http.Error(w, "Maintenance failed", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, model.AuditMaintenance, maintenance.Summary(report))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"report": report,
+	})
+}
+
+// handleGetStorage reports how many items the database holds, by feed, and
+// the space they and the database take, largest first.
+func (s *Server) handleGetStorage(w http.ResponseWriter, r *http.Request) {
+	report, err := s.db.GetStorageReport(r.Context())
+	if err != nil {
+		reqid.Logf(r.Context(), "Storage report failed: %v", err)
+		http.Error(w, "Storage report failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"report": report,
+	})
+}
+
+// handleFindOrphans reports rows left behind by deleted ones without
+// changing anything.
+func (s *Server) handleFindOrphans(w http.ResponseWriter, r *http.Request) {
+	report, err := s.db.FindOrphans(r.Context())
+	if err != nil {
+		reqid.Logf(r.Context(), "Orphan check failed: %v", err)
+		http.Error(w, "Orphan check failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"report": report,
+	})
+}
+
+// handleFixOrphans removes rows left behind by deleted ones and reports
+// what changed.
+func (s *Server) handleFixOrphans(w http.ResponseWriter, r *http.Request) {
+	report, err := s.db.FixOrphans(r.Context())
+	if err != nil {
+		reqid.Logf(r.Context(), "Orphan fix failed: %v", err)
+		http.Error(w, "Orphan fix failed", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, model.AuditFixOrphans, fmt.Sprintf("%d folders, %d items, %d tag links, %d settings",
+		len(report.Folders), report.Items, report.TagLinks, len(report.Settings)))
+	if report.Items > 0 || report.TagLinks > 0 {
+		s.caches.Publish(cluster.EventItems)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"report": report,
+	})
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/media"
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// handleMedia serves a downloaded enclosure. Range requests are supported,
+// so players can stream and seek.
+func (s *Server) handleMedia(w http.ResponseWriter, r *http.Request) {
+	if s.media == nil {
+		http.Error(w, media.ErrNotConfigured.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	itemID, err := urlID(r, "itemID")
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+	m, err := s.db.GetItemMedia(r.Context(), itemID)
+	if err != nil {
+		storeError(w, r, err, "Media")
+		return
+	}
+	if m.Status != model.MediaDone {
+		http.Error(w, "Media not found", http.StatusNotFound)
+		return
+	}
+	http.ServeFile(w, r, s.media.Path(m))
+}
+
+// handleDownloadItemMedia queues an item's enclosure for download,
+// regardless of the feed's download_enclosures option.
+func (s *Server) handleDownloadItemMedia(w http.ResponseWriter, r *http.Request) {
+	if s.media == nil {
+		http.Error(w, media.ErrNotConfigured.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	itemID, err := urlID(r, "itemID")
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+	item, err := s.db.GetItemByID(r.Context(), itemID)
+	if err != nil {
+		storeError(w, r, err, "Item")
+		return
+	}
+	if item.EnclosureURL == "" {
+		http.Error(w, "Item has no enclosure", http.StatusBadRequest)
+		return
+	}
+
+	status := item.MediaStatus
+	if status != model.MediaDone {
+		status = model.MediaPending
+		if err := s.db.SetItemMedia(r.Context(), model.ItemMedia{ItemID: itemID, Status: status, UpdatedAt: time.Now()}); err != nil {
+			http.Error(w, "Failed to queue download", http.StatusInternalServerError)
+			return
+		}
+		s.media.Trigger()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":       "ok",
+		"media_status": status,
+	})
+}
+
+// triggerDownloads starts downloading newly queued enclosures, if enabled.
+func (s *Server) triggerDownloads() {
+	if s.media != nil {
+		s.media.Trigger()
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// Recent items limits for offline reading.
+const (
+	defaultRecentItems = 100
+	maxRecentItems     = 500
+)
+
+// recentItem is an item as returned by GET /api/items/recent.
+type recentItem struct {
+	ID          int64     `json:"id"`
+	FeedID      int64     `json:"feed_id"`
+	FeedTitle   string    `json:"feed_title"`
+	Title       string    `json:"title"`
+	Link        string    `json:"link"`
+	Content     string    `json:"content"`
+	Summary     string    `json:"summary,omitempty"`
+	ReadingTime int       `json:"reading_time"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// pwaFile serves a file of the embedded static/pwa directory from the site
+// root, where the service worker must live to control every page.
+func pwaFile(name, contentType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := staticFS.ReadFile("static/pwa/" + name)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(data)
+	}
+}
+
+// handleRecentItems returns the newest unread items for the service worker
+// to cache. ?limit= caps the count.
+func (s *Server) handleRecentItems(w http.ResponseWriter, r *http.Request) {
+	limit := defaultRecentItems
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	if limit > maxRecentItems {
+		limit = maxRecentItems
+	}
+
+	filter := model.ItemFilter{OnlyUnread: true, Limit: limit}
+	s.holdBackDigest(r.Context(), &filter)
+	items, err := s.db.QueryItems(r.Context(), filter)
+	if err != nil {
+		http.Error(w, "Failed to load items", http.StatusInternalServerError)
+		return
+	}
+	feeds, _ := s.db.GetAllFeeds(r.Context())
+	titles := make(map[int64]string, len(feeds))
+	for _, f := range feeds {
+		titles[f.ID] = f.Title
+	}
+
+	list := make([]recentItem, 0, len(items))
+	for _, it := range items {
+		list = append(list, recentItem{
+			ID:          it.ID,
+			FeedID:      it.FeedID,
+			FeedTitle:   titles[it.FeedID],
+			Title:       it.Title,
+			Link:        it.Link,
+			Content:     it.Content,
+			Summary:     it.Summary,
+			ReadingTime: it.ReadingTime,
+			PublishedAt: it.PublishedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items": list,
+	})
+}
@@ -0,0 +1,320 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/cluster"
+	"github.com/bryan-buckman/infovore/internal/jobs"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+	"github.com/bryan-buckman/infovore/internal/rss"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// refreshTimeout bounds a full refresh.
+	refreshTimeout = 5 * time.Minute
+	// refreshJobTTL is how long a finished refresh stays queryable.
+	refreshJobTTL = time.Hour
+)
+
+// Refresh job states.
+const (
+	refreshRunning   = "running"
+	refreshDone      = "done"
+	refreshFailed    = "failed"
+	refreshCancelled = "cancelled"
+)
+
+// refreshEvent reports one fetched feed.
+type refreshEvent struct {
+	FeedID   int64  `json:"feed_id"`
+	Title    string `json:"title"`
+	NewItems int    `json:"new_items"`
+	Error    string `json:"error,omitempty"`
+	Retrying bool   `json:"retrying,omitempty"` // the error was transient, the feed is fetched again later
+}
+
+// refreshStatus is a snapshot of a refresh job.
+type refreshStatus struct {
+	ID        string    `json:"id"`
+	State     string    `json:"state"` // one of the refresh* states
+	Error     string    `json:"error,omitempty"`
+	Total     int       `json:"total"` // feeds in the run, 0 until known
+	Done      int       `json:"done"`
+	Failed    int       `json:"failed"`
+	Retrying  int       `json:"retrying"` // feeds waiting to be fetched again
+	NewItems  int       `json:"new_items"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"` // zero while running
+}
+
+// refreshJobs tracks the full refreshes run by a server. At most one runs
+// at a time.
+type refreshJobs struct {
+	mu      sync.Mutex
+	jobs    map[string]*refreshJob // by ID, including recently finished ones
+	running *refreshJob            // nil if none
+}
+
+// refreshJob is a full refresh running in the background, as a job of the
+// job runner. Its events are only kept in memory.
+type refreshJob struct {
+	jobID   int64
+	mu      sync.Mutex
+	status  refreshStatus
+	events  []refreshEvent
+	changed chan struct{} // closed and replaced on every update
+}
+
+// update applies change to the job and wakes its watchers.
+func (j *refreshJob) update(change func(j *refreshJob)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	change(j)
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// since returns the events after the first n, a status snapshot and a
+// channel closed on the next update.
+func (j *refreshJob) since(n int) ([]refreshEvent, refreshStatus, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.events[n:], j.status, j.changed
+}
+
+// startRefresh starts a full refresh unless one is running, and returns
+// the running job. A new refresh takes the request ID carried by ctx.
+func (s *Server) startRefresh(ctx context.Context) (*refreshJob, error) {
+	s.refresh.mu.Lock()
+	defer s.refresh.mu.Unlock()
+	if s.refresh.running != nil {
+		return s.refresh.running, nil
+	}
+	jobID, err := s.jobs.Enqueue(ctx, jobRefresh, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.refresh.begin(jobID), nil
+}
+
+// begin records the refresh run by a job as the running one. The caller
+// holds r.mu.
+func (r *refreshJobs) begin(jobID int64) *refreshJob {
+	for id, j := range r.jobs {
+		if _, st, _ := j.since(0); st.State != refreshRunning && time.Since(st.EndedAt) > refreshJobTTL {
+			delete(r.jobs, id)
+		}
+	}
+	id := strconv.FormatInt(jobID, 10)
+	if job := r.jobs[id]; job != nil {
+		return job
+	}
+	job := &refreshJob{
+		jobID:   jobID,
+		status:  refreshStatus{ID: id, State: refreshRunning, StartedAt: time.Now()},
+		changed: make(chan struct{}),
+	}
+	if r.jobs == nil {
+		r.jobs = make(map[string]*refreshJob)
+	}
+	r.jobs[id] = job
+	r.running = job
+	return job
+}
+
+// cancelRefresh cancels the running refresh, if any, and returns it.
+func (s *Server) cancelRefresh() *refreshJob {
+	s.refresh.mu.Lock()
+	defer s.refresh.mu.Unlock()
+	job := s.refresh.running
+	if job != nil {
+		if err := s.jobs.Cancel(job.jobID); err != nil {
+			log.Printf("Refresh %d: %v", job.jobID, err)
+		}
+	}
+	return job
+}
+
+// runRefreshJob fetches every feed, recording progress in the refresh job
+// and in the job runner. A refresh interrupted by a restart starts over.
+func (s *Server) runRefreshJob(ctx context.Context, j *jobs.Job) (interface{}, error) {
+	s.refresh.mu.Lock()
+	job := s.refresh.jobs[strconv.FormatInt(j.ID, 10)]
+	if job == nil {
+		if s.refresh.running != nil {
+			s.refresh.mu.Unlock()
+			return nil, errors.New("another refresh is running")
+		}
+		job = s.refresh.begin(j.ID)
+	}
+	s.refresh.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, refreshTimeout)
+	defer cancel()
+
+	retried := make(map[int64]bool) // feeds reported as retrying
+	_, err := s.fetcher.FetchAllProgress(ctx, func(r rss.FetchResult, done, total int) {
+		job.update(func(j *refreshJob) {
+			ev := refreshEvent{FeedID: r.FeedID, Title: r.Title, NewItems: r.NewItems, Retrying: r.Retrying}
+			if r.Error != nil {
+				ev.Error = r.Error.Error()
+			}
+			if retried[r.FeedID] {
+				j.status.Retrying--
+			}
+			retried[r.FeedID] = r.Retrying
+			switch {
+			case r.Retrying:
+				j.status.Retrying++
+			case r.Error != nil && ctx.Err() == nil: // not merely interrupted
+				j.status.Failed++
+			}
+			j.events = append(j.events, ev)
+			j.status.Done = done
+			j.status.Total = total
+			j.status.NewItems += r.NewItems
+		})
+		j.Progress(done, total)
+	})
+	s.caches.Publish(cluster.EventItems)
+
+	s.refresh.mu.Lock()
+	s.refresh.running = nil
+	s.refresh.mu.Unlock()
+	job.update(func(j *refreshJob) {
+		switch {
+		case errors.Is(ctx.Err(), context.Canceled):
+			// Parallel fetches stop without reporting an error.
+			j.status.State = refreshCancelled
+		case err != nil:
+			j.status.State = refreshFailed
+			j.status.Error = err.Error()
+		case ctx.Err() != nil:
+			j.status.State = refreshFailed
+			j.status.Error = ctx.Err().Error()
+		default:
+			j.status.State = refreshDone
+		}
+		j.status.EndedAt = time.Now()
+	})
+	_, st, _ := job.since(0)
+	reqid.Logf(ctx, "Refresh %s %s: %d new items from %d/%d feeds", st.ID, st.State, st.NewItems, st.Done, st.Total)
+	if st.State == refreshFailed {
+		return st, errors.New(st.Error)
+	}
+	return st, nil
+}
+
+// handleRefresh starts a full refresh in the background and returns its
+// job ID. If a refresh is already running, its ID is returned instead.
+func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	job, err := s.startRefresh(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to start refresh", http.StatusInternalServerError)
+		return
+	}
+	_, st, _ := job.since(0)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     "ok",
+		"job_id":     st.ID,
+		"state":      st.State,
+		"events_url": "/api/refresh/" + st.ID + "/events",
+	})
+}
+
+// handleCancelRefresh cancels the running refresh. Feeds already fetched
+// keep their new items.
+func (s *Server) handleCancelRefresh(w http.ResponseWriter, r *http.Request) {
+	job := s.cancelRefresh()
+	if job == nil {
+		http.Error(w, "No refresh is running", http.StatusConflict)
+		return
+	}
+	_, st, _ := job.since(0)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"job_id": st.ID,
+	})
+}
+
+// refreshJobFromURL returns the job named in the URL, or nil.
+func (s *Server) refreshJobFromURL(r *http.Request) *refreshJob {
+	s.refresh.mu.Lock()
+	defer s.refresh.mu.Unlock()
+	return s.refresh.jobs[chi.URLParam(r, "jobID")]
+}
+
+// handleRefreshStatus returns a snapshot of a refresh job.
+func (s *Server) handleRefreshStatus(w http.ResponseWriter, r *http.Request) {
+	job := s.refreshJobFromURL(r)
+	if job == nil {
+		http.Error(w, "Refresh job not found", http.StatusNotFound)
+		return
+	}
+	_, st, _ := job.since(0)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
+// handleRefreshEvents streams a refresh job as server-sent events: a
+// "feed" event with a refreshEvent for every feed fetched (starting from
+// the first, however late the client connects), a "progress" event with
+// the status after each batch and a final "end" event with the status once
+// the job has finished.
+func (s *Server) handleRefreshEvents(w http.ResponseWriter, r *http.Request) {
+	job := s.refreshJobFromURL(r)
+	if job == nil {
+		http.Error(w, "Refresh job not found", http.StatusNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // disable proxy buffering
+
+	sent := 0
+	for {
+		events, st, changed := job.since(sent)
+		for _, ev := range events {
+			writeEvent(w, "feed", ev)
+		}
+		sent += len(events)
+		if st.State != refreshRunning {
+			writeEvent(w, "end", st)
+			flusher.Flush()
+			return
+		}
+		writeEvent(w, "progress", st)
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent writes one server-sent event with a JSON payload.
+func writeEvent(w http.ResponseWriter, name string, v interface{}) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+}
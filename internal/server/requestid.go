@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/bryan-buckman/infovore/internal/reqid"
+)
+
+// requestID gives every request an ID, the client's X-Request-ID if it is
+// usable or a new one otherwise. The ID is sent back in the response, shown
+// in the request log and carried by the request's context into the jobs and
+// fetches the request starts.
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(reqid.Header)
+		if !reqid.Valid(id) {
+			id = reqid.New()
+		}
+		ctx := reqid.With(r.Context(), id)
+		ctx = context.WithValue(ctx, middleware.RequestIDKey, id)
+		w.Header().Set(reqid.Header, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// errorRequestID ends plain-text error responses with the request ID, so
+// that an error reported from the UI can be matched with the log.
+func errorRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		if ww.Status() >= 400 && strings.HasPrefix(ww.Header().Get("Content-Type"), "text/plain") {
+			fmt.Fprintf(ww, "Request ID: %s\n", reqid.From(r.Context()))
+		}
+	})
+}
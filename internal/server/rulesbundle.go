@@ -0,0 +1,149 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/alerts"
+	"github.com/bryan-buckman/infovore/internal/classify"
+	"github.com/bryan-buckman/infovore/internal/cluster"
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+)
+
+// rulesBundleVersion is the format version of rules bundles.
+const rulesBundleVersion = 1
+
+// rulesBundle holds the rules tuned by hand: keyword alerts and the
+// classifier's keyword rules and topics. Unlike a settings bundle it is
+// merged into the rules of the instance importing it.
+type rulesBundle struct {
+	Version    int            `json:"version"`
+	ExportedAt time.Time      `json:"exported_at"`
+	Alerts     []alerts.Alert `json:"alerts"`
+	Rules      classify.Rules `json:"classifier_rules"`
+	Topics     []string       `json:"classifier_topics"`
+}
+
+// loadRules reads the alerts and classifier rules of this instance into a
+// bundle.
+func (s *Server) loadRules(r *http.Request) rulesBundle {
+	bundle := rulesBundle{Version: rulesBundleVersion, ExportedAt: time.Now().UTC(),
+		Alerts: alerts.Load(r.Context(), s.db), Rules: classify.Rules{}, Topics: []string{}}
+	if bundle.Alerts == nil {
+		bundle.Alerts = []alerts.Alert{}
+	}
+	if raw, err := s.db.GetSetting(r.Context(), model.SettingClassifierRules); err == nil && raw != "" {
+		json.Unmarshal([]byte(raw), &bundle.Rules)
+	}
+	if raw, err := s.db.GetSetting(r.Context(), model.SettingClassifierTopics); err == nil && raw != "" {
+		json.Unmarshal([]byte(raw), &bundle.Topics)
+	}
+	return bundle
+}
+
+// handleExportRules downloads the alerts and classifier rules as a bundle.
+func (s *Server) handleExportRules(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename=infovore-rules.json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(s.loadRules(r))
+}
+
+// handleImportRules merges a bundle made by handleExportRules into this
+// instance's rules. Alerts replace alerts of the same name and are added
+// otherwise, keywords are added to the classifier rule of their topic and
+// topics to the topic list. Nothing is removed.
+func (s *Server) handleImportRules(w http.ResponseWriter, r *http.Request) {
+	var bundle rulesBundle
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSettingsBundleSize)).Decode(&bundle); err != nil {
+		http.Error(w, "Invalid rules bundle", http.StatusBadRequest)
+		return
+	}
+	if bundle.Version != rulesBundleVersion {
+		http.Error(w, fmt.Sprintf("Unsupported rules bundle version %d", bundle.Version), http.StatusBadRequest)
+		return
+	}
+	imported, err := alerts.Validate(bundle.Alerts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	current := s.loadRules(r)
+	list, added, replaced := mergeAlerts(current.Alerts, imported)
+	rules := mergeClassifierRules(current.Rules, bundle.Rules)
+	topics := classify.NormalizeLabels(append(current.Topics, bundle.Topics...))
+
+	alertsJSON, _ := json.Marshal(list)
+	rulesJSON, _ := json.Marshal(rules)
+	topicsJSON, _ := json.Marshal(topics)
+	if err := s.db.SetSettings(r.Context(), map[string]string{
+		model.SettingAlerts:           string(alertsJSON),
+		model.SettingClassifierRules:  string(rulesJSON),
+		model.SettingClassifierTopics: string(topicsJSON),
+	}); err != nil {
+		reqid.Logf(r.Context(), "Rules import failed: %v", err)
+		http.Error(w, "Failed to save rules", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, model.AuditUpdateSettings, fmt.Sprintf("imported rules: %d alerts added, %d replaced", added, replaced))
+	s.caches.Publish(cluster.EventSettings)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":          "ok",
+		"alerts_added":    added,
+		"alerts_replaced": replaced,
+		"alerts":          len(list),
+		"rule_topics":     len(rules),
+		"topics":          len(topics),
+	})
+}
+
+// mergeAlerts adds imported alerts to current ones; an imported alert
+// replaces the current one of the same name, compared ignoring case.
+func mergeAlerts(current, imported []alerts.Alert) (list []alerts.Alert, added, replaced int) {
+	list = append(list, current...)
+	at := make(map[string]int, len(list))
+	for i, a := range list {
+		at[strings.ToLower(a.Name)] = i
+	}
+	for _, a := range imported {
+		if i, ok := at[strings.ToLower(a.Name)]; ok {
+			list[i] = a
+			replaced++
+			continue
+		}
+		at[strings.ToLower(a.Name)] = len(list)
+		list = append(list, a)
+		added++
+	}
+	return list, added, replaced
+}
+
+// mergeClassifierRules adds the imported keywords of each topic to the
+// current ones, skipping keywords the topic already has in any case.
+func mergeClassifierRules(current, imported classify.Rules) classify.Rules {
+	merged := make(classify.Rules, len(current)+len(imported))
+	for topic, keywords := range current {
+		merged[topic] = append([]string(nil), keywords...)
+	}
+	for topic, keywords := range imported {
+		have := make(map[string]bool)
+		for _, k := range merged[topic] {
+			have[strings.ToLower(strings.TrimSpace(k))] = true
+		}
+		for _, k := range keywords {
+			if key := strings.ToLower(strings.TrimSpace(k)); key != "" && !have[key] {
+				have[key] = true
+				merged[topic] = append(merged[topic], strings.TrimSpace(k))
+			}
+		}
+	}
+	return merged
+}
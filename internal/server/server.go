@@ -4,22 +4,48 @@ package server
 import (
 	"bufio"
 	"context"
+	"database/sql"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io/fs"
 	"log"
+	"math/rand"
 	"net/http"
+	"net/mail"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/bryan-buckman/infovore/internal/classify"
+	"github.com/bryan-buckman/infovore/internal/cluster"
 	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/dedupe"
+	"github.com/bryan-buckman/infovore/internal/digest"
+	"github.com/bryan-buckman/infovore/internal/export"
+	"github.com/bryan-buckman/infovore/internal/health"
+	"github.com/bryan-buckman/infovore/internal/interest"
+	"github.com/bryan-buckman/infovore/internal/jobs"
+	"github.com/bryan-buckman/infovore/internal/linkrot"
+	"github.com/bryan-buckman/infovore/internal/llm"
+	"github.com/bryan-buckman/infovore/internal/mailer"
+	"github.com/bryan-buckman/infovore/internal/maintenance"
+	"github.com/bryan-buckman/infovore/internal/media"
 	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/newsletter"
 	"github.com/bryan-buckman/infovore/internal/opml"
+	"github.com/bryan-buckman/infovore/internal/pipeline"
+	"github.com/bryan-buckman/infovore/internal/reqid"
 	"github.com/bryan-buckman/infovore/internal/rss"
+	"github.com/bryan-buckman/infovore/internal/textutil"
+	"github.com/bryan-buckman/infovore/internal/transform"
+	"github.com/bryan-buckman/infovore/internal/trash"
+	"github.com/bryan-buckman/infovore/internal/trending"
+	"github.com/bryan-buckman/infovore/internal/wayback"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
@@ -35,6 +61,21 @@ type Server struct {
 	db         database.Store
 	fetcher    *rss.Fetcher
 	poller     *rss.Poller
+	interest   *interest.Job
+	health     *health.Job
+	trending   *trending.Analyzer
+	trash      *trash.Job
+	maintain   *maintenance.Job
+	digest     *digest.Job
+	linkrot    *linkrot.Job
+	elector    *cluster.Elector
+	caches     *cluster.Invalidator
+	jobs       *jobs.Runner
+	refresh    refreshJobs
+	newsletter *newsletter.Poller // nil when no mailbox is configured
+	mailer     *mailer.Mailer     // nil when no SMTP server is configured
+	wayback    *wayback.Client
+	media      *media.Downloader // nil when no media directory is configured
 	router     chi.Router
 	httpServer *http.Server
 	templates  *template.Template
@@ -43,58 +84,204 @@ type Server struct {
 // New creates a new server.
 func New(db database.Store) (*Server, error) {
 	tmpl, err := template.New("").Funcs(template.FuncMap{
-		"timeAgo":  timeAgo,
-		"safeHTML": func(s string) template.HTML { return template.HTML(s) },
+		"timeAgo":   timeAgo,
+		"safeHTML":  func(s string) template.HTML { return template.HTML(s) },
+		"hasPrefix": strings.HasPrefix,
+		"join":      strings.Join,
 	}).ParseFS(templatesFS, "templates/*.html")
 	if err != nil {
 		return nil, fmt.Errorf("parse templates: %w", err)
 	}
 
+	fetcher := rss.NewFetcher(db)
+	mailbox, err := newsletter.NewFromEnv(db, fetcher)
+	if err != nil {
+		log.Printf("Newsletter ingestion disabled: %v", err)
+	}
+	smtp, err := mailer.NewFromEnv()
+	if err != nil {
+		log.Printf("Sending email disabled: %v", err)
+	}
+	downloader, err := media.NewFromEnv(db)
+	if err != nil {
+		log.Printf("Enclosure downloads disabled: %v", err)
+	}
+
 	s := &Server{
-		db:        db,
-		fetcher:   rss.NewFetcher(db),
-		poller:    rss.NewPoller(db),
-		templates: tmpl,
+		db:         db,
+		fetcher:    fetcher,
+		newsletter: mailbox,
+		mailer:     smtp,
+		wayback:    wayback.NewFromEnv(),
+		media:      downloader,
+		poller:     rss.NewPoller(db, fetcher),
+		interest:   interest.NewJob(db),
+		health:     health.NewJob(db),
+		trending:   trending.NewAnalyzer(db),
+		trash:      trash.NewJob(db),
+		maintain:   maintenance.NewJob(db),
+		digest:     digest.NewJob(db),
+		linkrot:    linkrot.NewJob(db),
+		jobs:       jobs.NewRunner(db),
+		templates:  tmpl,
 	}
+	s.registerJobs()
+	s.elector = cluster.NewElector(db, cluster.LeaderLock, s.startJobs, s.stopJobs)
+	s.caches = cluster.NewInvalidator(db, s.invalidate)
+	s.digest.Deliver = s.deliverDigest
 	s.setupRoutes()
 	return s, nil
 }
 
 func (s *Server) setupRoutes() {
 	r := chi.NewRouter()
+	r.Use(requestID)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Compress(5))
+	r.Use(errorRequestID)
 
 	// Serve static files.
 	staticSub, _ := fs.Sub(staticFS, "static")
 	r.Handle("/static/*", http.StripPrefix("/static/", http.FileServer(http.FS(staticSub))))
 
+	// Progressive web app: served from the root so the service worker's
+	// scope covers every page.
+	r.Get("/sw.js", pwaFile("sw.js", "text/javascript; charset=utf-8"))
+	r.Get("/manifest.webmanifest", pwaFile("manifest.webmanifest", "application/manifest+json"))
+	r.Get("/offline", pwaFile("offline.html", "text/html; charset=utf-8"))
+
+	// Folder Atom and iCalendar feeds, opened by a secret token instead of
+	// the UI.
+	r.Get("/atom/{token}", s.handleFolderFeed)
+	r.Get("/ical/{token}", s.handleFolderCalendar)
+
+	// Public blogroll of the published folders.
+	r.Get("/blogroll", s.handleBlogroll)
+	r.Get("/blogroll.opml", s.handleBlogrollOPML)
+
 	// Pages.
 	r.Get("/", s.handleHome)
 	r.Get("/feed/{feedID}", s.handleFeed)
 	r.Get("/folder/{folderID}", s.handleFolder)
+	r.Get("/tag/{tagName}", s.handleTag)
+	r.Get("/label/{label}", s.handleLabel)
+	r.Get("/author/{authorName}", s.handleAuthor)
+	r.Get("/domain/{domain}", s.handleDomain)
+	r.Get("/view/{view}", s.handleView)
+	r.Get("/archive/{itemID}", s.handleArchivePage)
+	r.Get("/media/{itemID}", s.handleMedia)
+	r.Get("/feed-icon/{feedID}", s.handleFeedIcon)
+
+	// Page fragments, for updating a page in place.
+	r.Get("/partials/items", s.handleItemsFragment)
+	r.Get("/partials/item/{itemID}", s.handleItemFragment)
+	r.Get("/partials/sidebar", s.handleSidebarFragment)
 
 	// API.
 	r.Route("/api", func(r chi.Router) {
 		r.Post("/mark-read", s.handleMarkRead)
+		r.Get("/items", s.handleListItems)
+		r.Post("/items", s.handleCreateItem)
+		r.Get("/items/recent", s.handleRecentItems)
+		r.Post("/items/mark-read", s.handleMarkItemsRead)
+		r.Post("/view/{view}/mark-read", s.handleMarkViewRead)
+		r.Put("/item/{itemID}/note", s.handleSetItemNote)
+		r.Put("/item/{itemID}/position", s.handleSetItemPosition)
+		r.Post("/item/{itemID}/summarize", s.handleSummarizeItem)
+		r.Post("/item/{itemID}/archive", s.handleArchiveItem)
+		r.Post("/item/{itemID}/wayback", s.handleWaybackItem)
+		r.Post("/item/{itemID}/download", s.handleDownloadItemMedia)
+		r.Post("/item/{itemID}/subscribe-comments", s.handleSubscribeComments)
+		r.Post("/item/{itemID}/open", s.handleOpenItem)
+		r.Put("/item/{itemID}/star", s.handleStarItem)
+		r.Post("/interest/retrain", s.handleRetrainInterest)
+		r.Get("/trending", s.handleTrending)
+		r.Get("/stats", s.handleStats)
+		r.Get("/notes", s.handleSearchNotes)
+		r.Get("/tags", s.handleGetTags)
+		r.Get("/authors", s.handleGetAuthors)
+		r.Get("/domains", s.handleGetDomains)
+		r.Get("/classifier", s.handleGetClassifier)
+		r.Post("/classifier", s.handleSaveClassifier)
+		r.Get("/alerts", s.handleGetAlerts)
+		r.Post("/alerts", s.handleSaveAlerts)
+		r.Get("/pipeline", s.handleGetPipeline)
+		r.Post("/pipeline/{stage}", s.handleSavePipelineStage)
 		r.Post("/delete-read", s.handleDeleteRead)
 		r.Post("/settings", s.handleSaveSettings)
 		r.Get("/settings", s.handleGetSettings)
+		r.Get("/settings/export", s.handleExportSettings)
+		r.Post("/settings/import", s.handleImportSettings)
+		r.Get("/rules/export", s.handleExportRules)
+		r.Post("/rules/import", s.handleImportRules)
+		r.Get("/domain-limits", s.handleGetDomainLimits)
+		r.Post("/domain-limits", s.handleSaveDomainLimits)
 		r.Post("/import-opml", s.handleImportOPML)
 		r.Get("/export-opml", s.handleExportOPML)
+		r.Get("/export/archive", s.handleExportArchive)
+		r.Get("/export/epub", s.handleExportEPUB)
+		r.Get("/export/dump", s.handleExportDump)
+		r.Post("/import/dump", s.handleImportDump)
+		r.Get("/jobs", s.handleListJobs)
+		r.Get("/jobs/{jobID}", s.handleGetJob)
+		r.Post("/jobs/{jobID}/cancel", s.handleCancelJob)
 		r.Post("/refresh", s.handleRefresh)
+		r.Post("/refresh/cancel", s.handleCancelRefresh)
+		r.Get("/refresh/{jobID}", s.handleRefreshStatus)
+		r.Get("/refresh/{jobID}/events", s.handleRefreshEvents)
 		r.Post("/refresh-feed/{feedID}", s.handleRefreshFeed)
 		r.Post("/refresh-folder/{folderID}", s.handleRefreshFolder)
 		r.Post("/cleanup", s.handleCleanup)
+		r.Get("/trash", s.handleGetTrash)
+		r.Post("/trash/feed/{feedID}/restore", s.handleRestoreFeed)
+		r.Post("/trash/items/restore", s.handleRestoreItems)
+		r.Post("/trash/purge", s.handlePurgeTrash)
 		r.Get("/sidebar", s.handleSidebar)
+		r.Post("/sidebar/order", s.handleSaveSidebarOrder)
+		r.Post("/folder/{folderID}/collapsed", s.handleSetFolderCollapsed)
+		r.Post("/folder/{folderID}/digest", s.handleSetFolderDigest)
+		r.Post("/folder/{folderID}/blogroll", s.handleSetFolderBlogroll)
+		r.Post("/folder/{folderID}/notify", s.handleSetFolderNotify)
+		r.Get("/folder/{folderID}/feed", s.handleGetFolderFeed)
+		r.Post("/folder/{folderID}/feed", s.handleSetFolderFeed)
+		r.Get("/folder/{folderID}/calendar", s.handleGetFolderCalendar)
+		r.Post("/folder/{folderID}/calendar", s.handleSetFolderCalendar)
+		r.Post("/digest", s.handleRunDigest)
 		r.Delete("/feed/{feedID}", s.handleDeleteFeed)
 		r.Delete("/folder/{folderID}", s.handleDeleteFolder)
 		r.Post("/feed/{feedID}/move", s.handleMoveFeed)
+		r.Post("/feed/{feedID}/refresh-metadata", s.handleRefreshFeedMetadata)
+		r.Post("/feed/{feedID}/debug-fetch", s.handleDebugFetch)
+		r.Get("/feed/{feedID}/settings", s.handleGetFeedSettings)
+		r.Post("/feed/{feedID}/settings", s.handleSaveFeedSettings)
+		r.Post("/feed/{feedID}/labels", s.handleSetFeedLabels)
+		r.Post("/feed/{feedID}/backfill", s.handleBackfillFeed)
+		r.Post("/feed/{feedID}/suggested-url", s.handleApplySuggestedURL)
+		r.Delete("/feed/{feedID}/suggested-url", s.handleDismissSuggestedURL)
+		r.Put("/feed/{feedID}/icon", s.handleSetFeedIcon)
+		r.Delete("/feed/{feedID}/icon", s.handleDeleteFeedIcon)
 		r.Post("/feed", s.handleAddFeed)
+		r.Post("/feeds/bulk-add", s.handleBulkAddFeeds)
+		r.Get("/feeds/errors", s.handleFeedErrors)
+		r.Get("/feeds/search", s.handleSearchFeeds)
 		r.Post("/folder", s.handleAddFolder)
 		r.Get("/database-settings", s.handleGetDatabaseSettings)
+		r.Post("/inbox", s.handleCreateInbox)
+		r.Post("/inbox/{token}", s.handleInboxPush)
+		r.Post("/newsletters/poll", s.handlePollNewsletters)
+		r.Get("/push/key", s.handleGetPushKey)
+		r.Post("/push/subscribe", s.handlePushSubscribe)
+		r.Post("/push/unsubscribe", s.handlePushUnsubscribe)
+		r.Post("/push/test", s.handlePushTest)
 		r.Post("/database-settings", s.handleSaveDatabaseSettings)
+		r.Get("/admin/audit", s.handleGetAuditLog)
+		r.Post("/admin/maintenance", s.handleMaintenance)
+		r.Get("/admin/duplicates", s.handleFindDuplicates)
+		r.Post("/admin/duplicates", s.handleMergeDuplicates)
+		r.Get("/admin/storage", s.handleGetStorage)
+		r.Get("/admin/orphans", s.handleFindOrphans)
+		r.Post("/admin/orphans", s.handleFixOrphans)
 	})
 
 	s.router = r
@@ -106,8 +293,8 @@ func (s *Server) Start(addr string) error {
 		Addr:    addr,
 		Handler: s.router,
 	}
-	// Note: Poller is NOT started automatically to avoid 403 errors from aggressive polling.
-	// Users should use the manual Refresh button instead.
+	s.caches.Start()
+	s.elector.Start()
 	log.Printf("Server starting on %s", addr)
 	return s.httpServer.ListenAndServe()
 }
@@ -116,6 +303,9 @@ func (s *Server) Start(addr string) error {
 func (s *Server) Stop() {
 	log.Println("Stopping poller...")
 	s.poller.Stop()
+	s.cancelRefresh()
+	s.elector.Stop()
+	s.caches.Stop()
 
 	if s.httpServer != nil {
 		log.Println("Shutting down HTTP server...")
@@ -125,351 +315,1468 @@ func (s *Server) Stop() {
 			log.Printf("HTTP server shutdown error: %v", err)
 		}
 	}
-	log.Println("Shutdown complete")
+	log.Println("Shutdown complete")
+}
+
+// --- Page Handlers ---
+
+func (s *Server) handleHome(w http.ResponseWriter, r *http.Request) {
+	filter, err := itemFilterFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.renderItems(w, r, filter, map[string]interface{}{
+		"PageTitle": "All Items",
+	})
+}
+
+func (s *Server) handleFeed(w http.ResponseWriter, r *http.Request) {
+	feedID, err := urlID(r, "feedID")
+	if err != nil {
+		http.Error(w, "Invalid feed ID", http.StatusBadRequest)
+		return
+	}
+	filter, err := itemFilterFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	feed, err := s.db.GetFeedByID(r.Context(), feedID)
+	if err != nil {
+		storeError(w, r, err, "Feed")
+		return
+	}
+	labels, err := s.db.GetFeedLabels(r.Context())
+	if err != nil {
+		storeError(w, r, err, "Feed labels")
+		return
+	}
+
+	filter.FeedID = &feedID
+	s.renderItems(w, r, filter, map[string]interface{}{
+		"CurrentFeedID":   feedID,
+		"FeedLabels":      labels[feedID],
+		"PageTitle":       feed.Title,
+		"FeedError":       feed.LastError,
+		"FeedErrorStatus": feed.LastErrorStatus,
+		"FeedErrorClass":  feed.LastErrorClass,
+		"SuggestedURL":    feed.SuggestedURL,
+		"FeedNotes":       feed.Notes,
+		"SiteURL":         feed.SiteURL,
+		"FeedDescription": feed.Description,
+	})
+}
+
+func (s *Server) handleFolder(w http.ResponseWriter, r *http.Request) {
+	folderID, err := urlID(r, "folderID")
+	if err != nil {
+		http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+	filter, err := itemFilterFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	folder, err := s.db.GetFolderByID(r.Context(), folderID)
+	if err != nil {
+		storeError(w, r, err, "Folder")
+		return
+	}
+
+	filter.FolderID = &folderID
+	s.renderItems(w, r, filter, map[string]interface{}{
+		"CurrentFolderID": folderID,
+		"PageTitle":       folder.Name,
+	})
+}
+
+func (s *Server) handleTag(w http.ResponseWriter, r *http.Request) {
+	tagName := chi.URLParam(r, "tagName")
+	filter, err := itemFilterFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter.Tag = tagName
+	s.renderItems(w, r, filter, map[string]interface{}{
+		"CurrentTag": tagName,
+		"PageTitle":  "🏷️ " + tagName,
+	})
+}
+
+// handleLabel lists the items of the feeds carrying a label.
+func (s *Server) handleLabel(w http.ResponseWriter, r *http.Request) {
+	label := chi.URLParam(r, "label")
+	filter, err := itemFilterFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter.FeedLabel = label
+	s.renderItems(w, r, filter, map[string]interface{}{
+		"CurrentLabel": label,
+		"PageTitle":    "🔖 " + label,
+	})
+}
+
+func (s *Server) handleAuthor(w http.ResponseWriter, r *http.Request) {
+	authorName := chi.URLParam(r, "authorName")
+	filter, err := itemFilterFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter.Author = authorName
+	s.renderItems(w, r, filter, map[string]interface{}{
+		"CurrentAuthor": authorName,
+		"PageTitle":     "✍️ " + authorName,
+	})
+}
+
+// handleDomain lists the items of every feed that link to a site.
+func (s *Server) handleDomain(w http.ResponseWriter, r *http.Request) {
+	domain := model.LinkDomain("//" + chi.URLParam(r, "domain"))
+	if domain == "" {
+		http.NotFound(w, r)
+		return
+	}
+	filter, err := itemFilterFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter.Domain = domain
+	s.renderItems(w, r, filter, map[string]interface{}{
+		"CurrentDomain": domain,
+		"PageTitle":     "🌐 " + domain,
+	})
+}
+
+// renderItems renders the item list page for filter. data holds the
+// page-specific fields; the sidebar, items and settings are added here.
+func (s *Server) renderItems(w http.ResponseWriter, r *http.Request, filter model.ItemFilter, data map[string]interface{}) {
+	s.holdBackDigest(r.Context(), &filter)
+	if err := s.addSidebar(r.Context(), data); err != nil {
+		storeError(w, r, err, "Sidebar")
+		return
+	}
+	items, err := s.db.QueryItems(r.Context(), filter)
+	if err != nil {
+		storeError(w, r, err, "Items")
+		return
+	}
+	s.useSnippets(r.Context(), items)
+	s.prepareContent(r.Context(), items)
+	interval, err := s.db.GetPollingInterval(r.Context())
+	if err != nil {
+		storeError(w, r, err, "Settings")
+		return
+	}
+
+	view, _ := data["CurrentView"].(string)
+	data["Items"] = items
+	data["ItemsQuery"] = itemsQuery(filter, view)
+	data["PollingInterval"] = interval
+	data["DatabaseType"] = s.db.DatabaseType()
+	s.render(w, r, "layout.html", data)
+}
+
+// addSidebar adds the contents of the sidebar to page data.
+func (s *Server) addSidebar(ctx context.Context, data map[string]interface{}) error {
+	foldersWithFeeds, err := s.sidebarFolders(ctx)
+	if err != nil {
+		return err
+	}
+	unfiledFeeds, err := s.db.GetUnfiledFeeds(ctx)
+	if err != nil {
+		return err
+	}
+	if s.hideEmptyFeeds(ctx) {
+		current, _ := data["CurrentFeedID"].(int64)
+		for i := range foldersWithFeeds {
+			foldersWithFeeds[i].Feeds = withUnread(foldersWithFeeds[i].Feeds, current)
+		}
+		unfiledFeeds = withUnread(unfiledFeeds, current)
+	}
+	tags, err := s.db.GetTags(ctx)
+	if err != nil {
+		return err
+	}
+	labels, err := s.db.GetFeedLabels(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range foldersWithFeeds {
+		addFeedLabels(foldersWithFeeds[i].Feeds, labels)
+	}
+	addFeedLabels(unfiledFeeds, labels)
+	data["FoldersWithFeeds"] = foldersWithFeeds
+	data["UnfiledFeeds"] = unfiledFeeds
+	data["Tags"] = tags
+	data["Labels"] = labelCounts(labels)
+	return nil
+}
+
+// --- API Handlers ---
+
+func (s *Server) handleMarkRead(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ItemIDs []int64 `json:"item_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := s.db.MarkItemsRead(r.Context(), req.ItemIDs); err != nil {
+		http.Error(w, "Failed to mark read", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// maxNoteLength bounds the size of a single item or feed note.
+const maxNoteLength = 10000
+
+func (s *Server) handleSetItemNote(w http.ResponseWriter, r *http.Request) {
+	itemID, err := urlID(r, "itemID")
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	note := strings.TrimSpace(req.Note)
+	if len(note) > maxNoteLength {
+		http.Error(w, fmt.Sprintf("Note exceeds %d characters", maxNoteLength), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := s.db.GetItemByID(r.Context(), itemID); err != nil {
+		storeError(w, r, err, "Item")
+		return
+	}
+	if err := s.db.SetItemNote(r.Context(), itemID, note); err != nil {
+		http.Error(w, "Failed to save note", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"note":   note,
+	})
+}
+
+// handleSetItemPosition records how far an item has been read, as a
+// percentage, so that reading can resume there on any device. It is called
+// often while reading, so it doesn't load the item.
+func (s *Server) handleSetItemPosition(w http.ResponseWriter, r *http.Request) {
+	itemID, err := urlID(r, "itemID")
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Position *float64 `json:"position"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Position == nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if *req.Position < 0 || *req.Position > 100 {
+		http.Error(w, "position must be between 0 and 100", http.StatusBadRequest)
+		return
+	}
+	if err := s.db.SetItemPosition(r.Context(), itemID, *req.Position); err != nil {
+		storeError(w, r, err, "Item")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "ok",
+		"position": *req.Position,
+	})
+}
+
+func (s *Server) handleSummarizeItem(w http.ResponseWriter, r *http.Request) {
+	itemID, err := urlID(r, "itemID")
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+
+	item, err := s.db.GetItemByID(r.Context(), itemID)
+	if err != nil {
+		storeError(w, r, err, "Item")
+		return
+	}
+
+	summary, err := s.fetcher.SummarizeItem(r.Context(), item)
+	if errors.Is(err, llm.ErrNotConfigured) {
+		http.Error(w, "Summarizer not configured", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Summarize error: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"summary": summary,
+	})
+}
+
+func (s *Server) handleOpenItem(w http.ResponseWriter, r *http.Request) {
+	itemID, err := urlID(r, "itemID")
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+	if err := s.db.MarkItemOpened(r.Context(), itemID); err != nil {
+		http.Error(w, "Failed to record open", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+func (s *Server) handleRetrainInterest(w http.ResponseWriter, r *http.Request) {
+	scored, err := interest.Retrain(r.Context(), s.db)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Retrain error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"scored": scored,
+	})
+}
+
+// maxTrendingHours bounds the trending window to one week.
+const maxTrendingHours = 168
+
+func (s *Server) handleTrending(w http.ResponseWriter, r *http.Request) {
+	hours := 24
+	if h, err := strconv.Atoi(r.URL.Query().Get("hours")); err == nil && h > 0 {
+		hours = h
+	}
+	if hours > maxTrendingHours {
+		hours = maxTrendingHours
+	}
+
+	report, err := s.trending.Report(r.Context(), time.Duration(hours)*time.Hour)
+	if err != nil {
+		http.Error(w, "Failed to compute trends", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func (s *Server) handleSearchNotes(w http.ResponseWriter, r *http.Request) {
+	items, err := s.db.SearchItemNotes(r.Context(), strings.TrimSpace(r.URL.Query().Get("q")))
+	if err != nil {
+		http.Error(w, "Failed to search notes", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items": items,
+	})
+}
+
+// feedSearchEntry is a feed in the JSON feed search results.
+type feedSearchEntry struct {
+	ID          int64  `json:"id"`
+	FolderID    *int64 `json:"folder_id"`
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	SiteURL     string `json:"site_url"`
+	Description string `json:"description"`
+	Notes       string `json:"notes"`
+}
+
+// handleSearchFeeds finds the feeds whose title, URL, description or notes
+// contain ?q=.
+func (s *Server) handleSearchFeeds(w http.ResponseWriter, r *http.Request) {
+	feeds, err := s.db.SearchFeeds(r.Context(), strings.TrimSpace(r.URL.Query().Get("q")))
+	if err != nil {
+		http.Error(w, "Failed to search feeds", http.StatusInternalServerError)
+		return
+	}
+	list := make([]feedSearchEntry, 0, len(feeds))
+	for _, f := range feeds {
+		list = append(list, feedSearchEntry{
+			ID:          f.ID,
+			FolderID:    f.FolderID,
+			Title:       f.Title,
+			URL:         f.URL,
+			SiteURL:     f.SiteURL,
+			Description: f.Description,
+			Notes:       f.Notes,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"feeds": list,
+	})
+}
+
+func (s *Server) handleGetTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := s.db.GetTags(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to load tags", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tags": tags,
+	})
+}
+
+// handleGetAuthors lists authors matching ?q=, most prolific first.
+func (s *Server) handleGetAuthors(w http.ResponseWriter, r *http.Request) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	authors, err := s.db.GetAuthors(r.Context(), strings.TrimSpace(r.URL.Query().Get("q")), limit)
+	if err != nil {
+		http.Error(w, "Failed to load authors", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"authors": authors,
+	})
+}
+
+// handleGetDomains lists the sites items link to matching ?q=, most linked
+// to first, with the number of items and feeds linking to each.
+func (s *Server) handleGetDomains(w http.ResponseWriter, r *http.Request) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	domains, err := s.db.GetDomains(r.Context(), strings.TrimSpace(r.URL.Query().Get("q")), limit)
+	if err != nil {
+		http.Error(w, "Failed to load domains", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"domains": domains,
+	})
+}
+
+func (s *Server) handleGetClassifier(w http.ResponseWriter, r *http.Request) {
+	backend, _ := s.db.GetSetting(r.Context(), model.SettingClassifierBackend)
+	var rules classify.Rules
+	if raw, err := s.db.GetSetting(r.Context(), model.SettingClassifierRules); err == nil && raw != "" {
+		json.Unmarshal([]byte(raw), &rules)
+	}
+	var topics []string
+	if raw, err := s.db.GetSetting(r.Context(), model.SettingClassifierTopics); err == nil && raw != "" {
+		json.Unmarshal([]byte(raw), &topics)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"backend": backend,
+		"rules":   rules,
+		"topics":  topics,
+	})
+}
+
+func (s *Server) handleSaveClassifier(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Backend string         `json:"backend"`
+		Rules   classify.Rules `json:"rules"`
+		Topics  []string       `json:"topics"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	switch req.Backend {
+	case classify.BackendNone, classify.BackendKeywords, classify.BackendLLM:
+	default:
+		http.Error(w, "Unknown classifier backend", http.StatusBadRequest)
+		return
+	}
+
+	rules, _ := json.Marshal(req.Rules)
+	topics, _ := json.Marshal(classify.NormalizeLabels(req.Topics))
+	for key, value := range map[string]string{
+		model.SettingClassifierBackend: req.Backend,
+		model.SettingClassifierRules:   string(rules),
+		model.SettingClassifierTopics:  string(topics),
+	} {
+		if err := s.db.SetSetting(r.Context(), key, value); err != nil {
+			http.Error(w, "Failed to save classifier settings", http.StatusInternalServerError)
+			return
+		}
+	}
+	s.audit(r, model.AuditUpdateSettings, "classifier")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+func (s *Server) handleGetPipeline(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"stages": pipeline.Stages(r.Context(), s.db),
+	})
+}
+
+func (s *Server) handleSavePipelineStage(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "stage")
+	if !pipeline.Registered(name) {
+		http.Error(w, "Unknown stage", http.StatusNotFound)
+		return
+	}
+
+	var req pipeline.StageConfig
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	cfg := pipeline.LoadConfig(r.Context(), s.db)
+	cfg[name] = req
+	if err := pipeline.SaveConfig(r.Context(), s.db, cfg); err != nil {
+		http.Error(w, "Failed to save pipeline settings", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, model.AuditUpdateSettings, "pipeline stage "+name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"stages": pipeline.Stages(r.Context(), s.db),
+	})
+}
+
+func (s *Server) handleSaveSettings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PollingInterval         int     `json:"polling_interval"`
+		ArchiveBackfillMaxPages *int    `json:"archive_backfill_max_pages"`
+		TrashRetentionDays      *int    `json:"trash_retention_days"`
+		UpgradeFeedsToHTTPS     *bool   `json:"upgrade_feeds_to_https"`
+		SidebarSort             *string `json:"sidebar_sort"`
+		SidebarFolderSort       *string `json:"sidebar_folder_sort"`
+		SidebarHideEmpty        *bool   `json:"sidebar_hide_empty"`
+		KindleEmail             *string `json:"kindle_email"`
+		WaybackStarred          *bool   `json:"wayback_starred"`
+		DomainMaxConcurrency    *int    `json:"domain_max_concurrency"`
+		DomainDelayMs           *int    `json:"domain_delay_ms"`
+		FetchWorkers            *int    `json:"fetch_workers"`
+		FetchTimeoutSeconds     *int    `json:"fetch_timeout_seconds"`
+		MaintenanceDays         *int    `json:"maintenance_days"`
+		LinkCheckDays           *int    `json:"link_check_days"`
+		DigestHour              *int    `json:"digest_hour"`
+		DedupeMode              *string `json:"dedupe_mode"`
+		DedupeWindowHours       *int    `json:"dedupe_window_hours"`
+		SnippetLength           *int    `json:"snippet_length"`
+		RediscoverAutoApply     *bool   `json:"rediscover_auto_apply"`
+		// KeyboardShortcuts replaces the stored keys of shortcut actions;
+		// actions left out get their default keys.
+		KeyboardShortcuts map[string]string `json:"keyboard_shortcuts"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	// Enforce minimum.
+	if req.PollingInterval < rss.MinPollingIntervalMinutes {
+		req.PollingInterval = rss.MinPollingIntervalMinutes
+	}
+	if err := s.db.SetSetting(r.Context(), model.SettingPollingInterval, strconv.Itoa(req.PollingInterval)); err != nil {
+		http.Error(w, "Failed to save", http.StatusInternalServerError)
+		return
+	}
+	if req.ArchiveBackfillMaxPages != nil {
+		if *req.ArchiveBackfillMaxPages < 0 {
+			http.Error(w, "archive_backfill_max_pages must not be negative", http.StatusBadRequest)
+			return
+		}
+		if err := s.db.SetSetting(r.Context(), model.SettingArchiveBackfillMaxPages, strconv.Itoa(*req.ArchiveBackfillMaxPages)); err != nil {
+			http.Error(w, "Failed to save", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.TrashRetentionDays != nil {
+		if *req.TrashRetentionDays < 0 {
+			http.Error(w, "trash_retention_days must not be negative", http.StatusBadRequest)
+			return
+		}
+		if err := s.db.SetSetting(r.Context(), model.SettingTrashRetentionDays, strconv.Itoa(*req.TrashRetentionDays)); err != nil {
+			http.Error(w, "Failed to save", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.UpgradeFeedsToHTTPS != nil {
+		val := "0"
+		if *req.UpgradeFeedsToHTTPS {
+			val = "1"
+		}
+		if err := s.db.SetSetting(r.Context(), model.SettingUpgradeFeedsToHTTPS, val); err != nil {
+			http.Error(w, "Failed to save", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.SidebarSort != nil {
+		switch *req.SidebarSort {
+		case model.SidebarSortName, model.SidebarSortManual, model.SidebarSortUnread, model.SidebarSortUpdated:
+		default:
+			http.Error(w, "Unknown sidebar_sort", http.StatusBadRequest)
+			return
+		}
+		if err := s.db.SetSetting(r.Context(), model.SettingSidebarSort, *req.SidebarSort); err != nil {
+			http.Error(w, "Failed to save", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.SidebarFolderSort != nil {
+		switch *req.SidebarFolderSort {
+		case "", model.SidebarSortName, model.SidebarSortManual, model.SidebarSortUnread, model.SidebarSortUpdated:
+		default:
+			http.Error(w, "Unknown sidebar_folder_sort", http.StatusBadRequest)
+			return
+		}
+		if err := s.db.SetSetting(r.Context(), model.SettingSidebarFolderSort, *req.SidebarFolderSort); err != nil {
+			http.Error(w, "Failed to save", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.SidebarHideEmpty != nil {
+		val := "0"
+		if *req.SidebarHideEmpty {
+			val = "1"
+		}
+		if err := s.db.SetSetting(r.Context(), model.SettingSidebarHideEmpty, val); err != nil {
+			http.Error(w, "Failed to save", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.KindleEmail != nil {
+		addr := strings.TrimSpace(*req.KindleEmail)
+		if addr != "" {
+			if _, err := mail.ParseAddress(addr); err != nil {
+				http.Error(w, "Invalid kindle_email", http.StatusBadRequest)
+				return
+			}
+		}
+		if err := s.db.SetSetting(r.Context(), model.SettingKindleEmail, addr); err != nil {
+			http.Error(w, "Failed to save", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.WaybackStarred != nil {
+		val := "0"
+		if *req.WaybackStarred {
+			val = "1"
+		}
+		if err := s.db.SetSetting(r.Context(), model.SettingWaybackStarred, val); err != nil {
+			http.Error(w, "Failed to save", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.DomainMaxConcurrency != nil || req.DomainDelayMs != nil {
+		limit := model.DomainLimit{MaxConcurrency: req.DomainMaxConcurrency, DelayMs: req.DomainDelayMs}
+		if err := rss.ValidateDomainLimit(limit); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if limit.MaxConcurrency != nil {
+			if err := s.db.SetSetting(r.Context(), model.SettingDomainMaxConcurrency, strconv.Itoa(*limit.MaxConcurrency)); err != nil {
+				http.Error(w, "Failed to save", http.StatusInternalServerError)
+				return
+			}
+		}
+		if limit.DelayMs != nil {
+			if err := s.db.SetSetting(r.Context(), model.SettingDomainDelayMs, strconv.Itoa(*limit.DelayMs)); err != nil {
+				http.Error(w, "Failed to save", http.StatusInternalServerError)
+				return
+			}
+		}
+		s.caches.Publish(cluster.EventSettings)
+	}
+	if req.FetchWorkers != nil {
+		if *req.FetchWorkers < 0 || *req.FetchWorkers > rss.MaxFetchWorkers {
+			http.Error(w, fmt.Sprintf("fetch_workers must be between 0 and %d", rss.MaxFetchWorkers), http.StatusBadRequest)
+			return
+		}
+		if err := s.db.SetSetting(r.Context(), model.SettingFetchWorkers, strconv.Itoa(*req.FetchWorkers)); err != nil {
+			http.Error(w, "Failed to save", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.FetchTimeoutSeconds != nil {
+		if *req.FetchTimeoutSeconds < 0 || *req.FetchTimeoutSeconds > rss.MaxFetchTimeoutSeconds {
+			http.Error(w, fmt.Sprintf("fetch_timeout_seconds must be between 0 and %d", rss.MaxFetchTimeoutSeconds), http.StatusBadRequest)
+			return
+		}
+		if err := s.db.SetSetting(r.Context(), model.SettingFetchTimeoutSeconds, strconv.Itoa(*req.FetchTimeoutSeconds)); err != nil {
+			http.Error(w, "Failed to save", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.FetchWorkers != nil || req.FetchTimeoutSeconds != nil {
+		s.caches.Publish(cluster.EventSettings)
+	}
+	if req.MaintenanceDays != nil {
+		if *req.MaintenanceDays < 0 {
+			http.Error(w, "maintenance_days must not be negative", http.StatusBadRequest)
+			return
+		}
+		if err := s.db.SetSetting(r.Context(), model.SettingMaintenanceDays, strconv.Itoa(*req.MaintenanceDays)); err != nil {
+			http.Error(w, "Failed to save", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.LinkCheckDays != nil {
+		if *req.LinkCheckDays < 0 {
+			http.Error(w, "link_check_days must not be negative", http.StatusBadRequest)
+			return
+		}
+		if err := s.db.SetSetting(r.Context(), model.SettingLinkCheckDays, strconv.Itoa(*req.LinkCheckDays)); err != nil {
+			http.Error(w, "Failed to save", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.DigestHour != nil {
+		if *req.DigestHour < 0 || *req.DigestHour > 23 {
+			http.Error(w, "digest_hour must be between 0 and 23", http.StatusBadRequest)
+			return
+		}
+		if err := s.db.SetSetting(r.Context(), model.SettingDigestHour, strconv.Itoa(*req.DigestHour)); err != nil {
+			http.Error(w, "Failed to save", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.DedupeMode != nil {
+		if !dedupe.ValidMode(*req.DedupeMode) {
+			http.Error(w, "Unknown dedupe_mode", http.StatusBadRequest)
+			return
+		}
+		if err := s.db.SetSetting(r.Context(), model.SettingDedupeMode, *req.DedupeMode); err != nil {
+			http.Error(w, "Failed to save", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.DedupeWindowHours != nil {
+		if *req.DedupeWindowHours < 0 {
+			http.Error(w, "dedupe_window_hours must not be negative", http.StatusBadRequest)
+			return
+		}
+		if err := s.db.SetSetting(r.Context(), model.SettingDedupeWindowHours, strconv.Itoa(*req.DedupeWindowHours)); err != nil {
+			http.Error(w, "Failed to save", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.SnippetLength != nil {
+		if *req.SnippetLength < 0 || *req.SnippetLength > textutil.MaxSnippetLength {
+			http.Error(w, fmt.Sprintf("snippet_length must be between 0 and %d", textutil.MaxSnippetLength), http.StatusBadRequest)
+			return
+		}
+		if err := s.db.SetSetting(r.Context(), model.SettingSnippetLength, strconv.Itoa(*req.SnippetLength)); err != nil {
+			http.Error(w, "Failed to save", http.StatusInternalServerError)
+			return
+		}
+		s.caches.Publish(cluster.EventSettings)
+	}
+	if req.RediscoverAutoApply != nil {
+		val := "0"
+		if *req.RediscoverAutoApply {
+			val = "1"
+		}
+		if err := s.db.SetSetting(r.Context(), model.SettingRediscoverAutoApply, val); err != nil {
+			http.Error(w, "Failed to save", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.KeyboardShortcuts != nil {
+		keys, err := validateShortcuts(req.KeyboardShortcuts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := json.Marshal(keys)
+		if err := s.db.SetSetting(r.Context(), model.SettingKeyboardShortcuts, string(data)); err != nil {
+			http.Error(w, "Failed to save", http.StatusInternalServerError)
+			return
+		}
+	}
+	s.audit(r, model.AuditUpdateSettings, "settings")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "polling_interval": req.PollingInterval})
+}
+
+func (s *Server) handleGetSettings(w http.ResponseWriter, r *http.Request) {
+	interval, _ := s.db.GetPollingInterval(r.Context())
+	kindleEmail, _ := s.db.GetSetting(r.Context(), model.SettingKindleEmail)
+	folderSort, _ := s.db.GetSetting(r.Context(), model.SettingSidebarFolderSort)
+	domainLimit, _ := rss.DomainLimits(r.Context(), s.db)
+	dedupePolicy := dedupe.PolicyFromSettings(r.Context(), s.db)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"polling_interval":           interval,
+		"archive_backfill_max_pages": database.GetIntSetting(r.Context(), s.db, model.SettingArchiveBackfillMaxPages, rss.DefaultArchiveBackfillMaxPages),
+		"trash_retention_days":       trash.RetentionDays(r.Context(), s.db),
+		"upgrade_feeds_to_https":     database.GetIntSetting(r.Context(), s.db, model.SettingUpgradeFeedsToHTTPS, 0) != 0,
+		"sidebar_sort":               sidebarSort(r.Context(), s.db),
+		"sidebar_folder_sort":        folderSort,
+		"sidebar_hide_empty":         s.hideEmptyFeeds(r.Context()),
+		"kindle_email":               kindleEmail,
+		"wayback_starred":            waybackStarredEnabled(r.Context(), s.db),
+		"domain_max_concurrency":     *domainLimit.MaxConcurrency,
+		"domain_delay_ms":            *domainLimit.DelayMs,
+		"fetch_workers":              database.GetIntSetting(r.Context(), s.db, model.SettingFetchWorkers, 0),
+		"fetch_timeout_seconds":      database.GetIntSetting(r.Context(), s.db, model.SettingFetchTimeoutSeconds, 0),
+		"maintenance_days":           database.GetIntSetting(r.Context(), s.db, model.SettingMaintenanceDays, 0),
+		"link_check_days":            linkrot.Days(r.Context(), s.db),
+		"digest_hour":                digest.Hour(r.Context(), s.db),
+		"dedupe_mode":                dedupePolicy.Mode,
+		"dedupe_window_hours":        int(dedupePolicy.Window / time.Hour),
+		"snippet_length":             snippetLength(r.Context(), s.db),
+		"keyboard_shortcuts":         keyboardShortcuts(r.Context(), s.db),
+		"rediscover_auto_apply":      database.GetIntSetting(r.Context(), s.db, model.SettingRediscoverAutoApply, 0) != 0,
+	})
+}
+
+func (s *Server) handleGetDomainLimits(w http.ResponseWriter, r *http.Request) {
+	_, overrides := rss.DomainLimits(r.Context(), s.db)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"domains": overrides,
+		"budgets": s.fetcher.DomainBudgets(),
+	})
+}
+
+// handleSaveDomainLimits replaces the per-domain rate limit overrides.
+func (s *Server) handleSaveDomainLimits(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Domains map[string]model.DomainLimit `json:"domains"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	domains := make(map[string]model.DomainLimit, len(req.Domains))
+	for domain, limit := range req.Domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain == "" || strings.ContainsAny(domain, "/: ") {
+			http.Error(w, "Invalid domain", http.StatusBadRequest)
+			return
+		}
+		if err := rss.ValidateDomainLimit(limit); err != nil {
+			http.Error(w, domain+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if limit.MaxConcurrency == nil && limit.DelayMs == nil {
+			continue
+		}
+		domains[domain] = limit
+	}
+
+	data, _ := json.Marshal(domains)
+	if err := s.db.SetSetting(r.Context(), model.SettingDomainLimits, string(data)); err != nil {
+		http.Error(w, "Failed to save domain limits", http.StatusInternalServerError)
+		return
+	}
+	s.caches.Publish(cluster.EventSettings)
+	s.audit(r, model.AuditUpdateSettings, "domain limits")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"domains": domains,
+	})
+}
+
+// sidebarSort returns the configured sidebar sort mode, defaulting to by name.
+func sidebarSort(ctx context.Context, db database.Store) string {
+	mode, err := db.GetSetting(ctx, model.SettingSidebarSort)
+	if err != nil || mode == "" {
+		return model.SidebarSortName
+	}
+	return mode
+}
+
+// maxCategoryTags bounds the item tags exported as categories per feed.
+const maxCategoryTags = 5
+
+// handleExportOPML exports the feeds as OPML, nested by folder. With
+// ?categories=1 each feed also gets a category attribute naming its folder
+// and the tags most used by its items, for readers that don't nest outlines.
+// With ?folder_id=N only that folder and its subfolders are exported, the
+// folder's own feeds at the top level.
+func (s *Server) handleExportOPML(w http.ResponseWriter, r *http.Request) {
+	rootID, err := queryID(r.URL.Query(), "folder_id")
+	if err != nil {
+		http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+	var root *model.Folder
+	if rootID != nil {
+		if root, err = s.db.GetFolderByID(r.Context(), *rootID); err != nil {
+			storeError(w, r, err, "Folder")
+			return
+		}
+	}
+
+	feeds, err := s.db.GetAllFeeds(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to get feeds", http.StatusInternalServerError)
+		return
+	}
+	var feedTags map[int64][]string
+	categories := r.URL.Query().Get("categories") == "1"
+	if categories {
+		if feedTags, err = s.db.GetFeedTags(r.Context(), maxCategoryTags); err != nil {
+			http.Error(w, "Failed to get tags", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	folders, err := s.db.GetFolders(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to get folders", http.StatusInternalServerError)
+		return
+	}
+	folderMap := make(map[int64]string)
+	for _, f := range folders {
+		folderMap[f.ID] = f.Name
+	}
+	var subtree map[int64]bool
+	if root != nil {
+		subtree = folderSubtree(folders, root.ID)
+		delete(folderMap, root.ID)
+	}
+
+	// Group feeds.
+	grouped := make(map[string][]opml.FeedEntry)
+	for _, feed := range feeds {
+		if feed.IsVirtual() {
+			continue // nothing another reader could subscribe to
+		}
+		if subtree != nil && (feed.FolderID == nil || !subtree[*feed.FolderID]) {
+			continue
+		}
+		entry := opml.FeedEntry{
+			Title:   feed.Title,
+			URL:     feed.URL,
+			HTMLURL: feed.SiteURL,
+		}
+		if feed.FolderID != nil {
+			if name, ok := folderMap[*feed.FolderID]; ok {
+				entry.FolderPath = []string{name}
+			}
+		}
+		if categories {
+			if len(entry.FolderPath) > 0 {
+				entry.Categories = append(entry.Categories, "/"+strings.Join(entry.FolderPath, "/"))
+			}
+			for _, tag := range feedTags[feed.ID] {
+				// Commas separate categories; a leading slash marks a folder.
+				if tag = strings.TrimLeft(strings.ReplaceAll(tag, ",", " "), "/"); tag != "" {
+					entry.Categories = append(entry.Categories, tag)
+				}
+			}
+		}
+		key := strings.Join(entry.FolderPath, "/")
+		grouped[key] = append(grouped[key], entry)
+	}
+
+	title, name := "Infovore Feeds", "infovore-feeds.opml"
+	if root != nil {
+		title = "Infovore Feeds: " + root.Name
+		name = export.FileName(model.Item{Title: "infovore-" + root.Name}, map[string]bool{}) + ".opml"
+	}
+	data, err := opml.Export(title, grouped)
+	if err != nil {
+		http.Error(w, "Failed to export", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Disposition", "attachment; filename="+name)
+	w.Write(data)
+}
+
+// folderSubtree returns the IDs of a folder and all the folders nested in it.
+func folderSubtree(folders []model.Folder, rootID int64) map[int64]bool {
+	children := make(map[int64][]int64)
+	for _, f := range folders {
+		if f.ParentID != nil {
+			children[*f.ParentID] = append(children[*f.ParentID], f.ID)
+		}
+	}
+	subtree := map[int64]bool{rootID: true}
+	queue := []int64{rootID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, child := range children[id] {
+			if !subtree[child] {
+				subtree[child] = true
+				queue = append(queue, child)
+			}
+		}
+	}
+	return subtree
+}
+
+func (s *Server) handleCleanup(w http.ResponseWriter, r *http.Request) {
+	deleted, err := s.db.CleanupReadItems(r.Context())
+	if err != nil {
+		http.Error(w, "Cleanup failed", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, model.AuditCleanup, fmt.Sprintf("%d read items", deleted))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"deleted": deleted,
+	})
+}
+
+func (s *Server) handleSidebar(w http.ResponseWriter, r *http.Request) {
+	folders, err := s.db.GetFolders(r.Context())
+	if err != nil {
+		storeError(w, r, err, "Folders")
+		return
+	}
+	feeds, err := s.db.GetAllFeeds(r.Context())
+	if err != nil {
+		storeError(w, r, err, "Feeds")
+		return
+	}
+	state := s.collapsedFolders(r.Context())
+	collapsed := []int64{}
+	for _, f := range folders {
+		if state[f.ID] {
+			collapsed = append(collapsed, f.ID)
+		}
+	}
+	held := s.digestFolders(r.Context())
+	digestFolders := []int64{}
+	for _, f := range folders {
+		if held[f.ID] {
+			digestFolders = append(digestFolders, f.ID)
+		}
+	}
+	hideEmpty := s.hideEmptyFeeds(r.Context())
+	if hideEmpty {
+		feeds = withUnread(feeds, 0)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"folders":           folders,
+		"feeds":             feeds,
+		"collapsed_folders": collapsed,
+		"digest_folders":    digestFolders,
+		"hide_empty":        hideEmpty,
+	})
 }
 
-// --- Page Handlers ---
-
-func (s *Server) handleHome(w http.ResponseWriter, r *http.Request) {
-	foldersWithFeeds, _ := s.db.GetFoldersWithFeeds()
-	unfiledFeeds, _ := s.db.GetUnfiledFeeds()
-	items, _ := s.db.GetAllItems(false)
-	interval, _ := s.db.GetPollingInterval()
-
-	data := map[string]interface{}{
-		"FoldersWithFeeds": foldersWithFeeds,
-		"UnfiledFeeds":     unfiledFeeds,
-		"Items":            items,
-		"PollingInterval":  interval,
-		"PageTitle":        "All Items",
-		"DatabaseType":     s.db.DatabaseType(),
+func (s *Server) handleSetFolderCollapsed(w http.ResponseWriter, r *http.Request) {
+	folderID, err := urlID(r, "folderID")
+	if err != nil {
+		http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Collapsed bool `json:"collapsed"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	folders, err := s.db.GetFolders(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to load folders", http.StatusInternalServerError)
+		return
 	}
-	s.render(w, "layout.html", data)
-}
 
-func (s *Server) handleFeed(w http.ResponseWriter, r *http.Request) {
-	feedIDStr := chi.URLParam(r, "feedID")
-	feedID, _ := strconv.ParseInt(feedIDStr, 10, 64)
+	// Rewrite the whole list, dropping folders that no longer exist.
+	state := s.collapsedFolders(r.Context())
+	state[folderID] = req.Collapsed
+	ids := []int64{}
+	for _, f := range folders {
+		if state[f.ID] {
+			ids = append(ids, f.ID)
+		}
+	}
+	data, _ := json.Marshal(ids)
+	if err := s.db.SetSetting(r.Context(), model.SettingCollapsedFolders, string(data)); err != nil {
+		http.Error(w, "Failed to save", http.StatusInternalServerError)
+		return
+	}
 
-	foldersWithFeeds, _ := s.db.GetFoldersWithFeeds()
-	unfiledFeeds, _ := s.db.GetUnfiledFeeds()
-	items, _ := s.db.GetItems(feedID, false)
-	interval, _ := s.db.GetPollingInterval()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":            "ok",
+		"collapsed_folders": ids,
+	})
+}
 
-	// Get feed name and error for title.
-	pageTitle := "Feed"
-	feedError := ""
-	if feed, err := s.db.GetFeedByID(feedID); err == nil {
-		pageTitle = feed.Title
-		feedError = feed.LastError
+// collapsedFolders returns the set of folders collapsed in the sidebar.
+func (s *Server) collapsedFolders(ctx context.Context) map[int64]bool {
+	collapsed := make(map[int64]bool)
+	val, err := s.db.GetSetting(ctx, model.SettingCollapsedFolders)
+	if err != nil {
+		return collapsed
 	}
-
-	data := map[string]interface{}{
-		"FoldersWithFeeds": foldersWithFeeds,
-		"UnfiledFeeds":     unfiledFeeds,
-		"Items":            items,
-		"CurrentFeedID":    feedID,
-		"PollingInterval":  interval,
-		"PageTitle":        pageTitle,
-		"FeedError":        feedError,
-		"DatabaseType":     s.db.DatabaseType(),
+	var ids []int64
+	if err := json.Unmarshal([]byte(val), &ids); err != nil {
+		return collapsed
+	}
+	for _, id := range ids {
+		collapsed[id] = true
 	}
-	s.render(w, "layout.html", data)
+	return collapsed
 }
 
-func (s *Server) handleFolder(w http.ResponseWriter, r *http.Request) {
-	folderIDStr := chi.URLParam(r, "folderID")
-	folderID, _ := strconv.ParseInt(folderIDStr, 10, 64)
-
-	foldersWithFeeds, _ := s.db.GetFoldersWithFeeds()
-	unfiledFeeds, _ := s.db.GetUnfiledFeeds()
-	items, _ := s.db.GetItemsByFolderID(folderID, false)
-	interval, _ := s.db.GetPollingInterval()
-
-	// Get folder name for title.
-	pageTitle := "Folder"
-	if folder, err := s.db.GetFolderByID(folderID); err == nil {
-		pageTitle = folder.Name
+// sidebarFolders returns the folder tree for the sidebar with each folder's
+// collapse, digest, blogroll and notify state filled in.
+func (s *Server) sidebarFolders(ctx context.Context) ([]model.FolderWithFeeds, error) {
+	folders, err := s.db.GetFoldersWithFeeds(ctx)
+	if err != nil {
+		return nil, err
 	}
-
-	data := map[string]interface{}{
-		"FoldersWithFeeds": foldersWithFeeds,
-		"UnfiledFeeds":     unfiledFeeds,
-		"Items":            items,
-		"CurrentFolderID":  folderID,
-		"PollingInterval":  interval,
-		"PageTitle":        pageTitle,
-		"DatabaseType":     s.db.DatabaseType(),
+	collapsed := s.collapsedFolders(ctx)
+	held := s.digestFolders(ctx)
+	published := s.blogrollFolders(ctx)
+	notify := s.notifyFolders(ctx)
+	for i := range folders {
+		folders[i].Collapsed = collapsed[folders[i].ID]
+		folders[i].Digest = held[folders[i].ID]
+		folders[i].Blogroll = published[folders[i].ID]
+		folders[i].Notify = notify[folders[i].ID]
 	}
-	s.render(w, "layout.html", data)
+	return folders, nil
 }
 
-// --- API Handlers ---
+// hideEmptyFeeds reports whether feeds without unread items are left out of
+// the sidebar.
+func (s *Server) hideEmptyFeeds(ctx context.Context) bool {
+	return database.GetIntSetting(ctx, s.db, model.SettingSidebarHideEmpty, 0) != 0
+}
 
-func (s *Server) handleMarkRead(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		ItemIDs []int64 `json:"item_ids"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
-		return
-	}
-	if err := s.db.MarkItemsRead(req.ItemIDs); err != nil {
-		http.Error(w, "Failed to mark read", http.StatusInternalServerError)
-		return
+// withUnread returns the feeds with unread items, keeping the feed called
+// keep so the page being viewed stays in the sidebar.
+func withUnread(feeds []model.Feed, keep int64) []model.Feed {
+	kept := feeds[:0]
+	for _, f := range feeds {
+		if f.UnreadCount > 0 || f.ID == keep {
+			kept = append(kept, f)
+		}
 	}
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	return kept
 }
 
-func (s *Server) handleSaveSettings(w http.ResponseWriter, r *http.Request) {
+// handleSaveSidebarOrder stores a drag-and-drop order and switches the
+// sidebar to manual sorting.
+func (s *Server) handleSaveSidebarOrder(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		PollingInterval int `json:"polling_interval"`
+		Folders []int64 `json:"folders"`
+		Feeds   []int64 `json:"feeds"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
-	// Enforce minimum.
-	if req.PollingInterval < rss.MinPollingIntervalMinutes {
-		req.PollingInterval = rss.MinPollingIntervalMinutes
+	if err := s.db.SetSidebarOrder(r.Context(), req.Folders, req.Feeds); err != nil {
+		http.Error(w, "Failed to save order", http.StatusInternalServerError)
+		return
 	}
-	if err := s.db.SetSetting(model.SettingPollingInterval, strconv.Itoa(req.PollingInterval)); err != nil {
+	if err := s.db.SetSetting(r.Context(), model.SettingSidebarSort, model.SidebarSortManual); err != nil {
 		http.Error(w, "Failed to save", http.StatusInternalServerError)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "polling_interval": req.PollingInterval})
-}
 
-func (s *Server) handleGetSettings(w http.ResponseWriter, r *http.Request) {
-	interval, _ := s.db.GetPollingInterval()
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"polling_interval": interval,
+		"status": "ok",
 	})
 }
 
-func (s *Server) handleImportOPML(w http.ResponseWriter, r *http.Request) {
-	file, _, err := r.FormFile("opml")
+func (s *Server) handleDeleteFeed(w http.ResponseWriter, r *http.Request) {
+	feedID, err := urlID(r, "feedID")
 	if err != nil {
-		http.Error(w, "No file provided", http.StatusBadRequest)
+		http.Error(w, "Invalid feed ID", http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
 
-	entries, err := opml.Parse(file)
+	feed, err := s.db.GetFeedByID(r.Context(), feedID)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to parse OPML: %v", err), http.StatusBadRequest)
+		storeError(w, r, err, "Feed")
+		return
+	}
+	target := fmt.Sprintf("feed %d (%s)", feedID, feed.Title)
+	if err := s.db.DeleteFeed(r.Context(), feedID); err != nil {
+		http.Error(w, "Failed to delete feed", http.StatusInternalServerError)
 		return
 	}
+	s.audit(r, model.AuditDeleteFeed, target)
 
-	imported := 0
-	for _, entry := range entries {
-		// Create folder hierarchy.
-		var folderID *int64
-		for _, folderName := range entry.FolderPath {
-			id, err := s.db.GetOrCreateFolder(folderName, folderID)
-			if err != nil {
-				log.Printf("Error creating folder %s: %v", folderName, err)
-				continue
-			}
-			folderID = &id
-		}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+	})
+}
 
-		// Create feed.
-		_, isNew, err := s.db.GetOrCreateFeed(folderID, entry.Title, entry.URL)
-		if err != nil {
-			log.Printf("Error creating feed %s: %v", entry.URL, err)
-			continue
-		}
-		if isNew {
-			imported++
-		}
+func (s *Server) handleDeleteFolder(w http.ResponseWriter, r *http.Request) {
+	folderID, err := urlID(r, "folderID")
+	if err != nil {
+		http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+		return
 	}
 
-	// Note: We no longer auto-fetch after import to avoid 403 errors.
-	// Users should click the Refresh button manually.
+	folder, err := s.db.GetFolderByID(r.Context(), folderID)
+	if err != nil {
+		storeError(w, r, err, "Folder")
+		return
+	}
+	target := fmt.Sprintf("folder %d (%s)", folderID, folder.Name)
+	if err := s.db.DeleteFolder(r.Context(), folderID); err != nil {
+		http.Error(w, "Failed to delete folder", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, model.AuditDeleteFolder, target)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":   "ok",
-		"imported": imported,
-		"total":    len(entries),
+		"status": "ok",
 	})
 }
 
-func (s *Server) handleExportOPML(w http.ResponseWriter, r *http.Request) {
-	feeds, err := s.db.GetAllFeeds()
+func (s *Server) handleMoveFeed(w http.ResponseWriter, r *http.Request) {
+	feedID, err := urlID(r, "feedID")
 	if err != nil {
-		http.Error(w, "Failed to get feeds", http.StatusInternalServerError)
+		http.Error(w, "Invalid feed ID", http.StatusBadRequest)
 		return
 	}
 
-	folders, _ := s.db.GetFolders()
-	folderMap := make(map[int64]string)
-	for _, f := range folders {
-		folderMap[f.ID] = f.Name
+	var req struct {
+		FolderID *int64 `json:"folder_id"`
 	}
-
-	// Group feeds.
-	grouped := make(map[string][]opml.FeedEntry)
-	for _, feed := range feeds {
-		entry := opml.FeedEntry{
-			Title: feed.Title,
-			URL:   feed.URL,
-		}
-		if feed.FolderID != nil {
-			if name, ok := folderMap[*feed.FolderID]; ok {
-				entry.FolderPath = []string{name}
-			}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.db.GetFeedByID(r.Context(), feedID); err != nil {
+		storeError(w, r, err, "Feed")
+		return
+	}
+	if req.FolderID != nil {
+		if _, err := s.db.GetFolderByID(r.Context(), *req.FolderID); err != nil {
+			storeError(w, r, err, "Folder")
+			return
 		}
-		key := strings.Join(entry.FolderPath, "/")
-		grouped[key] = append(grouped[key], entry)
 	}
 
-	data, err := opml.Export("Infovore Feeds", grouped)
-	if err != nil {
-		http.Error(w, "Failed to export", http.StatusInternalServerError)
+	if err := s.db.MoveFeedToFolder(r.Context(), feedID, req.FolderID); err != nil {
+		http.Error(w, "Failed to move feed", http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/xml")
-	w.Header().Set("Content-Disposition", "attachment; filename=infovore-feeds.opml")
-	w.Write(data)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+	})
 }
 
-func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
-	defer cancel()
+func (s *Server) handleRefreshFeed(w http.ResponseWriter, r *http.Request) {
+	feedID, err := urlID(r, "feedID")
+	if err != nil {
+		http.Error(w, "Invalid feed ID", http.StatusBadRequest)
+		return
+	}
 
-	results, err := s.fetcher.FetchAll(ctx)
+	feed, err := s.db.GetFeedByID(r.Context(), feedID)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Fetch error: %v", err), http.StatusInternalServerError)
+		storeError(w, r, err, "Feed")
 		return
 	}
 
-	total := 0
-	for _, c := range results {
-		total += c
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
+	defer cancel()
+
+	count, err := s.fetcher.FetchFeed(ctx, *feed)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Fetch error: %v", err), http.StatusInternalServerError)
+		return
 	}
+	s.caches.Publish(cluster.EventItems)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":    "ok",
-		"new_items": total,
-		"feeds":     len(results),
+		"new_items": count,
 	})
 }
 
-func (s *Server) handleCleanup(w http.ResponseWriter, r *http.Request) {
-	deleted, err := s.db.CleanupReadItems()
+// handleDebugFetch fetches and parses a feed without storing anything and
+// reports the response and what the parser made of it.
+func (s *Server) handleDebugFetch(w http.ResponseWriter, r *http.Request) {
+	feedID, err := urlID(r, "feedID")
 	if err != nil {
-		http.Error(w, "Cleanup failed", http.StatusInternalServerError)
+		http.Error(w, "Invalid feed ID", http.StatusBadRequest)
+		return
+	}
+
+	feed, err := s.db.GetFeedByID(r.Context(), feedID)
+	if err != nil {
+		storeError(w, r, err, "Feed")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
+	defer cancel()
+
+	report, err := s.fetcher.DebugFetch(ctx, *feed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":  "ok",
-		"deleted": deleted,
-	})
-}
 
-func (s *Server) handleSidebar(w http.ResponseWriter, r *http.Request) {
-	folders, _ := s.db.GetFolders()
-	feeds, _ := s.db.GetAllFeeds()
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"folders": folders,
-		"feeds":   feeds,
-	})
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
 }
 
-func (s *Server) handleDeleteFeed(w http.ResponseWriter, r *http.Request) {
-	feedIDStr := chi.URLParam(r, "feedID")
-	feedID, err := strconv.ParseInt(feedIDStr, 10, 64)
+func (s *Server) handleRefreshFeedMetadata(w http.ResponseWriter, r *http.Request) {
+	feedID, err := urlID(r, "feedID")
 	if err != nil {
 		http.Error(w, "Invalid feed ID", http.StatusBadRequest)
 		return
 	}
 
-	if err := s.db.DeleteFeed(feedID); err != nil {
-		http.Error(w, "Failed to delete feed", http.StatusInternalServerError)
+	feed, err := s.db.GetFeedByID(r.Context(), feedID)
+	if err != nil {
+		storeError(w, r, err, "Feed")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
+	defer cancel()
+
+	updated, err := s.fetcher.RefreshMetadata(ctx, *feed)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Fetch error: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status": "ok",
+		"status":      "ok",
+		"title":       updated.Title,
+		"site_url":    updated.SiteURL,
+		"description": updated.Description,
+		"icon_url":    updated.IconURL,
 	})
 }
 
-func (s *Server) handleDeleteFolder(w http.ResponseWriter, r *http.Request) {
-	folderIDStr := chi.URLParam(r, "folderID")
-	folderID, err := strconv.ParseInt(folderIDStr, 10, 64)
+func (s *Server) handleGetFeedSettings(w http.ResponseWriter, r *http.Request) {
+	feedID, err := urlID(r, "feedID")
 	if err != nil {
-		http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+		http.Error(w, "Invalid feed ID", http.StatusBadRequest)
 		return
 	}
 
-	if err := s.db.DeleteFolder(folderID); err != nil {
-		http.Error(w, "Failed to delete folder", http.StatusInternalServerError)
+	feed, err := s.db.GetFeedByID(r.Context(), feedID)
+	if err != nil {
+		storeError(w, r, err, "Feed")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status": "ok",
-	})
+	json.NewEncoder(w).Encode(feed.FeedOptions)
 }
 
-func (s *Server) handleMoveFeed(w http.ResponseWriter, r *http.Request) {
-	feedIDStr := chi.URLParam(r, "feedID")
-	feedID, err := strconv.ParseInt(feedIDStr, 10, 64)
+func (s *Server) handleSaveFeedSettings(w http.ResponseWriter, r *http.Request) {
+	feedID, err := urlID(r, "feedID")
 	if err != nil {
 		http.Error(w, "Invalid feed ID", http.StatusBadRequest)
 		return
 	}
 
-	var req struct {
-		FolderID *int64 `json:"folder_id"`
+	feed, err := s.db.GetFeedByID(r.Context(), feedID)
+	if err != nil {
+		storeError(w, r, err, "Feed")
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+
+	// Decode over the current options so omitted fields keep their values.
+	opts := feed.FeedOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
-
-	if err := s.db.MoveFeedToFolder(feedID, req.FolderID); err != nil {
-		http.Error(w, "Failed to move feed", http.StatusInternalServerError)
+	if err := s.fetcher.CheckFetchStrategy(opts.FetchStrategy); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := transform.Compile(opts.Transforms); err != nil {
+		http.Error(w, "Invalid transforms: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.Notes = strings.TrimSpace(opts.Notes)
+	if len(opts.Notes) > maxNoteLength {
+		http.Error(w, fmt.Sprintf("Notes exceed %d characters", maxNoteLength), http.StatusBadRequest)
+		return
+	}
+	if err := s.db.UpdateFeedOptions(r.Context(), feedID, opts); err != nil {
+		http.Error(w, "Failed to save feed settings", http.StatusInternalServerError)
 		return
 	}
+	s.audit(r, model.AuditUpdateSettings, fmt.Sprintf("feed %d (%s)", feedID, feed.Title))
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status": "ok",
-	})
+	json.NewEncoder(w).Encode(opts)
 }
 
-func (s *Server) handleRefreshFeed(w http.ResponseWriter, r *http.Request) {
-	feedIDStr := chi.URLParam(r, "feedID")
-	feedID, err := strconv.ParseInt(feedIDStr, 10, 64)
+func (s *Server) handleBackfillFeed(w http.ResponseWriter, r *http.Request) {
+	feedID, err := urlID(r, "feedID")
 	if err != nil {
 		http.Error(w, "Invalid feed ID", http.StatusBadRequest)
 		return
 	}
 
-	feed, err := s.db.GetFeedByID(feedID)
+	feed, err := s.db.GetFeedByID(r.Context(), feedID)
 	if err != nil {
-		http.Error(w, "Feed not found", http.StatusNotFound)
+		storeError(w, r, err, "Feed")
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
 	defer cancel()
 
-	count, err := s.fetcher.FetchFeed(ctx, *feed)
+	count, err := s.fetcher.BackfillArchives(ctx, *feed)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Fetch error: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Backfill error: %v", err), http.StatusInternalServerError)
 		return
 	}
 
@@ -481,14 +1788,17 @@ func (s *Server) handleRefreshFeed(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleRefreshFolder(w http.ResponseWriter, r *http.Request) {
-	folderIDStr := chi.URLParam(r, "folderID")
-	folderID, err := strconv.ParseInt(folderIDStr, 10, 64)
+	folderID, err := urlID(r, "folderID")
 	if err != nil {
 		http.Error(w, "Invalid folder ID", http.StatusBadRequest)
 		return
 	}
+	if _, err := s.db.GetFolderByID(r.Context(), folderID); err != nil {
+		storeError(w, r, err, "Folder")
+		return
+	}
 
-	feeds, err := s.db.GetFeedsByFolderID(folderID)
+	feeds, err := s.db.GetFeedsByFolderID(r.Context(), folderID)
 	if err != nil {
 		http.Error(w, "Failed to get feeds", http.StatusInternalServerError)
 		return
@@ -506,11 +1816,12 @@ func (s *Server) handleRefreshFolder(w http.ResponseWriter, r *http.Request) {
 		}
 		count, err := s.fetcher.FetchFeed(ctx, feed)
 		if err != nil {
-			log.Printf("Failed to fetch %s: %v", feed.URL, err)
+			reqid.Logf(r.Context(), "Failed to fetch %s: %v", feed.URL, err)
 			continue
 		}
 		total += count
 	}
+	s.caches.Publish(cluster.EventItems)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -528,10 +1839,17 @@ func (s *Server) handleDeleteRead(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
-	if err := s.db.DeleteReadItems(req.ItemIDs); err != nil {
+	// Items scrolled past without being opened count as skipped.
+	if err := s.db.RecordSkippedItems(r.Context(), req.ItemIDs); err != nil {
+		reqid.Logf(r.Context(), "Failed to record skipped items: %v", err)
+	}
+	if err := s.db.DeleteReadItems(r.Context(), req.ItemIDs); err != nil {
 		http.Error(w, "Failed to delete items", http.StatusInternalServerError)
 		return
 	}
+	if len(req.ItemIDs) > 0 {
+		s.audit(r, model.AuditDeleteItems, fmt.Sprintf("%d read items", len(req.ItemIDs)))
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":  "ok",
@@ -541,8 +1859,9 @@ func (s *Server) handleDeleteRead(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleAddFeed(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		URL      string `json:"url"`
-		FolderID *int64 `json:"folder_id"`
+		URL              string `json:"url"`
+		FolderID         *int64 `json:"folder_id"`
+		BackfillArchives bool   `json:"backfill_archives"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
@@ -552,13 +1871,25 @@ func (s *Server) handleAddFeed(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "URL is required", http.StatusBadRequest)
 		return
 	}
+	if req.FolderID != nil {
+		if _, err := s.db.GetFolderByID(r.Context(), *req.FolderID); err != nil {
+			storeError(w, r, err, "Folder")
+			return
+		}
+	}
 
 	// Use URL as default title until we fetch the feed
-	feedID, isNew, err := s.db.GetOrCreateFeed(req.FolderID, req.URL, req.URL)
+	feedID, isNew, err := s.addFeed(r.Context(), req.FolderID, req.URL, req.URL)
 	if err != nil {
 		http.Error(w, "Failed to add feed", http.StatusInternalServerError)
 		return
 	}
+	if isNew && req.BackfillArchives {
+		// The archive walk happens on the feed's first fetch.
+		if err := s.db.UpdateFeedOptions(r.Context(), feedID, model.FeedOptions{BackfillArchives: true}); err != nil {
+			reqid.Logf(r.Context(), "Error enabling backfill for feed %d: %v", feedID, err)
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -581,8 +1912,14 @@ func (s *Server) handleAddFolder(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Name is required", http.StatusBadRequest)
 		return
 	}
+	if req.ParentID != nil {
+		if _, err := s.db.GetFolderByID(r.Context(), *req.ParentID); err != nil {
+			storeError(w, r, err, "Folder")
+			return
+		}
+	}
 
-	folderID, err := s.db.CreateFolder(req.Name, req.ParentID)
+	folderID, err := s.db.CreateFolder(r.Context(), req.Name, req.ParentID)
 	if err != nil {
 		http.Error(w, "Failed to create folder", http.StatusInternalServerError)
 		return
@@ -679,6 +2016,7 @@ func (s *Server) handleSaveDatabaseSettings(w http.ResponseWriter, r *http.Reque
 	for _, line := range existingLines {
 		file.WriteString(line + "\n")
 	}
+	s.audit(r, model.AuditUpdateSettings, "database")
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -690,10 +2028,115 @@ func (s *Server) handleSaveDatabaseSettings(w http.ResponseWriter, r *http.Reque
 
 // --- Helpers ---
 
-func (s *Server) render(w http.ResponseWriter, name string, data interface{}) {
+// itemFilterFromQuery reads the filters and sort mode shared by all item
+// listings from the query string (min_words, max_words, unread, author,
+// domain, sort, seed). A random sort without a seed gets a new one.
+// The error describes the first malformed parameter.
+func itemFilterFromQuery(r *http.Request) (model.ItemFilter, error) {
+	q := r.URL.Query()
+	var filter model.ItemFilter
+	var err error
+	if filter.MinWords, err = queryCount(q, "min_words"); err != nil {
+		return filter, err
+	}
+	if filter.MaxWords, err = queryCount(q, "max_words"); err != nil {
+		return filter, err
+	}
+	filter.OnlyUnread = q.Get("unread") == "1"
+	filter.Author = strings.TrimSpace(q.Get("author"))
+	if domain := strings.TrimSpace(q.Get("domain")); domain != "" {
+		if filter.Domain = model.LinkDomain("//" + domain); filter.Domain == "" {
+			return filter, fmt.Errorf("invalid domain %q", domain)
+		}
+	}
+	switch sort := q.Get("sort"); sort {
+	case "", model.SortNewest, model.SortOldest, model.SortFetched, model.SortLongest, model.SortShortest,
+		model.SortInterest, model.SortRandom:
+		filter.Sort = sort
+	default:
+		return filter, fmt.Errorf("unknown sort %q", sort)
+	}
+	if filter.Sort == model.SortRandom {
+		if raw := q.Get("seed"); raw != "" {
+			seed, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || seed < 0 || seed > model.MaxSortSeed {
+				return filter, fmt.Errorf("invalid seed %q", raw)
+			}
+			filter.Seed = seed
+		} else {
+			filter.Seed = rand.Int63n(model.MaxSortSeed + 1)
+		}
+	}
+	return filter, nil
+}
+
+// queryCount parses the optional non-negative integer query parameter name,
+// returning 0 if it is absent.
+func queryCount(q url.Values, name string) (int, error) {
+	raw := q.Get(name)
+	if raw == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, raw)
+	}
+	return n, nil
+}
+
+// queryID parses the optional ID query parameter name, returning nil if it
+// is absent.
+func queryID(q url.Values, name string) (*int64, error) {
+	raw := q.Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id <= 0 {
+		return nil, fmt.Errorf("invalid %s %q", name, raw)
+	}
+	return &id, nil
+}
+
+// queryBool parses the optional boolean query parameter name ("1", "true",
+// "0" or "false"). ok is false if it is absent.
+func queryBool(q url.Values, name string) (val, ok bool, err error) {
+	switch raw := q.Get(name); raw {
+	case "":
+		return false, false, nil
+	case "1", "true":
+		return true, true, nil
+	case "0", "false":
+		return false, true, nil
+	default:
+		return false, false, fmt.Errorf("invalid %s %q", name, raw)
+	}
+}
+
+// urlID parses the URL parameter name as a row ID, which is always positive.
+func urlID(r *http.Request, name string) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, name), 10, 64)
+	if err == nil && id <= 0 {
+		err = fmt.Errorf("invalid ID %d", id)
+	}
+	return id, err
+}
+
+// storeError reports a failed Store lookup of what ("Feed", "Items", ...):
+// 404 if the row doesn't exist, 500 for anything else.
+func storeError(w http.ResponseWriter, r *http.Request, err error, what string) {
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, what+" not found", http.StatusNotFound)
+		return
+	}
+	reqid.Logf(r.Context(), "Error loading %s: %v", strings.ToLower(what), err)
+	http.Error(w, "Failed to load "+strings.ToLower(what), http.StatusInternalServerError)
+}
+
+func (s *Server) render(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if err := s.templates.ExecuteTemplate(w, name, data); err != nil {
-		log.Printf("Template error: %v", err)
+		reqid.Logf(r.Context(), "Template error: %v", err)
 		http.Error(w, "Render error", http.StatusInternalServerError)
 	}
 }
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/cluster"
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+)
+
+// settingsBundleVersion is the format version of settings bundles.
+const settingsBundleVersion = 1
+
+// maxSettingsBundleSize caps the size of an imported settings bundle.
+const maxSettingsBundleSize = 1 << 20
+
+// instanceSettings are left out of settings bundles: they record the state
+// of this instance or refer to its rows by ID.
+var instanceSettings = map[string]bool{
+	model.SettingMaintenanceLastRun:   true,
+	model.SettingCollapsedFolders:     true,
+	model.SettingDigestFolders:        true,
+	model.SettingDigestLastRun:        true,
+	model.SettingFolderFeedTokens:     true,
+	model.SettingFolderCalendarTokens: true,
+	model.SettingBlogrollFolders:      true,
+	model.SettingDomainBudgets:        true,
+	model.SettingNotifyFolders:        true,
+	model.SettingWebPushKey:           true,
+	model.SettingWebPushSubscriptions: true,
+}
+
+// jsonSettings hold JSON documents and must be valid JSON to import.
+var jsonSettings = map[string]bool{
+	model.SettingClassifierRules:   true,
+	model.SettingClassifierTopics:  true,
+	model.SettingPipelineStages:    true,
+	model.SettingDomainLimits:      true,
+	model.SettingAlerts:            true,
+	model.SettingKeyboardShortcuts: true,
+}
+
+// settingsBundle is the configuration of an instance, apart from its feeds
+// and items. Settings hold the raw stored values by key.
+type settingsBundle struct {
+	Version    int               `json:"version"`
+	ExportedAt time.Time         `json:"exported_at"`
+	Settings   map[string]string `json:"settings"`
+}
+
+// handleExportSettings downloads every configured setting as a bundle.
+func (s *Server) handleExportSettings(w http.ResponseWriter, r *http.Request) {
+	bundle := settingsBundle{Version: settingsBundleVersion, ExportedAt: time.Now().UTC(), Settings: map[string]string{}}
+	for _, key := range model.KnownSettings {
+		if instanceSettings[key] {
+			continue
+		}
+		value, err := s.db.GetSetting(r.Context(), key)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			reqid.Logf(r.Context(), "Settings export failed: %v", err)
+			http.Error(w, "Failed to load settings", http.StatusInternalServerError)
+			return
+		}
+		bundle.Settings[key] = value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename=infovore-settings.json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(bundle)
+}
+
+// handleImportSettings applies a bundle made by handleExportSettings.
+// Settings this instance doesn't know are skipped and reported; the others
+// are saved together or not at all.
+func (s *Server) handleImportSettings(w http.ResponseWriter, r *http.Request) {
+	var bundle settingsBundle
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSettingsBundleSize)).Decode(&bundle); err != nil {
+		http.Error(w, "Invalid settings bundle", http.StatusBadRequest)
+		return
+	}
+	if bundle.Version != settingsBundleVersion {
+		http.Error(w, fmt.Sprintf("Unsupported settings bundle version %d", bundle.Version), http.StatusBadRequest)
+		return
+	}
+
+	known := make(map[string]bool, len(model.KnownSettings))
+	for _, key := range model.KnownSettings {
+		known[key] = !instanceSettings[key]
+	}
+	values := make(map[string]string, len(bundle.Settings))
+	skipped := []string{}
+	for key, value := range bundle.Settings {
+		if !known[key] {
+			skipped = append(skipped, key)
+			continue
+		}
+		if jsonSettings[key] && value != "" && !json.Valid([]byte(value)) {
+			http.Error(w, fmt.Sprintf("Setting %s is not valid JSON", key), http.StatusBadRequest)
+			return
+		}
+		values[key] = value
+	}
+	sort.Strings(skipped)
+
+	if err := s.db.SetSettings(r.Context(), values); err != nil {
+		reqid.Logf(r.Context(), "Settings import failed: %v", err)
+		http.Error(w, "Failed to save settings", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, model.AuditUpdateSettings, fmt.Sprintf("imported %d settings", len(values)))
+	s.caches.Publish(cluster.EventSettings)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "ok",
+		"imported": len(values),
+		"skipped":  skipped,
+	})
+}
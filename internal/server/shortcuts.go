@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// defaultShortcuts are the keys bound to the keyboard shortcut actions of
+// item lists unless changed in settings. Keys are named as in the key
+// property of a browser KeyboardEvent, "Space" for the space bar, and may be
+// prefixed with "Ctrl+", "Alt+" or "Meta+".
+var defaultShortcuts = map[string]string{
+	"next_item":   "j",
+	"prev_item":   "k",
+	"mark_read":   "m",
+	"toggle_star": "s",
+	"open_link":   "v",
+}
+
+// maxShortcutKey bounds the length of a key name.
+const maxShortcutKey = 32
+
+// keyboardShortcuts returns the key of every shortcut action: the stored
+// keys over the defaults. An empty key leaves the action unbound.
+func keyboardShortcuts(ctx context.Context, db database.Store) map[string]string {
+	keys := make(map[string]string, len(defaultShortcuts))
+	for action, key := range defaultShortcuts {
+		keys[action] = key
+	}
+	raw, err := db.GetSetting(ctx, model.SettingKeyboardShortcuts)
+	if err != nil || raw == "" {
+		return keys
+	}
+	var stored map[string]string
+	if err := json.Unmarshal([]byte(raw), &stored); err != nil {
+		return keys
+	}
+	for action, key := range stored {
+		if _, ok := defaultShortcuts[action]; ok {
+			keys[action] = key
+		}
+	}
+	return keys
+}
+
+// validateShortcuts checks keys to bind to shortcut actions: the actions
+// must exist and no key may be bound twice, counting the defaults of the
+// actions not listed. Key names are trimmed.
+func validateShortcuts(keys map[string]string) (map[string]string, error) {
+	out := make(map[string]string, len(keys))
+	for action, key := range keys {
+		if _, ok := defaultShortcuts[action]; !ok {
+			return nil, fmt.Errorf("unknown shortcut action %q", action)
+		}
+		key = strings.TrimSpace(key)
+		if len(key) > maxShortcutKey {
+			return nil, fmt.Errorf("key of %s is too long", action)
+		}
+		out[action] = key
+	}
+	bound := make(map[string]string)
+	for action, key := range defaultShortcuts {
+		if k, ok := out[action]; ok {
+			key = k
+		}
+		if key == "" {
+			continue
+		}
+		if other, ok := bound[key]; ok {
+			return nil, fmt.Errorf("%s and %s are both bound to %q", min(action, other), max(action, other), key)
+		}
+		bound[key] = action
+	}
+	return out, nil
+}
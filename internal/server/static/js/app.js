@@ -19,8 +19,18 @@
     const folderContextMenu = document.getElementById('folderContextMenu');
     const deleteFeedBtn = document.getElementById('deleteFeedBtn');
     const updateFeedBtn = document.getElementById('updateFeedBtn');
+    const refreshMetadataBtn = document.getElementById('refreshMetadataBtn');
+    const setFeedIconBtn = document.getElementById('setFeedIconBtn');
+    const feedIconFile = document.getElementById('feedIconFile');
+    const feedLabelsBtn = document.getElementById('feedLabelsBtn');
+    const notifyFeedBtn = document.getElementById('notifyFeedBtn');
     const deleteFolderBtn = document.getElementById('deleteFolderBtn');
     const updateFolderBtn = document.getElementById('updateFolderBtn');
+    const digestFolderBtn = document.getElementById('digestFolderBtn');
+    const folderFeedBtn = document.getElementById('folderFeedBtn');
+    const folderCalendarBtn = document.getElementById('folderCalendarBtn');
+    const blogrollFolderBtn = document.getElementById('blogrollFolderBtn');
+    const notifyFolderBtn = document.getElementById('notifyFolderBtn');
 
     // Confirm modal
     const confirmModal = document.getElementById('confirmModal');
@@ -34,6 +44,7 @@
     const closeAddFeed = document.getElementById('closeAddFeed');
     const feedUrlInput = document.getElementById('feedUrlInput');
     const addFeedFolderId = document.getElementById('addFeedFolderId');
+    const backfillArchivesInput = document.getElementById('backfillArchivesInput');
     const submitAddFeed = document.getElementById('submitAddFeed');
     const addFeedSettingsBtn = document.getElementById('addFeedSettingsBtn');
     const addFeedFolderBtn = document.getElementById('addFeedFolderBtn');
@@ -45,31 +56,23 @@
     const submitAddFolder = document.getElementById('submitAddFolder');
     const addFolderSettingsBtn = document.getElementById('addFolderSettingsBtn');
 
+    // Offline support: the service worker caches the latest unread items
+    if ('serviceWorker' in navigator) {
+        navigator.serviceWorker.register('/sw.js').then(reg => {
+            reg.active?.postMessage('refresh');
+        }).catch(() => { });
+    }
+
     // Sidebar toggle (mobile)
     if (sidebarToggle) sidebarToggle.onclick = () => sidebar.classList.toggle('open');
 
-    // Collapsible folders - use arrow click area only, not the whole link
-    const FOLDER_STATE_KEY = 'infovore_folder_state';
-    function getFolderState() {
-        try {
-            return JSON.parse(localStorage.getItem(FOLDER_STATE_KEY)) || {};
-        } catch { return {}; }
-    }
-    function saveFolderState(state) {
-        localStorage.setItem(FOLDER_STATE_KEY, JSON.stringify(state));
-    }
+    // Collapsible folders - use arrow click area only, not the whole link.
+    // The collapse state is rendered by the server and saved there on toggle.
     document.querySelectorAll('.folder-toggle').forEach(toggle => {
         const folderId = toggle.dataset.folderId;
         const feedsContainer = document.getElementById('folder-' + folderId);
         if (!feedsContainer) return;
 
-        // Restore saved state (default to expanded)
-        const state = getFolderState();
-        if (state[folderId] === false) {
-            feedsContainer.classList.add('collapsed');
-            toggle.classList.add('collapsed');
-        }
-
         // Toggle collapse on click of the ::before arrow area (first 20px)
         toggle.addEventListener('click', (e) => {
             const rect = toggle.getBoundingClientRect();
@@ -79,9 +82,11 @@
                 e.preventDefault();
                 const isCollapsed = feedsContainer.classList.toggle('collapsed');
                 toggle.classList.toggle('collapsed', isCollapsed);
-                const state = getFolderState();
-                state[folderId] = !isCollapsed;
-                saveFolderState(state);
+                fetch(`/api/folder/${folderId}/collapsed`, {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ collapsed: isCollapsed })
+                }).catch(() => showToast('Failed to save folder state'));
             }
             // Otherwise, let the link navigate to the folder view
         });
@@ -153,6 +158,130 @@
         };
     }
 
+    // Refresh feed metadata (title, site URL, description, icon)
+    if (refreshMetadataBtn) {
+        refreshMetadataBtn.onclick = async () => {
+            if (!contextFeedId) return;
+            const feedId = contextFeedId;
+            hideAllContextMenus();
+
+            showToast('Refreshing feed metadata...', 30000);
+            try {
+                const res = await fetch(`/api/feed/${feedId}/refresh-metadata`, { method: 'POST' });
+                if (res.ok) {
+                    const data = await res.json();
+                    showToast(`Updated: ${data.title}`);
+                    setTimeout(() => location.reload(), 1000);
+                } else {
+                    showToast('Metadata refresh failed');
+                }
+            } catch (e) {
+                showToast('Error refreshing metadata');
+            }
+        };
+    }
+
+    // Set feed icon: an emoji, an uploaded image, or back to the default
+    if (setFeedIconBtn && feedIconFile) {
+        let iconFeedId = null;
+
+        const saveIcon = async (feedId, options) => {
+            try {
+                const res = await fetch(`/api/feed/${feedId}/icon`, options);
+                if (res.ok) {
+                    location.reload();
+                } else {
+                    showToast(await res.text() || 'Failed to set icon');
+                }
+            } catch (e) {
+                showToast('Error setting icon');
+            }
+        };
+
+        setFeedIconBtn.onclick = () => {
+            if (!contextFeedId) return;
+            const feedId = contextFeedId;
+            hideAllContextMenus();
+
+            const emoji = prompt('Emoji for this feed. Leave empty to upload an image, or enter - to restore the default icon.');
+            if (emoji === null) return;
+            if (emoji.trim() === '-') {
+                saveIcon(feedId, { method: 'DELETE' });
+            } else if (emoji.trim() !== '') {
+                saveIcon(feedId, {
+                    method: 'PUT',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ emoji: emoji.trim() })
+                });
+            } else {
+                iconFeedId = feedId;
+                feedIconFile.value = '';
+                feedIconFile.click();
+            }
+        };
+
+        feedIconFile.onchange = () => {
+            const file = feedIconFile.files[0];
+            if (!file || !iconFeedId) return;
+            const form = new FormData();
+            form.append('icon', file);
+            saveIcon(iconFeedId, { method: 'PUT', body: form });
+        };
+    }
+
+    // Feed labels: comma-separated, independent of the feed's folder
+    if (feedLabelsBtn) {
+        feedLabelsBtn.onclick = async () => {
+            if (!contextFeedId) return;
+            const feedId = contextFeedId;
+            hideAllContextMenus();
+
+            const feedItem = document.querySelector(`.feed-item[data-feed-id="${feedId}"]`);
+            const input = prompt('Labels for this feed, separated by commas:', feedItem?.dataset.labels || '');
+            if (input === null) return;
+            try {
+                const res = await fetch(`/api/feed/${feedId}/labels`, {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ labels: input.split(',') })
+                });
+                if (res.ok) {
+                    location.reload();
+                } else {
+                    showToast(await res.text() || 'Failed to save labels');
+                }
+            } catch (e) {
+                showToast('Error saving labels');
+            }
+        };
+    }
+
+    // Push notifications for a feed's new items
+    if (notifyFeedBtn) {
+        notifyFeedBtn.onclick = async () => {
+            if (!contextFeedId) return;
+            const feedId = contextFeedId;
+            hideAllContextMenus();
+
+            const feedItem = document.querySelector(`.feed-item[data-feed-id="${feedId}"]`);
+            const notify = !feedItem?.dataset.notify;
+            try {
+                const res = await fetch(`/api/feed/${feedId}/settings`, {
+                    method: 'POST', headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ notify })
+                });
+                if (!res.ok) { showToast(await res.text()); return; }
+                if (feedItem) {
+                    if (notify) feedItem.dataset.notify = '1';
+                    else delete feedItem.dataset.notify;
+                }
+                showToast(notify ? 'New items of this feed will send notifications' : 'Notifications off for this feed');
+            } catch (e) {
+                showToast('Error saving feed');
+            }
+        };
+    }
+
     // Delete feed
     if (deleteFeedBtn) {
         deleteFeedBtn.onclick = async () => {
@@ -198,12 +327,149 @@
         };
     }
 
+    // Move a folder into or out of the daily digest
+    if (digestFolderBtn) {
+        digestFolderBtn.onclick = async () => {
+            if (!contextFolderId) return;
+            const folderId = contextFolderId;
+            hideAllContextMenus();
+            const toggle = document.querySelector(`.folder-toggle[data-folder-id="${folderId}"]`);
+            const digest = !toggle?.dataset.digest;
+            try {
+                const res = await fetch(`/api/folder/${folderId}/digest`, {
+                    method: 'POST', headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ digest })
+                });
+                if (!res.ok) { showToast(await res.text()); return; }
+                showToast(digest ? 'Folder moved to the daily digest' : 'Folder back in the main stream');
+                setTimeout(() => location.reload(), 1000);
+            } catch (e) {
+                showToast('Error saving folder');
+            }
+        };
+    }
+
+    // Publish a folder's feeds on the public blogroll, or take them off it
+    if (blogrollFolderBtn) {
+        blogrollFolderBtn.onclick = async () => {
+            if (!contextFolderId) return;
+            const folderId = contextFolderId;
+            hideAllContextMenus();
+            const toggle = document.querySelector(`.folder-toggle[data-folder-id="${folderId}"]`);
+            const published = !toggle?.dataset.blogroll;
+            if (published && !confirm('List the feeds of this folder on the public blogroll page?')) return;
+            try {
+                const res = await fetch(`/api/folder/${folderId}/blogroll`, {
+                    method: 'POST', headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ published })
+                });
+                if (!res.ok) { showToast(await res.text()); return; }
+                const data = await res.json();
+                if (toggle) {
+                    if (published) toggle.dataset.blogroll = '1';
+                    else delete toggle.dataset.blogroll;
+                }
+                showToast(published ? `Folder published at ${location.origin}${data.path}` : 'Folder taken off the blogroll');
+            } catch (e) {
+                showToast('Error saving folder');
+            }
+        };
+    }
+
+    // Push notifications for a folder's new items
+    if (notifyFolderBtn) {
+        notifyFolderBtn.onclick = async () => {
+            if (!contextFolderId) return;
+            const folderId = contextFolderId;
+            hideAllContextMenus();
+            const toggle = document.querySelector(`.folder-toggle[data-folder-id="${folderId}"]`);
+            const notify = !toggle?.dataset.notify;
+            try {
+                const res = await fetch(`/api/folder/${folderId}/notify`, {
+                    method: 'POST', headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ notify })
+                });
+                if (!res.ok) { showToast(await res.text()); return; }
+                if (toggle) {
+                    if (notify) toggle.dataset.notify = '1';
+                    else delete toggle.dataset.notify;
+                }
+                showToast(notify ? 'New items of this folder will send notifications' : 'Notifications off for this folder');
+            } catch (e) {
+                showToast('Error saving folder');
+            }
+        };
+    }
+
+    // Private Atom feed of a folder: show its secret URL, making one if needed.
+    // Clearing the URL revokes it.
+    if (folderFeedBtn) {
+        folderFeedBtn.onclick = async () => {
+            if (!contextFolderId) return;
+            const folderId = contextFolderId;
+            hideAllContextMenus();
+            const setFeed = enabled => fetch(`/api/folder/${folderId}/feed`, {
+                method: 'POST', headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ enabled })
+            });
+            try {
+                let res = await fetch(`/api/folder/${folderId}/feed`);
+                if (!res.ok) { showToast(await res.text()); return; }
+                let data = await res.json();
+                if (!data.enabled) {
+                    res = await setFeed(true);
+                    if (!res.ok) { showToast(await res.text()); return; }
+                    data = await res.json();
+                }
+                const url = location.origin + data.path;
+                const answer = prompt('Private Atom feed of this folder. Anyone with this URL can read it; clear it and press OK to revoke it.', url);
+                if (answer !== '') return;
+                res = await setFeed(false);
+                if (!res.ok) { showToast(await res.text()); return; }
+                showToast('Atom feed URL revoked');
+            } catch (e) {
+                showToast('Error loading folder feed');
+            }
+        };
+    }
+
+    // iCalendar feed of a folder: show its secret URL, making one if needed.
+    if (folderCalendarBtn) {
+        folderCalendarBtn.onclick = async () => {
+            if (!contextFolderId) return;
+            const folderId = contextFolderId;
+            hideAllContextMenus();
+            const setCalendar = enabled => fetch(`/api/folder/${folderId}/calendar`, {
+                method: 'POST', headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ enabled })
+            });
+            try {
+                let res = await fetch(`/api/folder/${folderId}/calendar`);
+                if (!res.ok) { showToast(await res.text()); return; }
+                let data = await res.json();
+                if (!data.enabled) {
+                    res = await setCalendar(true);
+                    if (!res.ok) { showToast(await res.text()); return; }
+                    data = await res.json();
+                }
+                const url = location.origin + data.path;
+                const answer = prompt('Calendar feed of this folder, for subscribing in a calendar app. Anyone with this URL can read it; clear it and press OK to revoke it.', url);
+                if (answer !== '') return;
+                res = await setCalendar(false);
+                if (!res.ok) { showToast(await res.text()); return; }
+                showToast('Calendar feed URL revoked');
+            } catch (e) {
+                showToast('Error loading calendar feed');
+            }
+        };
+    }
+
     // Delete folder - show confirm modal
     if (deleteFolderBtn) {
         deleteFolderBtn.onclick = () => {
             if (!contextFolderId) return;
             pendingConfirmAction = { type: 'deleteFolder', folderId: contextFolderId };
-            confirmMessage.textContent = 'Are you sure you want to delete this folder and ALL feeds inside it? This cannot be undone.';
+            confirmMessage.textContent = 'Are you sure you want to delete this folder and ALL feeds inside it? Its feeds can be restored from the trash.';
             confirmModal.classList.add('active');
             hideAllContextMenus();
         };
@@ -245,7 +511,23 @@
     }
 
     // Settings modal
-    if (menuBtn) menuBtn.onclick = () => settingsModal.classList.add('active');
+    if (menuBtn) menuBtn.onclick = async () => {
+        settingsModal.classList.add('active');
+        try {
+            const res = await fetch('/api/settings');
+            const data = await res.json();
+            const sortSelect = document.getElementById('sidebarSort');
+            if (sortSelect) sortSelect.value = data.sidebar_sort;
+            const folderSortSelect = document.getElementById('sidebarFolderSort');
+            if (folderSortSelect) folderSortSelect.value = data.sidebar_folder_sort || '';
+            const hideEmptyInput = document.getElementById('sidebarHideEmpty');
+            if (hideEmptyInput) hideEmptyInput.checked = !!data.sidebar_hide_empty;
+            const kindleInput = document.getElementById('kindleEmail');
+            if (kindleInput) kindleInput.value = data.kindle_email || '';
+            const waybackInput = document.getElementById('waybackStarred');
+            if (waybackInput) waybackInput.checked = !!data.wayback_starred;
+        } catch (e) { /* keep the form defaults */ }
+    };
     if (closeSettings) closeSettings.onclick = () => settingsModal.classList.remove('active');
     settingsModal?.addEventListener('click', e => { if (e.target === settingsModal) settingsModal.classList.remove('active'); });
 
@@ -253,6 +535,7 @@
     function openAddFeedModal(folderId = null) {
         if (addFeedFolderId) addFeedFolderId.value = folderId || '';
         if (feedUrlInput) feedUrlInput.value = '';
+        if (backfillArchivesInput) backfillArchivesInput.checked = false;
         addFeedModal?.classList.add('active');
         feedUrlInput?.focus();
     }
@@ -293,6 +576,7 @@
             }
 
             const folderId = addFeedFolderId?.value ? parseInt(addFeedFolderId.value, 10) : null;
+            const backfillArchives = !!backfillArchivesInput?.checked;
             closeAddFeedModal();
             showToast('Adding feed...', 10000);
 
@@ -300,7 +584,7 @@
                 const res = await fetch('/api/feed', {
                     method: 'POST',
                     headers: { 'Content-Type': 'application/json' },
-                    body: JSON.stringify({ url, folder_id: folderId })
+                    body: JSON.stringify({ url, folder_id: folderId, backfill_archives: backfillArchives })
                 });
                 const data = await res.json();
                 if (res.ok) {
@@ -445,30 +729,183 @@
     // Save settings
     if (saveSettings) saveSettings.onclick = async () => {
         const interval = parseInt(document.getElementById('pollingInterval').value, 10);
+        const sidebarSort = document.getElementById('sidebarSort')?.value;
+        const sidebarFolderSort = document.getElementById('sidebarFolderSort')?.value ?? '';
+        const sidebarHideEmpty = !!document.getElementById('sidebarHideEmpty')?.checked;
+        const kindleEmail = document.getElementById('kindleEmail')?.value ?? '';
+        const waybackStarred = !!document.getElementById('waybackStarred')?.checked;
         showToast('Saving settings...');
         try {
             const res = await fetch('/api/settings', {
                 method: 'POST', headers: { 'Content-Type': 'application/json' },
-                body: JSON.stringify({ polling_interval: interval })
+                body: JSON.stringify({ polling_interval: interval, sidebar_sort: sidebarSort, sidebar_folder_sort: sidebarFolderSort, sidebar_hide_empty: sidebarHideEmpty, kindle_email: kindleEmail, wayback_starred: waybackStarred })
             });
+            if (!res.ok) { showToast(await res.text()); return; }
             const data = await res.json();
             showToast(`Saved! Interval: ${data.polling_interval}m`);
             settingsModal.classList.remove('active');
+            setTimeout(() => location.reload(), 500);
         } catch (e) { showToast('Error saving settings'); }
     };
 
-    // Refresh feeds
+    // Refresh feeds. While a refresh runs the button cancels it.
+    let refreshing = false;
+    const refreshLabel = refreshBtn?.textContent;
+    const refreshDone = () => {
+        refreshing = false;
+        refreshBtn.textContent = refreshLabel;
+        refreshBtn.disabled = false;
+    };
     if (refreshBtn) refreshBtn.onclick = async () => {
-        refreshBtn.disabled = true;
-        showToast('Updating feeds... This may take a while.', 60000);
+        if (refreshing) {
+            refreshBtn.disabled = true;
+            showToast('Cancelling...');
+            await fetch('/api/refresh/cancel', { method: 'POST' }).catch(() => {});
+            return;
+        }
+        refreshing = true;
+        refreshBtn.textContent = '⏹ Cancel Update';
+        showToast('Updating feeds...', 60000);
         try {
             const res = await fetch('/api/refresh', { method: 'POST' });
+            if (!res.ok) throw new Error(await res.text());
             const data = await res.json();
-            showToast(`Fetched ${data.new_items} new items from ${data.feeds} feeds`);
-            setTimeout(() => location.reload(), 1500);
+            const events = new EventSource(data.events_url);
+            events.addEventListener('progress', (e) => {
+                const st = JSON.parse(e.data);
+                const retrying = st.retrying ? `, retrying ${st.retrying}` : '';
+                if (st.total) showToast(`Fetched ${st.done}/${st.total} feeds, ${st.new_items} new items${retrying}`, 60000);
+            });
+            events.addEventListener('end', (e) => {
+                events.close();
+                const st = JSON.parse(e.data);
+                const failed = st.failed ? ` (${st.failed} failed)` : '';
+                if (st.state === 'done') {
+                    showToast(`Fetched ${st.new_items} new items from ${st.done} feeds${failed}`);
+                } else if (st.state === 'cancelled') {
+                    showToast(`Refresh cancelled after ${st.done}/${st.total} feeds, ${st.new_items} new items`);
+                } else {
+                    showToast(`Refresh stopped after ${st.done}/${st.total} feeds: ${st.error}`);
+                }
+                refreshDone();
+                reloadItems();
+            });
+            events.onerror = () => {
+                if (events.readyState === EventSource.CLOSED) {
+                    showToast('Lost track of the refresh');
+                    refreshDone();
+                }
+            };
         } catch (e) {
             showToast('Refresh failed');
-            refreshBtn.disabled = false;
+            refreshDone();
+        }
+    };
+
+    // Import a settings bundle exported from this or another instance
+    const importSettingsBtn = document.getElementById('importSettingsBtn');
+    if (importSettingsBtn) importSettingsBtn.onclick = async () => {
+        const fileInput = document.getElementById('settingsFile');
+        if (!fileInput.files.length) { showToast('Select a file first'); return; }
+        try {
+            const res = await fetch('/api/settings/import', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: await fileInput.files[0].text()
+            });
+            if (!res.ok) { showToast(`Import failed: ${(await res.text()).trim()}`); return; }
+            const data = await res.json();
+            const skipped = data.skipped.length ? ` (skipped ${data.skipped.join(', ')})` : '';
+            showToast(`Imported ${data.imported} settings${skipped}`);
+            setTimeout(() => location.reload(), 2000);
+        } catch (e) {
+            showToast('Settings import failed');
+        }
+    };
+
+    // Merge alerts and classifier rules exported from another instance
+    const importRulesBtn = document.getElementById('importRulesBtn');
+    if (importRulesBtn) importRulesBtn.onclick = async () => {
+        const fileInput = document.getElementById('rulesFile');
+        if (!fileInput.files.length) { showToast('Select a file first'); return; }
+        try {
+            const res = await fetch('/api/rules/import', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: await fileInput.files[0].text()
+            });
+            if (!res.ok) { showToast(`Import failed: ${(await res.text()).trim()}`); return; }
+            const data = await res.json();
+            showToast(`Rules imported: ${data.alerts_added} alerts added, ${data.alerts_replaced} replaced`);
+        } catch (e) {
+            showToast('Rules import failed');
+        }
+    };
+
+    // Subscribe this browser to push notifications
+    const pushSubscribeBtn = document.getElementById('pushSubscribeBtn');
+    if (pushSubscribeBtn) pushSubscribeBtn.onclick = async () => {
+        if (!('serviceWorker' in navigator) || !('PushManager' in window)) {
+            showToast('This browser does not support push notifications');
+            return;
+        }
+        try {
+            if (await Notification.requestPermission() !== 'granted') {
+                showToast('Notifications are blocked for this site');
+                return;
+            }
+            const keyRes = await fetch('/api/push/key');
+            if (!keyRes.ok) { showToast(await keyRes.text()); return; }
+            const { public_key: publicKey } = await keyRes.json();
+            const raw = atob(publicKey.replace(/-/g, '+').replace(/_/g, '/'));
+            const applicationServerKey = Uint8Array.from(raw, c => c.charCodeAt(0));
+
+            const reg = await navigator.serviceWorker.ready;
+            let sub = await reg.pushManager.getSubscription();
+            // A subscription made with another key can't be pushed to.
+            const subKey = sub?.options.applicationServerKey;
+            if (sub && subKey && btoa(String.fromCharCode(...new Uint8Array(subKey))) !== btoa(raw)) {
+                await sub.unsubscribe();
+                sub = null;
+            }
+            if (!sub) sub = await reg.pushManager.subscribe({ userVisibleOnly: true, applicationServerKey });
+            const res = await fetch('/api/push/subscribe', {
+                method: 'POST', headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(sub)
+            });
+            if (!res.ok) { showToast(await res.text()); return; }
+            showToast('Push notifications enabled on this device');
+        } catch (e) {
+            showToast('Could not enable push notifications');
+        }
+    };
+
+    const pushTestBtn = document.getElementById('pushTestBtn');
+    if (pushTestBtn) pushTestBtn.onclick = async () => {
+        try {
+            const res = await fetch('/api/push/test', { method: 'POST' });
+            if (!res.ok) { showToast(await res.text()); return; }
+            const data = await res.json();
+            showToast(data.sent ? `Test notification sent to ${data.sent} device(s)` : 'No device has push notifications enabled');
+        } catch (e) {
+            showToast('Test notification failed');
+        }
+    };
+
+    // Import a full backup
+    const importDumpBtn = document.getElementById('importDumpBtn');
+    if (importDumpBtn) importDumpBtn.onclick = async () => {
+        const fileInput = document.getElementById('dumpFile');
+        if (!fileInput.files.length) { showToast('Select a file first'); return; }
+        showToast('Importing backup...', 600000);
+        try {
+            const res = await fetch('/api/import/dump', { method: 'POST', body: fileInput.files[0] });
+            if (!res.ok) { showToast(`Import failed: ${(await res.text()).trim()}`); return; }
+            const { report } = await res.json();
+            showToast(`Imported ${report.feeds} feeds and ${report.items} items (${report.existing} already present)`);
+            setTimeout(() => location.reload(), 2000);
+        } catch (e) {
+            showToast('Backup import failed');
         }
     };
 
@@ -478,12 +915,42 @@
         if (!fileInput.files.length) { showToast('Select a file first'); return; }
         const formData = new FormData();
         formData.append('opml', fileInput.files[0]);
-        showToast('Importing...', 15000);
+        showToast('Importing...', 60000);
         try {
-            const res = await fetch('/api/import-opml', { method: 'POST', body: formData });
-            const data = await res.json();
-            showToast(`Imported ${data.imported} of ${data.total} feeds. Click "Update Feeds" to fetch items.`);
-            setTimeout(() => location.reload(), 2000);
+            const res = await fetch('/api/import-opml', {
+                method: 'POST',
+                body: formData,
+                headers: { 'Accept': 'text/event-stream' }
+            });
+            if (!res.ok) { showToast(`Import failed: ${(await res.text()).trim()}`); return; }
+            // The response is a stream of server-sent events.
+            const reader = res.body.getReader();
+            const decoder = new TextDecoder();
+            let buf = '';
+            for (;;) {
+                const { done, value } = await reader.read();
+                if (done) break;
+                buf += decoder.decode(value, { stream: true });
+                let end;
+                while ((end = buf.indexOf('\n\n')) >= 0) {
+                    const block = buf.slice(0, end);
+                    buf = buf.slice(end + 2);
+                    const name = (block.match(/^event: (.*)$/m) || [])[1];
+                    const data = JSON.parse((block.match(/^data: (.*)$/m) || [])[1] || '{}');
+                    if (name === 'progress') {
+                        showToast(`Importing ${data.done}/${data.total} feeds...`, 60000);
+                    } else if (name === 'error') {
+                        showToast(data.error);
+                        return;
+                    } else if (name === 'end') {
+                        const skipped = data.invalid ? `, ${data.invalid} invalid` : '';
+                        showToast(`Imported ${data.imported} of ${data.total} feeds (${data.exists} already subscribed${skipped}). Click "Update Feeds" to fetch items.`);
+                        setTimeout(() => location.reload(), 2000);
+                        return;
+                    }
+                }
+            }
+            showToast('Import failed');
         } catch (e) { showToast('Import failed'); }
     };
 
@@ -498,14 +965,275 @@
         } catch (e) { showToast('Cleanup failed'); }
     };
 
-    // Expand items on click
-    itemsContainer?.addEventListener('click', e => {
+    // Sort the item list; a new shuffle each time Shuffle is picked
+    const itemSort = document.getElementById('itemSort');
+    if (itemSort) {
+        const params = new URLSearchParams(location.search);
+        itemSort.value = params.get('sort') || '';
+        itemSort.onchange = () => {
+            params.delete('seed');
+            if (itemSort.value) params.set('sort', itemSort.value);
+            else params.delete('sort');
+            location.search = params.toString();
+        };
+    }
+
+    // Mark everything in a smart view as read
+    const markViewReadBtn = document.getElementById('markViewReadBtn');
+    if (markViewReadBtn) markViewReadBtn.onclick = async () => {
+        try {
+            const res = await fetch(`/api/view/${markViewReadBtn.dataset.view}/mark-read`, { method: 'POST' });
+            if (!res.ok) { showToast('Failed to mark read'); return; }
+            const data = await res.json();
+            document.querySelectorAll('.item.unread').forEach(item => {
+                item.classList.remove('unread');
+                item.classList.add('read');
+            });
+            showToast(`Marked ${data.marked} items read`);
+        } catch (e) { showToast('Failed to mark read'); }
+    };
+
+    // Accept or dismiss the new URL rediscovered for a feed that went missing
+    const suggestedUrl = document.querySelector('.feed-suggested-url');
+    const answerSuggestedUrl = async (method, done) => {
+        try {
+            const res = await fetch(`/api/feed/${suggestedUrl.dataset.feedId}/suggested-url`, { method });
+            if (!res.ok) { showToast(await res.text()); return; }
+            suggestedUrl.remove();
+            showToast(done);
+        } catch (e) { showToast('Failed to update feed'); }
+    };
+    document.getElementById('applySuggestedUrlBtn')?.addEventListener('click', () =>
+        answerSuggestedUrl('POST', 'Feed URL updated, fetched on the next refresh'));
+    document.getElementById('dismissSuggestedUrlBtn')?.addEventListener('click', () =>
+        answerSuggestedUrl('DELETE', 'Suggestion dismissed'));
+
+    // Send the current folder or starred items to Kindle as an EPUB
+    document.querySelector('.kindle-btn')?.addEventListener('click', async e => {
+        const btn = e.currentTarget;
+        btn.disabled = true;
+        showToast('Sending to Kindle...', 60000);
+        try {
+            const query = btn.dataset.query ? `${btn.dataset.query}&send=kindle` : 'send=kindle';
+            const res = await fetch(`/api/export/epub?${query}`);
+            if (!res.ok) { showToast(await res.text()); return; }
+            const data = await res.json();
+            showToast(`Sent ${data.items} items to ${data.sent}`);
+        } catch (e) { showToast('Failed to send'); }
+        finally { btn.disabled = false; }
+    });
+
+    // Lists only carry snippets; an item's content is loaded when it is
+    // first expanded.
+    const loadContent = async (item) => {
+        const content = item.querySelector('.item-content[data-lazy]');
+        if (!content) return;
+        delete content.dataset.lazy;
+        try {
+            const res = await fetch(`/partials/item/${item.dataset.itemId}`);
+            if (!res.ok) throw new Error(res.statusText);
+            const tpl = document.createElement('template');
+            tpl.innerHTML = await res.text();
+            content.innerHTML = tpl.content.querySelector('.item-content')?.innerHTML ?? '';
+        } catch (e) {
+            content.dataset.lazy = '';
+            showToast('Failed to load item');
+        }
+    };
+
+    // Reading positions: how far an expanded item's content has scrolled
+    // past the top of the list, in percent. They are saved while scrolling
+    // and restored when the item is expanded again, here or elsewhere.
+    const readPosition = (item) => {
+        const content = item.querySelector('.item-content');
+        const rect = content.getBoundingClientRect();
+        if (rect.height === 0) return 0;
+        const top = itemsContainer.getBoundingClientRect().top;
+        return Math.min(100, Math.max(0, (top - rect.top) / rect.height * 100));
+    };
+    const restorePosition = (item) => {
+        const position = parseFloat(item.dataset.position || '0');
+        if (position <= 0 || position >= 99) return;
+        const content = item.querySelector('.item-content');
+        const offset = content.getBoundingClientRect().top - itemsContainer.getBoundingClientRect().top;
+        itemsContainer.scrollTop += offset + content.offsetHeight * position / 100;
+    };
+    let positionTimer = null;
+    itemsContainer?.addEventListener('scroll', () => {
+        clearTimeout(positionTimer);
+        positionTimer = setTimeout(() => {
+            itemsContainer.querySelectorAll('.item.expanded').forEach(item => {
+                if (item.querySelector('.item-content[data-lazy]')) return;
+                const position = Math.round(readPosition(item) * 10) / 10;
+                if (Math.abs(position - parseFloat(item.dataset.position || '0')) < 1) return;
+                item.dataset.position = position;
+                fetch(`/api/item/${item.dataset.itemId}/position`, {
+                    method: 'PUT',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ position }),
+                }).catch(() => {});
+            });
+        }, 1000);
+    });
+
+    // Expand items on click, resuming where they were left
+    itemsContainer?.addEventListener('click', async e => {
         const item = e.target.closest('.item');
-        if (item && !e.target.closest('a')) item.classList.toggle('expanded');
+        if (item && !e.target.closest('a') && !e.target.closest('button')) {
+            if (item.classList.toggle('expanded')) {
+                await loadContent(item);
+                restorePosition(item);
+            }
+        }
     });
 
+    // Load click-to-play video embeds
+    itemsContainer?.addEventListener('click', e => {
+        const embed = e.target.closest('.video-embed');
+        if (!embed || embed.querySelector('iframe')) return;
+        e.preventDefault();
+        const frame = document.createElement('iframe');
+        frame.src = embed.dataset.embedSrc;
+        frame.allow = 'autoplay; encrypted-media; fullscreen; picture-in-picture';
+        frame.allowFullscreen = true;
+        frame.loading = 'lazy';
+        embed.replaceChildren(frame);
+        embed.classList.add('playing');
+    });
+
+    // Edit item notes
+    itemsContainer?.addEventListener('click', async e => {
+        const btn = e.target.closest('.item-note-btn');
+        if (!btn) return;
+        const item = btn.closest('.item');
+        const note = prompt('Note for this item (leave empty to remove):', btn.dataset.note || '');
+        if (note === null) return;
+        try {
+            const res = await fetch(`/api/item/${item.dataset.itemId}/note`, {
+                method: 'PUT', headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ note })
+            });
+            if (!res.ok) { showToast('Failed to save note'); return; }
+            const data = await res.json();
+            btn.dataset.note = data.note;
+            let noteEl = item.querySelector('.item-note');
+            if (data.note) {
+                if (!noteEl) {
+                    noteEl = document.createElement('div');
+                    noteEl.className = 'item-note';
+                    item.querySelector('.item-header').after(noteEl);
+                }
+                noteEl.textContent = data.note;
+            } else if (noteEl) {
+                noteEl.remove();
+            }
+            showToast('Note saved');
+        } catch (err) { showToast('Error saving note'); }
+    });
+
+    // Star items
+    itemsContainer?.addEventListener('click', async e => {
+        const btn = e.target.closest('.item-star-btn');
+        if (!btn) return;
+        const item = btn.closest('.item');
+        const starred = !btn.classList.contains('starred');
+        try {
+            const res = await fetch(`/api/item/${item.dataset.itemId}/star`, {
+                method: 'PUT', headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ starred })
+            });
+            if (!res.ok) { showToast('Failed to save star'); return; }
+            btn.classList.toggle('starred', starred);
+            btn.textContent = starred ? '★' : '☆';
+        } catch (err) { showToast('Error saving star'); }
+    });
+
+    // Mark the items above or below one as read, within the current listing
+    itemsContainer?.addEventListener('click', async e => {
+        const btn = e.target.closest('.item-mark-btn');
+        if (!btn) return;
+        const item = btn.closest('.item');
+        const scope = new URLSearchParams((itemsContainer.dataset.fragment || '').split('?')[1] || '');
+        scope.set(`${btn.dataset.direction}_than`, item.dataset.itemId);
+        try {
+            const res = await fetch(`/api/items/mark-read?${scope}`, { method: 'POST' });
+            if (!res.ok) { showToast(await res.text()); return; }
+            const data = await res.json();
+            showToast(`Marked ${data.marked} item${data.marked === 1 ? '' : 's'} as read`);
+            reloadItems();
+        } catch (err) { showToast('Error marking items read'); }
+    });
+
+    // Save items to the Wayback Machine
+    itemsContainer?.addEventListener('click', async e => {
+        const btn = e.target.closest('.item-wayback-btn');
+        if (!btn) return;
+        const item = btn.closest('.item');
+        btn.disabled = true;
+        showToast('Saving to the Wayback Machine...', 180000);
+        try {
+            const res = await fetch(`/api/item/${item.dataset.itemId}/wayback`, { method: 'POST' });
+            if (!res.ok) { showToast(await res.text()); btn.disabled = false; return; }
+            const data = await res.json();
+            const link = document.createElement('a');
+            link.className = 'item-archive-link';
+            link.href = data.wayback_url;
+            link.target = '_blank';
+            link.title = 'Wayback Machine capture';
+            link.textContent = '🏛';
+            btn.replaceWith(link);
+            showToast('Saved to the Wayback Machine');
+        } catch (err) { showToast('Error saving to the Wayback Machine'); btn.disabled = false; }
+    });
+
+    // Subscribe to an item's comments feed
+    itemsContainer?.addEventListener('click', async e => {
+        const btn = e.target.closest('.item-comments-btn');
+        if (!btn) return;
+        const item = btn.closest('.item');
+        btn.disabled = true;
+        try {
+            const res = await fetch(`/api/item/${item.dataset.itemId}/subscribe-comments`, { method: 'POST' });
+            if (!res.ok) { showToast(await res.text()); btn.disabled = false; return; }
+            const data = await res.json();
+            if (data.is_new) {
+                showToast('Subscribed to comments! Updating...');
+                await fetch(`/api/refresh-feed/${data.feed_id}`, { method: 'POST' });
+                setTimeout(() => location.reload(), 500);
+            } else {
+                showToast('Already subscribed to these comments');
+                btn.disabled = false;
+            }
+        } catch (err) { showToast('Error subscribing to comments'); btn.disabled = false; }
+    });
+
+    // Queue podcast episode downloads
+    itemsContainer?.addEventListener('click', async e => {
+        const btn = e.target.closest('.item-download-btn');
+        if (!btn) return;
+        const item = btn.closest('.item');
+        btn.disabled = true;
+        try {
+            const res = await fetch(`/api/item/${item.dataset.itemId}/download`, { method: 'POST' });
+            if (!res.ok) { showToast(await res.text()); btn.disabled = false; return; }
+            btn.textContent = 'Downloading…';
+            showToast('Episode queued for download');
+        } catch (err) { showToast('Error queueing download'); btn.disabled = false; }
+    });
+
+    // Record opened items so the interest ranking can learn from them
+    const recordOpen = e => {
+        const link = e.target.closest('.item-title a');
+        if (!link) return;
+        const item = link.closest('.item');
+        navigator.sendBeacon(`/api/item/${item.dataset.itemId}/open`);
+    };
+    itemsContainer?.addEventListener('click', recordOpen);
+    itemsContainer?.addEventListener('auxclick', recordOpen);
+
     // Drag and drop for feeds
     let draggedFeed = null;
+    let draggedFolder = null;
 
     // Helper to move feed to folder
     async function moveFeedToFolder(feedId, targetFolderId) {
@@ -532,6 +1260,24 @@
         }
     }
 
+    // Save the sidebar order as currently shown, switching to manual sorting
+    async function saveSidebarOrder() {
+        const folders = [...document.querySelectorAll('.folder[data-folder-id]')]
+            .map(el => parseInt(el.dataset.folderId, 10));
+        const feeds = [...document.querySelectorAll('.feed-item[data-feed-id]')]
+            .map(el => parseInt(el.dataset.feedId, 10));
+        try {
+            const res = await fetch('/api/sidebar/order', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ folders, feeds })
+            });
+            showToast(res.ok ? 'Order saved' : 'Failed to save order');
+        } catch (e) {
+            showToast('Error saving order');
+        }
+    }
+
     // Clear all drag-over styles
     function clearDragStyles() {
         document.querySelectorAll('.drop-zone').forEach(z => z.classList.remove('drag-over'));
@@ -572,6 +1318,14 @@
             e.preventDefault();
             clearDragStyles();
             if (!draggedFeed) return;
+            // Dropping onto another feed of the same folder reorders instead of moving.
+            const target = e.target.closest('.feed-item');
+            if (target && target !== draggedFeed && draggedFeed.closest('.drop-zone') === zone) {
+                e.stopPropagation();
+                zone.insertBefore(draggedFeed, target);
+                await saveSidebarOrder();
+                return;
+            }
             await moveFeedToFolder(draggedFeed.dataset.feedId, zone.dataset.folderId);
         });
     });
@@ -595,29 +1349,107 @@
         folder.addEventListener('drop', async (e) => {
             e.preventDefault();
             clearDragStyles();
+            if (draggedFolder && draggedFolder !== folder) {
+                folder.parentNode.insertBefore(draggedFolder, folder);
+                await saveSidebarOrder();
+                return;
+            }
             if (!draggedFeed) return;
             await moveFeedToFolder(draggedFeed.dataset.feedId, folderId);
         });
+
+        // Folders are reordered by dragging their name onto another folder
+        const toggle = folder.querySelector('.folder-toggle');
+        toggle.draggable = true;
+        toggle.addEventListener('dragstart', (e) => {
+            draggedFolder = folder;
+            e.dataTransfer.effectAllowed = 'move';
+            e.dataTransfer.setData('text/plain', folderId);
+        });
+        toggle.addEventListener('dragend', () => {
+            draggedFolder = null;
+            clearDragStyles();
+        });
     });
 
     // Mark items as read on scroll using IntersectionObserver
     const readItems = new Set();
+    const markItemRead = item => {
+        const id = parseInt(item.dataset.itemId, 10);
+        if (id && !readItems.has(id) && item.classList.contains('unread')) {
+            readItems.add(id);
+            item.classList.remove('unread');
+            item.classList.add('read');
+        }
+    };
     const observer = new IntersectionObserver(entries => {
         entries.forEach(entry => {
-            if (entry.isIntersecting && entry.intersectionRatio >= 0.5) {
-                const item = entry.target;
-                const id = parseInt(item.dataset.itemId, 10);
-                if (id && !readItems.has(id) && item.classList.contains('unread')) {
-                    readItems.add(id);
-                    item.classList.remove('unread');
-                    item.classList.add('read');
-                }
-            }
+            if (entry.isIntersecting && entry.intersectionRatio >= 0.5) markItemRead(entry.target);
         });
     }, { threshold: 0.5 });
 
     document.querySelectorAll('.item.unread').forEach(item => observer.observe(item));
 
+    // Keyboard shortcuts act on the selected item. Their keys come from the
+    // settings, by action.
+    const selectedItem = () => itemsContainer?.querySelector('.item.selected');
+    const moveSelection = step => {
+        const items = Array.from(itemsContainer?.querySelectorAll('.item') || []);
+        const current = selectedItem();
+        const next = current ? items[items.indexOf(current) + step] : items[0];
+        if (!next) return;
+        current?.classList.remove('selected');
+        next.classList.add('selected');
+        next.scrollIntoView({ block: 'nearest' });
+    };
+    const shortcutActions = {
+        next_item: () => moveSelection(1),
+        prev_item: () => moveSelection(-1),
+        mark_read: () => { const item = selectedItem(); if (item) markItemRead(item); },
+        toggle_star: () => selectedItem()?.querySelector('.item-star-btn')?.click(),
+        open_link: () => {
+            const link = selectedItem()?.querySelector('.item-title a');
+            if (link) window.open(link.href, '_blank', 'noopener');
+        },
+    };
+    const shortcutKeys = new Map();
+    if (itemsContainer) {
+        fetch('/api/settings').then(res => res.ok ? res.json() : {}).then(settings => {
+            Object.entries(settings.keyboard_shortcuts || {}).forEach(([action, key]) => {
+                if (key) shortcutKeys.set(key, action);
+            });
+        }).catch(() => { });
+    }
+    const keyName = e => {
+        let name = e.key === ' ' ? 'Space' : e.key;
+        if (e.metaKey) name = `Meta+${name}`;
+        if (e.altKey) name = `Alt+${name}`;
+        if (e.ctrlKey) name = `Ctrl+${name}`;
+        return name;
+    };
+    document.addEventListener('keydown', e => {
+        if (e.target.closest?.('input, textarea, select, [contenteditable]')) return;
+        if (document.querySelector('.modal-overlay.active')) return;
+        const action = shortcutActions[shortcutKeys.get(keyName(e))];
+        if (!action) return;
+        e.preventDefault();
+        action();
+    });
+
+    // Replace the item list with a fresh copy from the server, keeping the
+    // page. Items already read are still deleted when leaving the page.
+    const reloadItems = async () => {
+        const fragment = itemsContainer?.dataset.fragment;
+        if (!fragment) { location.reload(); return; }
+        try {
+            const res = await fetch(fragment);
+            if (!res.ok) throw new Error(res.statusText);
+            collectReadItems();
+            itemsContainer.innerHTML = await res.text();
+            itemsContainer.querySelectorAll('.item.unread').forEach(item => observer.observe(item));
+        } catch (e) { location.reload(); }
+    };
+
     // Periodically send read items to server
     setInterval(() => {
         if (readItems.size === 0) return;
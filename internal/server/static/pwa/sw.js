@@ -0,0 +1,91 @@
+// Infovore service worker: caches the app shell and the latest unread items
+// so they can be read offline, and shows push notifications for new items.
+const CACHE = 'infovore-v1';
+const RECENT_ITEMS = '/api/items/recent';
+const SHELL = [
+    '/offline',
+    '/static/css/style.css',
+    '/static/js/app.js',
+    '/static/pwa/icon.svg',
+    '/manifest.webmanifest',
+];
+
+self.addEventListener('install', event => {
+    event.waitUntil(
+        caches.open(CACHE)
+            .then(cache => cache.addAll(SHELL))
+            .then(() => self.skipWaiting())
+    );
+});
+
+self.addEventListener('activate', event => {
+    event.waitUntil(
+        caches.keys()
+            .then(keys => Promise.all(keys.filter(k => k !== CACHE).map(k => caches.delete(k))))
+            .then(() => self.clients.claim())
+            .then(refreshRecentItems)
+    );
+});
+
+// Fetch the latest unread items into the cache.
+function refreshRecentItems() {
+    return fetch(RECENT_ITEMS).then(res => {
+        if (!res.ok) return;
+        return caches.open(CACHE).then(cache => cache.put(RECENT_ITEMS, res));
+    }).catch(() => { });
+}
+
+self.addEventListener('message', event => {
+    if (event.data === 'refresh') event.waitUntil(refreshRecentItems());
+});
+
+self.addEventListener('fetch', event => {
+    const req = event.request;
+    if (req.method !== 'GET') return;
+    const url = new URL(req.url);
+    if (url.origin !== location.origin) return;
+
+    // Pages and the recent items: network first, falling back to the cache.
+    if (req.mode === 'navigate' || url.pathname === RECENT_ITEMS) {
+        event.respondWith(
+            fetch(req).then(res => {
+                if (res.ok && url.pathname === RECENT_ITEMS && !url.search) {
+                    const copy = res.clone();
+                    caches.open(CACHE).then(cache => cache.put(RECENT_ITEMS, copy));
+                }
+                return res;
+            }).catch(() => caches.match(url.pathname === RECENT_ITEMS ? RECENT_ITEMS : '/offline'))
+        );
+        return;
+    }
+
+    // Static assets: cache first.
+    if (url.pathname.startsWith('/static/') || url.pathname === '/manifest.webmanifest') {
+        event.respondWith(caches.match(req).then(hit => hit || fetch(req)));
+    }
+});
+
+// Push notifications for new items of the feeds and folders flagged to notify.
+self.addEventListener('push', event => {
+    let msg = {};
+    try { msg = event.data ? event.data.json() : {}; } catch (e) { /* not JSON */ }
+    event.waitUntil(self.registration.showNotification(msg.title || 'Infovore', {
+        body: msg.body || '',
+        icon: '/static/pwa/icon.svg',
+        tag: msg.tag,
+        renotify: !!msg.tag,
+        data: { url: msg.url || '/' },
+    }));
+});
+
+// Focus a window already showing the item, or open one.
+self.addEventListener('notificationclick', event => {
+    event.notification.close();
+    const url = new URL(event.notification.data?.url || '/', location.origin).href;
+    event.waitUntil(
+        self.clients.matchAll({ type: 'window', includeUncontrolled: true }).then(windows => {
+            const open = windows.find(w => w.url === url);
+            return open ? open.focus() : self.clients.openWindow(url);
+        })
+    );
+});
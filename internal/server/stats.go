@@ -0,0 +1,42 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/readstats"
+)
+
+// maxStatsDays bounds the reading statistics window to one year.
+const maxStatsDays = 366
+
+// handleStats reports reading statistics over the last days (default 30):
+// items read per day and week, the most read feeds, and the unread backlog
+// at the end of each day.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if d, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && d > 0 {
+		days = min(d, maxStatsDays)
+	}
+
+	now := time.Now()
+	acts, err := s.db.GetReadActivity(r.Context(), readstats.Since(now, days))
+	if err != nil {
+		http.Error(w, "Failed to load reading activity", http.StatusInternalServerError)
+		return
+	}
+	feeds, err := s.db.GetAllFeeds(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to load feeds", http.StatusInternalServerError)
+		return
+	}
+	titles := make(map[int64]string, len(feeds))
+	for _, f := range feeds {
+		titles[f.ID] = f.Title
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(readstats.Compute(acts, titles, days, now))
+}
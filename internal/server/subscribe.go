@@ -0,0 +1,256 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/feedurl"
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// Bulk subscribe limits.
+const (
+	maxBulkURLs         = 500
+	maxBulkPayload      = 1 << 20
+	bulkWorkers         = 4
+	bulkDiscoverTimeout = 30 * time.Second
+)
+
+// bulkResult reports what happened to one URL of a bulk subscribe.
+type bulkResult struct {
+	URL     string `json:"url"`
+	Status  string `json:"status"` // "added", "exists" or "error"
+	FeedID  int64  `json:"feed_id,omitempty"`
+	FeedURL string `json:"feed_url,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// handleBulkAddFeeds subscribes to many URLs at once. The body is either JSON
+// ({"urls": [...], "folder_id": N}) or plain text with one URL per line and
+// the folder given as ?folder_id=N. Each URL may be a feed or a page
+// advertising one.
+func (s *Server) handleBulkAddFeeds(w http.ResponseWriter, r *http.Request) {
+	body := http.MaxBytesReader(w, r.Body, maxBulkPayload)
+	var urls []string
+	var folderID *int64
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var req struct {
+			URLs     []string `json:"urls"`
+			FolderID *int64   `json:"folder_id"`
+		}
+		if err := json.NewDecoder(body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		urls, folderID = req.URLs, req.FolderID
+	} else {
+		var err error
+		if urls, err = readURLList(body); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if v := r.URL.Query().Get("folder_id"); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+				return
+			}
+			folderID = &id
+		}
+	}
+
+	urls = dedupeURLs(urls)
+	if len(urls) == 0 {
+		http.Error(w, "No URLs given", http.StatusBadRequest)
+		return
+	}
+	if len(urls) > maxBulkURLs {
+		http.Error(w, "Too many URLs (max "+strconv.Itoa(maxBulkURLs)+")", http.StatusBadRequest)
+		return
+	}
+	if folderID != nil {
+		if _, err := s.db.GetFolderByID(r.Context(), *folderID); err != nil {
+			storeError(w, r, err, "Folder")
+			return
+		}
+	}
+
+	// Discovery runs in parallel; subscribing is sequential so two URLs
+	// leading to the same feed don't race to create it.
+	results := make([]bulkResult, len(urls))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for n := 0; n < bulkWorkers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = s.discoverFeed(r.Context(), urls[i])
+			}
+		}()
+	}
+	for i := range urls {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	for i := range results {
+		if results[i].Error == "" {
+			s.subscribeDiscovered(r.Context(), &results[i], folderID)
+		}
+	}
+
+	counts := map[string]int{}
+	for _, res := range results {
+		counts[res.Status]++
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"added":   counts["added"],
+		"exists":  counts["exists"],
+		"failed":  counts["error"],
+		"results": results,
+	})
+}
+
+// discoverFeed validates rawURL and finds the feed behind it. The result
+// carries an error or the feed URL and title.
+func (s *Server) discoverFeed(ctx context.Context, rawURL string) bulkResult {
+	res := bulkResult{URL: rawURL, Status: "error"}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		res.Error = "not an http(s) URL"
+		return res
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, bulkDiscoverTimeout)
+	defer cancel()
+	found, err := s.fetcher.Discover(ctx, rawURL)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.FeedURL, res.Title = found.URL, found.Title
+	return res
+}
+
+// subscribeDiscovered subscribes to a discovered feed and records the outcome.
+func (s *Server) subscribeDiscovered(ctx context.Context, res *bulkResult, folderID *int64) {
+	title := res.Title
+	if title == "" {
+		title = res.FeedURL
+	}
+	feedID, isNew, err := s.addFeed(ctx, folderID, title, res.FeedURL)
+	if err != nil {
+		res.Error = "failed to add feed"
+		return
+	}
+	res.FeedID = feedID
+	if isNew {
+		res.Status = "added"
+	} else {
+		res.Status = "exists"
+	}
+}
+
+// addFeed subscribes to a feed after normalizing its URL. If an existing
+// feed's URL only differs in spelling (scheme, case, default port, trailing
+// slash or fragment), that feed is returned instead of a duplicate. A title
+// equal to the URL is a placeholder the first fetch replaces.
+func (s *Server) addFeed(ctx context.Context, folderID *int64, title, rawURL string) (int64, bool, error) {
+	upgrade := database.GetIntSetting(ctx, s.db, model.SettingUpgradeFeedsToHTTPS, 0) != 0
+	feedURL := feedurl.Normalize(rawURL, upgrade)
+	if title == "" || title == rawURL {
+		title = feedURL
+	}
+
+	feeds, err := s.db.GetAllFeeds(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	key := feedurl.Key(feedURL)
+	for _, f := range feeds {
+		if feedurl.Key(f.URL) == key {
+			return f.ID, false, nil
+		}
+	}
+	return s.db.GetOrCreateFeed(ctx, folderID, title, feedURL)
+}
+
+// handleSubscribeComments subscribes to an item's comments feed, in the
+// folder of the item's feed.
+func (s *Server) handleSubscribeComments(w http.ResponseWriter, r *http.Request) {
+	itemID, err := urlID(r, "itemID")
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+	item, err := s.db.GetItemByID(r.Context(), itemID)
+	if err != nil {
+		storeError(w, r, err, "Item")
+		return
+	}
+	if item.CommentsFeed == "" {
+		http.Error(w, "Item has no comments feed", http.StatusBadRequest)
+		return
+	}
+	feed, err := s.db.GetFeedByID(r.Context(), item.FeedID)
+	if err != nil {
+		storeError(w, r, err, "Feed")
+		return
+	}
+
+	feedID, isNew, err := s.addFeed(r.Context(), feed.FolderID, "Comments: "+item.Title, item.CommentsFeed)
+	if err != nil {
+		http.Error(w, "Failed to add feed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"feed_id": feedID,
+		"is_new":  isNew,
+	})
+}
+
+// readURLList reads one URL per line, skipping blank lines and # comments.
+func readURLList(r io.Reader) ([]string, error) {
+	var urls []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, sc.Err()
+}
+
+// dedupeURLs trims URLs and drops blanks and repeats, keeping the first
+// occurrence of each.
+func dedupeURLs(urls []string) []string {
+	seen := make(map[string]bool, len(urls))
+	var out []string
+	for _, u := range urls {
+		u = strings.TrimSpace(u)
+		if u == "" || seen[u] {
+			continue
+		}
+		seen[u] = true
+		out = append(out, u)
+	}
+	return out
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/trash"
+)
+
+// maxTrashItems bounds how many trashed items GET /api/trash lists.
+const maxTrashItems = 500
+
+// trashFeed is a trashed feed as listed by GET /api/trash.
+type trashFeed struct {
+	ID        int64     `json:"id"`
+	Title     string    `json:"title"`
+	URL       string    `json:"url"`
+	ItemCount int       `json:"item_count"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+// trashItem is a trashed item as listed by GET /api/trash.
+type trashItem struct {
+	ID        int64     `json:"id"`
+	FeedID    int64     `json:"feed_id"`
+	Title     string    `json:"title"`
+	Link      string    `json:"link"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+func (s *Server) handleGetTrash(w http.ResponseWriter, r *http.Request) {
+	feeds, err := s.db.GetTrashedFeeds(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to load trash", http.StatusInternalServerError)
+		return
+	}
+	items, err := s.db.GetTrashedItems(r.Context(), maxTrashItems)
+	if err != nil {
+		http.Error(w, "Failed to load trash", http.StatusInternalServerError)
+		return
+	}
+
+	days := trash.RetentionDays(r.Context(), s.db)
+	feedList := make([]trashFeed, 0, len(feeds))
+	for _, f := range feeds {
+		feedList = append(feedList, trashFeed{
+			ID:        f.ID,
+			Title:     f.Title,
+			URL:       f.URL,
+			ItemCount: f.ItemCount,
+			DeletedAt: f.DeletedAt,
+			PurgeAt:   purgeTime(f.DeletedAt, days),
+		})
+	}
+	itemList := make([]trashItem, 0, len(items))
+	for _, it := range items {
+		itemList = append(itemList, trashItem{
+			ID:        it.ID,
+			FeedID:    it.FeedID,
+			Title:     it.Title,
+			Link:      it.Link,
+			DeletedAt: it.DeletedAt,
+			PurgeAt:   purgeTime(it.DeletedAt, days),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"retention_days": days,
+		"feeds":          feedList,
+		"items":          itemList,
+	})
+}
+
+func (s *Server) handleRestoreFeed(w http.ResponseWriter, r *http.Request) {
+	feedID, err := urlID(r, "feedID")
+	if err != nil {
+		http.Error(w, "Invalid feed ID", http.StatusBadRequest)
+		return
+	}
+	if err := s.db.RestoreFeed(r.Context(), feedID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Feed not in trash", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to restore feed", http.StatusInternalServerError)
+		return
+	}
+	s.interest.Trigger()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+	})
+}
+
+func (s *Server) handleRestoreItems(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ItemIDs []int64 `json:"item_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	restored, err := s.db.RestoreItems(r.Context(), req.ItemIDs)
+	if err != nil {
+		http.Error(w, "Failed to restore items", http.StatusInternalServerError)
+		return
+	}
+	if restored > 0 {
+		s.interest.Trigger()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "ok",
+		"restored": restored,
+	})
+}
+
+// handlePurgeTrash empties expired trash now, or the whole trash with ?all=1.
+func (s *Server) handlePurgeTrash(w http.ResponseWriter, r *http.Request) {
+	var feeds, items int64
+	var err error
+	scope := "expired"
+	if r.URL.Query().Get("all") == "1" {
+		scope = "all"
+		feeds, items, err = s.db.PurgeTrash(r.Context(), time.Now())
+	} else {
+		feeds, items, err = trash.Purge(r.Context(), s.db)
+	}
+	if err != nil {
+		http.Error(w, "Failed to purge trash", http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, model.AuditPurgeTrash, fmt.Sprintf("%s: %d feeds, %d items", scope, feeds, items))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"feeds":  feeds,
+		"items":  items,
+	})
+}
+
+// purgeTime returns when something deleted at deletedAt will be purged.
+func purgeTime(deletedAt time.Time, days int) time.Time {
+	return deletedAt.AddDate(0, 0, days)
+}
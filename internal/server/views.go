@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/go-chi/chi/v5"
+)
+
+// Smart view names, used in /view/{view} routes.
+const (
+	ViewToday     = "today"
+	ViewYesterday = "yesterday"
+	ViewWeek      = "week"
+	ViewUnread    = "unread"
+	ViewStarred   = "starred"
+	ViewDeadLinks = "dead-links"
+)
+
+// viewTitles maps each smart view to its page title.
+var viewTitles = map[string]string{
+	ViewToday:     "Today",
+	ViewYesterday: "Yesterday",
+	ViewWeek:      "This Week",
+	ViewUnread:    "All Unread",
+	ViewStarred:   "Starred",
+	ViewDeadLinks: "Dead Links",
+}
+
+// viewFilter returns the item filter for a smart view relative to now, in
+// the server's local time zone. Weeks start on Monday.
+func viewFilter(view string, now time.Time) (model.ItemFilter, bool) {
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	switch view {
+	case ViewToday:
+		return model.ItemFilter{Since: today}, true
+	case ViewYesterday:
+		return model.ItemFilter{Since: today.AddDate(0, 0, -1), Until: today}, true
+	case ViewWeek:
+		offset := (int(today.Weekday()) + 6) % 7 // days since Monday
+		return model.ItemFilter{Since: today.AddDate(0, 0, -offset)}, true
+	case ViewUnread:
+		return model.ItemFilter{OnlyUnread: true}, true
+	case ViewStarred:
+		return model.ItemFilter{Starred: true}, true
+	case ViewDeadLinks:
+		return model.ItemFilter{DeadLinks: true}, true
+	}
+	return model.ItemFilter{}, false
+}
+
+func (s *Server) handleView(w http.ResponseWriter, r *http.Request) {
+	view := chi.URLParam(r, "view")
+	filter, ok := viewFilter(view, time.Now())
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	q, err := itemFilterFromQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.MinWords, filter.MaxWords, filter.Sort, filter.Seed = q.MinWords, q.MaxWords, q.Sort, q.Seed
+
+	s.renderItems(w, r, filter, map[string]interface{}{
+		"CurrentView": view,
+		"PageTitle":   viewTitles[view],
+	})
+}
+
+func (s *Server) handleMarkViewRead(w http.ResponseWriter, r *http.Request) {
+	filter, ok := viewFilter(chi.URLParam(r, "view"), time.Now())
+	if !ok {
+		http.Error(w, "Unknown view", http.StatusNotFound)
+		return
+	}
+	s.holdBackDigest(r.Context(), &filter)
+	marked, err := s.db.MarkReadByFilter(r.Context(), filter)
+	if err != nil {
+		http.Error(w, "Failed to mark read", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"marked": marked,
+	})
+}
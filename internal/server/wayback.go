@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/jobs"
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+)
+
+// waybackTimeout bounds one Save Page Now capture.
+const waybackTimeout = 3 * time.Minute
+
+// handleWaybackItem submits an item's link to the Wayback Machine and
+// stores the capture URL on the item.
+func (s *Server) handleWaybackItem(w http.ResponseWriter, r *http.Request) {
+	itemID, err := urlID(r, "itemID")
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+	item, err := s.db.GetItemByID(r.Context(), itemID)
+	if err != nil {
+		storeError(w, r, err, "Item")
+		return
+	}
+	if item.Link == "" {
+		http.Error(w, "Item has no link", http.StatusBadRequest)
+		return
+	}
+
+	job, err := s.runJob(r, jobWayback, itemJob{ItemID: itemID}, nil)
+	var res waybackResult
+	if err := jobOutcome(job, err, &res); err != nil {
+		http.Error(w, fmt.Sprintf("Wayback error: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      "ok",
+		"wayback_url": res.WaybackURL,
+	})
+}
+
+// waybackResult is the outcome of a Wayback job.
+type waybackResult struct {
+	WaybackURL string `json:"wayback_url"`
+}
+
+// runWaybackJob captures the link of the item in its payload.
+func (s *Server) runWaybackJob(ctx context.Context, j *jobs.Job) (interface{}, error) {
+	var p itemJob
+	if err := j.Decode(&p); err != nil {
+		return nil, err
+	}
+	item, err := s.db.GetItemByID(ctx, p.ItemID)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, waybackTimeout)
+	defer cancel()
+	waybackURL, err := s.saveToWayback(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	return waybackResult{WaybackURL: waybackURL}, nil
+}
+
+// saveToWayback captures an item's link and records the capture URL.
+func (s *Server) saveToWayback(ctx context.Context, item *model.Item) (string, error) {
+	waybackURL, err := s.wayback.Save(ctx, item.Link)
+	if err != nil {
+		return "", err
+	}
+	if err := s.db.SetItemWaybackURL(ctx, item.ID, waybackURL); err != nil {
+		return "", err
+	}
+	return waybackURL, nil
+}
+
+// waybackStarredEnabled reports whether starred items are saved to the
+// Wayback Machine automatically.
+func waybackStarredEnabled(ctx context.Context, db database.Store) bool {
+	return database.GetIntSetting(ctx, db, model.SettingWaybackStarred, 0) != 0
+}
+
+// saveStarredToWayback captures a newly starred item in the background.
+func (s *Server) saveStarredToWayback(ctx context.Context, item *model.Item) {
+	if _, err := s.jobs.Enqueue(ctx, jobWayback, itemJob{ItemID: item.ID}); err != nil {
+		reqid.Logf(ctx, "Wayback: failed to queue item %d: %v", item.ID, err)
+	}
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+	"github.com/bryan-buckman/infovore/internal/webpush"
+)
+
+// maxPushSubscriptionSize caps the size of a subscription request.
+const maxPushSubscriptionSize = 8 << 10
+
+// notifyFolders returns the IDs of the folders whose new items send push
+// notifications.
+func (s *Server) notifyFolders(ctx context.Context) map[int64]bool {
+	notify := make(map[int64]bool)
+	for _, id := range webpush.Folders(ctx, s.db) {
+		notify[id] = true
+	}
+	return notify
+}
+
+// handleSetFolderNotify turns push notifications for a folder's new items
+// on or off.
+func (s *Server) handleSetFolderNotify(w http.ResponseWriter, r *http.Request) {
+	folderID, err := urlID(r, "folderID")
+	if err != nil {
+		http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Notify bool `json:"notify"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.db.GetFolderByID(r.Context(), folderID); err != nil {
+		storeError(w, r, err, "Folder")
+		return
+	}
+	folders, err := s.db.GetFolders(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to load folders", http.StatusInternalServerError)
+		return
+	}
+
+	// Rewrite the whole list, dropping folders that no longer exist.
+	state := s.notifyFolders(r.Context())
+	state[folderID] = req.Notify
+	ids := []int64{}
+	for _, f := range folders {
+		if state[f.ID] {
+			ids = append(ids, f.ID)
+		}
+	}
+	data, _ := json.Marshal(ids)
+	if err := s.db.SetSetting(r.Context(), model.SettingNotifyFolders, string(data)); err != nil {
+		http.Error(w, "Failed to save", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":         "ok",
+		"notify_folders": ids,
+	})
+}
+
+// handleGetPushKey returns the VAPID public key browsers subscribe with,
+// generating it on first use.
+func (s *Server) handleGetPushKey(w http.ResponseWriter, r *http.Request) {
+	key, err := webpush.PublicKey(r.Context(), s.db)
+	if err != nil {
+		reqid.Logf(r.Context(), "Push key: %v", err)
+		http.Error(w, "Failed to load push key", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"public_key":    key,
+		"subscriptions": len(webpush.Subscriptions(r.Context(), s.db)),
+	})
+}
+
+// handlePushSubscribe stores a browser's push subscription, as sent by
+// PushSubscription.toJSON().
+func (s *Server) handlePushSubscribe(w http.ResponseWriter, r *http.Request) {
+	var sub webpush.Subscription
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPushSubscriptionSize)).Decode(&sub); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := sub.Validate(); err != nil {
+		http.Error(w, "Invalid subscription: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := webpush.Subscribe(r.Context(), s.db, sub); err != nil {
+		http.Error(w, "Failed to save subscription", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok"})
+}
+
+// handlePushUnsubscribe removes a browser's push subscription by endpoint.
+func (s *Server) handlePushUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Endpoint string `json:"endpoint"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPushSubscriptionSize)).Decode(&req); err != nil || req.Endpoint == "" {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	removed, err := webpush.Unsubscribe(r.Context(), s.db, req.Endpoint)
+	if err != nil {
+		http.Error(w, "Failed to remove subscription", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"removed": removed,
+	})
+}
+
+// handlePushTest sends a test notification to every subscribed browser.
+func (s *Server) handlePushTest(w http.ResponseWriter, r *http.Request) {
+	sent, err := webpush.Send(r.Context(), s.db, webpush.Message{
+		Title: "Infovore",
+		Body:  "Push notifications are working.",
+		URL:   "/",
+		Tag:   "test",
+	})
+	if err != nil {
+		reqid.Logf(r.Context(), "Test push: %v", err)
+		http.Error(w, "Push failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"sent":   sent,
+	})
+}
@@ -0,0 +1,180 @@
+// Package snapshot downloads web pages and reduces them to cleaned,
+// script-free HTML suitable for long-term storage.
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+
+	"github.com/bryan-buckman/infovore/internal/reqid"
+)
+
+// MaxPageSize bounds how much of a page is downloaded.
+const MaxPageSize = 5 << 20
+
+// UserAgent is sent with snapshot requests.
+const UserAgent = "Infovore/1.0 (page archiver)"
+
+// Page is a cleaned snapshot of a web page.
+type Page struct {
+	URL   string // final URL after redirects
+	Title string
+	HTML  string
+}
+
+// Fetch downloads pageURL and cleans it.
+func Fetch(ctx context.Context, pageURL string) (*Page, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	reqid.Set(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("fetch %s: http error: %d %s", pageURL, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" && !strings.Contains(ct, "html") {
+		return nil, fmt.Errorf("fetch %s: not an HTML page (%s)", pageURL, ct)
+	}
+	body, err := charset.NewReader(io.LimitReader(resp.Body, MaxPageSize), resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	doc, err := html.Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	title, content := Clean(doc, resp.Request.URL)
+	return &Page{URL: resp.Request.URL.String(), Title: title, HTML: content}, nil
+}
+
+// Clean extracts the title and main content of a parsed page. Scripts,
+// styles, embeds, forms and page chrome are removed, only presentational
+// attributes are kept, and links and images are made absolute against base.
+func Clean(doc *html.Node, base *url.URL) (title, content string) {
+	if t := find(doc, atom.Title); t != nil {
+		title = strings.Join(strings.Fields(text(t)), " ")
+	}
+	root := find(doc, atom.Article)
+	if root == nil {
+		root = find(doc, atom.Main)
+	}
+	if root == nil {
+		root = find(doc, atom.Body)
+	}
+	if root == nil {
+		return title, ""
+	}
+	clean(root, base)
+	var b bytes.Buffer
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		html.Render(&b, c)
+	}
+	return title, strings.TrimSpace(b.String())
+}
+
+// dropped lists elements removed together with their content.
+var dropped = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Link: true, atom.Meta: true,
+	atom.Iframe: true, atom.Object: true, atom.Embed: true, atom.Frame: true, atom.Frameset: true,
+	atom.Form: true, atom.Input: true, atom.Button: true, atom.Select: true, atom.Textarea: true,
+	atom.Nav: true, atom.Aside: true, atom.Footer: true, atom.Template: true, atom.Svg: true,
+	atom.Canvas: true, atom.Dialog: true,
+}
+
+// keptAttrs lists the attributes that survive cleaning.
+var keptAttrs = map[string]bool{
+	"href": true, "src": true, "alt": true, "title": true, "colspan": true, "rowspan": true,
+	"datetime": true, "cite": true, "lang": true, "dir": true, "width": true, "height": true,
+}
+
+func clean(n *html.Node, base *url.URL) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.Type == html.CommentNode, c.Type == html.ElementNode && dropped[c.DataAtom]:
+			n.RemoveChild(c)
+		case c.Type == html.ElementNode:
+			cleanAttrs(c, base)
+			clean(c, base)
+		}
+		c = next
+	}
+}
+
+func cleanAttrs(n *html.Node, base *url.URL) {
+	// Lazy-loaded images often keep the real source in data-src.
+	if n.DataAtom == atom.Img && attr(n, "src") == "" {
+		if lazy := attr(n, "data-src"); lazy != "" {
+			n.Attr = append(n.Attr, html.Attribute{Key: "src", Val: lazy})
+		}
+	}
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		if a.Namespace != "" || !keptAttrs[a.Key] {
+			continue
+		}
+		if a.Key == "href" || a.Key == "src" || a.Key == "cite" {
+			u, err := base.Parse(strings.TrimSpace(a.Val))
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "mailto") {
+				continue
+			}
+			a.Val = u.String()
+		}
+		attrs = append(attrs, a)
+	}
+	n.Attr = attrs
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// find returns the first element of the given type in document order.
+func find(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := find(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// text returns the text content of a node.
+func text(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
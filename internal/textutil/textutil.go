@@ -0,0 +1,207 @@
+// Package textutil provides helpers for turning feed HTML into plain text
+// and extracting words and links from it.
+package textutil
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// WordsPerMinute is the reading speed used for reading time estimates.
+const WordsPerMinute = 230
+
+// DefaultSnippetLength is the length of item snippets in characters, and
+// MaxSnippetLength the longest allowed.
+const (
+	DefaultSnippetLength = 300
+	MaxSnippetLength     = 2000
+)
+
+// PlainText strips markup from an HTML fragment, decoding entities and
+// dropping script and style contents. Whitespace is collapsed.
+func PlainText(fragment string) string {
+	z := html.NewTokenizer(strings.NewReader(fragment))
+	var b strings.Builder
+	skip := 0
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return strings.Join(strings.Fields(b.String()), " ")
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "script", "style":
+				skip++
+			case "br", "p", "div", "li", "h1", "h2", "h3", "h4", "h5", "h6", "tr", "blockquote":
+				b.WriteByte(' ')
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "script", "style":
+				if skip > 0 {
+					skip--
+				}
+			case "p", "div", "li", "h1", "h2", "h3", "h4", "h5", "h6", "tr", "blockquote":
+				b.WriteByte(' ')
+			}
+		case html.TextToken:
+			if skip == 0 {
+				b.Write(z.Text())
+			}
+		}
+	}
+}
+
+// MaxTitleLength is the longest item title kept, in characters.
+const MaxTitleLength = 300
+
+// titleTags are the elements Title strips from titles. Other tags are kept
+// as text, since a title like "Using Vec<T>" is more likely than markup
+// nobody has heard of.
+var titleTags = map[string]bool{
+	"a": true, "abbr": true, "b": true, "bdi": true, "bdo": true, "big": true, "br": true, "cite": true,
+	"code": true, "del": true, "dfn": true, "div": true, "em": true, "font": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "i": true, "img": true, "ins": true, "kbd": true,
+	"mark": true, "p": true, "q": true, "s": true, "samp": true, "script": true, "small": true,
+	"span": true, "strike": true, "strong": true, "style": true, "sub": true, "sup": true, "time": true,
+	"tt": true, "u": true, "var": true, "wbr": true,
+}
+
+// Title normalizes an item title for display: HTML tags are stripped,
+// entities decoded, whitespace collapsed and overlong titles shortened
+// like a Snippet.
+func Title(raw string) string {
+	z := html.NewTokenizer(strings.NewReader(raw))
+	var b strings.Builder
+	skip := 0
+	for done := false; !done; {
+		switch z.Next() {
+		case html.ErrorToken:
+			done = true
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			// Token lowercases the tag name in place, so copy the raw
+			// text first.
+			raw := string(z.Raw())
+			tt := z.Token()
+			switch {
+			case !titleTags[tt.Data]:
+				if skip == 0 {
+					b.WriteString(raw)
+				}
+			case tt.Data == "script" || tt.Data == "style":
+				if tt.Type == html.StartTagToken {
+					skip++
+				} else if tt.Type == html.EndTagToken && skip > 0 {
+					skip--
+				}
+			case tt.Data == "br":
+				b.WriteByte(' ')
+			}
+		case html.TextToken:
+			if skip == 0 {
+				b.Write(z.Text())
+			}
+		}
+	}
+	return Snippet(strings.Join(strings.Fields(b.String()), " "), MaxTitleLength)
+}
+
+// Snippet shortens plain text to at most n characters, cutting at a word
+// boundary where there is one and marking the cut with an ellipsis.
+func Snippet(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	cut := n
+	for i := n; i > n/2; i-- {
+		if unicode.IsSpace(runes[i]) {
+			cut = i
+			break
+		}
+	}
+	return strings.TrimRightFunc(string(runes[:cut]), func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	}) + "…"
+}
+
+// WordCount counts the words in plain text.
+func WordCount(text string) int {
+	return len(strings.FieldsFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r)
+	}))
+}
+
+// stopwords are common English words that carry no topical signal.
+var stopwords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`a about after all also an and any are as at be been but by can could did do
+		does for from had has have he her his how if in into is it its just like more most my new no not now
+		of on one or our out over she so some than that the their them then there these they this to too up
+		us was we were what when where which who why will with would you your`) {
+		stopwords[w] = true
+	}
+}
+
+// Keywords splits text into lowercased words, dropping stopwords, single
+// characters and bare numbers.
+func Keywords(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	out := words[:0]
+	for _, w := range words {
+		if len([]rune(w)) < 2 || stopwords[w] || isNumber(w) {
+			continue
+		}
+		out = append(out, w)
+	}
+	return out
+}
+
+func isNumber(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Links returns the href of every anchor in an HTML fragment.
+func Links(fragment string) []string {
+	z := html.NewTokenizer(strings.NewReader(fragment))
+	var links []string
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return links
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			if string(name) != "a" {
+				continue
+			}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				if string(key) == "href" && len(val) > 0 {
+					links = append(links, string(val))
+				}
+			}
+		}
+	}
+}
+
+// ReadingMinutes estimates the reading time for a number of words,
+// rounding up so any non-empty text takes at least a minute.
+func ReadingMinutes(words int) int {
+	if words <= 0 {
+		return 0
+	}
+	return int(math.Ceil(float64(words) / WordsPerMinute))
+}
@@ -0,0 +1,242 @@
+// Package transform rewrites the content of a feed's items as they are
+// fetched, following the feed's list of transforms: removing the elements
+// a CSS selector matches, such as a trailing ad block, replacing text
+// matching a regular expression, and making relative URLs absolute.
+package transform
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// MaxTransforms bounds the transforms of a feed.
+const MaxTransforms = 20
+
+// maxExprLen bounds selectors and patterns.
+const maxExprLen = 1000
+
+// urlAttrs lists the attributes holding a single URL.
+var urlAttrs = map[string]bool{"href": true, "src": true, "poster": true, "cite": true}
+
+// Chain is a compiled list of transforms.
+type Chain struct {
+	steps []func(content string, base *url.URL) string
+}
+
+// Compile checks a list of transforms and prepares it to be applied.
+func Compile(ts []model.ContentTransform) (*Chain, error) {
+	if len(ts) > MaxTransforms {
+		return nil, fmt.Errorf("at most %d transforms", MaxTransforms)
+	}
+	c := &Chain{}
+	for i, t := range ts {
+		step, err := compile(t)
+		if err != nil {
+			return nil, fmt.Errorf("transform %d: %w", i+1, err)
+		}
+		c.steps = append(c.steps, step)
+	}
+	return c, nil
+}
+
+func compile(t model.ContentTransform) (func(string, *url.URL) string, error) {
+	switch t.Op {
+	case model.TransformStripSelector:
+		if t.Selector == "" || len(t.Selector) > maxExprLen {
+			return nil, fmt.Errorf("%s needs a selector of 1 to %d characters", t.Op, maxExprLen)
+		}
+		sel, err := cascadia.Compile(t.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", t.Selector, err)
+		}
+		return func(content string, _ *url.URL) string {
+			return rewrite(content, func(root *html.Node) bool { return strip(root, sel) })
+		}, nil
+	case model.TransformRegexReplace:
+		if t.Pattern == "" || len(t.Pattern) > maxExprLen {
+			return nil, fmt.Errorf("%s needs a pattern of 1 to %d characters", t.Op, maxExprLen)
+		}
+		re, err := regexp.Compile(t.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", t.Pattern, err)
+		}
+		return func(content string, _ *url.URL) string {
+			return re.ReplaceAllString(content, t.Replace)
+		}, nil
+	case model.TransformAbsolutizeURLs:
+		return Absolutize, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", t.Op)
+}
+
+// Apply runs the transforms on an HTML fragment in order. base is the URL
+// relative URLs are resolved against, see Base.
+func (c *Chain) Apply(content string, base *url.URL) string {
+	for _, step := range c.steps {
+		content = step(content, base)
+	}
+	return content
+}
+
+// Base returns the URL relative URLs in an item's content refer to: the
+// item's link, see ResolveLink, else the feed's site or the feed itself.
+// It returns nil if none of them is an absolute http(s) URL.
+func Base(link string, feed model.Feed) *url.URL {
+	if u := httpURL(ResolveLink(link, feed)); u != nil {
+		return u
+	}
+	return feedBase(feed)
+}
+
+// ResolveLink returns an item's link resolved against the feed's site or
+// the feed itself if it is relative, and link unchanged otherwise.
+func ResolveLink(link string, feed model.Feed) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || link == "" || u.IsAbs() {
+		return link
+	}
+	if base := feedBase(feed); base != nil {
+		return base.ResolveReference(u).String()
+	}
+	return link
+}
+
+// feedBase returns the feed's site, else the feed itself, nil if neither
+// is an absolute http(s) URL, as for virtual feeds.
+func feedBase(feed model.Feed) *url.URL {
+	if u := httpURL(feed.SiteURL); u != nil {
+		return u
+	}
+	return httpURL(feed.URL)
+}
+
+func httpURL(raw string) *url.URL {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil
+	}
+	return u
+}
+
+// Absolutize resolves the relative URLs of links, images, media and their
+// srcset candidates in an HTML fragment against base. Links within the
+// page, such as to footnotes, are left alone. The fragment is returned
+// unchanged if base is nil or it holds no relative URLs.
+func Absolutize(content string, base *url.URL) string {
+	if base == nil || !strings.Contains(content, "<") {
+		return content
+	}
+	return rewrite(content, func(root *html.Node) bool { return absolutize(root, base) })
+}
+
+// rewrite parses an HTML fragment, changes it with fn and renders it again.
+// The fragment is returned unchanged if it can't be parsed or fn reports
+// that it changed nothing.
+func rewrite(content string, fn func(root *html.Node) bool) string {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(content), body)
+	if err != nil {
+		return content
+	}
+	for _, n := range nodes {
+		body.AppendChild(n)
+	}
+	if !fn(body) {
+		return content
+	}
+	var b strings.Builder
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&b, c); err != nil {
+			return content
+		}
+	}
+	return b.String()
+}
+
+// strip removes the elements below root that sel matches, reporting
+// whether there were any.
+func strip(root *html.Node, sel cascadia.Selector) bool {
+	changed := false
+	for _, n := range sel.MatchAll(root) {
+		if n != root && n.Parent != nil {
+			n.Parent.RemoveChild(n)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// absolutize resolves the URL attributes of n and the elements below it,
+// reporting whether any changed.
+func absolutize(n *html.Node, base *url.URL) bool {
+	changed := false
+	if n.Type == html.ElementNode {
+		for i, a := range n.Attr {
+			val := a.Val
+			switch {
+			case a.Namespace != "":
+			case urlAttrs[a.Key]:
+				val = resolve(a.Val, base)
+			case a.Key == "srcset":
+				val = resolveSrcset(a.Val, base)
+			}
+			if val != a.Val {
+				n.Attr[i].Val = val
+				changed = true
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if absolutize(c, base) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// resolve returns ref resolved against base, or ref itself if it is
+// absolute, refers within the page or doesn't parse.
+func resolve(ref string, base *url.URL) string {
+	trimmed := strings.TrimSpace(ref)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return ref
+	}
+	u, err := url.Parse(trimmed)
+	if err != nil || u.IsAbs() {
+		return ref
+	}
+	return base.ResolveReference(u).String()
+}
+
+// resolveSrcset resolves the URL of each candidate of a srcset attribute,
+// keeping its width or density descriptor. Candidates given as data URLs,
+// which may hold commas, are left alone.
+func resolveSrcset(srcset string, base *url.URL) string {
+	if strings.Contains(srcset, "data:") {
+		return srcset
+	}
+	changed := false
+	candidates := strings.Split(srcset, ",")
+	for i, c := range candidates {
+		fields := strings.Fields(c)
+		if len(fields) == 0 {
+			continue
+		}
+		if resolved := resolve(fields[0], base); resolved != fields[0] {
+			fields[0], changed = resolved, true
+		}
+		candidates[i] = strings.Join(fields, " ")
+	}
+	if !changed {
+		return srcset
+	}
+	return strings.Join(candidates, ", ")
+}
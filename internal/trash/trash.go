@@ -0,0 +1,86 @@
+// Package trash permanently removes deleted feeds and items once their
+// retention period has passed.
+package trash
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/model"
+)
+
+// DefaultRetentionDays is how long deleted feeds and items stay restorable
+// when no retention is configured.
+const DefaultRetentionDays = 30
+
+// PurgeInterval is how often the background job empties expired trash.
+const PurgeInterval = 6 * time.Hour
+
+// RetentionDays returns the configured retention period in days.
+func RetentionDays(ctx context.Context, db database.Store) int {
+	days := database.GetIntSetting(ctx, db, model.SettingTrashRetentionDays, DefaultRetentionDays)
+	if days < 0 {
+		days = DefaultRetentionDays
+	}
+	return days
+}
+
+// Purge permanently deletes everything trashed longer ago than the
+// retention period. Returns the number of feeds and items removed.
+func Purge(ctx context.Context, db database.Store) (feeds, items int64, err error) {
+	cutoff := time.Now().AddDate(0, 0, -RetentionDays(ctx, db))
+	return db.PurgeTrash(ctx, cutoff)
+}
+
+// Job periodically purges expired trash.
+type Job struct {
+	db       database.Store
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewJob creates a purge job.
+func NewJob(db database.Store) *Job {
+	return &Job{
+		db:       db,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins the purge loop.
+func (j *Job) Start() {
+	j.stopChan = make(chan struct{})
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		ctx := context.Background()
+		for {
+			if feeds, items, err := Purge(ctx, j.db); err != nil {
+				log.Printf("Trash: purge error: %v", err)
+			} else if feeds > 0 || items > 0 {
+				log.Printf("Trash: purged %d feeds and %d items", feeds, items)
+				target := fmt.Sprintf("expired: %d feeds, %d items", feeds, items)
+				err := j.db.AddAuditEntry(ctx, model.AuditEntry{Actor: model.AuditActorSystem, Action: model.AuditPurgeTrash, Target: target, CreatedAt: time.Now()})
+				if err != nil {
+					log.Printf("Trash: failed to record purge: %v", err)
+				}
+			}
+
+			select {
+			case <-j.stopChan:
+				return
+			case <-time.After(PurgeInterval):
+			}
+		}
+	}()
+}
+
+// Stop stops the job gracefully.
+func (j *Job) Stop() {
+	close(j.stopChan)
+	j.wg.Wait()
+}
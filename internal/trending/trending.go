@@ -0,0 +1,186 @@
+// Package trending surfaces the terms and linked domains that recent items
+// have in common.
+package trending
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/textutil"
+)
+
+// CacheTTL is how long a computed report is served before recomputing.
+const CacheTTL = 10 * time.Minute
+
+// baselineWindows is how many windows before the current one are used as
+// the baseline when judging whether a term is trending.
+const baselineWindows = 7
+
+// maxResults bounds each list in a report.
+const maxResults = 25
+
+// Term is a word and how many items mentioned it.
+type Term struct {
+	Term  string  `json:"term"`
+	Count int     `json:"count"`
+	Score float64 `json:"score,omitempty"` // recent rate relative to the baseline
+}
+
+// Domain is a linked host and how many items linked to it.
+type Domain struct {
+	Domain string `json:"domain"`
+	Count  int    `json:"count"`
+}
+
+// Report summarizes a window of recent items.
+type Report struct {
+	Since       time.Time `json:"since"`
+	Items       int       `json:"items"`
+	TopTerms    []Term    `json:"top_terms"`
+	Trending    []Term    `json:"trending"`
+	Domains     []Domain  `json:"domains"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// Analyzer computes reports and caches them per window size.
+type Analyzer struct {
+	db    database.Store
+	mu    sync.Mutex
+	cache map[time.Duration]*Report
+}
+
+// NewAnalyzer creates an analyzer backed by db.
+func NewAnalyzer(db database.Store) *Analyzer {
+	return &Analyzer{db: db, cache: make(map[time.Duration]*Report)}
+}
+
+// Report returns the report for items published within window, computing
+// it if the cached copy is missing or older than CacheTTL.
+func (a *Analyzer) Report(ctx context.Context, window time.Duration) (*Report, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if r, ok := a.cache[window]; ok && time.Since(r.GeneratedAt) < CacheTTL {
+		return r, nil
+	}
+
+	now := time.Now()
+	since := now.Add(-window)
+	items, err := a.db.QueryItems(ctx, model.ItemFilter{Since: since.Add(-baselineWindows * window)})
+	if err != nil {
+		return nil, err
+	}
+	r := analyze(items, since)
+	r.GeneratedAt = now
+	a.cache[window] = r
+	return r, nil
+}
+
+// Invalidate drops the cached reports.
+func (a *Analyzer) Invalidate() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.cache = make(map[time.Duration]*Report)
+}
+
+// analyze splits items into the recent window (published at or after since)
+// and the baseline before it, and counts terms and domains.
+func analyze(items []model.Item, since time.Time) *Report {
+	recent := make(map[string]int)
+	baseline := make(map[string]int)
+	domains := make(map[string]int)
+	r := &Report{Since: since}
+
+	for _, it := range items {
+		counts := baseline
+		if !it.PublishedAt.Before(since) {
+			counts = recent
+			r.Items++
+			for d := range linkedDomains(it) {
+				domains[d]++
+			}
+		}
+		// Count each term once per item so one long post can't dominate.
+		seen := make(map[string]bool)
+		for _, t := range textutil.Keywords(it.Title + " " + textutil.PlainText(it.Content)) {
+			if !seen[t] {
+				seen[t] = true
+				counts[t]++
+			}
+		}
+	}
+
+	for t, c := range recent {
+		r.TopTerms = append(r.TopTerms, Term{Term: t, Count: c})
+		if c < 2 {
+			continue
+		}
+		// Add-one smoothing so terms absent from the baseline don't divide by zero.
+		score := float64(c) / (float64(baseline[t])/baselineWindows + 1)
+		if score > 1 {
+			r.Trending = append(r.Trending, Term{Term: t, Count: c, Score: score})
+		}
+	}
+	for d, c := range domains {
+		r.Domains = append(r.Domains, Domain{Domain: d, Count: c})
+	}
+
+	sort.Slice(r.TopTerms, func(i, j int) bool {
+		if r.TopTerms[i].Count != r.TopTerms[j].Count {
+			return r.TopTerms[i].Count > r.TopTerms[j].Count
+		}
+		return r.TopTerms[i].Term < r.TopTerms[j].Term
+	})
+	sort.Slice(r.Trending, func(i, j int) bool {
+		if r.Trending[i].Score != r.Trending[j].Score {
+			return r.Trending[i].Score > r.Trending[j].Score
+		}
+		return r.Trending[i].Term < r.Trending[j].Term
+	})
+	sort.Slice(r.Domains, func(i, j int) bool {
+		if r.Domains[i].Count != r.Domains[j].Count {
+			return r.Domains[i].Count > r.Domains[j].Count
+		}
+		return r.Domains[i].Domain < r.Domains[j].Domain
+	})
+	r.TopTerms = truncate(r.TopTerms)
+	r.Trending = truncate(r.Trending)
+	if len(r.Domains) > maxResults {
+		r.Domains = r.Domains[:maxResults]
+	}
+	return r
+}
+
+func truncate(terms []Term) []Term {
+	if len(terms) > maxResults {
+		return terms[:maxResults]
+	}
+	return terms
+}
+
+// linkedDomains returns the hosts an item links to in its content,
+// excluding the host the item itself lives on.
+func linkedDomains(it model.Item) map[string]bool {
+	own := host(it.Link)
+	out := make(map[string]bool)
+	for _, l := range textutil.Links(it.Content) {
+		if h := host(l); h != "" && h != own {
+			out[h] = true
+		}
+	}
+	return out
+}
+
+// host returns the lowercased host of an absolute URL without a "www." prefix.
+func host(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
@@ -0,0 +1,230 @@
+// Package video finds YouTube and Vimeo links and players in item content
+// and replaces them with click-to-load embeds, so that showing an item
+// contacts no video site until the reader chooses to play.
+package video
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Video is a video on a supported site.
+type Video struct {
+	Site     string // "YouTube" or "Vimeo"
+	ID       string
+	Start    string // start offset in seconds, empty for the beginning
+	EmbedURL string // privacy-friendly player URL, autoplaying
+	PageURL  string // the video's page on its site
+}
+
+var (
+	youtubeID = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+	vimeoID   = regexp.MustCompile(`^[0-9]+$`)
+	startTime = regexp.MustCompile(`^(?:(\d+)h)?(?:(\d+)m)?(?:(\d+)s?)?$`)
+)
+
+// Parse recognizes the page, short and player URLs of YouTube and Vimeo
+// videos. It returns nil for other URLs.
+func Parse(raw string) *Video {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return nil
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	host = strings.TrimPrefix(host, "m.")
+	path := strings.Trim(u.Path, "/")
+	q := u.Query()
+
+	switch host {
+	case "youtube.com", "youtube-nocookie.com":
+		var id string
+		switch {
+		case path == "watch":
+			id = q.Get("v")
+		case strings.HasPrefix(path, "embed/"), strings.HasPrefix(path, "shorts/"), strings.HasPrefix(path, "live/"):
+			id = path[strings.IndexByte(path, '/')+1:]
+		}
+		return youtube(id, q)
+	case "youtu.be":
+		return youtube(path, q)
+	case "vimeo.com":
+		return vimeo(path)
+	case "player.vimeo.com":
+		return vimeo(strings.TrimPrefix(path, "video/"))
+	}
+	return nil
+}
+
+func youtube(id string, q url.Values) *Video {
+	if !youtubeID.MatchString(id) {
+		return nil
+	}
+	v := &Video{Site: "YouTube", ID: id, Start: seconds(q.Get("t"))}
+	if v.Start == "" {
+		v.Start = seconds(q.Get("start"))
+	}
+	v.EmbedURL = "https://www.youtube-nocookie.com/embed/" + id + "?autoplay=1"
+	v.PageURL = "https://www.youtube.com/watch?v=" + id
+	if v.Start != "" {
+		v.EmbedURL += "&start=" + v.Start
+		v.PageURL += "&t=" + v.Start
+	}
+	return v
+}
+
+func vimeo(id string) *Video {
+	if !vimeoID.MatchString(id) {
+		return nil
+	}
+	return &Video{
+		Site:     "Vimeo",
+		ID:       id,
+		EmbedURL: "https://player.vimeo.com/video/" + id + "?autoplay=1&dnt=1",
+		PageURL:  "https://vimeo.com/" + id,
+	}
+}
+
+// seconds converts a start time such as 90, 90s or 1m30s to seconds.
+func seconds(t string) string {
+	m := startTime.FindStringSubmatch(t)
+	if t == "" || m == nil {
+		return ""
+	}
+	total := 0
+	for i, unit := range []int{3600, 60, 1} {
+		n, _ := strconv.Atoi(m[i+1])
+		total += n * unit
+	}
+	if total == 0 {
+		return ""
+	}
+	return strconv.Itoa(total)
+}
+
+// Embed replaces the video players (iframes) in an HTML fragment, and the
+// links to videos that stand on their own, with click-to-load placeholders.
+// A link stands on its own if its text is its URL or if it is all its
+// paragraph holds. The fragment is returned unchanged if it holds
+// no videos.
+func Embed(fragment string) string {
+	if !strings.Contains(fragment, "youtu") && !strings.Contains(fragment, "vimeo") {
+		return fragment
+	}
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), body)
+	if err != nil {
+		return fragment
+	}
+	for _, n := range nodes {
+		body.AppendChild(n)
+	}
+	if !replace(body) {
+		return fragment
+	}
+	var b strings.Builder
+	for c := body.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&b, c); err != nil {
+			return fragment
+		}
+	}
+	return b.String()
+}
+
+// replace swaps the videos below n for placeholders, reporting whether it
+// found any.
+func replace(n *html.Node) bool {
+	found := false
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if v := videoOf(c); v != nil {
+			n.InsertBefore(placeholder(v), c)
+			n.RemoveChild(c)
+			found = true
+		} else if replace(c) {
+			found = true
+		}
+		c = next
+	}
+	return found
+}
+
+// videoOf returns the video an iframe plays, a standalone link points to or
+// a paragraph holding nothing but a link consists of. Such paragraphs are
+// replaced whole, as the placeholder is a block.
+func videoOf(n *html.Node) *Video {
+	if n.Type != html.ElementNode {
+		return nil
+	}
+	switch n.DataAtom {
+	case atom.Iframe:
+		return Parse(attr(n, "src"))
+	case atom.P:
+		if a := soleElement(n); a != nil && a.DataAtom == atom.A {
+			return Parse(attr(a, "href"))
+		}
+	case atom.A:
+		if strings.TrimSpace(textOf(n)) == strings.TrimSpace(attr(n, "href")) {
+			return Parse(attr(n, "href"))
+		}
+	}
+	return nil
+}
+
+// soleElement returns the only child element of n if n has no other
+// content than it, whitespace and line breaks.
+func soleElement(n *html.Node) *html.Node {
+	var sole *html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case c.Type == html.TextNode && strings.TrimSpace(c.Data) == "":
+		case c.Type == html.ElementNode && c.DataAtom == atom.Br:
+		case c.Type == html.ElementNode && sole == nil:
+			sole = c
+		default:
+			return nil
+		}
+	}
+	return sole
+}
+
+// placeholder renders the click-to-load element for v: a link to the video
+// page that the page script turns into a player when clicked.
+func placeholder(v *Video) *html.Node {
+	div := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div, Attr: []html.Attribute{
+		{Key: "class", Val: "video-embed"},
+		{Key: "data-embed-src", Val: v.EmbedURL},
+	}}
+	a := &html.Node{Type: html.ElementNode, Data: "a", DataAtom: atom.A, Attr: []html.Attribute{
+		{Key: "href", Val: v.PageURL},
+		{Key: "target", Val: "_blank"},
+		{Key: "rel", Val: "noopener"},
+	}}
+	a.AppendChild(&html.Node{Type: html.TextNode, Data: "▶ Play " + v.Site + " video"})
+	div.AppendChild(a)
+	return div
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func textOf(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textOf(c))
+	}
+	return b.String()
+}
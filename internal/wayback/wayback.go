@@ -0,0 +1,146 @@
+// Package wayback submits pages to the Internet Archive's Save Page Now
+// service.
+package wayback
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the Wayback Machine endpoint.
+const DefaultBaseURL = "https://web.archive.org"
+
+// pollInterval is the delay between job status checks.
+const pollInterval = 3 * time.Second
+
+// Client talks to Save Page Now. With API keys the authenticated SPN2 job
+// API is used; otherwise the anonymous GET /save/{url} endpoint.
+type Client struct {
+	BaseURL   string
+	AccessKey string
+	SecretKey string
+	HTTP      *http.Client
+}
+
+// NewFromEnv builds a client from WAYBACK_ACCESS_KEY and WAYBACK_SECRET_KEY
+// (both optional, from https://archive.org/account/s3.php) and
+// WAYBACK_BASE_URL.
+func NewFromEnv() *Client {
+	base := strings.TrimRight(os.Getenv("WAYBACK_BASE_URL"), "/")
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	return &Client{
+		BaseURL:   base,
+		AccessKey: os.Getenv("WAYBACK_ACCESS_KEY"),
+		SecretKey: os.Getenv("WAYBACK_SECRET_KEY"),
+		HTTP:      &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+// Save asks the Wayback Machine to capture pageURL and returns the URL of
+// the capture. Captures can take a minute or more; bound ctx accordingly.
+func (c *Client) Save(ctx context.Context, pageURL string) (string, error) {
+	if c.AccessKey != "" && c.SecretKey != "" {
+		return c.saveJob(ctx, pageURL)
+	}
+	return c.saveAnonymous(ctx, pageURL)
+}
+
+// saveAnonymous uses GET /save/{url}, which answers once the capture is
+// done and names it in Content-Location or by redirecting to it.
+func (c *Client) saveAnonymous(ctx context.Context, pageURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/save/"+pageURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("wayback: save returned HTTP %d", resp.StatusCode)
+	}
+	if loc := resp.Header.Get("Content-Location"); strings.HasPrefix(loc, "/web/") {
+		return c.BaseURL + loc, nil
+	}
+	if final := resp.Request.URL; strings.HasPrefix(final.Path, "/web/") {
+		return final.String(), nil
+	}
+	return "", errors.New("wayback: response did not name the capture")
+}
+
+// saveJob submits an SPN2 capture job and polls it until it finishes.
+func (c *Client) saveJob(ctx context.Context, pageURL string) (string, error) {
+	form := url.Values{"url": {pageURL}}
+	var job struct {
+		URL     string `json:"url"`
+		JobID   string `json:"job_id"`
+		Message string `json:"message"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/save", strings.NewReader(form.Encode()), &job); err != nil {
+		return "", err
+	}
+	if job.JobID == "" {
+		return "", fmt.Errorf("wayback: %s", job.Message)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(pollInterval):
+		}
+		var status struct {
+			Status      string `json:"status"`
+			Timestamp   string `json:"timestamp"`
+			OriginalURL string `json:"original_url"`
+			Message     string `json:"message"`
+		}
+		if err := c.do(ctx, http.MethodGet, "/save/status/"+url.PathEscape(job.JobID), nil, &status); err != nil {
+			return "", err
+		}
+		switch status.Status {
+		case "success":
+			original := status.OriginalURL
+			if original == "" {
+				original = pageURL
+			}
+			return fmt.Sprintf("%s/web/%s/%s", c.BaseURL, status.Timestamp, original), nil
+		case "error":
+			return "", fmt.Errorf("wayback: %s", status.Message)
+		}
+	}
+}
+
+// do sends an authenticated SPN2 request and decodes the JSON response.
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "LOW "+c.AccessKey+":"+c.SecretKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("wayback: %s returned HTTP %d", path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
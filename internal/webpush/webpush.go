@@ -0,0 +1,418 @@
+// Package webpush sends browser push notifications (RFC 8030) for new items
+// of the feeds and folders flagged to notify. Each message is encrypted for
+// the subscribed browser (RFC 8291) and signed with the instance's VAPID key
+// (RFC 8292), which is generated on first use and kept in the settings.
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bryan-buckman/infovore/internal/database"
+	"github.com/bryan-buckman/infovore/internal/model"
+	"github.com/bryan-buckman/infovore/internal/reqid"
+	"github.com/bryan-buckman/infovore/internal/textutil"
+)
+
+const (
+	// TTL is how long a push service keeps a message for a browser that is
+	// offline.
+	TTL = 24 * time.Hour
+	// MaxSubscriptions caps the stored subscriptions; the oldest are
+	// dropped beyond it.
+	MaxSubscriptions = 50
+
+	// maxTitleLen and maxBodyLen bound the notification text in
+	// characters, keeping the encrypted message within the 4096 bytes push
+	// services must accept.
+	maxTitleLen = 150
+	maxBodyLen  = 300
+	// recordSize is the aes128gcm record size; every message fits one
+	// record.
+	recordSize = 4096
+	// tokenLifetime is how long a VAPID token is valid, at most 24 hours.
+	tokenLifetime = 12 * time.Hour
+)
+
+// ErrGone reports a subscription the push service no longer knows, because
+// the browser unsubscribed or the subscription expired.
+var ErrGone = errors.New("push subscription expired")
+
+// mu serializes changes to the key and subscription settings.
+var mu sync.Mutex
+
+// Subscription is a browser's push subscription, in the form of the
+// JavaScript PushSubscription.toJSON().
+type Subscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"` // the browser's P-256 public key, base64url
+		Auth   string `json:"auth"`   // the 16-byte authentication secret, base64url
+	} `json:"keys"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Validate checks that a subscription can be pushed to.
+func (s Subscription) Validate() error {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.New("endpoint must be an https URL")
+	}
+	if _, err := ecdh.P256().NewPublicKey(decodeKey(s.Keys.P256dh)); err != nil {
+		return errors.New("invalid p256dh key")
+	}
+	if len(decodeKey(s.Keys.Auth)) != 16 {
+		return errors.New("invalid auth secret")
+	}
+	return nil
+}
+
+// Message is a notification, as the service worker reads it.
+type Message struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	URL   string `json:"url"` // opened when the notification is clicked
+	// Tag makes a notification replace an earlier one with the same tag
+	// instead of stacking up.
+	Tag string `json:"tag,omitempty"`
+}
+
+// Folders returns the IDs of the folders whose new items send push
+// notifications.
+func Folders(ctx context.Context, db database.Store) []int64 {
+	val, err := db.GetSetting(ctx, model.SettingNotifyFolders)
+	if err != nil {
+		return nil
+	}
+	var ids []int64
+	if err := json.Unmarshal([]byte(val), &ids); err != nil {
+		return nil
+	}
+	return ids
+}
+
+// Subscriptions returns the stored push subscriptions.
+func Subscriptions(ctx context.Context, db database.Store) []Subscription {
+	raw, err := db.GetSetting(ctx, model.SettingWebPushSubscriptions)
+	if err != nil || raw == "" {
+		return nil
+	}
+	var subs []Subscription
+	if err := json.Unmarshal([]byte(raw), &subs); err != nil {
+		return nil
+	}
+	return subs
+}
+
+// Subscribe stores a subscription, replacing any with the same endpoint.
+func Subscribe(ctx context.Context, db database.Store, sub Subscription) error {
+	if err := sub.Validate(); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	subs := []Subscription{}
+	for _, s := range Subscriptions(ctx, db) {
+		if s.Endpoint != sub.Endpoint {
+			subs = append(subs, s)
+		}
+	}
+	if sub.CreatedAt.IsZero() {
+		sub.CreatedAt = time.Now()
+	}
+	subs = append(subs, sub)
+	if len(subs) > MaxSubscriptions {
+		subs = subs[len(subs)-MaxSubscriptions:]
+	}
+	return saveSubscriptions(ctx, db, subs)
+}
+
+// Unsubscribe removes the subscriptions with the given endpoints and
+// reports how many it removed.
+func Unsubscribe(ctx context.Context, db database.Store, endpoints ...string) (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	drop := make(map[string]bool, len(endpoints))
+	for _, e := range endpoints {
+		drop[e] = true
+	}
+	subs := []Subscription{}
+	removed := 0
+	for _, s := range Subscriptions(ctx, db) {
+		if drop[s.Endpoint] {
+			removed++
+			continue
+		}
+		subs = append(subs, s)
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, saveSubscriptions(ctx, db, subs)
+}
+
+func saveSubscriptions(ctx context.Context, db database.Store, subs []Subscription) error {
+	data, _ := json.Marshal(subs)
+	return db.SetSetting(ctx, model.SettingWebPushSubscriptions, string(data))
+}
+
+// PublicKey returns the VAPID public key browsers subscribe with, as the
+// base64url uncompressed P-256 point PushManager.subscribe expects.
+func PublicKey(ctx context.Context, db database.Store) (string, error) {
+	key, err := vapidKey(ctx, db)
+	if err != nil {
+		return "", err
+	}
+	pub, err := key.PublicKey.ECDH()
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(pub.Bytes()), nil
+}
+
+// vapidKey loads the VAPID private key, generating and storing one if there
+// is none yet. A new key invalidates the stored subscriptions, so they are
+// dropped with it.
+func vapidKey(ctx context.Context, db database.Store) (*ecdsa.PrivateKey, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if raw, err := db.GetSetting(ctx, model.SettingWebPushKey); err == nil && raw != "" {
+		der, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s setting: %w", model.SettingWebPushKey, err)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("%s setting: %w", model.SettingWebPushKey, err)
+		}
+		key, ok := parsed.(*ecdsa.PrivateKey)
+		if !ok || key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%s setting: not a P-256 key", model.SettingWebPushKey)
+		}
+		return key, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	err = db.SetSettings(ctx, map[string]string{
+		model.SettingWebPushKey:           base64.StdEncoding.EncodeToString(der),
+		model.SettingWebPushSubscriptions: "",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Send pushes a message to every subscription and returns how many it
+// reached. Subscriptions the push service reports gone are removed.
+func Send(ctx context.Context, db database.Store, msg Message) (int, error) {
+	subs := Subscriptions(ctx, db)
+	if len(subs) == 0 {
+		return 0, nil
+	}
+	key, err := vapidKey(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	msg.Title = textutil.Snippet(msg.Title, maxTitleLen)
+	msg.Body = textutil.Snippet(msg.Body, maxBodyLen)
+	payload, _ := json.Marshal(msg)
+
+	sent := 0
+	var gone []string
+	var errs []error
+	for _, sub := range subs {
+		err := push(ctx, key, sub, payload)
+		switch {
+		case err == nil:
+			sent++
+		case errors.Is(err, ErrGone):
+			gone = append(gone, sub.Endpoint)
+		default:
+			errs = append(errs, err)
+		}
+	}
+	if len(gone) > 0 {
+		if _, err := Unsubscribe(ctx, db, gone...); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return sent, errors.Join(errs...)
+}
+
+// push delivers an encrypted payload to one subscription.
+func push(ctx context.Context, key *ecdsa.PrivateKey, sub Subscription, payload []byte) error {
+	body, err := encrypt(sub, payload, nil, nil)
+	if err != nil {
+		return err
+	}
+	auth, err := vapidAuth(key, sub.Endpoint, time.Now())
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(TTL/time.Second)))
+	req.Header.Set("Urgency", "normal")
+	req.Header.Set("Authorization", auth)
+	reqid.Set(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrGone
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("push service %s returned HTTP %d", req.URL.Host, resp.StatusCode)
+	}
+	return nil
+}
+
+// encrypt encrypts a payload for a subscription with the aes128gcm content
+// coding of RFC 8291, as a single record. The ephemeral key and salt are
+// random unless given.
+func encrypt(sub Subscription, payload []byte, ephemeral *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	uaPublic, err := ecdh.P256().NewPublicKey(decodeKey(sub.Keys.P256dh))
+	if err != nil {
+		return nil, errors.New("invalid p256dh key")
+	}
+	authSecret := decodeKey(sub.Keys.Auth)
+	if len(authSecret) != 16 {
+		return nil, errors.New("invalid auth secret")
+	}
+	if ephemeral == nil {
+		if ephemeral, err = ecdh.P256().GenerateKey(rand.Reader); err != nil {
+			return nil, err
+		}
+	}
+	if salt == nil {
+		salt = make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+	}
+	secret, err := ephemeral.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := ephemeral.PublicKey().Bytes()
+
+	// Combine the shared secret with the auth secret, then derive the
+	// content key and nonce from the result and the salt.
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaPublic.Bytes()...), asPublic...)
+	ikm := hkdf(authSecret, secret, keyInfo, 32)
+	cek := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// The 0x02 delimiter marks the last record.
+	plaintext := append(append([]byte{}, payload...), 2)
+	if len(plaintext)+gcm.Overhead() > recordSize {
+		return nil, errors.New("push message too long")
+	}
+
+	header := make([]byte, 0, 16+4+1+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, recordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+// hkdf derives length bytes (at most 32) with HKDF-SHA-256 (RFC 5869).
+func hkdf(salt, ikm, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(ikm)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write(info)
+	expand.Write([]byte{1})
+	return expand.Sum(nil)[:length]
+}
+
+// vapidAuth returns the Authorization header identifying the instance to
+// the push service of endpoint: a token signed with the VAPID key, with the
+// contact in WEBPUSH_SUBJECT (a mailto: or https: URL) if set.
+func vapidAuth(key *ecdsa.PrivateKey, endpoint string, now time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	claims := map[string]interface{}{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": now.Add(tokenLifetime).Unix(),
+	}
+	if sub := os.Getenv("WEBPUSH_SUBJECT"); sub != "" {
+		claims["sub"] = sub
+	}
+	header, _ := json.Marshal(map[string]string{"typ": "JWT", "alg": "ES256"})
+	body, _ := json.Marshal(claims)
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(body)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	pub, err := key.PublicKey.ECDH()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("vapid t=%s.%s, k=%s", unsigned, base64.RawURLEncoding.EncodeToString(sig),
+		base64.RawURLEncoding.EncodeToString(pub.Bytes())), nil
+}
+
+// decodeKey decodes a base64url key, with or without padding, returning nil
+// if it doesn't decode.
+func decodeKey(s string) []byte {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		b, _ = base64.URLEncoding.DecodeString(s)
+	}
+	return b
+}